@@ -2,23 +2,51 @@ package main
 
 import (
 	"bufio"
+	"encoding/hex"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"github.com/aura-speak/networking/internal/config"
+	"github.com/aura-speak/networking/internal/logger"
 	"github.com/aura-speak/networking/pkg/client"
 	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/transport"
 	log "github.com/sirupsen/logrus"
 )
 
 func main() {
-	// Standardwerte
-	host := "localhost"
-	port := 8080
+	// Konfiguration: Standardwerte < Datei < Umgebungsvariablen < Flags
+	flags := config.RegisterFlags(flag.CommandLine, map[string]string{
+		"host":      "client.host",
+		"port":      "client.port",
+		"log-level": "log.level",
+	})
+	flag.Parse()
+	cfg, err := flags.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ungültige Konfiguration:\n%v\n", err)
+		os.Exit(2)
+	}
+	logger.SetLevel(cfg.Log.Level)
 
 	// Client erstellen
-	c := client.NewClient(host, port)
+	c := client.NewClient(cfg.Client.Host, int(cfg.Client.Port))
+
+	// Token für den Connect-Handshake (optional, auch über AURA_TOKEN)
+	if cfg.Client.Token != "" {
+		c.Credential = []byte(cfg.Client.Token)
+	}
+
+	// Transport wählen (UDP oder DTLS)
+	t, err := newTransport(cfg.Client)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Transport konnte nicht erstellt werden: %v\n", err)
+		os.Exit(2)
+	}
+	c.Transport = t
 
 	// Message Handler registrieren
 	c.OnPacket(protocol.PacketTypeDebugAny, func(packet *protocol.Packet) error {
@@ -68,3 +96,27 @@ func main() {
 		}
 	}
 }
+
+// newTransport erstellt den Transport aus der Konfiguration
+// Bei DTLS wird mit PSK-Identität der Pre-Shared Key verwendet, sonst das Client-Zertifikat
+func newTransport(cfg config.ClientConfig) (transport.Transport, error) {
+	if cfg.Transport != "dtls" {
+		return transport.UDP{}, nil
+	}
+	if cfg.DTLS.PSKIdentity != "" {
+		key, err := hex.DecodeString(cfg.DTLS.PSKKey)
+		if err != nil {
+			return nil, err
+		}
+		return &transport.DTLS{Config: client.NewDTLSClientPSKConfig(cfg.DTLS.PSKIdentity, key)}, nil
+	}
+	serverName := cfg.DTLS.ServerName
+	if serverName == "" {
+		serverName = cfg.Host
+	}
+	dtlsCfg, err := client.NewDTLSClientMTLSConfig(cfg.DTLS.Cert, cfg.DTLS.Key, cfg.DTLS.CA, serverName)
+	if err != nil {
+		return nil, err
+	}
+	return &transport.DTLS{Config: dtlsCfg}, nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/conformance"
+	"github.com/aura-speak/networking/pkg/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// conformance publishes the wire format test vectors and checks other implementations against them
+//
+// Example:
+//
+//	conformance vectors -out pkg/conformance/vectors/v2.json
+//	conformance verify -vectors their-vectors.json
+//	conformance server -addr 127.0.0.1:8080 -credential secret -reports
+//	conformance client -listen 127.0.0.1:8080
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	// Decoders log on debug level
+	log.SetLevel(log.WarnLevel)
+
+	args := os.Args[2:]
+	var results []conformance.Result
+	var jsonOutput bool
+	var err error
+	switch os.Args[1] {
+	case "vectors":
+		err = vectors(args)
+	case "verify":
+		results, jsonOutput, err = verify(args)
+	case "server":
+		results, jsonOutput, err = server(args)
+	case "client":
+		results, jsonOutput, err = client(args)
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if results == nil {
+		return
+	}
+	report(results, jsonOutput)
+	if conformance.Failed(results) > 0 {
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: conformance vectors|verify|server|client [flags]")
+	fmt.Fprintln(os.Stderr, "  vectors  write the test vectors of this implementation")
+	fmt.Fprintln(os.Stderr, "  verify   decode a vectors file and compare it with this implementation")
+	fmt.Fprintln(os.Stderr, "  server   drive a running server through the handshake")
+	fmt.Fprintln(os.Stderr, "  client   act as server for a client and check its handshake")
+	os.Exit(2)
+}
+
+// vectors writes the generated vectors, or with -check compares them with the published file
+func vectors(args []string) error {
+	flags := flag.NewFlagSet("vectors", flag.ExitOnError)
+	out := flags.String("out", "", "output file, stdout if empty")
+	check := flags.Bool("check", false, "fail if the generated vectors differ from the published ones")
+	flags.Parse(args)
+
+	var buf bytes.Buffer
+	if err := conformance.Generate().Write(&buf); err != nil {
+		return err
+	}
+	if *check {
+		published, err := conformance.Published()
+		if err != nil {
+			return err
+		}
+		var publishedBuf bytes.Buffer
+		if err := published.Write(&publishedBuf); err != nil {
+			return err
+		}
+		if !bytes.Equal(buf.Bytes(), publishedBuf.Bytes()) {
+			return fmt.Errorf("the wire format changed, publish new vectors with a new version")
+		}
+		fmt.Printf("vectors version %d are up to date\n", conformance.Version)
+		return nil
+	}
+	if *out == "" {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	return os.WriteFile(*out, buf.Bytes(), 0o644)
+}
+
+func verify(args []string) ([]conformance.Result, bool, error) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	path := flags.String("vectors", "", "vectors file, the published vectors if empty")
+	jsonOutput := flags.Bool("json", false, "print the results as JSON")
+	flags.Parse(args)
+
+	set, err := conformance.Published()
+	if *path != "" {
+		set, err = conformance.LoadFile(*path)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return conformance.Verify(set), *jsonOutput, nil
+}
+
+func server(args []string) ([]conformance.Result, bool, error) {
+	flags := flag.NewFlagSet("server", flag.ExitOnError)
+	addr := flags.String("addr", "127.0.0.1:8080", "address of the server")
+	credential := flags.String("credential", "", "credential sent with the connect")
+	expect := flags.String("expect", "accept", "expected answer: accept or a reject reason, e.g. InvalidCredential")
+	reports := flags.Bool("reports", false, "exchange sender and receiver reports after the handshake")
+	timeout := flags.Duration("timeout", 2*time.Second, "timeout for an answer")
+	quiet := flags.Duration("quiet", conformance.DefaultQuiet, "how long the server has to stay silent for packets it must drop")
+	jsonOutput := flags.Bool("json", false, "print the results as JSON")
+	flags.Parse(args)
+
+	opts := conformance.ServerOptions{
+		Credential: []byte(*credential),
+		Reports:    *reports,
+		Timeout:    *timeout,
+		Quiet:      *quiet,
+	}
+	if *expect != "accept" {
+		reason, ok := parseRejectReason(*expect)
+		if !ok {
+			return nil, false, fmt.Errorf("unknown reject reason %q", *expect)
+		}
+		opts.Reject, opts.Reason = true, reason
+	}
+	results, err := conformance.CheckServer(*addr, opts)
+	return results, *jsonOutput, err
+}
+
+func client(args []string) ([]conformance.Result, bool, error) {
+	flags := flag.NewFlagSet("client", flag.ExitOnError)
+	listen := flags.String("listen", "127.0.0.1:8080", "address the client connects to")
+	reports := flags.Bool("reports", false, "exchange sender and receiver reports after the handshake")
+	timeout := flags.Duration("timeout", 30*time.Second, "how long to wait for the client")
+	jsonOutput := flags.Bool("json", false, "print the results as JSON")
+	flags.Parse(args)
+
+	fmt.Fprintf(os.Stderr, "waiting for a client on %s\n", *listen)
+	results, err := conformance.CheckClient(*listen, conformance.ClientOptions{Reports: *reports, Timeout: *timeout})
+	return results, *jsonOutput, err
+}
+
+func parseRejectReason(name string) (protocol.RejectReason, bool) {
+	for reason := protocol.RejectReasonUnknown; reason <= protocol.RejectReasonBanned; reason++ {
+		if strings.EqualFold(reason.String(), name) {
+			return reason, true
+		}
+	}
+	return 0, false
+}
+
+func report(results []conformance.Result, jsonOutput bool) {
+	if jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(results)
+		return
+	}
+	for _, result := range results {
+		status := "ok  "
+		if !result.OK {
+			status = "FAIL"
+		}
+		if result.Detail != "" {
+			fmt.Printf("%s %s: %s\n", status, result.Check, result.Detail)
+			continue
+		}
+		fmt.Printf("%s %s\n", status, result.Check)
+	}
+	fmt.Printf("%d checks, %d failed\n", len(results), conformance.Failed(results))
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+var errNoCPU = errors.New("cpu and memory usage are only measured on linux")
+
+func processCPU(pid int) (time.Duration, error) { return 0, errNoCPU }
+
+func processRSS(pid int) (uint64, error) { return 0, errNoCPU }
+
+func selfCPU() (time.Duration, error) { return 0, errNoCPU }
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// histogramGrowth is the relative width of a bucket, the percentiles are exact to about 2%
+const histogramGrowth = 1.02
+
+// histogramBuckets covers up to 1.02^1000 µs, about 400 seconds
+const histogramBuckets = 1000
+
+// histogram counts durations in logarithmic buckets
+// Every virtual client has its own, so recording needs no lock
+type histogram struct {
+	counts [histogramBuckets + 1]uint64
+	n      uint64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+func bucketOf(d time.Duration) int {
+	us := float64(d) / float64(time.Microsecond)
+	if us < 1 {
+		return 0
+	}
+	return min(histogramBuckets, int(math.Log(us)/math.Log(histogramGrowth))+1)
+}
+
+// bucketValue is the middle of a bucket
+func bucketValue(bucket int) time.Duration {
+	if bucket == 0 {
+		return 0
+	}
+	low := math.Pow(histogramGrowth, float64(bucket-1))
+	return time.Duration(low * (1 + histogramGrowth) / 2 * float64(time.Microsecond))
+}
+
+func (h *histogram) record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	if h.n == 0 || d < h.min {
+		h.min = d
+	}
+	h.max = max(h.max, d)
+	h.n++
+	h.sum += d
+	h.counts[bucketOf(d)]++
+}
+
+func (h *histogram) merge(other *histogram) {
+	if other.n == 0 {
+		return
+	}
+	if h.n == 0 || other.min < h.min {
+		h.min = other.min
+	}
+	h.max = max(h.max, other.max)
+	h.n += other.n
+	h.sum += other.sum
+	for i, count := range other.counts {
+		h.counts[i] += count
+	}
+}
+
+// percentile returns the duration below which the fraction p of the values are
+func (h *histogram) percentile(p float64) time.Duration {
+	if h.n == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(p * float64(h.n)))
+	var seen uint64
+	for bucket, count := range h.counts {
+		seen += count
+		if seen >= rank {
+			return min(max(bucketValue(bucket), h.min), h.max)
+		}
+	}
+	return h.max
+}
+
+// Percentiles are the summary of a histogram in milliseconds
+type Percentiles struct {
+	Count uint64  `json:"count"`
+	Min   float64 `json:"min"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	P999  float64 `json:"p999"`
+	Max   float64 `json:"max"`
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (h *histogram) summary() Percentiles {
+	if h.n == 0 {
+		return Percentiles{}
+	}
+	return Percentiles{
+		Count: h.n,
+		Min:   ms(h.min),
+		Mean:  ms(h.sum / time.Duration(h.n)),
+		P50:   ms(h.percentile(0.50)),
+		P90:   ms(h.percentile(0.90)),
+		P99:   ms(h.percentile(0.99)),
+		P999:  ms(h.percentile(0.999)),
+		Max:   ms(h.max),
+	}
+}
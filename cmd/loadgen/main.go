@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aura-speak/networking/internal/logger"
+	log "github.com/sirupsen/logrus"
+)
+
+// loadgen connects many virtual voice clients to a running server and measures what the server forwards
+// Every client joins one of the channels loadgen-0 to loadgen-<channels-1> and alternates between talkspurts and silence
+// The server forwards the voice frames to the other members of the channel, the channels need the forward mode
+// and no floor control, and the clients connect as guests, so guests have to be allowed to speak
+// The default rate limit of the server allows 1000 packets per second and IP,
+// so the clients are spread over several loopback source IPs or the limits have to be raised
+//
+// Example:
+//
+//	server -log-level warn &
+//	loadgen -clients 200 -channels 20 -duration 30s -server-pid $! -label v0.4.0 -json report.json -csv runs.csv
+//
+// Sharded servers are compared with one run per shard count into the same CSV,
+// the kernel spreads the clients over the shards by their source address and port
+//
+//	server -log-level warn -shards 4 &
+//	loadgen -clients 200 -channels 20 -source-ips 50 -server-pid $! -label shards4 -csv runs.csv
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "address of the server")
+	clients := flag.Int("clients", 100, "number of virtual clients")
+	channels := flag.Int("channels", 10, "number of channels the clients are spread over")
+	duration := flag.Duration("duration", 30*time.Second, "duration of the measurement")
+	ramp := flag.Duration("ramp", 5*time.Second, "time over which the clients connect")
+	drain := flag.Duration("drain", time.Second, "time to wait for frames in flight after the measurement")
+	connectTimeout := flag.Duration("connect-timeout", 5*time.Second, "timeout of a handshake and the channel join")
+	frameInterval := flag.Duration("frame-interval", 20*time.Millisecond, "interval between two voice frames while talking")
+	frameSize := flag.Int("frame-size", 80, "size of a voice packet in bytes including the packet and voice headers")
+	talkRatio := flag.Float64("talk-ratio", 0.4, "share of the time a client talks, 0 to 1")
+	talkspurt := flag.Duration("talkspurt", 1500*time.Millisecond, "mean length of a talkspurt")
+	sourceIPs := flag.Int("source-ips", 0, "spread the clients over this many source IPs 127.0.1.1 to 127.0.1.254, 0 uses the default route; loopback targets only")
+	seed := flag.Uint64("seed", 1, "seed of the talk patterns")
+	serverPID := flag.Int("server-pid", 0, "pid of the server process for CPU and memory usage, linux only")
+	interval := flag.Duration("interval", 5*time.Second, "interval of the progress output, 0 to disable")
+	label := flag.String("label", "", "label of the run in the report, e.g. the release")
+	jsonPath := flag.String("json", "", "write the report as JSON to this file, - for stdout")
+	csvPath := flag.String("csv", "", "append the report as CSV row to this file")
+	logLevel := flag.String("log-level", "warn", "log level")
+	flag.Parse()
+
+	if err := logger.SetLevel(*logLevel); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	host, portString, err := net.SplitHostPort(*addr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	port, err := strconv.Atoi(portString)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid port:", portString)
+		os.Exit(2)
+	}
+	if *clients < 1 || *channels < 1 || *talkRatio < 0 || *talkRatio > 1 || *frameInterval <= 0 {
+		fmt.Fprintln(os.Stderr, "clients and channels must be positive, talk-ratio between 0 and 1 and frame-interval positive")
+		os.Exit(2)
+	}
+	if *sourceIPs < 0 || *sourceIPs > 254 {
+		fmt.Fprintln(os.Stderr, "source-ips must be between 0 and 254")
+		os.Exit(2)
+	}
+	if *frameSize < frameOverhead+frameHeaderSize {
+		fmt.Fprintf(os.Stderr, "frame-size must be at least %d bytes\n", frameOverhead+frameHeaderSize)
+		os.Exit(2)
+	}
+
+	pattern := voice{
+		FrameInterval: *frameInterval,
+		FrameSize:     *frameSize,
+		TalkRatio:     *talkRatio,
+		Talkspurt:     *talkspurt,
+	}
+	report := &Report{
+		Label:     *label,
+		StartedAt: time.Now(),
+		Target:    *addr,
+		GoVersion: runtime.Version(),
+		NumCPU:    runtime.NumCPU(),
+		Settings: Settings{
+			Clients:       *clients,
+			Channels:      *channels,
+			Duration:      duration.String(),
+			Ramp:          ramp.String(),
+			FrameInterval: frameInterval.String(),
+			FrameSize:     *frameSize,
+			TalkRatio:     *talkRatio,
+			Talkspurt:     talkspurt.String(),
+			SourceIPs:     *sourceIPs,
+			Seed:          *seed,
+		},
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		report.Notes = append(report.Notes, "the server is not on loopback, the forwarding latency includes both network hops")
+	}
+
+	vcs := make([]*virtualClient, *clients)
+	for i := range vcs {
+		vcs[i] = newVirtualClient(uint32(i), uint16(i%*channels), *seed)
+	}
+
+	fmt.Fprintf(os.Stderr, "connecting %d clients to %s over %s\n", *clients, *addr, *ramp)
+	connectAll(vcs, host, port, *sourceIPs, *ramp, *connectTimeout)
+	var connectTimes, joinTimes histogram
+	for _, vc := range vcs {
+		if vc.connected {
+			report.Clients.Connected++
+			connectTimes.record(vc.connectTime)
+			joinTimes.record(vc.joinTime)
+		}
+	}
+	report.Clients.Requested = *clients
+	report.Clients.Failed = *clients - report.Clients.Connected
+	report.Clients.ConnectMs = connectTimes.summary()
+	report.Clients.JoinMs = joinTimes.summary()
+	if report.Clients.Connected == 0 {
+		fmt.Fprintln(os.Stderr, "no client connected and joined its channel, is the server running?")
+		os.Exit(1)
+	}
+
+	var serverCPU *cpuSampler
+	if *serverPID != 0 {
+		serverCPU = newCPUSampler(func() (time.Duration, error) { return processCPU(*serverPID) })
+	}
+	loadgenCPU := newCPUSampler(selfCPU)
+
+	fmt.Fprintf(os.Stderr, "%d clients joined their channels, talking for %s\n", report.Clients.Connected, *duration)
+	ctx, cancel := context.WithTimeout(context.Background(), *duration)
+	measureStart := time.Now()
+	var wg sync.WaitGroup
+	for _, vc := range vcs {
+		if vc.connected {
+			wg.Go(func() { vc.talk(ctx, pattern) })
+		}
+	}
+	samplers := []*cpuSampler{serverCPU, loadgenCPU}
+	progress(ctx, vcs, samplers, *interval, measureStart)
+	wg.Wait()
+	cancel()
+	sendDuration := time.Since(measureStart)
+
+	// frames still in flight count as received, the drain is not part of the CPU measurement
+	if serverCPU != nil {
+		report.ServerCPU = serverCPU.stats()
+		if rss, err := processRSS(*serverPID); err == nil {
+			report.ServerCPU.RSSMB = float64(rss) / (1 << 20)
+		}
+	}
+	report.LoadgenCPU = loadgenCPU.stats()
+	time.Sleep(*drain)
+
+	var stopWG sync.WaitGroup
+	for _, vc := range vcs {
+		stopWG.Go(vc.stop)
+	}
+	stopWG.Wait()
+
+	collect(report, vcs, sendDuration)
+	report.print(os.Stdout)
+	if *jsonPath != "" {
+		if err := report.writeJSON(*jsonPath); err != nil {
+			fmt.Fprintln(os.Stderr, "json:", err)
+			os.Exit(1)
+		}
+	}
+	if *csvPath != "" {
+		if err := report.appendCSV(*csvPath); err != nil {
+			fmt.Fprintln(os.Stderr, "csv:", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// connectAll connects the clients evenly spread over the ramp
+func connectAll(vcs []*virtualClient, host string, port int, sourceIPs int, ramp, timeout time.Duration) {
+	var wg sync.WaitGroup
+	step := ramp / time.Duration(len(vcs))
+	for i, vc := range vcs {
+		var source net.IP
+		if sourceIPs > 0 {
+			source = net.IPv4(127, 0, 1, byte(1+i%sourceIPs))
+		}
+		wg.Go(func() {
+			time.Sleep(time.Duration(i) * step)
+			if err := vc.connect(host, port, source, timeout); err != nil {
+				log.WithField("caller", "loadgen").WithError(err).Warnf("Client %d failed to connect and join", vc.id)
+				vc.stop()
+			}
+		})
+	}
+	wg.Wait()
+}
+
+// collect sums up the counters of the clients
+// A receiver expects every frame the other members of its channel sent, the server does not echo the own frames
+// The receive timestamps are only reported as kernel if every client had them
+func collect(report *Report, vcs []*virtualClient, sendDuration time.Duration) {
+	sentPerChannel := make(map[uint16]uint64)
+	for _, vc := range vcs {
+		sent := vc.sent.Load()
+		sentPerChannel[vc.channel] += sent
+		report.Frames.Sent += sent
+	}
+	var forwarding, endToEnd histogram
+	report.ReceiveTimestamps = "kernel"
+	for _, vc := range vcs {
+		if !vc.connected {
+			continue
+		}
+		report.Frames.Expected += sentPerChannel[vc.channel] - vc.sent.Load()
+		report.Frames.Received += vc.received.Load()
+		report.Frames.Foreign += vc.foreign.Load()
+		forwarding.merge(&vc.forwarding)
+		endToEnd.merge(&vc.endToEnd)
+		if !vc.conn.kernelTime {
+			report.ReceiveTimestamps = "read"
+		}
+	}
+	if report.Frames.Expected > 0 {
+		report.Frames.Loss = 1 - float64(report.Frames.Received)/float64(report.Frames.Expected)
+	}
+	seconds := sendDuration.Seconds()
+	report.Frames.SentPerSecond = float64(report.Frames.Sent) / seconds
+	report.Frames.ReceivedPerSecond = float64(report.Frames.Received+report.Frames.Foreign) / seconds
+	report.ForwardingLatency = forwarding.summary()
+	report.EndToEndLatency = endToEnd.summary()
+}
+
+// progress prints the counters every interval until ctx is done
+func progress(ctx context.Context, vcs []*virtualClient, samplers []*cpuSampler, interval time.Duration, start time.Time) {
+	tick := interval
+	if tick <= 0 || tick > time.Second {
+		// the CPU peaks are sampled every second
+		tick = time.Second
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	lastPrint := start
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, sampler := range samplers {
+				sampler.sample()
+			}
+			if interval <= 0 || now.Sub(lastPrint) < interval {
+				continue
+			}
+			lastPrint = now
+			var sent, received, foreign uint64
+			for _, vc := range vcs {
+				sent += vc.sent.Load()
+				received += vc.received.Load()
+				foreign += vc.foreign.Load()
+			}
+			fmt.Fprintf(os.Stderr, "%6s sent %d heard %d foreign %d\n", now.Sub(start).Round(time.Second), sent, received, foreign)
+		}
+	}
+}
+
+// cpuSampler measures the CPU usage of a process between its creation and stats
+// sample records the peak usage since the previous sample
+type cpuSampler struct {
+	read    func() (time.Duration, error)
+	start   time.Duration
+	startAt time.Time
+	last    time.Duration
+	lastAt  time.Time
+	peak    float64
+	err     error
+}
+
+func newCPUSampler(read func() (time.Duration, error)) *cpuSampler {
+	s := &cpuSampler{read: read, startAt: time.Now()}
+	s.start, s.err = read()
+	if s.err != nil {
+		log.WithField("caller", "loadgen").WithError(s.err).Warn("CPU usage is not measured")
+	}
+	s.last, s.lastAt = s.start, s.startAt
+	return s
+}
+
+func (s *cpuSampler) sample() {
+	if s == nil || s.err != nil {
+		return
+	}
+	now := time.Now()
+	used, err := s.read()
+	if err != nil {
+		s.err = err
+		return
+	}
+	// the CPU times have a resolution of 10ms, shorter intervals would make up peaks
+	if elapsed := now.Sub(s.lastAt); elapsed >= 500*time.Millisecond {
+		s.peak = max(s.peak, 100*float64(used-s.last)/float64(elapsed))
+	}
+	s.last, s.lastAt = used, now
+}
+
+// stats returns nil if the usage could not be measured
+func (s *cpuSampler) stats() *CPUStats {
+	s.sample()
+	if s.err != nil {
+		return nil
+	}
+	used := s.last - s.start
+	return &CPUStats{
+		Percent:     100 * float64(used) / float64(s.lastAt.Sub(s.startAt)),
+		PeakPercent: s.peak,
+		Seconds:     used.Seconds(),
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Report is the result of a load run, written as JSON or as a CSV row
+// Loss compares the frames the clients of a channel heard with the frames the other members sent
+// ForwardingLatency is measured from the write of the sender to the arrival at the socket of the receiver,
+// on loopback that is the time a frame spends in the server, see stampedConn
+// ReceiveTimestamps tells if the arrival is the receive timestamp of the kernel or the time after the read
+// EndToEndLatency is measured from the talk loop of the sender to the handler of the receiver,
+// it adds the send queue of the client and the scheduling of the load generator
+type Report struct {
+	Label     string    `json:"label"`
+	StartedAt time.Time `json:"startedAt"`
+	Target    string    `json:"target"`
+	GoVersion string    `json:"goVersion"`
+	NumCPU    int       `json:"numCpu"`
+
+	Settings          Settings    `json:"settings"`
+	Clients           ClientStats `json:"clients"`
+	Frames            FrameStats  `json:"frames"`
+	ForwardingLatency Percentiles `json:"forwardingLatencyMs"`
+	ReceiveTimestamps string      `json:"receiveTimestamps"`
+	EndToEndLatency   Percentiles `json:"endToEndLatencyMs"`
+	Notes             []string    `json:"notes,omitempty"`
+
+	ServerCPU  *CPUStats `json:"serverCpu,omitempty"`
+	LoadgenCPU *CPUStats `json:"loadgenCpu,omitempty"`
+}
+
+// Settings are the parameters of the run
+type Settings struct {
+	Clients       int     `json:"clients"`
+	Channels      int     `json:"channels"`
+	Duration      string  `json:"duration"`
+	Ramp          string  `json:"ramp"`
+	FrameInterval string  `json:"frameInterval"`
+	FrameSize     int     `json:"frameSize"`
+	TalkRatio     float64 `json:"talkRatio"`
+	Talkspurt     string  `json:"talkspurt"`
+	SourceIPs     int     `json:"sourceIps"`
+	Seed          uint64  `json:"seed"`
+}
+
+// ClientStats are the handshakes and channel joins of the virtual clients
+// A client that connected but did not join its channel counts as failed
+type ClientStats struct {
+	Requested int         `json:"requested"`
+	Connected int         `json:"connected"`
+	Failed    int         `json:"failed"`
+	ConnectMs Percentiles `json:"connectMs"`
+	JoinMs    Percentiles `json:"joinMs"`
+}
+
+// FrameStats count the voice frames
+// Expected are the frames the other members of the channel of a client sent, the server does not echo the own frames
+// Foreign are frames of other channels, the server should never forward them
+type FrameStats struct {
+	Sent              uint64  `json:"sent"`
+	Expected          uint64  `json:"expected"`
+	Received          uint64  `json:"received"`
+	Foreign           uint64  `json:"foreign"`
+	Loss              float64 `json:"loss"`
+	SentPerSecond     float64 `json:"sentPerSecond"`
+	ReceivedPerSecond float64 `json:"receivedPerSecond"`
+}
+
+// CPUStats is the CPU usage of a process during the run, 100 percent is one core
+type CPUStats struct {
+	Percent     float64 `json:"percent"`
+	PeakPercent float64 `json:"peakPercent"`
+	Seconds     float64 `json:"seconds"`
+	RSSMB       float64 `json:"rssMb,omitempty"`
+}
+
+// writeJSON writes the report to path, "-" is stdout
+func (r *Report) writeJSON(path string) error {
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+var csvHeader = []string{
+	"label", "startedAt", "target", "clients", "channels", "duration", "frameInterval", "frameSize", "talkRatio",
+	"connected", "failed", "connectP50Ms", "connectP99Ms", "joinP50Ms", "joinP99Ms",
+	"framesSent", "framesExpected", "framesReceived", "framesForeign", "loss", "sentPerSecond", "receivedPerSecond",
+	"fwdLatencyP50Ms", "fwdLatencyP90Ms", "fwdLatencyP99Ms", "fwdLatencyP999Ms", "fwdLatencyMaxMs", "receiveTimestamps",
+	"e2eLatencyP50Ms", "e2eLatencyP90Ms", "e2eLatencyP99Ms", "e2eLatencyP999Ms", "e2eLatencyMaxMs",
+	"serverCpuPercent", "serverCpuPeakPercent", "serverRssMb", "loadgenCpuPercent",
+}
+
+// appendCSV appends the report as a row to path and writes the header if the file is new
+// One file collects the runs of several releases
+func (r *Report) appendCSV(path string) error {
+	_, err := os.Stat(path)
+	newFile := os.IsNotExist(err)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if newFile {
+		w.Write(csvHeader)
+	}
+	w.Write(r.csvRow())
+	w.Flush()
+	return w.Error()
+}
+
+func (r *Report) csvRow() []string {
+	float := func(v float64) string { return strconv.FormatFloat(v, 'f', 3, 64) }
+	cpu := func(stats *CPUStats, value func(*CPUStats) float64) string {
+		if stats == nil {
+			return ""
+		}
+		return float(value(stats))
+	}
+	return []string{
+		r.Label, r.StartedAt.Format(time.RFC3339), r.Target,
+		strconv.Itoa(r.Settings.Clients), strconv.Itoa(r.Settings.Channels), r.Settings.Duration,
+		r.Settings.FrameInterval, strconv.Itoa(r.Settings.FrameSize), float(r.Settings.TalkRatio),
+		strconv.Itoa(r.Clients.Connected), strconv.Itoa(r.Clients.Failed), float(r.Clients.ConnectMs.P50), float(r.Clients.ConnectMs.P99),
+		float(r.Clients.JoinMs.P50), float(r.Clients.JoinMs.P99),
+		strconv.FormatUint(r.Frames.Sent, 10), strconv.FormatUint(r.Frames.Expected, 10), strconv.FormatUint(r.Frames.Received, 10),
+		strconv.FormatUint(r.Frames.Foreign, 10), strconv.FormatFloat(r.Frames.Loss, 'f', 6, 64), float(r.Frames.SentPerSecond), float(r.Frames.ReceivedPerSecond),
+		float(r.ForwardingLatency.P50), float(r.ForwardingLatency.P90), float(r.ForwardingLatency.P99), float(r.ForwardingLatency.P999), float(r.ForwardingLatency.Max),
+		r.ReceiveTimestamps,
+		float(r.EndToEndLatency.P50), float(r.EndToEndLatency.P90), float(r.EndToEndLatency.P99), float(r.EndToEndLatency.P999), float(r.EndToEndLatency.Max),
+		cpu(r.ServerCPU, func(s *CPUStats) float64 { return s.Percent }),
+		cpu(r.ServerCPU, func(s *CPUStats) float64 { return s.PeakPercent }),
+		cpu(r.ServerCPU, func(s *CPUStats) float64 { return s.RSSMB }),
+		cpu(r.LoadgenCPU, func(s *CPUStats) float64 { return s.Percent }),
+	}
+}
+
+// print writes a short human readable summary
+func (r *Report) print(w io.Writer) {
+	fmt.Fprintf(w, "clients   %d connected, %d failed, connect p50 %.2fms p99 %.2fms, join p50 %.2fms p99 %.2fms\n",
+		r.Clients.Connected, r.Clients.Failed, r.Clients.ConnectMs.P50, r.Clients.ConnectMs.P99, r.Clients.JoinMs.P50, r.Clients.JoinMs.P99)
+	fmt.Fprintf(w, "frames    %d sent (%.0f/s), %d of %d heard, loss %.3f%%, %d foreign, %.0f received/s\n",
+		r.Frames.Sent, r.Frames.SentPerSecond, r.Frames.Received, r.Frames.Expected, r.Frames.Loss*100, r.Frames.Foreign, r.Frames.ReceivedPerSecond)
+	fmt.Fprintf(w, "fwd lat.  p50 %.2fms p90 %.2fms p99 %.2fms p99.9 %.2fms max %.2fms (%s receive timestamps)\n",
+		r.ForwardingLatency.P50, r.ForwardingLatency.P90, r.ForwardingLatency.P99, r.ForwardingLatency.P999, r.ForwardingLatency.Max, r.ReceiveTimestamps)
+	fmt.Fprintf(w, "e2e lat.  p50 %.2fms p90 %.2fms p99 %.2fms p99.9 %.2fms max %.2fms\n",
+		r.EndToEndLatency.P50, r.EndToEndLatency.P90, r.EndToEndLatency.P99, r.EndToEndLatency.P999, r.EndToEndLatency.Max)
+	if r.ServerCPU != nil {
+		fmt.Fprintf(w, "server    cpu %.1f%% (peak %.1f%%), rss %.1fMB\n", r.ServerCPU.Percent, r.ServerCPU.PeakPercent, r.ServerCPU.RSSMB)
+	}
+	if r.LoadgenCPU != nil {
+		fmt.Fprintf(w, "loadgen   cpu %.1f%% (peak %.1f%%)\n", r.LoadgenCPU.Percent, r.LoadgenCPU.PeakPercent)
+	}
+	for _, note := range r.Notes {
+		fmt.Fprintf(w, "note      %s\n", note)
+	}
+}
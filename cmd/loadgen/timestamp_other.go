@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// enableReceiveTimestamps fails, receive times are taken after the read
+func enableReceiveTimestamps(conn *net.UDPConn) error {
+	return errors.New("receive timestamps of the kernel are only read on linux")
+}
+
+func receiveTimestamp(oob []byte) (time.Time, bool) { return time.Time{}, false }
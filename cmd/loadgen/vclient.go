@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/client"
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+// The frames are Voice packets the server forwards to the other members of the channel of the sender
+// The loadgen header at the start of the voice frame tells receivers where and when a frame was sent
+//
+//	magic "LG" | channel uint16 | sender uint32 | seq uint32 | createdAt int64 | sentAt int64 | padding
+//
+// createdAt is taken when the talk loop hands the frame to the client, sentAt right before the datagram is written
+// Both are nanoseconds of the wall clock of the load generator, senders and receivers share it
+const frameHeaderSize = 28
+
+// frameOverhead is the size of the packet and voice headers in front of the loadgen header
+const frameOverhead = protocol.HeaderSize + protocol.VoiceHeaderSize
+
+// sentAtOffset is the offset of sentAt in an encoded Voice packet
+const sentAtOffset = frameOverhead + 20
+
+// frameCodec is the codec of the frames, the server forwards them without decoding
+// Channels in mix mode decode the frames and drop them, so the load runs in forward mode channels
+const frameCodec = protocol.CodecOpus
+
+var frameMagic = [2]byte{'L', 'G'}
+
+type frame struct {
+	channel   uint16
+	sender    uint32
+	seq       uint32
+	createdAt int64
+	sentAt    int64
+}
+
+// encodeFrame encodes a frame into a voice frame, the Voice packet is size bytes long
+func encodeFrame(f frame, size int) []byte {
+	data := make([]byte, max(size-frameOverhead, frameHeaderSize))
+	copy(data, frameMagic[:])
+	binary.BigEndian.PutUint16(data[2:4], f.channel)
+	binary.BigEndian.PutUint32(data[4:8], f.sender)
+	binary.BigEndian.PutUint32(data[8:12], f.seq)
+	binary.BigEndian.PutUint64(data[12:20], uint64(f.createdAt))
+	binary.BigEndian.PutUint64(data[20:28], uint64(f.sentAt))
+	return data
+}
+
+func decodeFrame(data []byte) (frame, bool) {
+	if len(data) < frameHeaderSize || data[0] != frameMagic[0] || data[1] != frameMagic[1] {
+		return frame{}, false
+	}
+	return frame{
+		channel:   binary.BigEndian.Uint16(data[2:4]),
+		sender:    binary.BigEndian.Uint32(data[4:8]),
+		seq:       binary.BigEndian.Uint32(data[8:12]),
+		createdAt: int64(binary.BigEndian.Uint64(data[12:20])),
+		sentAt:    int64(binary.BigEndian.Uint64(data[20:28])),
+	}, true
+}
+
+// channelName is the name of a loadgen channel on the server
+func channelName(channel uint16) string {
+	return fmt.Sprintf("loadgen-%d", channel)
+}
+
+// voice is the talk pattern of the virtual clients
+// A client alternates between talkspurts and silence, both exponentially distributed
+// TalkRatio is the share of the time a client talks, Talkspurt the mean length of a talkspurt
+type voice struct {
+	FrameInterval time.Duration
+	FrameSize     int
+	TalkRatio     float64
+	Talkspurt     time.Duration
+}
+
+// virtualClient is one simulated talker on top of a real client.Client
+type virtualClient struct {
+	id      uint32
+	channel uint16
+	client  *client.Client
+	conn    *stampedConn
+	rng     *rand.Rand
+	done    chan struct{}
+	joined  chan struct{}
+
+	connectTime time.Duration
+	joinTime    time.Duration
+	connected   bool
+
+	sent     atomic.Uint64
+	received atomic.Uint64
+	foreign  atomic.Uint64
+	// the histograms are only written by the receive loop of the client and read after it stopped
+	forwarding histogram
+	endToEnd   histogram
+}
+
+func newVirtualClient(id uint32, channel uint16, seed uint64) *virtualClient {
+	return &virtualClient{
+		id:      id,
+		channel: channel,
+		rng:     rand.New(rand.NewPCG(seed, uint64(id))),
+		done:    make(chan struct{}),
+		joined:  make(chan struct{}),
+	}
+}
+
+// connect starts the client, waits for the accepted handshake and joins the channel of the client
+func (v *virtualClient) connect(host string, port int, source net.IP, timeout time.Duration) error {
+	v.client = client.NewClient(host, port)
+	v.client.Transport = stampedUDP{source: source, dialed: func(conn *stampedConn) { v.conn = conn }}
+	v.client.OnPacket(protocol.PacketTypeVoice, v.handleFrame)
+	v.client.OnPacket(protocol.PacketTypeChannelJoin, func(packet *protocol.Packet) error {
+		if string(packet.Payload) == channelName(v.channel) {
+			select {
+			case <-v.joined:
+			default:
+				close(v.joined)
+			}
+		}
+		return nil
+	})
+
+	started := time.Now()
+	go func() {
+		defer close(v.done)
+		v.client.Run()
+	}()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	poll := time.NewTicker(5 * time.Millisecond)
+	defer poll.Stop()
+	for !v.client.Connected() {
+		select {
+		case <-v.done:
+			return errors.New("client stopped before the handshake completed")
+		case <-deadline.C:
+			return errors.New("handshake timed out")
+		case <-poll.C:
+		}
+	}
+	v.connectTime = time.Since(started)
+
+	joinStarted := time.Now()
+	if err := v.client.JoinChannel(channelName(v.channel)); err != nil {
+		return err
+	}
+	select {
+	case <-v.done:
+		return errors.New("client stopped before the channel was joined")
+	case <-deadline.C:
+		return fmt.Errorf("join of %s timed out", channelName(v.channel))
+	case <-v.joined:
+	}
+	v.joinTime = time.Since(joinStarted)
+	v.connected = true
+	return nil
+}
+
+// handleFrame accounts a frame the server forwarded
+// The forwarding latency ends when the datagram arrived at the socket, the end-to-end latency when the frame is handled
+func (v *virtualClient) handleFrame(packet *protocol.Packet) error {
+	handledAt := time.Now().UnixNano()
+	voice, err := protocol.DecodeVoice(packet.Payload)
+	if err != nil {
+		return nil
+	}
+	f, ok := decodeFrame(voice.Frame)
+	if !ok {
+		return nil
+	}
+	if f.channel != v.channel {
+		v.foreign.Add(1)
+		return nil
+	}
+	v.received.Add(1)
+	v.forwarding.record(time.Duration(v.conn.receivedAt.Load() - f.sentAt))
+	v.endToEnd.record(time.Duration(handledAt - f.createdAt))
+	return nil
+}
+
+// talk sends frames with the voice pattern until ctx is done
+func (v *virtualClient) talk(ctx context.Context, pattern voice) {
+	// spread the clients over the frame interval, real clients are not in phase
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(time.Duration(v.rng.Int64N(int64(pattern.FrameInterval)))):
+	}
+	ticker := time.NewTicker(pattern.FrameInterval)
+	defer ticker.Stop()
+
+	// the timestamps count the 48kHz clock of Opus
+	ticks := uint32(pattern.FrameInterval * 48000 / time.Second)
+	talking := v.rng.Float64() < pattern.TalkRatio
+	switchAt := time.Now().Add(v.period(talking, pattern))
+	var seq, timestamp uint32
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for !now.Before(switchAt) {
+				talking = !talking
+				switchAt = switchAt.Add(v.period(talking, pattern))
+			}
+			// the timestamp runs on in silence, like the sampling clock of a real client
+			timestamp += ticks
+			if !talking {
+				continue
+			}
+			data := encodeFrame(frame{channel: v.channel, sender: v.id, seq: seq, createdAt: time.Now().UnixNano()}, pattern.FrameSize)
+			seq++
+			if err := v.client.SendVoice(frameCodec, timestamp, data); err != nil {
+				continue
+			}
+			v.sent.Add(1)
+		}
+	}
+}
+
+// period draws the length of the next talkspurt or silence
+func (v *virtualClient) period(talking bool, pattern voice) time.Duration {
+	mean := pattern.Talkspurt
+	switch {
+	case pattern.TalkRatio >= 1:
+		// never silent
+		if !talking {
+			return 0
+		}
+		return time.Duration(1 << 62)
+	case pattern.TalkRatio <= 0:
+		if talking {
+			return 0
+		}
+		return time.Duration(1 << 62)
+	case !talking:
+		mean = time.Duration(float64(pattern.Talkspurt) * (1 - pattern.TalkRatio) / pattern.TalkRatio)
+	}
+	return time.Duration(v.rng.ExpFloat64() * float64(mean))
+}
+
+func (v *virtualClient) stop() {
+	if v.client == nil {
+		return
+	}
+	v.client.Stop()
+	<-v.done
+}
+
+// stampedUDP dials the connections of the virtual clients, from a fixed local IP if source is set
+// The server limits the packets per source IP, loopback addresses like 127.0.1.x spread the clients over several IPs
+type stampedUDP struct {
+	source net.IP
+	dialed func(conn *stampedConn)
+}
+
+func (s stampedUDP) Listen(addr string) (net.PacketConn, error) {
+	return nil, errors.New("stampedUDP can only dial")
+}
+
+func (s stampedUDP) Dial(addr string) (net.Conn, error) {
+	raddr, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+	var laddr *net.UDPAddr
+	if s.source != nil {
+		laddr = &net.UDPAddr{IP: s.source}
+	}
+	conn, err := net.DialUDP("udp", laddr, raddr)
+	if err != nil {
+		return nil, err
+	}
+	stamped := newStampedConn(conn)
+	s.dialed(stamped)
+	return stamped, nil
+}
+
+// stampedConn takes the times of the forwarding latency as close to the socket as the load generator gets
+// Write stamps sentAt into outgoing frames right before the datagram is written, after the send queue of the client
+// Read notes when the datagram arrived, with the receive timestamp of the kernel where the platform has one,
+// so the forwarding latency does not include the scheduling of the receive loop
+// On loopback the datagram reaches the socket of the server within the write,
+// so the forwarding latency is the time it spends in the server
+type stampedConn struct {
+	*net.UDPConn
+	oob        []byte
+	kernelTime bool
+	receivedAt atomic.Int64
+}
+
+func newStampedConn(conn *net.UDPConn) *stampedConn {
+	c := &stampedConn{UDPConn: conn, oob: make([]byte, 128)}
+	c.kernelTime = enableReceiveTimestamps(conn) == nil
+	return c
+}
+
+func (c *stampedConn) Write(b []byte) (int, error) {
+	if len(b) >= sentAtOffset+8 && protocol.PacketType(b[0]) == protocol.PacketTypeVoice && b[frameOverhead] == frameMagic[0] && b[frameOverhead+1] == frameMagic[1] {
+		binary.BigEndian.PutUint64(b[sentAtOffset:], uint64(time.Now().UnixNano()))
+	}
+	return c.UDPConn.Write(b)
+}
+
+func (c *stampedConn) Read(b []byte) (int, error) {
+	n, oobn, _, _, err := c.ReadMsgUDP(b, c.oob)
+	at := time.Now()
+	if err != nil {
+		return n, err
+	}
+	if c.kernelTime {
+		if kernel, ok := receiveTimestamp(c.oob[:oobn]); ok {
+			at = kernel
+		}
+	}
+	c.receivedAt.Store(at.UnixNano())
+	return n, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/aura-speak/networking/internal/logger"
+	"github.com/aura-speak/networking/pkg/netem"
+	"github.com/aura-speak/networking/pkg/simnet"
+	log "github.com/sirupsen/logrus"
+)
+
+// netem-proxy sits between a client and the server and impairs the traffic in both directions
+//
+// Example:
+//
+//	netem-proxy -listen 127.0.0.1:9000 -upstream 127.0.0.1:8080 -preset mobile
+//	client -port 9000
+//	curl -X PUT localhost:9001/profile -d '{"both": {"loss": 0.05, "delay": "80ms", "jitter": "20ms"}}'
+func main() {
+	listen := flag.String("listen", "127.0.0.1:9000", "address the clients send to")
+	upstream := flag.String("upstream", "127.0.0.1:8080", "address of the server")
+	httpAddr := flag.String("http", "127.0.0.1:9001", "address of the HTTP API, empty to disable it")
+	seed := flag.Uint64("seed", 1, "seed of the random decisions")
+	preset := flag.String("preset", "none", "profile preset: "+strings.Join(netem.PresetNames(), ", "))
+	loss := flag.Float64("loss", -1, "loss probability 0 to 1, overrides the preset")
+	delay := flag.Duration("delay", -1, "one-way latency, overrides the preset")
+	jitter := flag.Duration("jitter", -1, "jitter, overrides the preset")
+	duplicate := flag.Float64("duplicate", -1, "duplication probability 0 to 1, overrides the preset")
+	reorder := flag.Float64("reorder", -1, "probability that a datagram skips the delay, overrides the preset")
+	rate := flag.Int("rate", -1, "bandwidth in bytes per second per direction, 0 unlimited, overrides the preset")
+	maxQueue := flag.Duration("max-queue", -1, "longest wait for the bandwidth before a datagram is dropped, overrides the preset")
+	logLevel := flag.String("log-level", "", "log level")
+	flag.Parse()
+
+	if err := logger.SetLevel(*logLevel); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	profile, ok := netem.Presets[*preset]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown preset %q, use one of %s\n", *preset, strings.Join(netem.PresetNames(), ", "))
+		os.Exit(2)
+	}
+	if *loss >= 0 {
+		profile.Loss = *loss
+		profile.Burst = nil
+	}
+	if *delay >= 0 {
+		profile.Delay = *delay
+	}
+	if *jitter >= 0 {
+		profile.Jitter = *jitter
+	}
+	if *duplicate >= 0 {
+		profile.Duplicate = *duplicate
+	}
+	if *reorder >= 0 {
+		profile.Reorder = *reorder
+	}
+	if *rate >= 0 {
+		profile.Rate = *rate
+	}
+	if *maxQueue >= 0 {
+		profile.MaxQueue = *maxQueue
+	}
+
+	proxy, err := netem.NewProxy(netem.Options{
+		Listen:   *listen,
+		Upstream: *upstream,
+		Seed:     *seed,
+		Up:       profile,
+		Down:     profile,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *httpAddr != "" {
+		httpServer := &http.Server{Addr: *httpAddr, Handler: proxy.Handler()}
+		go func() {
+			log.Infof("HTTP API on http://%s", *httpAddr)
+			if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.WithError(err).Error("HTTP API stopped")
+			}
+		}()
+		defer httpServer.Close()
+	}
+
+	printProfile(proxy.Status().Up)
+	if err := proxy.Run(ctx); err != nil {
+		log.WithError(err).Error("Proxy stopped")
+		os.Exit(1)
+	}
+}
+
+func printProfile(p simnet.Profile) {
+	data, _ := p.MarshalJSON()
+	log.Infof("Profile of both directions: %s", data)
+}
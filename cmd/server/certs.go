@@ -0,0 +1,338 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aura-speak/networking/internal/config"
+	"github.com/aura-speak/networking/internal/util"
+	"github.com/aura-speak/networking/pkg/auth"
+	"gopkg.in/yaml.v2"
+)
+
+const certsUsage = `usage: server certs <command> [flags]
+
+commands:
+  ca      generate the local CA (ca.crt and ca.key in the dtls path)
+  server  issue a server certificate signed by the CA
+  client  issue a client certificate for a user signed by the CA
+  revoke  add a certificate to the CRL of the CA
+  psk     add a random pre-shared key for an identity to the PSK keyfile
+
+run "server certs <command> -h" for the flags of a command`
+
+// runCerts runs the certs subcommand and returns the exit code
+func runCerts(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, certsUsage)
+		return 2
+	}
+	var err error
+	switch args[0] {
+	case "ca":
+		err = certsCA(args[1:])
+	case "server":
+		err = certsServer(args[1:])
+	case "client":
+		err = certsClient(args[1:])
+	case "revoke":
+		err = certsRevoke(args[1:])
+	case "psk":
+		err = certsPSK(args[1:])
+	case "-h", "-help", "--help", "help":
+		fmt.Println(certsUsage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown certs command %q\n\n%s\n", args[0], certsUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "certs:", err)
+		return 1
+	}
+	return 0
+}
+
+// certsConfig parses the flags of a certs command and loads the configuration
+// It returns the configuration and the paths of the CA certificate and key
+func certsConfig(fs *flag.FlagSet, flags *config.Flags, args []string) (*config.ServerConfig, string, string, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, "", "", err
+	}
+	cfg, err := flags.Load()
+	if err != nil {
+		return nil, "", "", err
+	}
+	srvCfg := &cfg.ServerConfig
+	return srvCfg, filepath.Join(srvCfg.Server.DTLS.Path, srvCfg.Server.DTLS.CA), util.CAKeyPath(srvCfg), nil
+}
+
+// certFlags registers the flags shared by all certs commands
+func certFlags(fs *flag.FlagSet, validity time.Duration) (*time.Duration, *string) {
+	v := fs.Duration("validity", validity, "validity of the certificate, e.g. 8760h")
+	k := fs.String("key-type", string(util.KeyTypeECDSAP256), "key type: ecdsa-p256, ecdsa-p384 or ed25519")
+	return v, k
+}
+
+// certsCA generates the local CA
+func certsCA(args []string) error {
+	fs := flag.NewFlagSet("certs ca", flag.ContinueOnError)
+	flags := config.RegisterFlags(fs, nil)
+	validity, keyTypeName := certFlags(fs, util.DefaultCAValidity)
+	name := fs.String("cn", "aura-speak local CA", "common name of the CA")
+	force := fs.Bool("force", false, "replace an existing CA, this invalidates all issued certificates")
+	_, caPath, caKeyPath, err := certsConfig(fs, flags, args)
+	if err != nil {
+		return err
+	}
+	keyType, err := util.ParseKeyType(*keyTypeName)
+	if err != nil {
+		return err
+	}
+	if util.FileExists(caKeyPath) && !*force {
+		return fmt.Errorf("%s already exists, use -force to replace the CA", caKeyPath)
+	}
+
+	ca, keyPEM, err := util.GenerateCA(util.CertOptions{CommonName: *name, Validity: *validity, KeyType: keyType})
+	if err != nil {
+		return err
+	}
+	if err := util.WritePEMFiles(caPath, caKeyPath, ca.CertPEM, keyPEM); err != nil {
+		return err
+	}
+	fmt.Printf("CA %q valid until %s\n  cert: %s\n  key:  %s\n", ca.Cert.Subject.CommonName, ca.Cert.NotAfter.Format(time.RFC3339), caPath, caKeyPath)
+	return nil
+}
+
+// certsServer issues a server certificate
+func certsServer(args []string) error {
+	fs := flag.NewFlagSet("certs server", flag.ContinueOnError)
+	flags := config.RegisterFlags(fs, nil)
+	validity, keyTypeName := certFlags(fs, util.DefaultCertValidity)
+	dns := fs.String("dns", "localhost", "comma separated DNS names (SANs)")
+	ips := fs.String("ip", "127.0.0.1,::1", "comma separated IP addresses (SANs)")
+	out := fs.String("out", "", "path of the certificate without extension, the configured server cert and key if empty")
+	cfg, caPath, caKeyPath, err := certsConfig(fs, flags, args)
+	if err != nil {
+		return err
+	}
+	keyType, err := util.ParseKeyType(*keyTypeName)
+	if err != nil {
+		return err
+	}
+	opts := util.CertOptions{DNSNames: splitList(*dns), Validity: *validity, KeyType: keyType}
+	for _, s := range splitList(*ips) {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return fmt.Errorf("invalid ip %q", s)
+		}
+		opts.IPAddresses = append(opts.IPAddresses, ip)
+	}
+
+	ca, err := util.LoadOrCreateCA(caPath, caKeyPath, util.CertOptions{KeyType: keyType})
+	if err != nil {
+		return err
+	}
+	issued, err := ca.IssueServer(opts)
+	if err != nil {
+		return err
+	}
+	certPath := filepath.Join(cfg.Server.DTLS.Path, cfg.Server.DTLS.Cert)
+	keyPath := filepath.Join(cfg.Server.DTLS.Path, cfg.Server.DTLS.Key)
+	if *out != "" {
+		certPath, keyPath = *out+".crt", *out+".key"
+	}
+	if err := util.WritePEMFiles(certPath, keyPath, issued.CertPEM, issued.KeyPEM); err != nil {
+		return err
+	}
+	fmt.Printf("server certificate %q valid until %s\n  dns:  %s\n  ip:   %s\n  cert: %s\n  key:  %s\n",
+		issued.Cert.Subject.CommonName, issued.Cert.NotAfter.Format(time.RFC3339),
+		strings.Join(issued.Cert.DNSNames, ", "), joinIPs(issued.Cert.IPAddresses), certPath, keyPath)
+	return nil
+}
+
+// certsClient issues a client certificate for a user
+func certsClient(args []string) error {
+	fs := flag.NewFlagSet("certs client", flag.ContinueOnError)
+	flags := config.RegisterFlags(fs, nil)
+	validity, keyTypeName := certFlags(fs, util.DefaultCertValidity)
+	user := fs.String("user", "", "user ID, used as the common name of the subject (required)")
+	out := fs.String("out", "", "path of the certificate without extension, <dtls path>/clients/<user> if empty")
+	cfg, caPath, caKeyPath, err := certsConfig(fs, flags, args)
+	if err != nil {
+		return err
+	}
+	if *user == "" {
+		fs.Usage()
+		return fmt.Errorf("-user is required")
+	}
+	keyType, err := util.ParseKeyType(*keyTypeName)
+	if err != nil {
+		return err
+	}
+	if !util.FileExists(caPath) || !util.FileExists(caKeyPath) {
+		return fmt.Errorf("no CA found at %s, run \"server certs ca\" first", caPath)
+	}
+	ca, err := util.LoadCA(caPath, caKeyPath)
+	if err != nil {
+		return err
+	}
+	issued, err := ca.IssueClient(*user, util.CertOptions{Validity: *validity, KeyType: keyType})
+	if err != nil {
+		return err
+	}
+	base := *out
+	if base == "" {
+		if filepath.Base(*user) != *user {
+			return fmt.Errorf("user id %q can not be used as file name, set -out", *user)
+		}
+		base = filepath.Join(cfg.Server.DTLS.Path, "clients", *user)
+	}
+	if err := util.WritePEMFiles(base+".crt", base+".key", issued.CertPEM, issued.KeyPEM); err != nil {
+		return err
+	}
+	fmt.Printf("client certificate for %q valid until %s\n  cert: %s\n  key:  %s\n",
+		*user, issued.Cert.NotAfter.Format(time.RFC3339), base+".crt", base+".key")
+	return nil
+}
+
+// certsRevoke adds a certificate to the CRL
+func certsRevoke(args []string) error {
+	fs := flag.NewFlagSet("certs revoke", flag.ContinueOnError)
+	flags := config.RegisterFlags(fs, nil)
+	certFile := fs.String("cert", "", "certificate file to revoke")
+	serialHex := fs.String("serial", "", "serial number in hex to revoke, instead of -cert")
+	cfg, caPath, caKeyPath, err := certsConfig(fs, flags, args)
+	if err != nil {
+		return err
+	}
+	var serial *big.Int
+	switch {
+	case *certFile != "" && *serialHex == "":
+		data, err := os.ReadFile(*certFile)
+		if err != nil {
+			return err
+		}
+		block, _ := pem.Decode(data)
+		if block == nil || block.Type != "CERTIFICATE" {
+			return fmt.Errorf("%s: no certificate found", *certFile)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return err
+		}
+		serial = cert.SerialNumber
+	case *serialHex != "" && *certFile == "":
+		var ok bool
+		serial, ok = new(big.Int).SetString(strings.ReplaceAll(*serialHex, ":", ""), 16)
+		if !ok {
+			return fmt.Errorf("invalid serial %q", *serialHex)
+		}
+	default:
+		fs.Usage()
+		return fmt.Errorf("either -cert or -serial is required")
+	}
+
+	ca, err := util.LoadCA(caPath, caKeyPath)
+	if err != nil {
+		return err
+	}
+	crl := cfg.Server.DTLS.CRL
+	if crl == "" {
+		crl = "ca.crl"
+		fmt.Printf("dtls.crl is not set, set it to %q to enforce the CRL\n", crl)
+	}
+	crlPath := filepath.Join(cfg.Server.DTLS.Path, crl)
+	if err := ca.Revoke(crlPath, serial); err != nil {
+		return err
+	}
+	fmt.Printf("revoked serial %s\n  crl: %s\n", serial.Text(16), crlPath)
+	return nil
+}
+
+// certsPSK adds a random pre-shared key to the PSK keyfile
+func certsPSK(args []string) error {
+	fs := flag.NewFlagSet("certs psk", flag.ContinueOnError)
+	flags := config.RegisterFlags(fs, nil)
+	identity := fs.String("identity", "", "PSK identity the client sends in the handshake (required)")
+	user := fs.String("user", "", "user ID of the session, the identity if empty")
+	role := fs.String("role", "", "role of the session, member if empty")
+	cfg, _, _, err := certsConfig(fs, flags, args)
+	if err != nil {
+		return err
+	}
+	if *identity == "" {
+		fs.Usage()
+		return fmt.Errorf("-identity is required")
+	}
+	if _, ok := auth.ParseRole(*role); *role != "" && !ok {
+		return fmt.Errorf("unknown role %q", *role)
+	}
+
+	path := filepath.Join(cfg.Server.DTLS.Path, cfg.Server.DTLS.PSKFile)
+	var list auth.PSKList
+	if data, err := os.ReadFile(path); err == nil {
+		if err := yaml.Unmarshal(data, &list); err != nil {
+			return fmt.Errorf("decode %s: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	for _, psk := range list.Keys {
+		if psk.Identity == *identity {
+			return fmt.Errorf("identity %q already exists in %s", *identity, path)
+		}
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	list.Keys = append(list.Keys, auth.PSK{
+		Identity: *identity,
+		Key:      hex.EncodeToString(key),
+		UserID:   *user,
+		Role:     *role,
+	})
+	data, err := yaml.Marshal(&list)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return err
+	}
+	fmt.Printf("added psk for %q to %s\n  key: %s\n", *identity, path, hex.EncodeToString(key))
+	return nil
+}
+
+// splitList splits a comma separated flag value and drops empty entries
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func joinIPs(ips []net.IP) string {
+	s := make([]string, len(ips))
+	for i, ip := range ips {
+		s[i] = ip.String()
+	}
+	return strings.Join(s, ", ")
+}
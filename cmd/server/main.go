@@ -2,19 +2,83 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
 
 	"github.com/aura-speak/networking/internal/config"
+	"github.com/aura-speak/networking/internal/logger"
 	"github.com/aura-speak/networking/pkg/protocol"
 	"github.com/aura-speak/networking/pkg/server"
+	log "github.com/sirupsen/logrus"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "certs" {
+		os.Exit(runCerts(os.Args[2:]))
+	}
+
+	flags := config.RegisterFlags(flag.CommandLine, map[string]string{
+		"port":      "server.port",
+		"log-level": "log.level",
+		"shards":    "server.shards",
+		"rtp":       "server.rtp.listen",
+	})
+	initConfig := flag.Bool("init-config", false, "write the default config to the -config file and exit")
+	flag.Parse()
+
+	if *initConfig {
+		path := flags.Path
+		if path == "" {
+			path = config.DefaultPath
+		}
+		if err := config.WriteDefault(path); err != nil {
+			fmt.Fprintln(os.Stderr, "init-config:", err)
+			os.Exit(1)
+		}
+		fmt.Println("wrote", path)
+		return
+	}
+
+	cfg, err := flags.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config:\n%v\n", err)
+		os.Exit(2)
+	}
+	logger.SetLevel(cfg.Log.Level)
+
 	ctx := context.Background()
-	cfg := config.ServerConfigLoader()
-	server := server.NewServer(8080, ctx, cfg)
+	server := server.NewServer(int(cfg.Server.Port), ctx, &cfg.ServerConfig)
 	server.OnPacket(protocol.PacketTypeDebugAny, func(packet *protocol.Packet, clientAddr string) error {
 		server.Broadcast(packet)
 		return nil
 	})
-	server.Run()
+	watcher := config.NewWatcher(cfg, flags.Options())
+	go applyConfigChanges(watcher.Subscribe(), server)
+	go watcher.Watch(ctx, config.DefaultWatchInterval)
+
+	if err := server.Run(); err != nil {
+		log.WithError(err).Error("Server stopped")
+		os.Exit(1)
+	}
+}
+
+// applyConfigChanges applies the live parts of every config change to the server
+// and reports the settings that need a restart
+func applyConfigChanges(changes <-chan config.Change, srv *server.Server) {
+	for change := range changes {
+		if change.Err != nil {
+			continue
+		}
+		if err := logger.SetLevel(change.New.Log.Level); err != nil {
+			log.WithError(err).Error("Failed to apply log level")
+		}
+		if err := srv.ApplyConfig(&change.New.ServerConfig); err != nil {
+			log.WithError(err).Error("Failed to apply config")
+		}
+		if keys := change.RestartRequired("server.", "log."); len(keys) > 0 {
+			log.Warnf("Restart the server to apply: %s", strings.Join(keys, ", "))
+		}
+	}
 }
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
@@ -14,8 +16,19 @@ import (
 
 func main() {
 	logger.Setup()
-	cfg := config.ServerConfigLoader()
-	server := web.NewServer(8080, 9090, *cfg)
+	flags := config.RegisterFlags(flag.CommandLine, map[string]string{
+		"port":      "web.port",
+		"udp-port":  "web.udp_port",
+		"log-level": "log.level",
+	})
+	flag.Parse()
+	cfg, err := flags.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config:\n%v\n", err)
+		os.Exit(2)
+	}
+	logger.SetLevel(cfg.Log.Level)
+	server := web.NewServer(int(cfg.Web.Port), int(cfg.Web.UDPPort), cfg.ServerConfig)
 
 	// Starte Server in Goroutine
 	go func() {
@@ -2,17 +2,19 @@ module github.com/aura-speak/networking
 
 go 1.25.4
 
-require golang.org/x/net v0.48.0
+require (
+	github.com/pion/dtls/v3 v3.0.10
+	golang.org/x/net v0.48.0
+	gopkg.in/yaml.v2 v2.4.0
+)
 
 require (
-	github.com/pion/dtls/v3 v3.0.10 // indirect
 	github.com/pion/logging v0.2.4 // indirect
 	github.com/pion/transport/v4 v4.0.1 // indirect
 	golang.org/x/crypto v0.46.0 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
 
 require (
 	github.com/sirupsen/logrus v1.9.3
-	golang.org/x/sys v0.39.0 // indirect
+	golang.org/x/sys v0.39.0
 )
@@ -0,0 +1,85 @@
+// Package Config contains the configuration of the server, the client and the web debug UI
+// It is responsible for building the configuration from its layers
+// The layers are applied in the order defaults < config file < environment variables < command line flags
+// Every setting has a key like "server.port" that is used by the environment variables and the flags
+// The result is validated and errors point at the offending key
+package config
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Config is the configuration of all commands
+// The server settings are on the top level so older server config files stay valid
+type Config struct {
+	ServerConfig `yaml:",inline"`
+	Client       ClientConfig `yaml:"client"`
+	Web          WebConfig    `yaml:"web"`
+	Log          LogConfig    `yaml:"log"`
+
+	// File is the config file that was loaded, empty if only defaults, env and flags were used
+	File string `yaml:"-"`
+	// sources are the env variables and flags that set a key
+	sources map[string]string
+}
+
+// ClientConfig is the configuration of the UDP client
+type ClientConfig struct {
+	Host  string `yaml:"host"`
+	Port  Port   `yaml:"port"`
+	Token string `yaml:"token"` // credential for the connect handshake, optional
+	// udp or dtls; udp if nothing is set
+	Transport string           `yaml:"transport"`
+	DTLS      ClientDTLSConfig `yaml:"dtls"`
+}
+
+// ClientDTLSConfig are the credentials of the client for the DTLS transport
+// With a PSK identity the pre-shared key is used, otherwise the client certificate
+type ClientDTLSConfig struct {
+	Cert       string `yaml:"cert"`
+	Key        string `yaml:"key"`
+	CA         string `yaml:"ca"`          // CA the server certificate is verified against
+	ServerName string `yaml:"server_name"` // name in the server certificate, the host if nothing is set
+	// PSK identity and hex encoded pre-shared key from the keyfile of the server
+	PSKIdentity string `yaml:"psk_identity"`
+	PSKKey      string `yaml:"psk_key"`
+}
+
+// WebConfig is the configuration of the web debug UI
+type WebConfig struct {
+	Port    Port `yaml:"port"`     // port of the http server
+	UDPPort Port `yaml:"udp_port"` // port of the UDP server started from the UI
+}
+
+// LogConfig is the configuration of the logger
+type LogConfig struct {
+	Level string `yaml:"level"` // panic, fatal, error, warn, info, debug or trace; the default of the command if nothing is set
+}
+
+// Port is a UDP or TCP port
+// It also accepts quoted numbers, which older server config files contain
+type Port int
+
+// UnmarshalYAML decodes a port from a number or a quoted number
+func (p *Port) UnmarshalYAML(unmarshal func(any) error) error {
+	var n int
+	if err := unmarshal(&n); err == nil {
+		*p = Port(n)
+		return nil
+	}
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	if s == "" {
+		*p = 0
+		return nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", s)
+	}
+	*p = Port(n)
+	return nil
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Flags are the command line flags of the configuration
+// -config selects the config file, -set key=value sets any key
+// Commands can add shortcut flags for frequently used keys
+type Flags struct {
+	Path      string
+	overrides []Override
+}
+
+// RegisterFlags registers -config, -set and the shortcut flags on the flag set
+// The shortcuts map a flag name to the key it sets
+//
+// Example:
+//
+//	flags := config.RegisterFlags(flag.CommandLine, map[string]string{"port": "server.port"})
+//	flag.Parse()
+//	cfg, err := flags.Load()
+func RegisterFlags(fs *flag.FlagSet, shortcuts map[string]string) *Flags {
+	f := &Flags{}
+	fs.StringVar(&f.Path, "config", "", fmt.Sprintf("config file (default %s if it exists)", DefaultPath))
+	fs.Func("set", "set a config key, e.g. -set server.rate_limit.ban.duration=1m (repeatable)", func(s string) error {
+		key, value, ok := strings.Cut(s, "=")
+		if !ok {
+			return fmt.Errorf("expected key=value, got %q", s)
+		}
+		f.overrides = append(f.overrides, Override{Key: key, Value: value, Source: "flag -set"})
+		return nil
+	})
+	for name, key := range shortcuts {
+		fs.Func(name, "sets "+key, func(s string) error {
+			f.overrides = append(f.overrides, Override{Key: key, Value: s, Source: "flag -" + name})
+			return nil
+		})
+	}
+	return f
+}
+
+// Options returns the load options of the flags with the environment of the process
+func (f *Flags) Options() Options {
+	return Options{
+		Path:      f.Path,
+		Env:       os.Environ(),
+		Overrides: f.overrides,
+	}
+}
+
+// Load loads the configuration with the flags and the environment of the process
+func (f *Flags) Load() (*Config, error) {
+	return Load(f.Options())
+}
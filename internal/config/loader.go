@@ -0,0 +1,197 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/ratelimit"
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultPath is the config file that is used if no path is given
+const DefaultPath = "config.yml"
+
+// legacyPath is the config file of older versions, it is used if DefaultPath does not exist
+const legacyPath = "server_config.yml"
+
+// EnvPrefix is the prefix of the environment variables, e.g. AURA_SERVER_PORT for "server.port"
+const EnvPrefix = "AURA_"
+
+// envAliases are environment variables that were read before the generic ones existed
+var envAliases = map[string]string{
+	"AURA_TOKEN": "client.token",
+}
+
+// Override sets the setting Key to Value, e.g. from a command line flag
+type Override struct {
+	Key    string
+	Value  string
+	Source string // where the override comes from, e.g. "flag -port"
+}
+
+// Options are the inputs of Load
+// Path is the config file, if empty DefaultPath or server_config.yml is used if one of them exists
+// Env are the environment variables in the form "KEY=value" like os.Environ returns them
+// Overrides are applied in order after the environment variables
+type Options struct {
+	Path      string
+	Env       []string
+	Overrides []Override
+}
+
+// Default returns the default configuration
+func Default() *Config {
+	cfg := &Config{}
+	cfg.Server.Port = 8080
+	cfg.Server.Host = "0.0.0.0"
+	cfg.Server.Transport = "udp"
+	cfg.Server.DTLS.Mode = "mtls"
+	cfg.Server.DTLS.PSKFile = "psk.yml"
+	cfg.Server.DTLS.Path = "certs/"
+	cfg.Server.DTLS.Cert = "server.crt"
+	cfg.Server.DTLS.Key = "server.key"
+	cfg.Server.DTLS.CA = "ca.crt"
+	cfg.Server.DTLS.CAKey = "ca.key"
+	cfg.Server.DTLS.ExpiryWarningDays = 30
+	cfg.Server.Auth.Mode = "none"
+	cfg.Server.RateLimit.PerIP.Default = ratelimit.Limit{
+		PacketsPerSecond: 1000,
+		PacketBurst:      2000,
+		BytesPerSecond:   1 << 20,
+		ByteBurst:        2 << 20,
+	}
+	cfg.Server.RateLimit.PerSession.Default = ratelimit.Limit{
+		PacketsPerSecond: 200,
+		PacketBurst:      400,
+		BytesPerSecond:   256 << 10,
+		ByteBurst:        512 << 10,
+	}
+	cfg.Server.RateLimit.Ban = ratelimit.BanPolicy{
+		Violations:  100,
+		Window:      10 * time.Second,
+		Duration:    30 * time.Second,
+		MaxDuration: time.Hour,
+	}
+	cfg.Server.BanList = "bans.yml"
+	cfg.Server.Shards = 1
+	cfg.Server.RTP.Channel = "lobby"
+	cfg.Server.Recording.Dir = "recordings"
+
+	cfg.Client.Host = "localhost"
+	cfg.Client.Port = 8080
+	cfg.Client.Transport = "udp"
+
+	cfg.Web.Port = 8080
+	cfg.Web.UDPPort = 9090
+	return cfg
+}
+
+// Load builds the configuration from the defaults, the config file, the environment variables and the overrides
+// It returns an error if the config file can not be read or decoded, a setting is unknown or the result is invalid
+// A config file that is given explicitly has to exist
+//
+// Example:
+//
+//	cfg, err := config.Load(config.Options{Path: "config.yml", Env: os.Environ()})
+//	if err != nil {
+//		log.WithError(err).Error("Invalid config")
+//		return
+//	}
+func Load(opts Options) (*Config, error) {
+	cfg := Default()
+	cfg.sources = make(map[string]string)
+
+	path := opts.Path
+	if path == "" {
+		path = findDefaultPath()
+	}
+	if path != "" {
+		if err := cfg.readFile(path); err != nil {
+			return nil, err
+		}
+		cfg.File = path
+	}
+
+	if err := cfg.applyEnv(opts.Env); err != nil {
+		return nil, err
+	}
+	for _, o := range opts.Overrides {
+		if err := cfg.set(o.Key, o.Value, o.Source); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// findDefaultPath returns the first default config file that exists or an empty string
+func findDefaultPath() string {
+	for _, path := range []string{DefaultPath, legacyPath} {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// readFile decodes the config file on top of the current values
+// Unknown keys are an error, so typos do not go unnoticed
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return fmt.Errorf("decode config %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv applies all environment variables with EnvPrefix
+// Unknown variables with the prefix are an error
+func (c *Config) applyEnv(env []string) error {
+	keys := envKeys()
+	var errs []error
+	for _, kv := range env {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(name, EnvPrefix) {
+			continue
+		}
+		key, ok := keys[name]
+		if !ok {
+			key, ok = envAliases[name]
+		}
+		if !ok {
+			errs = append(errs, fmt.Errorf("env %s: unknown setting", name))
+			continue
+		}
+		if err := c.set(key, value, "env "+name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WriteDefault writes the default configuration to path
+// It does not overwrite an existing file
+func WriteDefault(path string) error {
+	data, err := yaml.Marshal(Default())
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -1,16 +1,95 @@
 package config
 
+import (
+	"time"
+
+	"github.com/aura-speak/networking/pkg/ratelimit"
+)
+
+// RateLimitConfig is the default limit and the overrides per packet type name, e.g. "DebugAny"
+type RateLimitConfig struct {
+	Default     ratelimit.Limit            `yaml:"default"`
+	PacketTypes map[string]ratelimit.Limit `yaml:"packet_types"`
+}
+
+// ServerConfig is the configuration of the UDP server
 type ServerConfig struct {
-	Server struct {
-		Port string `yaml:"port"`
-		// Implement Later
-		Host string `yaml:"host"`
-		DTLS struct {
-			Path string `yaml:"path"`
-			Cert string `yaml:"cert"`
-			Key  string `yaml:"key"`
-			CA   string `yaml:"ca"`
-		} `yaml:"dtls"`
-		Env string `yaml:"env"` // prod or env if nothing is set then prod
-	} `yaml:"server"`
+	Server ServerSettings `yaml:"server"`
+}
+
+// ServerSettings are the settings below the server key
+type ServerSettings struct {
+	Port Port `yaml:"port"`
+	// Implement Later
+	Host      string           `yaml:"host"`
+	Transport string           `yaml:"transport"` // udp or dtls; udp if nothing is set
+	DTLS      DTLSConfig       `yaml:"dtls"`
+	Auth      AuthConfig       `yaml:"auth"`
+	RateLimit RateLimitsConfig `yaml:"rate_limit"`
+	BanList   string           `yaml:"ban_list"`  // file of the persistent ban list, in memory if nothing is set
+	Shards    int              `yaml:"shards"`    // sockets on the port with SO_REUSEPORT, linux only
+	RTP       RTPConfig        `yaml:"rtp"`       // plain RTP listener for tools, disabled if nothing is set
+	Recording RecordingConfig  `yaml:"recording"` // recordings of channels and sessions, see pkg/recorder
+	Env       string           `yaml:"env"`       // prod or dev if nothing is set then prod
+	// Channels configures channels by name, channels without an entry are open to every speaker
+	Channels map[string]ChannelConfig `yaml:"channels"`
+}
+
+// DTLSConfig are the certificates and keys of the DTLS layer
+// The files are relative to Path
+type DTLSConfig struct {
+	// mtls or psk; mtls if nothing is set
+	Mode string `yaml:"mode"`
+	// keyfile of the pre-shared keys for mode psk
+	PSKFile string `yaml:"psk_file"`
+	Path    string `yaml:"path"`
+	Cert    string `yaml:"cert"`
+	Key     string `yaml:"key"`
+	CA      string `yaml:"ca"`
+	// private key of the local CA, only needed to issue certificates
+	CAKey string `yaml:"ca_key"`
+	// revoked client certificates, both optional
+	CRL      string `yaml:"crl"`
+	Denylist string `yaml:"denylist"`
+	// days before the expiry of a certificate from which on a warning is logged, 30 if nothing is set
+	ExpiryWarningDays int `yaml:"expiry_warning_days"`
+}
+
+// RTPConfig is the listener for plain RTP and RTCP
+// The listener has no handshake, everybody who reaches it may send voice, so it is meant for local tools and test harnesses
+type RTPConfig struct {
+	Listen  string `yaml:"listen"`  // host:port of the listener, e.g. 127.0.0.1:5004; disabled if nothing is set
+	Channel string `yaml:"channel"` // channel the RTP senders talk and listen in
+}
+
+// RecordingConfig is where and how the Server records channels and sessions
+// A file is rotated once it reaches MaxSize or MaxDuration, zero does not limit it
+type RecordingConfig struct {
+	Dir         string        `yaml:"dir"`          // directory of the WAV files and their JSON sidecars
+	MaxSize     int64         `yaml:"max_size"`     // bytes per file
+	MaxDuration time.Duration `yaml:"max_duration"` // length of a file, e.g. 1h
+}
+
+// ChannelConfig are the settings of one channel
+// With floor control only the holder of the floor talks, see pkg/floor
+// In mix mode the Server sends every listener one mixed stream instead of forwarding each speaker, see pkg/mixer
+type ChannelConfig struct {
+	Mode      string        `yaml:"mode"` // forward or mix, forward if nothing is set
+	Floor     bool          `yaml:"floor"`
+	MaxTalk   time.Duration `yaml:"max_talk"`   // talk time of a floor grant, unlimited if nothing is set
+	QueueSize int           `yaml:"queue_size"` // waiting talkers, 16 if nothing is set
+}
+
+// AuthConfig is the authentication of the connect handshake
+type AuthConfig struct {
+	Mode      string `yaml:"mode"`       // none, static or file; none if nothing is set, guests may speak then
+	Secret    string `yaml:"secret"`     // shared token secret for mode static
+	UsersFile string `yaml:"users_file"` // user list for mode file
+}
+
+// RateLimitsConfig are the rate limits per source IP and per session
+type RateLimitsConfig struct {
+	PerIP      RateLimitConfig     `yaml:"per_ip"`
+	PerSession RateLimitConfig     `yaml:"per_session"`
+	Ban        ratelimit.BanPolicy `yaml:"ban"` // automatic temporary bans of source IPs
 }
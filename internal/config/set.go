@@ -0,0 +1,164 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting is a leaf of the configuration that can be set by key
+type setting struct {
+	key   string
+	value reflect.Value
+}
+
+// settings walks the configuration and returns all leaves with their keys
+// The keys are the yaml names joined by dots, e.g. "server.rate_limit.ban.duration"
+func (c *Config) settings() []setting {
+	var list []setting
+	walk(reflect.ValueOf(c).Elem(), "", &list)
+	return list
+}
+
+func walk(v reflect.Value, prefix string, list *[]setting) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("yaml")
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if opts == "inline" {
+			walk(v.Field(i), prefix, list)
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		key := prefix + name
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Time{}) {
+			walk(v.Field(i), key+".", list)
+			continue
+		}
+		*list = append(*list, setting{key: key, value: v.Field(i)})
+	}
+}
+
+// Keys returns the keys of all settings
+func Keys() []string {
+	var keys []string
+	for _, s := range Default().settings() {
+		keys = append(keys, s.key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// EnvName returns the environment variable of a key, e.g. AURA_SERVER_PORT for "server.port"
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// envKeys maps the environment variables to the keys
+func envKeys() map[string]string {
+	keys := make(map[string]string)
+	for _, key := range Keys() {
+		keys[EnvName(key)] = key
+	}
+	return keys
+}
+
+// Set sets the setting of a key from its string form
+// Durations use the Go syntax like "30s", lists are comma separated
+//
+// Example:
+//
+//	cfg.Set("server.rate_limit.ban.duration", "1m")
+func (c *Config) Set(key, value string) error {
+	return c.set(key, value, "")
+}
+
+// set sets a key and remembers where the value comes from
+func (c *Config) set(key, value, source string) error {
+	at := key
+	if source != "" {
+		at = fmt.Sprintf("%s (%s)", key, source)
+	}
+	for _, s := range c.settings() {
+		if s.key != key {
+			continue
+		}
+		if err := setValue(s.value, value); err != nil {
+			return fmt.Errorf("%s: %w", at, err)
+		}
+		if c.sources == nil {
+			c.sources = make(map[string]string)
+		}
+		if source != "" {
+			c.sources[key] = source
+		}
+		return nil
+	}
+	return fmt.Errorf("%s: unknown setting", at)
+}
+
+// setValue parses the string into the value according to its type
+func setValue(v reflect.Value, s string) error {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", s)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid bool %q", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("can only be set in the config file")
+		}
+		var list []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list).Convert(v.Type()))
+	default:
+		return fmt.Errorf("can only be set in the config file")
+	}
+	return nil
+}
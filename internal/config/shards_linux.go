@@ -0,0 +1,7 @@
+//go:build linux
+// +build linux
+
+package config
+
+// shardsSupported tells if server.shards may open several sockets, SO_REUSEPORT spreads the datagrams over them
+const shardsSupported = true
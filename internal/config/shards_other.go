@@ -0,0 +1,7 @@
+//go:build !linux
+// +build !linux
+
+package config
+
+// shardsSupported tells if server.shards may open several sockets, other systems than Linux do not spread the datagrams
+const shardsSupported = false
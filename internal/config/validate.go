@@ -0,0 +1,211 @@
+package config
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/aura-speak/networking/pkg/auth"
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/ratelimit"
+	log "github.com/sirupsen/logrus"
+)
+
+// FieldError is a validation error of one setting
+type FieldError struct {
+	Key     string
+	Source  string // env variable or flag that set the key, empty for defaults and the config file
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	if e.Source != "" {
+		return fmt.Sprintf("%s (%s): %s", e.Key, e.Source, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Key, e.Message)
+}
+
+// validator collects the field errors of a configuration
+type validator struct {
+	cfg  *Config
+	errs []error
+}
+
+func (v *validator) fail(key string, format string, args ...any) {
+	v.errs = append(v.errs, &FieldError{
+		Key:     key,
+		Source:  v.cfg.sources[key],
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) port(key string, port Port) {
+	if port < 1 || port > 65535 {
+		v.fail(key, "must be between 1 and 65535, got %d", port)
+	}
+}
+
+func (v *validator) host(key string, host string) {
+	if host == "" {
+		v.fail(key, "is required")
+		return
+	}
+	if net.ParseIP(host) == nil && strings.ContainsAny(host, " /:\t") {
+		v.fail(key, "%q is neither an IP address nor a host name", host)
+	}
+}
+
+func (v *validator) oneOf(key string, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.fail(key, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+func (v *validator) required(key string, value string) {
+	if value == "" {
+		v.fail(key, "is required")
+	}
+}
+
+func (v *validator) limit(key string, limit ratelimit.Limit) {
+	if limit.PacketsPerSecond < 0 {
+		v.fail(key+".packets_per_second", "must not be negative")
+	}
+	if limit.PacketBurst < 0 {
+		v.fail(key+".packet_burst", "must not be negative")
+	}
+	if limit.BytesPerSecond < 0 {
+		v.fail(key+".bytes_per_second", "must not be negative")
+	}
+	if limit.ByteBurst < 0 {
+		v.fail(key+".byte_burst", "must not be negative")
+	}
+}
+
+func (v *validator) rateLimit(key string, rl RateLimitConfig) {
+	v.limit(key+".default", rl.Default)
+	for name, limit := range rl.PacketTypes {
+		if _, ok := protocol.ParsePacketType(name); !ok {
+			v.fail(key+".packet_types", "unknown packet type %q", name)
+			continue
+		}
+		v.limit(key+".packet_types."+name, limit)
+	}
+}
+
+// Validate checks all settings
+// It returns all problems at once, every error is a *FieldError
+func (c *Config) Validate() error {
+	v := &validator{cfg: c}
+	s := &c.Server
+
+	v.port("server.port", s.Port)
+	v.host("server.host", s.Host)
+	v.oneOf("server.env", s.Env, "", "prod", "dev")
+	v.oneOf("server.transport", s.Transport, "", "udp", "dtls")
+	if s.Shards < 1 || s.Shards > 256 {
+		v.fail("server.shards", "must be between 1 and 256, got %d", s.Shards)
+	} else if s.Shards > 1 && !shardsSupported {
+		v.fail("server.shards", "must be 1, sharding is only supported on linux, got %d", s.Shards)
+	}
+	if s.RTP.Listen != "" {
+		if _, port, err := net.SplitHostPort(s.RTP.Listen); err != nil {
+			v.fail("server.rtp.listen", "must be host:port, got %q", s.RTP.Listen)
+		} else if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			v.fail("server.rtp.listen", "port must be between 1 and 65535, got %q", port)
+		}
+	}
+	if err := protocol.ValidChannelName([]byte(s.RTP.Channel)); err != nil {
+		v.fail("server.rtp.channel", "%v", err)
+	}
+	v.required("server.recording.dir", s.Recording.Dir)
+	if s.Recording.MaxSize < 0 {
+		v.fail("server.recording.max_size", "must not be negative, got %d", s.Recording.MaxSize)
+	}
+	if s.Recording.MaxDuration < 0 {
+		v.fail("server.recording.max_duration", "must not be negative, got %s", s.Recording.MaxDuration)
+	}
+	for name, channel := range s.Channels {
+		if err := protocol.ValidChannelName([]byte(name)); err != nil {
+			v.fail("server.channels", "%q: %v", name, err)
+		}
+		if channel.Mode != "" && channel.Mode != "forward" && channel.Mode != "mix" {
+			v.fail("server.channels", "%q: mode must be forward or mix, got %q", name, channel.Mode)
+		}
+		if channel.MaxTalk < 0 {
+			v.fail("server.channels", "%q: max_talk must not be negative", name)
+		}
+		if channel.QueueSize < 0 {
+			v.fail("server.channels", "%q: queue_size must not be negative", name)
+		}
+	}
+
+	v.oneOf("server.dtls.mode", s.DTLS.Mode, "", "mtls", "psk")
+	v.required("server.dtls.path", s.DTLS.Path)
+	if s.DTLS.Mode == "psk" {
+		v.required("server.dtls.psk_file", s.DTLS.PSKFile)
+	} else {
+		v.required("server.dtls.cert", s.DTLS.Cert)
+		v.required("server.dtls.key", s.DTLS.Key)
+		v.required("server.dtls.ca", s.DTLS.CA)
+	}
+	if s.DTLS.ExpiryWarningDays < 0 {
+		v.fail("server.dtls.expiry_warning_days", "must not be negative")
+	}
+
+	v.oneOf("server.auth.mode", s.Auth.Mode, "", "none", "static", "file")
+	switch s.Auth.Mode {
+	case "static":
+		v.required("server.auth.secret", s.Auth.Secret)
+	case "file":
+		v.required("server.auth.users_file", s.Auth.UsersFile)
+	}
+
+	v.rateLimit("server.rate_limit.per_ip", s.RateLimit.PerIP)
+	v.rateLimit("server.rate_limit.per_session", s.RateLimit.PerSession)
+	ban := s.RateLimit.Ban
+	if ban.Violations < 0 {
+		v.fail("server.rate_limit.ban.violations", "must not be negative")
+	}
+	if ban.Window < 0 {
+		v.fail("server.rate_limit.ban.window", "must not be negative")
+	}
+	if ban.Duration < 0 {
+		v.fail("server.rate_limit.ban.duration", "must not be negative")
+	}
+	if ban.MaxDuration != 0 && ban.MaxDuration < ban.Duration {
+		v.fail("server.rate_limit.ban.max_duration", "must not be shorter than duration (%s), got %s", ban.Duration, ban.MaxDuration)
+	}
+
+	v.host("client.host", c.Client.Host)
+	v.port("client.port", c.Client.Port)
+	v.oneOf("client.transport", c.Client.Transport, "", "udp", "dtls")
+	if c.Client.Transport == "dtls" {
+		d := c.Client.DTLS
+		if d.PSKIdentity != "" {
+			if key, err := hex.DecodeString(d.PSKKey); err != nil || len(key) < auth.MinPSKSize {
+				v.fail("client.dtls.psk_key", "must be a hex encoded key of at least %d bytes", auth.MinPSKSize)
+			}
+		} else {
+			v.required("client.dtls.cert", d.Cert)
+			v.required("client.dtls.key", d.Key)
+			v.required("client.dtls.ca", d.CA)
+		}
+	}
+
+	v.port("web.port", c.Web.Port)
+	v.port("web.udp_port", c.Web.UDPPort)
+
+	if c.Log.Level != "" {
+		if _, err := log.ParseLevel(c.Log.Level); err != nil {
+			v.fail("log.level", "must be one of panic, fatal, error, warn, info, debug, trace, got %q", c.Log.Level)
+		}
+	}
+	return errors.Join(v.errs...)
+}
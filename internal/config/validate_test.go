@@ -0,0 +1,25 @@
+package config_test
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+
+	"github.com/aura-speak/networking/internal/config"
+)
+
+func TestValidateShards(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.Shards = 4
+	err := cfg.Validate()
+	if runtime.GOOS == "linux" {
+		if err != nil {
+			t.Fatalf("4 shards on linux: %v", err)
+		}
+		return
+	}
+	var fieldErr *config.FieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Key != "server.shards" {
+		t.Fatalf("4 shards on %s: %v, want a server.shards field error", runtime.GOOS, err)
+	}
+}
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultWatchInterval is the default interval in which the config file is checked for changes
+const DefaultWatchInterval = 2 * time.Second
+
+// liveKeys are the keys and key prefixes that are applied without a restart
+var liveKeys = []string{
+	"server.rate_limit.",
+	"server.ban_list",
+	"server.channels",
+	"log.level",
+}
+
+// IsLive reports if a key is applied to a running server without a restart
+func IsLive(key string) bool {
+	for _, live := range liveKeys {
+		if key == live || (strings.HasSuffix(live, ".") && strings.HasPrefix(key, live)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Change is the event a Watcher emits when the configuration changed
+// Err is set if the new configuration is invalid, New is nil then and Old stays active
+// Forced is set for a reload on SIGHUP, it is emitted without changed keys as well,
+// so the files the configuration points to, like the user list or the PSK keyfile, are read again
+type Change struct {
+	Old     *Config
+	New     *Config
+	Changed []string // keys with a different value
+	Forced  bool
+	Err     error
+}
+
+// RestartRequired returns the changed keys below one of the prefixes that are not applied live
+// Without prefixes all changed keys are checked
+//
+// Example:
+//
+//	if keys := change.RestartRequired("server.", "log."); len(keys) > 0 {
+//		log.Warnf("Restart the server to apply %s", strings.Join(keys, ", "))
+//	}
+func (c Change) RestartRequired(prefixes ...string) []string {
+	var keys []string
+	for _, key := range c.Changed {
+		if IsLive(key) {
+			continue
+		}
+		matches := len(prefixes) == 0
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) {
+				matches = true
+				break
+			}
+		}
+		if matches {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Diff returns the keys whose value differs between two configurations
+func Diff(a, b *Config) []string {
+	as, bs := a.settings(), b.settings()
+	var keys []string
+	for i := range as {
+		if !reflect.DeepEqual(as[i].value.Interface(), bs[i].value.Interface()) {
+			keys = append(keys, as[i].key)
+		}
+	}
+	return keys
+}
+
+// Watcher reloads the configuration when the config file changes or the process receives SIGHUP
+// Every reload is loaded with the same options as the first load, so env variables and flags keep their precedence
+// Subscribers receive a Change for every reload that changed something or failed
+type Watcher struct {
+	opts Options
+
+	mu          sync.Mutex
+	current     *Config
+	modTime     time.Time
+	subscribers []chan Change
+}
+
+// NewWatcher creates a Watcher for a configuration loaded with opts
+// If the configuration was loaded from a default path, that file is watched
+func NewWatcher(cfg *Config, opts Options) *Watcher {
+	if opts.Path == "" {
+		opts.Path = cfg.File
+	}
+	w := &Watcher{opts: opts, current: cfg}
+	w.modTime = w.fileModTime()
+	return w
+}
+
+// Current returns the active configuration
+func (w *Watcher) Current() *Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// Subscribe returns a channel that receives the config-changed events
+// Events are dropped for subscribers that do not keep up
+func (w *Watcher) Subscribe() <-chan Change {
+	ch := make(chan Change, 8)
+	w.mu.Lock()
+	w.subscribers = append(w.subscribers, ch)
+	w.mu.Unlock()
+	return ch
+}
+
+// Reload loads the configuration again and emits a Change if something changed or the new configuration is invalid
+// An invalid configuration is not activated
+func (w *Watcher) Reload() Change {
+	return w.reload(false)
+}
+
+// reload loads the configuration again, a forced reload emits the Change even if nothing changed
+func (w *Watcher) reload(forced bool) Change {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.modTime = w.fileModTime()
+	change := Change{Old: w.current, Forced: forced}
+	cfg, err := Load(w.opts)
+	if err != nil {
+		change.Err = err
+		w.emit(change)
+		return change
+	}
+	change.New = cfg
+	change.Changed = Diff(w.current, cfg)
+	if len(change.Changed) == 0 && !forced {
+		return change
+	}
+	w.current = cfg
+	w.emit(change)
+	return change
+}
+
+// emit sends the change to all subscribers
+// The caller has to hold the lock
+func (w *Watcher) emit(change Change) {
+	for _, ch := range w.subscribers {
+		select {
+		case ch <- change:
+		default:
+			log.WithField("caller", "config").Warn("Dropping config change event for a slow subscriber")
+		}
+	}
+}
+
+// fileModTime returns the modification time of the watched file, zero if there is none
+func (w *Watcher) fileModTime() time.Time {
+	if w.opts.Path == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(w.opts.Path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// Watch checks the config file for changes in the given interval and reloads on SIGHUP
+// It returns when the context is done
+func (w *Watcher) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		forced := false
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.WithField("caller", "config").Info("Received SIGHUP, reloading config")
+			forced = true
+		case <-ticker.C:
+			w.mu.Lock()
+			modTime := w.modTime
+			w.mu.Unlock()
+			if w.fileModTime().Equal(modTime) {
+				continue
+			}
+			log.WithField("caller", "config").Infof("%s changed, reloading config", w.opts.Path)
+		}
+		change := w.reload(forced)
+		if change.Err != nil {
+			log.WithField("caller", "config").WithError(change.Err).Error("Invalid config, keeping the previous one")
+		} else if len(change.Changed) > 0 {
+			log.WithField("caller", "config").Infof("Config changed: %s", strings.Join(change.Changed, ", "))
+		}
+	}
+}
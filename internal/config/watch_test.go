@@ -0,0 +1,62 @@
+package config_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/internal/config"
+)
+
+// watch loads the config file and watches it until the test ends
+func watch(t *testing.T, content string) (string, <-chan config.Change) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	opts := config.Options{Path: path}
+	cfg, err := config.Load(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := config.NewWatcher(cfg, opts)
+	changes := w.Subscribe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.Watch(ctx, 10*time.Millisecond)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return path, changes
+}
+
+func TestWatchReloadsOnChange(t *testing.T) {
+	path, changes := watch(t, "server:\n  port: 9000\n")
+	if err := os.WriteFile(path, []byte("server:\n  port: 9001\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// the file system may keep the modification time within its granularity
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case change := <-changes:
+		if change.Err != nil {
+			t.Fatal(change.Err)
+		}
+		if !slices.Contains(change.Changed, "server.port") || change.New.Server.Port != 9001 || change.Forced {
+			t.Fatalf("change of %v to port %d, forced %v", change.Changed, change.New.Server.Port, change.Forced)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change after the config file changed")
+	}
+}
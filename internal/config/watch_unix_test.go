@@ -0,0 +1,37 @@
+//go:build unix
+// +build unix
+
+package config_test
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWatchReloadsOnSIGHUP(t *testing.T) {
+	// SIGHUP terminates the process while nobody is notified, the Watcher may not listen yet
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	_, changes := watch(t, "server:\n  port: 9000\n")
+
+	deadline := time.After(5 * time.Second)
+	for {
+		if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case change := <-changes:
+			if change.Err != nil || !change.Forced || len(change.Changed) != 0 {
+				t.Fatalf("change of %v, forced %v, error %v", change.Changed, change.Forced, change.Err)
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("no change after SIGHUP")
+		}
+	}
+}
@@ -9,3 +9,17 @@ func Setup() {
 	})
 	logrus.SetLevel(logrus.DebugLevel)
 }
+
+// SetLevel sets the log level by name, e.g. "info"
+// An empty name keeps the current level
+func SetLevel(level string) error {
+	if level == "" {
+		return nil
+	}
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	logrus.SetLevel(lvl)
+	return nil
+}
@@ -0,0 +1,345 @@
+package util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+// KeyType is the type of the private key of a certificate
+type KeyType string
+
+const (
+	KeyTypeECDSAP256 KeyType = "ecdsa-p256"
+	KeyTypeECDSAP384 KeyType = "ecdsa-p384"
+	KeyTypeEd25519   KeyType = "ed25519"
+)
+
+// DefaultCAValidity is the validity of a generated CA certificate
+const DefaultCAValidity = 10 * 365 * 24 * time.Hour
+
+// DefaultCertValidity is the validity of a server or client certificate issued by the CA
+const DefaultCertValidity = 365 * 24 * time.Hour
+
+// ParseKeyType parses a key type name like "ecdsa-p256"
+// An empty name is KeyTypeECDSAP256
+func ParseKeyType(name string) (KeyType, error) {
+	switch KeyType(name) {
+	case "":
+		return KeyTypeECDSAP256, nil
+	case KeyTypeECDSAP256, KeyTypeECDSAP384, KeyTypeEd25519:
+		return KeyType(name), nil
+	}
+	return "", fmt.Errorf("unknown key type %q (ecdsa-p256, ecdsa-p384 or ed25519)", name)
+}
+
+// generateKey generates a private key of the given type
+func generateKey(keyType KeyType) (crypto.Signer, error) {
+	switch keyType {
+	case "", KeyTypeECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyTypeECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyTypeEd25519:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	}
+	return nil, fmt.Errorf("unknown key type %q", keyType)
+}
+
+// CertOptions are the options for a certificate generated by the CA
+// A zero Validity uses DefaultCAValidity for the CA and DefaultCertValidity otherwise
+type CertOptions struct {
+	CommonName  string
+	DNSNames    []string
+	IPAddresses []net.IP
+	Validity    time.Duration
+	KeyType     KeyType
+}
+
+// CA is a local certificate authority
+// It issues the server certificates and the client certificates for mTLS
+type CA struct {
+	Cert    *x509.Certificate
+	Key     crypto.Signer
+	CertPEM []byte
+}
+
+// IssuedCert is a certificate issued by the CA together with its private key in PEM format
+type IssuedCert struct {
+	Cert    *x509.Certificate
+	CertPEM []byte
+	KeyPEM  []byte
+}
+
+// GenerateCA generates a new self-signed CA
+//
+// Example:
+//
+//	ca, keyPEM, err := util.GenerateCA(util.CertOptions{CommonName: "aura-speak local CA"})
+func GenerateCA(opts CertOptions) (*CA, []byte, error) {
+	if opts.CommonName == "" {
+		opts.CommonName = "aura-speak local CA"
+	}
+	if opts.Validity == 0 {
+		opts.Validity = DefaultCAValidity
+	}
+	key, err := generateKey(opts.KeyType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate key: %w", err)
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	tpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   opts.CommonName,
+			Organization: []string{"local"},
+		},
+		NotBefore: now.Add(-1 * time.Hour),
+		NotAfter:  now.Add(opts.Validity),
+
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, key.Public(), key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create ca cert: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse ca cert: %w", err)
+	}
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &CA{
+		Cert:    cert,
+		Key:     key,
+		CertPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}, keyPEM, nil
+}
+
+// LoadCA loads the CA certificate and key from PEM files
+func LoadCA(certPath, keyPath string) (*CA, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("read ca cert: %w", err)
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%s: no certificate found", certPath)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse ca cert: %w", err)
+	}
+	if !cert.IsCA {
+		return nil, fmt.Errorf("%s is not a CA certificate", certPath)
+	}
+
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("read ca key: %w", err)
+	}
+	block, _ = pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no private key found", keyPath)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse ca key: %w", err)
+	}
+	key, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported key", keyPath)
+	}
+	return &CA{Cert: cert, Key: key, CertPEM: certPEM}, nil
+}
+
+// IssueServer issues a server certificate with the DNS names and IP addresses of opts as SANs
+// If no SAN is set the certificate is valid for localhost
+//
+// Example:
+//
+//	issued, err := ca.IssueServer(util.CertOptions{DNSNames: []string{"voice.example.com"}})
+func (ca *CA) IssueServer(opts CertOptions) (*IssuedCert, error) {
+	if len(opts.DNSNames) == 0 && len(opts.IPAddresses) == 0 {
+		opts.DNSNames = []string{"localhost"}
+		opts.IPAddresses = []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}
+	}
+	if opts.CommonName == "" {
+		if len(opts.DNSNames) > 0 {
+			opts.CommonName = opts.DNSNames[0]
+		} else {
+			opts.CommonName = opts.IPAddresses[0].String()
+		}
+	}
+	return ca.issue(opts, x509.ExtKeyUsageServerAuth)
+}
+
+// IssueClient issues a client certificate for a user
+// The user ID is the common name of the subject
+//
+// Example:
+//
+//	issued, err := ca.IssueClient("alice", util.CertOptions{Validity: 90 * 24 * time.Hour})
+func (ca *CA) IssueClient(userID string, opts CertOptions) (*IssuedCert, error) {
+	if userID == "" {
+		return nil, errors.New("user id is required")
+	}
+	opts.CommonName = userID
+	opts.DNSNames = nil
+	opts.IPAddresses = nil
+	return ca.issue(opts, x509.ExtKeyUsageClientAuth)
+}
+
+// issue creates a leaf certificate signed by the CA
+func (ca *CA) issue(opts CertOptions, usage x509.ExtKeyUsage) (*IssuedCert, error) {
+	if opts.Validity == 0 {
+		opts.Validity = DefaultCertValidity
+	}
+	key, err := generateKey(opts.KeyType)
+	if err != nil {
+		return nil, fmt.Errorf("generate key: %w", err)
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	notAfter := now.Add(opts.Validity)
+	if notAfter.After(ca.Cert.NotAfter) {
+		notAfter = ca.Cert.NotAfter
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   opts.CommonName,
+			Organization: []string{"local"},
+		},
+		NotBefore: now.Add(-1 * time.Hour),
+		NotAfter:  notAfter,
+
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{usage},
+		BasicConstraintsValid: true,
+
+		DNSNames:    opts.DNSNames,
+		IPAddresses: opts.IPAddresses,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, ca.Cert, key.Public(), ca.Key)
+	if err != nil {
+		return nil, fmt.Errorf("create cert: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("parse cert: %w", err)
+	}
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &IssuedCert{
+		Cert:    cert,
+		CertPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		KeyPEM:  keyPEM,
+	}, nil
+}
+
+// newSerial returns a random 128 bit serial number
+func newSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("serial: %w", err)
+	}
+	return serial, nil
+}
+
+// encodeKey PEM encodes a private key (PKCS#8)
+func encodeKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("marshal key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// DefaultCRLValidity is the time until the next update of a CRL written by the CA
+const DefaultCRLValidity = 30 * 24 * time.Hour
+
+// Revoke adds the serial numbers to the CRL at crlPath and writes it signed by the CA
+// An existing CRL is extended, its entries are kept
+//
+// Example:
+//
+//	err := ca.Revoke("certs/ca.crl", cert.SerialNumber)
+func (ca *CA) Revoke(crlPath string, serials ...*big.Int) error {
+	now := time.Now()
+	tpl := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: now,
+		NextUpdate: now.Add(DefaultCRLValidity),
+	}
+	if FileExists(crlPath) {
+		data, err := os.ReadFile(crlPath)
+		if err != nil {
+			return fmt.Errorf("read crl: %w", err)
+		}
+		if block, _ := pem.Decode(data); block != nil {
+			data = block.Bytes
+		}
+		crl, err := x509.ParseRevocationList(data)
+		if err != nil {
+			return fmt.Errorf("parse crl: %w", err)
+		}
+		if err := crl.CheckSignatureFrom(ca.Cert); err != nil {
+			return fmt.Errorf("%s is not signed by the ca: %w", crlPath, err)
+		}
+		tpl.RevokedCertificateEntries = crl.RevokedCertificateEntries
+		tpl.Number = new(big.Int).Add(crl.Number, big.NewInt(1))
+	}
+	for _, serial := range serials {
+		revoked := false
+		for _, entry := range tpl.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(serial) == 0 {
+				revoked = true
+				break
+			}
+		}
+		if !revoked {
+			tpl.RevokedCertificateEntries = append(tpl.RevokedCertificateEntries, x509.RevocationListEntry{
+				SerialNumber:   serial,
+				RevocationTime: now,
+			})
+		}
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, tpl, ca.Cert, ca.Key)
+	if err != nil {
+		return fmt.Errorf("create crl: %w", err)
+	}
+	if err := os.WriteFile(crlPath, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0o644); err != nil {
+		return fmt.Errorf("write crl: %w", err)
+	}
+	return nil
+}
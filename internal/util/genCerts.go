@@ -1,87 +1,16 @@
 package util
 
 import (
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
-	"crypto/tls"
-	"crypto/x509"
-	"crypto/x509/pkix"
-	"encoding/pem"
 	"fmt"
-	"math/big"
 	"net"
 	"os"
 	"path/filepath"
-	"time"
 
 	"github.com/aura-speak/networking/internal/config"
 )
 
-func generateSelfSigned() (tls.Certificate, *x509.Certificate, []byte, []byte, error) {
-	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	if err != nil {
-		return tls.Certificate{}, nil, nil, nil, fmt.Errorf("generate key: %w", err)
-	}
-
-	serialLimit := new(big.Int).Lsh(big.NewInt(1), 128)
-	serial, err := rand.Int(rand.Reader, serialLimit)
-	if err != nil {
-		return tls.Certificate{}, nil, nil, nil, fmt.Errorf("serial: %w", err)
-	}
-
-	now := time.Now()
-	tpl := x509.Certificate{
-		SerialNumber: serial,
-		Subject: pkix.Name{
-			CommonName:   "dev-dtls",
-			Organization: []string{"local"},
-		},
-		NotBefore: now.Add(-1 * time.Hour),
-		NotAfter:  now.Add(365 * 24 * time.Hour),
-
-		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
-		BasicConstraintsValid: true,
-		IsCA:                  true, // dev convenience
-
-		DNSNames: []string{"localhost"},
-		IPAddresses: []net.IP{
-			net.ParseIP("127.0.0.1"),
-			net.ParseIP("::1"),
-		},
-	}
-
-	der, err := x509.CreateCertificate(rand.Reader, &tpl, &tpl, &priv.PublicKey, priv)
-	if err != nil {
-		return tls.Certificate{}, nil, nil, nil, fmt.Errorf("create cert: %w", err)
-	}
-
-	leaf, err := x509.ParseCertificate(der)
-	if err != nil {
-		return tls.Certificate{}, nil, nil, nil, fmt.Errorf("parse cert: %w", err)
-	}
-
-	// PEM encode cert
-	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
-
-	// PEM encode key (PKCS#8)
-	keyBytes, err := x509.MarshalPKCS8PrivateKey(priv)
-	if err != nil {
-		return tls.Certificate{}, nil, nil, nil, fmt.Errorf("marshal key: %w", err)
-	}
-	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes})
-
-	tlsCert, err := tls.X509KeyPair(certPEM, keyPEM)
-	if err != nil {
-		return tls.Certificate{}, nil, nil, nil, fmt.Errorf("x509 key pair: %w", err)
-	}
-	tlsCert.Leaf = leaf
-
-	return tlsCert, leaf, certPEM, keyPEM, nil
-}
-
-func writePEMFiles(certPath, keyPath string, certPEM, keyPEM []byte) error {
+// WritePEMFiles writes a certificate and its key, the key is only readable by the owner
+func WritePEMFiles(certPath, keyPath string, certPEM, keyPEM []byte) error {
 	if err := os.MkdirAll(filepath.Dir(certPath), 0o755); err != nil {
 		return fmt.Errorf("mkdir cert dir: %w", err)
 	}
@@ -102,41 +31,69 @@ func writePEMFiles(certPath, keyPath string, certPEM, keyPEM []byte) error {
 	return nil
 }
 
-// GenerateCertificates generates self-signed certificates based on config and writes them to file
+// GenerateCertificates generates the local CA and a server certificate signed by it based on config and writes them to file
+// An existing CA is reused, so client certificates issued with the certs command stay valid
+// Nothing is generated if the CA, the CA key, the server certificate and the server key already exist
 func GenerateCertificates(cfg *config.ServerConfig) error {
 	certPath := filepath.Join(cfg.Server.DTLS.Path, cfg.Server.DTLS.Cert)
 	keyPath := filepath.Join(cfg.Server.DTLS.Path, cfg.Server.DTLS.Key)
 	caPath := filepath.Join(cfg.Server.DTLS.Path, cfg.Server.DTLS.CA)
+	caKeyPath := CAKeyPath(cfg)
 
-	// Check if certs already exist
-	if _, errCert := os.Stat(certPath); errCert == nil {
-		if _, errKey := os.Stat(keyPath); errKey == nil {
-			if _, errCA := os.Stat(caPath); errCA == nil {
-				// All files exist, skip generation
-				return nil
-			}
-		}
+	if FileExists(certPath) && FileExists(keyPath) && FileExists(caPath) && FileExists(caKeyPath) {
+		// All files exist, skip generation
+		return nil
 	}
 
-	// Generate self-signed certificate
-	_, _, certPEM, keyPEM, err := generateSelfSigned()
+	ca, err := LoadOrCreateCA(caPath, caKeyPath, CertOptions{})
 	if err != nil {
-		return fmt.Errorf("generate self-signed cert: %w", err)
+		return err
 	}
 
-	// Write PEM files to the configured paths
-	// For self-signed, the CA certificate is the same as the server certificate
-	if err := writePEMFiles(certPath, keyPath, certPEM, keyPEM); err != nil {
+	opts := CertOptions{
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+	}
+	if host := cfg.Server.Host; host != "" {
+		if ip := net.ParseIP(host); ip == nil {
+			opts.DNSNames = append(opts.DNSNames, host)
+		} else if !ip.IsUnspecified() && !ip.IsLoopback() {
+			opts.IPAddresses = append(opts.IPAddresses, ip)
+		}
+	}
+	issued, err := ca.IssueServer(opts)
+	if err != nil {
+		return fmt.Errorf("issue server cert: %w", err)
+	}
+	if err := WritePEMFiles(certPath, keyPath, issued.CertPEM, issued.KeyPEM); err != nil {
 		return fmt.Errorf("write pem files: %w", err)
 	}
+	return nil
+}
 
-	// Write CA certificate (same as cert for self-signed)
-	if err := os.MkdirAll(filepath.Dir(caPath), 0o755); err != nil {
-		return fmt.Errorf("mkdir ca dir: %w", err)
+// LoadOrCreateCA loads the CA from the given files
+// If the CA certificate or key does not exist a new CA is generated and written to them
+// A CA certificate without its key (e.g. the self-signed server certificate of older versions) is replaced
+func LoadOrCreateCA(caPath, caKeyPath string, opts CertOptions) (*CA, error) {
+	if FileExists(caPath) && FileExists(caKeyPath) {
+		return LoadCA(caPath, caKeyPath)
 	}
-	if err := os.WriteFile(caPath, certPEM, 0o644); err != nil {
-		return fmt.Errorf("write ca: %w", err)
+	ca, keyPEM, err := GenerateCA(opts)
+	if err != nil {
+		return nil, fmt.Errorf("generate ca: %w", err)
 	}
+	if err := WritePEMFiles(caPath, caKeyPath, ca.CertPEM, keyPEM); err != nil {
+		return nil, fmt.Errorf("write ca: %w", err)
+	}
+	return ca, nil
+}
 
-	return nil
+// CAKeyPath returns the path of the CA key from config
+// Configs written before the CA key was configurable use "ca.key"
+func CAKeyPath(cfg *config.ServerConfig) string {
+	name := cfg.Server.DTLS.CAKey
+	if name == "" {
+		name = "ca.key"
+	}
+	return filepath.Join(cfg.Server.DTLS.Path, name)
 }
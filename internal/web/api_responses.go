@@ -4,6 +4,12 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/aura-speak/networking/pkg/banlist"
+	"github.com/aura-speak/networking/pkg/certs"
+	"github.com/aura-speak/networking/pkg/netem"
+	"github.com/aura-speak/networking/pkg/recorder"
+	"github.com/aura-speak/networking/pkg/report"
+	"github.com/aura-speak/networking/pkg/simnet"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -57,6 +63,91 @@ func (s *ServerStateResponse) Send(w http.ResponseWriter) {
 	w.Write([]byte("\n"))
 }
 
+type ServerStatsResponse struct {
+	Remotes map[string]report.Stats `json:"remotes"`
+	// Errors counts the packets the handlers refused by error code
+	Errors map[string]uint64 `json:"errors"`
+}
+
+func (s *ServerStatsResponse) Send(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+	b, err := json.Marshal(s)
+	if err != nil {
+		log.WithField("caller", "web").WithError(err).Error("Can't marshal ServerStatsResponse to json")
+	}
+	w.Write(b)
+	w.Write([]byte("\n"))
+}
+
+type UDPClientStatsResponse struct {
+	Id    int          `json:"id"`
+	Stats report.Stats `json:"stats"`
+}
+
+func (s *UDPClientStatsResponse) Send(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+	b, err := json.Marshal(s)
+	if err != nil {
+		log.WithField("caller", "web").WithError(err).Error("Can't marshal UDPClientStatsResponse to json")
+	}
+	w.Write(b)
+	w.Write([]byte("\n"))
+}
+
+type BanListResponse struct {
+	Bans []banlist.Entry `json:"bans"`
+}
+
+func (b *BanListResponse) Send(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+	bb, err := json.Marshal(b)
+	if err != nil {
+		log.WithField("caller", "web").WithError(err).Error("Can't marshal BanListResponse to json")
+	}
+	w.Write(bb)
+	w.Write([]byte("\n"))
+}
+
+type BanRequest struct {
+	IP       string `json:"ip"`
+	UserId   string `json:"userId"`
+	Reason   string `json:"reason"`
+	Duration string `json:"duration"` // e.g. "1h", permanent if empty
+}
+
+type RecordingsResponse struct {
+	Recordings []string `json:"recordings"`
+}
+
+func (r *RecordingsResponse) Send(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+	bb, err := json.Marshal(r)
+	if err != nil {
+		log.WithField("caller", "web").WithError(err).Error("Can't marshal RecordingsResponse to json")
+	}
+	w.Write(bb)
+	w.Write([]byte("\n"))
+}
+
+type RecordingRequest struct {
+	Channel string `json:"channel"`
+	Session string `json:"session"` // remote address of the client
+}
+
+type RecordingResponse struct {
+	Sidecar recorder.Sidecar `json:"sidecar"`
+}
+
+func (r *RecordingResponse) Send(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+	bb, err := json.Marshal(r)
+	if err != nil {
+		log.WithField("caller", "web").WithError(err).Error("Can't marshal RecordingResponse to json")
+	}
+	w.Write(bb)
+	w.Write([]byte("\n"))
+}
+
 type UDPClientResponse struct {
 	Name string `json:"name"`
 	Id   int    `json:"id"`
@@ -158,3 +249,45 @@ func (m *MermaidResponse) Send(w http.ResponseWriter) {
 	w.Write(b)
 	w.Write([]byte("\n"))
 }
+
+type CertStatusResponse struct {
+	certs.Status
+}
+
+func (c *CertStatusResponse) Send(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+	b, err := json.Marshal(c)
+	if err != nil {
+		log.WithField("caller", "web").WithError(err).Error("Can't marshal CertStatusResponse to json")
+	}
+	w.Write(b)
+	w.Write([]byte("\n"))
+}
+
+type NetemStatusResponse struct {
+	netem.Status
+}
+
+func (n *NetemStatusResponse) Send(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+	b, err := json.Marshal(n)
+	if err != nil {
+		log.WithField("caller", "web").WithError(err).Error("Can't marshal NetemStatusResponse to json")
+	}
+	w.Write(b)
+	w.Write([]byte("\n"))
+}
+
+type NetemPresetsResponse struct {
+	Presets map[string]simnet.Profile `json:"presets"`
+}
+
+func (n *NetemPresetsResponse) Send(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+	b, err := json.Marshal(n)
+	if err != nil {
+		log.WithField("caller", "web").WithError(err).Error("Can't marshal NetemPresetsResponse to json")
+	}
+	w.Write(b)
+	w.Write([]byte("\n"))
+}
@@ -0,0 +1,139 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/banlist"
+	"github.com/aura-speak/networking/pkg/server"
+)
+
+// runningUDPServer returns the UDP server or sends an error if it is not started
+func (s *Server) runningUDPServer(w http.ResponseWriter) *server.Server {
+	s.mu.Lock()
+	udpServer := s.udpServer
+	s.mu.Unlock()
+	if udpServer == nil {
+		apiError := ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "UDP server is not running",
+		}
+		apiError.Send(w)
+	}
+	return udpServer
+}
+
+func (s *Server) getBans(w http.ResponseWriter, r *http.Request) {
+	udpServer := s.runningUDPServer(w)
+	if udpServer == nil {
+		return
+	}
+	banListResponse := BanListResponse{
+		Bans: udpServer.Bans(),
+	}
+	banListResponse.Send(w)
+}
+
+func (s *Server) addBan(w http.ResponseWriter, r *http.Request) {
+	var req BanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError := ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request body",
+			Details: err.Error(),
+		}
+		apiError.Send(w)
+		return
+	}
+	if (req.IP == "") == (req.UserId == "") {
+		apiError := ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Either ip or userId is required",
+		}
+		apiError.Send(w)
+		return
+	}
+	var duration time.Duration
+	if req.Duration != "" {
+		var err error
+		duration, err = time.ParseDuration(req.Duration)
+		if err != nil || duration < 0 {
+			apiError := ApiError{
+				Code:    http.StatusBadRequest,
+				Message: "Duration must be a positive duration like 1h",
+			}
+			apiError.Send(w)
+			return
+		}
+	}
+
+	udpServer := s.runningUDPServer(w)
+	if udpServer == nil {
+		return
+	}
+	var entry banlist.Entry
+	var err error
+	if req.IP != "" {
+		entry, err = udpServer.BanIP(req.IP, req.Reason, duration)
+	} else {
+		entry, err = udpServer.BanUser(req.UserId, req.Reason, duration)
+	}
+	if err != nil {
+		apiError := ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Failed to ban",
+			Details: err.Error(),
+		}
+		apiError.Send(w)
+		return
+	}
+	target := entry.IP
+	if target == "" {
+		target = entry.UserID
+	}
+	apiSuccess := ApiSuccess{
+		Message: "Banned",
+		Details: target,
+	}
+	apiSuccess.Send(w)
+}
+
+func (s *Server) removeBan(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		apiError := ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Target is required",
+		}
+		apiError.Send(w)
+		return
+	}
+	udpServer := s.runningUDPServer(w)
+	if udpServer == nil {
+		return
+	}
+	removed, err := udpServer.Unban(target)
+	if err != nil {
+		apiError := ApiError{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to unban",
+			Details: err.Error(),
+		}
+		apiError.Send(w)
+		return
+	}
+	if !removed {
+		apiError := ApiError{
+			Code:    http.StatusNotFound,
+			Message: "Ban not found",
+		}
+		apiError.Send(w)
+		return
+	}
+	apiSuccess := ApiSuccess{
+		Message: "Unbanned",
+		Details: target,
+	}
+	apiSuccess.Send(w)
+}
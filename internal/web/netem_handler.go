@@ -0,0 +1,178 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/aura-speak/networking/pkg/netem"
+	"github.com/aura-speak/networking/pkg/simnet"
+	log "github.com/sirupsen/logrus"
+)
+
+// NetemStartRequest starts the impairment proxy in front of the UDP server
+// Listen is 127.0.0.1 with the port after the UDP port if empty
+type NetemStartRequest struct {
+	Listen string `json:"listen,omitempty"`
+	Preset string `json:"preset,omitempty"`
+}
+
+// startNetem starts the impairment proxy, clients started afterwards connect through it
+func (s *Server) startNetem(w http.ResponseWriter, r *http.Request) {
+	var req NetemStartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		apiError := ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request body",
+			Details: err.Error(),
+		}
+		apiError.Send(w)
+		return
+	}
+	if req.Listen == "" {
+		req.Listen = "127.0.0.1:" + strconv.Itoa(s.config.UDPPort+1)
+	}
+	var profile simnet.Profile
+	if req.Preset != "" {
+		var ok bool
+		if profile, ok = netem.Presets[req.Preset]; !ok {
+			apiError := ApiError{
+				Code:    http.StatusBadRequest,
+				Message: "Unknown preset",
+				Details: req.Preset,
+			}
+			apiError.Send(w)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.netemProxy != nil {
+		apiError := ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Netem proxy is already running",
+		}
+		apiError.Send(w)
+		return
+	}
+	proxy, err := netem.NewProxy(netem.Options{
+		Listen:   req.Listen,
+		Upstream: "127.0.0.1:" + strconv.Itoa(s.config.UDPPort),
+		Up:       profile,
+		Down:     profile,
+	})
+	if err != nil {
+		apiError := ApiError{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to start netem proxy",
+			Details: err.Error(),
+		}
+		apiError.Send(w)
+		return
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.netemProxy = proxy
+	s.netemCancel = cancel
+	s.shutdownWg.Go(func() {
+		if err := proxy.Run(ctx); err != nil {
+			log.WithField("caller", "web").WithError(err).Error("Netem proxy stopped")
+		}
+	})
+
+	netemStatusResponse := NetemStatusResponse{Status: proxy.Status()}
+	netemStatusResponse.Send(w)
+}
+
+// stopNetem stops the impairment proxy
+func (s *Server) stopNetem(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.netemProxy == nil {
+		apiError := ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Netem proxy is not running",
+		}
+		apiError.Send(w)
+		return
+	}
+	s.netemCancel()
+	s.netemProxy.Close()
+	s.netemProxy = nil
+	s.netemCancel = nil
+
+	apiSuccess := ApiSuccess{
+		Message: "Netem proxy stopped",
+	}
+	apiSuccess.Send(w)
+}
+
+// runningNetem returns the impairment proxy or sends an error if it is not started
+func (s *Server) runningNetem(w http.ResponseWriter) *netem.Proxy {
+	s.mu.Lock()
+	proxy := s.netemProxy
+	s.mu.Unlock()
+	if proxy == nil {
+		apiError := ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Netem proxy is not running",
+		}
+		apiError.Send(w)
+	}
+	return proxy
+}
+
+func (s *Server) getNetem(w http.ResponseWriter, r *http.Request) {
+	proxy := s.runningNetem(w)
+	if proxy == nil {
+		return
+	}
+	netemStatusResponse := NetemStatusResponse{Status: proxy.Status()}
+	netemStatusResponse.Send(w)
+}
+
+// setNetemProfile changes the profiles of the impairment proxy with a netem.ProfileRequest
+func (s *Server) setNetemProfile(w http.ResponseWriter, r *http.Request) {
+	var req netem.ProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError := ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request body",
+			Details: err.Error(),
+		}
+		apiError.Send(w)
+		return
+	}
+	proxy := s.runningNetem(w)
+	if proxy == nil {
+		return
+	}
+	if err := req.Apply(proxy); err != nil {
+		apiError := ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Failed to change profile",
+			Details: err.Error(),
+		}
+		apiError.Send(w)
+		return
+	}
+	netemStatusResponse := NetemStatusResponse{Status: proxy.Status()}
+	netemStatusResponse.Send(w)
+}
+
+func (s *Server) getNetemPresets(w http.ResponseWriter, r *http.Request) {
+	netemPresetsResponse := NetemPresetsResponse{Presets: netem.Presets}
+	netemPresetsResponse.Send(w)
+}
+
+// udpClientPort returns the port new clients connect to, the proxy if it runs
+// The caller has to hold the lock
+func (s *Server) udpClientPort() int {
+	if s.netemProxy != nil {
+		return s.netemProxy.Addr().Port
+	}
+	return s.config.UDPPort
+}
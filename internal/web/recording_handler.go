@@ -0,0 +1,92 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func (s *Server) getRecordings(w http.ResponseWriter, r *http.Request) {
+	udpServer := s.runningUDPServer(w)
+	if udpServer == nil {
+		return
+	}
+	recordingsResponse := RecordingsResponse{
+		Recordings: udpServer.Recordings(),
+	}
+	recordingsResponse.Send(w)
+}
+
+func (s *Server) startRecording(w http.ResponseWriter, r *http.Request) {
+	var req RecordingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError := ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid request body",
+			Details: err.Error(),
+		}
+		apiError.Send(w)
+		return
+	}
+	if (req.Channel == "") == (req.Session == "") {
+		apiError := ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Either channel or session is required",
+		}
+		apiError.Send(w)
+		return
+	}
+	udpServer := s.runningUDPServer(w)
+	if udpServer == nil {
+		return
+	}
+	var err error
+	name := "channel:" + req.Channel
+	if req.Channel != "" {
+		err = udpServer.RecordChannel(req.Channel)
+	} else {
+		name = "session:" + req.Session
+		err = udpServer.RecordSession(req.Session)
+	}
+	if err != nil {
+		apiError := ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Failed to start recording",
+			Details: err.Error(),
+		}
+		apiError.Send(w)
+		return
+	}
+	apiSuccess := ApiSuccess{
+		Message: "Recording",
+		Details: name,
+	}
+	apiSuccess.Send(w)
+}
+
+func (s *Server) stopRecording(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		apiError := ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Name is required",
+		}
+		apiError.Send(w)
+		return
+	}
+	udpServer := s.runningUDPServer(w)
+	if udpServer == nil {
+		return
+	}
+	sidecar, err := udpServer.StopRecording(name)
+	if err != nil {
+		apiError := ApiError{
+			Code:    http.StatusNotFound,
+			Message: "Failed to stop recording",
+			Details: err.Error(),
+		}
+		apiError.Send(w)
+		return
+	}
+	recordingResponse := RecordingResponse{Sidecar: sidecar}
+	recordingResponse.Send(w)
+}
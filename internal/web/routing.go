@@ -15,6 +15,14 @@ func (s *Server) registerRoutes() http.Handler {
 	mux.HandleFunc("POST /api/server/start", s.startUDPServer)
 	mux.HandleFunc("POST /api/server/stop", s.stopUDPServer)
 	mux.HandleFunc("GET /api/server/get", s.getUDPServerState)
+	mux.HandleFunc("GET /api/server/stats", s.getUDPServerStats)
+	mux.HandleFunc("GET /api/server/bans", s.getBans)
+	mux.HandleFunc("POST /api/server/bans", s.addBan)
+	mux.HandleFunc("DELETE /api/server/bans", s.removeBan)
+	mux.HandleFunc("GET /api/server/certs", s.getCertStatus)
+	mux.HandleFunc("GET /api/server/recordings", s.getRecordings)
+	mux.HandleFunc("POST /api/server/recordings", s.startRecording)
+	mux.HandleFunc("DELETE /api/server/recordings", s.stopRecording)
 
 	mux.HandleFunc("POST /api/client/start", s.startUDPClient)
 	mux.HandleFunc("POST /api/client/stop", s.stopUDPClient)
@@ -22,6 +30,14 @@ func (s *Server) registerRoutes() http.Handler {
 	mux.HandleFunc("GET /api/client/get/name", s.getUDPClientStateByName)
 	mux.HandleFunc("GET /api/client/get/id", s.getUDPClientStateById)
 	mux.HandleFunc("GET /api/client/get/all", s.getAllUDPClients)
+	mux.HandleFunc("GET /api/client/stats", s.getUDPClientStats)
+
+	// Netem proxy handlers
+	mux.HandleFunc("POST /api/netem/start", s.startNetem)
+	mux.HandleFunc("POST /api/netem/stop", s.stopNetem)
+	mux.HandleFunc("GET /api/netem/get", s.getNetem)
+	mux.HandleFunc("PUT /api/netem/profile", s.setNetemProfile)
+	mux.HandleFunc("GET /api/netem/presets", s.getNetemPresets)
 
 	// Trace handlers
 	mux.HandleFunc("GET /api/traces/all", s.getTraces)
@@ -10,6 +10,7 @@ import (
 
 	"github.com/aura-speak/networking/internal/config"
 	"github.com/aura-speak/networking/pkg/client"
+	"github.com/aura-speak/networking/pkg/netem"
 	"github.com/aura-speak/networking/pkg/server"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/net/websocket"
@@ -44,6 +45,10 @@ type Server struct {
 	// Client command channels mapped by client ID
 	clientCommandChs map[int]chan client.InternalCommand
 
+	// Impairment proxy between the UDP clients and the UDP server
+	netemProxy  *netem.Proxy
+	netemCancel context.CancelFunc
+
 	// Traces
 	traces  []server.TraceEvent
 	traceMu sync.Mutex
@@ -18,7 +18,7 @@ import (
 func (s *Server) startUDPClient(w http.ResponseWriter, r *http.Request) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	name := s.genUDPClient(s.config.UDPPort)
+	name := s.genUDPClient(s.udpClientPort())
 	s.udpClients[name].client.OnPacket(protocol.PacketTypeDebugAny, func(packet *protocol.Packet) error {
 		return s.handleAllClient(name, packet.Payload)
 	})
@@ -128,6 +128,34 @@ func (s *Server) getUDPClientStateById(w http.ResponseWriter, r *http.Request) {
 	apiError.Send(w)
 }
 
+func (s *Server) getUDPClientStats(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		apiError := ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "Name is required",
+		}
+		apiError.Send(w)
+		return
+	}
+	s.mu.Lock()
+	udpClient, ok := s.udpClients[name]
+	s.mu.Unlock()
+	if !ok {
+		apiError := ApiError{
+			Code:    http.StatusNotFound,
+			Message: "UDP client not found",
+		}
+		apiError.Send(w)
+		return
+	}
+	statsResponse := UDPClientStatsResponse{
+		Id:    udpClient.id,
+		Stats: udpClient.client.Stats(),
+	}
+	statsResponse.Send(w)
+}
+
 func (s *Server) getAllUDPClients(w http.ResponseWriter, r *http.Request) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
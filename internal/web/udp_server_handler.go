@@ -74,3 +74,45 @@ func (s *Server) getUDPServerState(w http.ResponseWriter, r *http.Request) {
 	}
 	serverStateResponse.Send(w)
 }
+
+func (s *Server) getUDPServerStats(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	udpServer := s.udpServer
+	s.mu.Unlock()
+
+	if udpServer == nil {
+		apiError := ApiError{
+			Code:    http.StatusBadRequest,
+			Message: "UDP server is not running",
+		}
+		apiError.Send(w)
+		return
+	}
+
+	statsResponse := ServerStatsResponse{
+		Remotes: udpServer.Stats(),
+		Errors:  make(map[string]uint64),
+	}
+	for code, n := range udpServer.HandlerErrors() {
+		statsResponse.Errors[code.String()] = n
+	}
+	statsResponse.Send(w)
+}
+
+func (s *Server) getCertStatus(w http.ResponseWriter, r *http.Request) {
+	udpServer := s.runningUDPServer(w)
+	if udpServer == nil {
+		return
+	}
+	status, ok := udpServer.CertStatus()
+	if !ok {
+		apiError := ApiError{
+			Code:    http.StatusServiceUnavailable,
+			Message: "Certificates are not loaded",
+		}
+		apiError.Send(w)
+		return
+	}
+	certStatusResponse := CertStatusResponse{Status: status}
+	certStatusResponse.Send(w)
+}
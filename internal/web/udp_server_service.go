@@ -1,6 +1,8 @@
 package web
 
 import (
+	"bytes"
+
 	"github.com/aura-speak/networking/pkg/protocol"
 	log "github.com/sirupsen/logrus"
 )
@@ -8,6 +10,8 @@ import (
 // handleAll handles all incoming packets from UDP server
 func (s *Server) handleAll(clientAddr string, packet []byte) error {
 	log.WithField("caller", "web").Infof("Received packet: %s", string(packet))
+	// the websocket writes are asynchronous, the Server reuses the payload once the handler returns
+	packet = bytes.Clone(packet)
 	s.mu.Lock()
 	if s.udpServer != nil {
 		s.udpServer.Broadcast(&protocol.Packet{
@@ -0,0 +1,52 @@
+// Package Auth contains the authentication for the Server
+// It is responsible for validating the credential a client sends in the connect handshake
+// The implementation is based on HMAC signed tokens
+// It ships a static secret and a file backed Authenticator
+// Add a custom Authenticator to the Server to plug in other credential stores
+package auth
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// Errors returned by the Authenticators
+// The Server maps them to reject reasons of the connect handshake
+var (
+	ErrMissingCredential = errors.New("missing credential")
+	ErrMalformedToken    = errors.New("malformed token")
+	ErrInvalidSignature  = errors.New("invalid token signature")
+	ErrTokenExpired      = errors.New("token expired")
+	ErrUnknownUser       = errors.New("unknown user")
+	ErrUserDisabled      = errors.New("user disabled")
+)
+
+// Identity is the authenticated identity of a client
+// It contains the user ID, the role, the scopes granted to the user and the expiry of the credential
+type Identity struct {
+	UserID    string    `json:"userId"`
+	Role      Role      `json:"role"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// HasScope checks if the identity was granted the given scope
+func (i *Identity) HasScope(scope string) bool {
+	return slices.Contains(i.Scopes, scope)
+}
+
+// RoleOf returns the role of an identity
+// A nil identity is a guest
+func RoleOf(i *Identity) Role {
+	if i == nil {
+		return RoleGuest
+	}
+	return i.Role
+}
+
+// Authenticator validates the credential of a connect handshake
+// It returns the identity of the client or one of the errors above
+type Authenticator interface {
+	Authenticate(credential []byte) (*Identity, error)
+}
@@ -0,0 +1,65 @@
+package auth_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/auth"
+	"github.com/aura-speak/networking/pkg/clock"
+)
+
+// start is the time of the fake clocks, far from the real time so a real clock would fail the tests
+var start = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func token(t *testing.T, secret string, expiresAt time.Time) []byte {
+	t.Helper()
+	token, err := auth.NewToken([]byte(secret), auth.Claims{UserID: "alice", ExpiresAt: expiresAt.Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []byte(token)
+}
+
+func TestStaticSecretExpiresOnClock(t *testing.T) {
+	fake := clock.NewFake(start)
+	a := auth.NewStaticSecretAuthenticator([]byte("secret"))
+	a.SetClock(fake)
+	credential := token(t, "secret", start.Add(time.Minute))
+
+	if _, err := a.Authenticate(credential); err != nil {
+		t.Fatal(err)
+	}
+	fake.Advance(time.Minute)
+	if _, err := a.Authenticate(credential); !errors.Is(err, auth.ErrTokenExpired) {
+		t.Fatalf("expired token: %v", err)
+	}
+}
+
+func TestFileAuthenticatorExpiresOnClock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.yml")
+	if err := os.WriteFile(path, []byte("users:\n  - id: alice\n    secret: alice-secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	a, err := auth.NewFileAuthenticator(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := clock.NewFake(start)
+	a.SetClock(fake)
+	credential := token(t, "alice-secret", start.Add(time.Minute))
+
+	identity, err := a.Authenticate(credential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.UserID != "alice" {
+		t.Fatalf("identity of %q", identity.UserID)
+	}
+	fake.Advance(time.Minute)
+	if _, err := a.Authenticate(credential); !errors.Is(err, auth.ErrTokenExpired) {
+		t.Fatalf("expired token: %v", err)
+	}
+}
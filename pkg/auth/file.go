@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/aura-speak/networking/pkg/clock"
+	"gopkg.in/yaml.v2"
+)
+
+// User is an entry of the user list file
+// Every user signs its tokens with its own secret
+// Role overrides the role claimed by the token, if empty the token role is taken
+// Scopes limits the scopes a token of the user may carry, if empty the token scopes are taken as they are
+type User struct {
+	ID       string   `yaml:"id"`
+	Secret   string   `yaml:"secret"`
+	Role     string   `yaml:"role"`
+	Scopes   []string `yaml:"scopes"`
+	Disabled bool     `yaml:"disabled"`
+}
+
+// UserList is the content of the user list file
+type UserList struct {
+	Users []User `yaml:"users"`
+}
+
+// FileAuthenticator validates tokens against a user list stored in a yaml file
+// It looks up the user of the token and verifies the token with the secret of that user
+//
+// Example users.yml:
+//
+//	users:
+//	  - id: alice
+//	    secret: "change-me"
+//	    role: moderator
+//	    scopes: [speak, listen]
+//	  - id: bot
+//	    secret: "other-secret"
+//	    disabled: true
+type FileAuthenticator struct {
+	path  string
+	mu    sync.RWMutex
+	users map[string]User
+	clock clock.Clock
+}
+
+// NewFileAuthenticator creates a new FileAuthenticator and loads the user list from path
+func NewFileAuthenticator(path string) (*FileAuthenticator, error) {
+	a := &FileAuthenticator{path: path, clock: clock.Real}
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// SetClock replaces the Clock the expiry of the tokens is checked on
+func (a *FileAuthenticator) SetClock(clk clock.Clock) {
+	a.mu.Lock()
+	a.clock = clk
+	a.mu.Unlock()
+}
+
+// Reload reads the user list file again
+// On error the previously loaded users are kept
+func (a *FileAuthenticator) Reload() error {
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		return fmt.Errorf("read user list: %w", err)
+	}
+	var list UserList
+	if err := yaml.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("decode user list: %w", err)
+	}
+	users := make(map[string]User, len(list.Users))
+	for i, user := range list.Users {
+		if user.ID == "" {
+			return fmt.Errorf("user list: users[%d]: id is required", i)
+		}
+		if user.Secret == "" {
+			return fmt.Errorf("user list: users[%d] (%s): secret is required", i, user.ID)
+		}
+		if _, ok := ParseRole(user.Role); user.Role != "" && !ok {
+			return fmt.Errorf("user list: users[%d] (%s): unknown role %q", i, user.ID, user.Role)
+		}
+		users[user.ID] = user
+	}
+	a.mu.Lock()
+	a.users = users
+	a.mu.Unlock()
+	return nil
+}
+
+// Authenticate validates the token with the secret of its user and returns the identity
+func (a *FileAuthenticator) Authenticate(credential []byte) (*Identity, error) {
+	claims, _, _, err := parseToken(credential)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.RLock()
+	user, ok := a.users[claims.UserID]
+	clk := a.clock
+	a.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownUser
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+	claims, err = VerifyToken(credential, []byte(user.Secret), clk.Now())
+	if err != nil {
+		return nil, err
+	}
+	identity := claims.Identity()
+	if role, ok := ParseRole(user.Role); ok {
+		identity.Role = role
+	}
+	if len(user.Scopes) > 0 {
+		identity.Scopes = slices.DeleteFunc(identity.Scopes, func(scope string) bool {
+			return !slices.Contains(user.Scopes, scope)
+		})
+	}
+	return identity, nil
+}
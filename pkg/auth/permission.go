@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"strings"
+	"sync"
+)
+
+// Role is the role of an identity
+type Role string
+
+const (
+	RoleAdmin     Role = "admin"
+	RoleModerator Role = "moderator"
+	RoleMember    Role = "member"
+	RoleGuest     Role = "guest"
+)
+
+// ParseRole parses a role name
+// Unknown or empty names return false
+func ParseRole(name string) (Role, bool) {
+	switch Role(strings.ToLower(name)) {
+	case RoleAdmin:
+		return RoleAdmin, true
+	case RoleModerator:
+		return RoleModerator, true
+	case RoleMember:
+		return RoleMember, true
+	case RoleGuest:
+		return RoleGuest, true
+	}
+	return "", false
+}
+
+// Permission is a set of permissions stored as bit mask
+type Permission uint32
+
+const (
+	PermissionSpeak Permission = 1 << iota
+	PermissionListen
+	PermissionMoveUsers
+	PermissionKick
+	PermissionManageChannel
+	PermissionPrioritySpeaker // preempts the floor of other talkers
+
+	PermissionNone Permission = 0
+	PermissionAll  Permission = PermissionSpeak | PermissionListen | PermissionMoveUsers | PermissionKick | PermissionManageChannel | PermissionPrioritySpeaker
+)
+
+var permissionNames = []struct {
+	Permission Permission
+	String     string
+}{
+	{Permission: PermissionSpeak, String: "speak"},
+	{Permission: PermissionListen, String: "listen"},
+	{Permission: PermissionMoveUsers, String: "move_users"},
+	{Permission: PermissionKick, String: "kick"},
+	{Permission: PermissionManageChannel, String: "manage_channel"},
+	{Permission: PermissionPrioritySpeaker, String: "priority_speaker"},
+}
+
+// String returns the names of the permissions joined by "|"
+func (p Permission) String() string {
+	if p == PermissionNone {
+		return "none"
+	}
+	var names []string
+	for _, name := range permissionNames {
+		if p&name.Permission != 0 {
+			names = append(names, name.String)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// Has checks if all permissions of other are contained in p
+func (p Permission) Has(other Permission) bool {
+	return p&other == other
+}
+
+// ParsePermissions parses a list of permission names like "speak" or "kick"
+// Unknown names return false
+func ParsePermissions(names []string) (Permission, bool) {
+	var p Permission
+	for _, n := range names {
+		found := false
+		for _, name := range permissionNames {
+			if strings.EqualFold(n, name.String) {
+				p |= name.Permission
+				found = true
+				break
+			}
+		}
+		if !found {
+			return PermissionNone, false
+		}
+	}
+	return p, true
+}
+
+// Policy maps roles to permissions
+// Every role has server wide permissions, channels may override them per role
+type Policy struct {
+	mu       sync.RWMutex
+	roles    map[Role]Permission
+	channels map[string]map[Role]Permission
+}
+
+// DefaultPolicy creates a Policy with the default permissions
+// admin: all, moderator: speak, listen, move users, kick and priority speaker, member: speak and listen, guest: listen
+func DefaultPolicy() *Policy {
+	return &Policy{
+		roles: map[Role]Permission{
+			RoleAdmin:     PermissionAll,
+			RoleModerator: PermissionSpeak | PermissionListen | PermissionMoveUsers | PermissionKick | PermissionPrioritySpeaker,
+			RoleMember:    PermissionSpeak | PermissionListen,
+			RoleGuest:     PermissionListen,
+		},
+		channels: make(map[string]map[Role]Permission),
+	}
+}
+
+// SetRole sets the server wide permissions of a role
+func (p *Policy) SetRole(role Role, permissions Permission) {
+	p.mu.Lock()
+	p.roles[role] = permissions
+	p.mu.Unlock()
+}
+
+// SetChannel overrides the permissions of a role in a channel
+func (p *Policy) SetChannel(channel string, role Role, permissions Permission) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.channels[channel] == nil {
+		p.channels[channel] = make(map[Role]Permission)
+	}
+	p.channels[channel][role] = permissions
+}
+
+// RemoveChannel removes all overrides of a channel
+func (p *Policy) RemoveChannel(channel string) {
+	p.mu.Lock()
+	delete(p.channels, channel)
+	p.mu.Unlock()
+}
+
+// Permissions returns the permissions of a role in a channel
+// An empty channel returns the server wide permissions
+func (p *Policy) Permissions(role Role, channel string) Permission {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if overrides, ok := p.channels[channel]; ok {
+		if permissions, ok := overrides[role]; ok {
+			return permissions
+		}
+	}
+	return p.roles[role]
+}
+
+// Allowed checks if a role has the permission in a channel
+// An empty channel checks the server wide permissions
+func (p *Policy) Allowed(role Role, channel string, permission Permission) bool {
+	return p.Permissions(role, channel).Has(permission)
+}
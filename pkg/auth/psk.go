@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+// MinPSKSize is the minimum length of a pre-shared key in bytes
+const MinPSKSize = 16
+
+// PSK is an entry of the PSK keyfile
+// Key is the hex encoded pre-shared key of the identity
+// UserID is the user of the session, the identity itself if empty
+// Role is the role of the session, member if empty
+type PSK struct {
+	Identity string   `yaml:"identity"`
+	Key      string   `yaml:"key"`
+	UserID   string   `yaml:"user_id,omitempty"`
+	Role     string   `yaml:"role,omitempty"`
+	Scopes   []string `yaml:"scopes,omitempty"`
+	Disabled bool     `yaml:"disabled,omitempty"`
+}
+
+// PSKList is the content of the PSK keyfile
+type PSKList struct {
+	Keys []PSK `yaml:"keys"`
+}
+
+// pskEntry is a loaded PSK with the decoded key
+type pskEntry struct {
+	PSK
+	key []byte
+}
+
+// PSKStore holds the pre-shared keys for the DTLS PSK mode
+// It looks up the key for the PSK identity a client sends in the handshake
+// and maps the PSK identity to the identity of the session
+//
+// Example psk.yml:
+//
+//	keys:
+//	  - identity: bot-1
+//	    key: 8d3f1a0c5e7b9d2f4a6c8e0b1d3f5a7c
+//	    role: member
+//	  - identity: test-runner
+//	    key: 0f1e2d3c4b5a69788796a5b4c3d2e1f0
+//	    user_id: ci
+//	    scopes: [speak, listen]
+type PSKStore struct {
+	path string
+	mu   sync.RWMutex
+	keys map[string]pskEntry
+}
+
+// NewPSKStore creates a new PSKStore and loads the keyfile from path
+func NewPSKStore(path string) (*PSKStore, error) {
+	s := &PSKStore{path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload reads the keyfile again
+// On error the previously loaded keys are kept
+func (s *PSKStore) Reload() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("read psk keyfile: %w", err)
+	}
+	var list PSKList
+	if err := yaml.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("decode psk keyfile: %w", err)
+	}
+	keys := make(map[string]pskEntry, len(list.Keys))
+	for i, psk := range list.Keys {
+		if psk.Identity == "" {
+			return fmt.Errorf("psk keyfile: keys[%d]: identity is required", i)
+		}
+		if _, ok := keys[psk.Identity]; ok {
+			return fmt.Errorf("psk keyfile: keys[%d] (%s): duplicate identity", i, psk.Identity)
+		}
+		key, err := hex.DecodeString(psk.Key)
+		if err != nil {
+			return fmt.Errorf("psk keyfile: keys[%d] (%s): key is not hex: %w", i, psk.Identity, err)
+		}
+		if len(key) < MinPSKSize {
+			return fmt.Errorf("psk keyfile: keys[%d] (%s): key must be at least %d bytes", i, psk.Identity, MinPSKSize)
+		}
+		if _, ok := ParseRole(psk.Role); psk.Role != "" && !ok {
+			return fmt.Errorf("psk keyfile: keys[%d] (%s): unknown role %q", i, psk.Identity, psk.Role)
+		}
+		keys[psk.Identity] = pskEntry{PSK: psk, key: key}
+	}
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+	return nil
+}
+
+// lookup returns the enabled entry of a PSK identity
+func (s *PSKStore) lookup(pskIdentity []byte) (pskEntry, error) {
+	s.mu.RLock()
+	entry, ok := s.keys[string(pskIdentity)]
+	s.mu.RUnlock()
+	if !ok {
+		return pskEntry{}, ErrUnknownUser
+	}
+	if entry.Disabled {
+		return pskEntry{}, ErrUserDisabled
+	}
+	return entry, nil
+}
+
+// Key returns the pre-shared key of a PSK identity
+// It has the signature of the PSK callback of pion/dtls
+func (s *PSKStore) Key(pskIdentity []byte) ([]byte, error) {
+	entry, err := s.lookup(pskIdentity)
+	if err != nil {
+		return nil, err
+	}
+	return entry.key, nil
+}
+
+// Identity returns the session identity of a PSK identity
+func (s *PSKStore) Identity(pskIdentity []byte) (*Identity, error) {
+	entry, err := s.lookup(pskIdentity)
+	if err != nil {
+		return nil, err
+	}
+	identity := &Identity{
+		UserID: entry.UserID,
+		Role:   RoleMember,
+		Scopes: entry.Scopes,
+	}
+	if identity.UserID == "" {
+		identity.UserID = entry.Identity
+	}
+	if role, ok := ParseRole(entry.Role); ok {
+		identity.Role = role
+	}
+	return identity, nil
+}
+
+// CertificateIdentity returns the session identity of a verified client certificate
+// The user ID is the common name of the subject, the role is member
+func CertificateIdentity(cert *x509.Certificate) (*Identity, error) {
+	if cert.Subject.CommonName == "" {
+		return nil, ErrUnknownUser
+	}
+	return &Identity{
+		UserID:    cert.Subject.CommonName,
+		Role:      RoleMember,
+		ExpiresAt: cert.NotAfter,
+	}, nil
+}
@@ -0,0 +1,28 @@
+package auth
+
+import "github.com/aura-speak/networking/pkg/clock"
+
+// StaticSecretAuthenticator accepts every token signed with one shared secret
+type StaticSecretAuthenticator struct {
+	secret []byte
+	clock  clock.Clock
+}
+
+// NewStaticSecretAuthenticator creates a new StaticSecretAuthenticator for the secret
+func NewStaticSecretAuthenticator(secret []byte) *StaticSecretAuthenticator {
+	return &StaticSecretAuthenticator{secret: secret, clock: clock.Real}
+}
+
+// SetClock replaces the Clock the expiry of the tokens is checked on, it is called before the first Authenticate
+func (a *StaticSecretAuthenticator) SetClock(clk clock.Clock) {
+	a.clock = clk
+}
+
+// Authenticate validates the token and returns the identity from its claims
+func (a *StaticSecretAuthenticator) Authenticate(credential []byte) (*Identity, error) {
+	claims, err := VerifyToken(credential, a.secret, a.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	return claims.Identity(), nil
+}
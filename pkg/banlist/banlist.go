@@ -0,0 +1,295 @@
+// Package Banlist contains the persistent ban list of the Server
+// It is responsible for banning IP addresses, CIDR ranges and user IDs
+// The list is stored as yaml file and written on every change
+// Entries may be permanent or expire after a duration
+package banlist
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/clock"
+	"gopkg.in/yaml.v2"
+)
+
+// Entry is a ban of an IP address or CIDR range, or of a user ID
+// Exactly one of IP and UserID is set
+// A zero Expires means the ban is permanent
+type Entry struct {
+	IP      string    `yaml:"ip,omitempty" json:"ip,omitempty"`
+	UserID  string    `yaml:"user_id,omitempty" json:"userId,omitempty"`
+	Reason  string    `yaml:"reason,omitempty" json:"reason,omitempty"`
+	Created time.Time `yaml:"created" json:"created"`
+	Expires time.Time `yaml:"expires,omitempty" json:"expires,omitempty"`
+
+	network *net.IPNet
+}
+
+// Expired checks if the ban is expired
+func (e *Entry) Expired(now time.Time) bool {
+	return !e.Expires.IsZero() && !now.Before(e.Expires)
+}
+
+// file is the content of the ban list file
+type file struct {
+	Bans []Entry `yaml:"bans"`
+}
+
+// List is the ban list
+type List struct {
+	mu      sync.RWMutex
+	path    string
+	entries []Entry
+	clock   clock.Clock
+}
+
+// Load loads the ban list from path
+// A missing file is an empty list, it is created on the first change
+// An empty path keeps the list in memory only
+func Load(path string) (*List, error) {
+	entries, err := read(path)
+	if err != nil {
+		return nil, err
+	}
+	return &List{path: path, entries: entries, clock: clock.Real}, nil
+}
+
+// SetClock replaces the Clock the bans are created and expired on
+func (l *List) SetClock(clk clock.Clock) {
+	l.mu.Lock()
+	l.clock = clk
+	l.mu.Unlock()
+}
+
+// Open replaces the bans with the content of the file at path and uses it from now on
+// On error the list and its file stay unchanged
+func (l *List) Open(path string) error {
+	entries, err := read(path)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.path = path
+	l.entries = entries
+	l.mu.Unlock()
+	return nil
+}
+
+// Reload reads the file of the list again, e.g. after it was edited by hand
+func (l *List) Reload() error {
+	l.mu.RLock()
+	path := l.path
+	l.mu.RUnlock()
+	if path == "" {
+		return nil
+	}
+	return l.Open(path)
+}
+
+// Path returns the file of the list, empty if it is kept in memory only
+func (l *List) Path() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.path
+}
+
+// read reads the entries of a ban list file
+func read(path string) ([]Entry, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read ban list: %w", err)
+	}
+	var f file
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("decode ban list: %w", err)
+	}
+	entries := make([]Entry, 0, len(f.Bans))
+	for i, entry := range f.Bans {
+		if err := entry.parse(); err != nil {
+			return nil, fmt.Errorf("ban list: bans[%d]: %w", i, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// parse validates the entry and parses its IP or CIDR range
+func (e *Entry) parse() error {
+	switch {
+	case e.IP != "" && e.UserID != "":
+		return errors.New("ip and user_id are mutually exclusive")
+	case e.UserID != "":
+		return nil
+	case e.IP == "":
+		return errors.New("ip or user_id is required")
+	}
+	network, err := parseNetwork(e.IP)
+	if err != nil {
+		return err
+	}
+	e.network = network
+	e.IP = network.String()
+	return nil
+}
+
+// parseNetwork parses an IP address or CIDR range
+// A single address becomes a /32 or /128 range
+func parseNetwork(target string) (*net.IPNet, error) {
+	if strings.Contains(target, "/") {
+		_, network, err := net.ParseCIDR(target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q", target)
+		}
+		return network, nil
+	}
+	ip := net.ParseIP(target)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid ip %q", target)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// BanIP bans an IP address or CIDR range
+// A duration of zero bans permanently
+//
+// Example:
+//
+//	list.BanIP("203.0.113.0/24", "flooding", 24*time.Hour)
+func (l *List) BanIP(target string, reason string, duration time.Duration) (Entry, error) {
+	entry := Entry{IP: target}
+	if err := entry.parse(); err != nil {
+		return Entry{}, err
+	}
+	err := l.add(&entry, reason, duration)
+	return entry, err
+}
+
+// BanUser bans a user ID
+// A duration of zero bans permanently
+func (l *List) BanUser(userID string, reason string, duration time.Duration) (Entry, error) {
+	if userID == "" {
+		return Entry{}, errors.New("user id is required")
+	}
+	entry := Entry{UserID: userID}
+	err := l.add(&entry, reason, duration)
+	return entry, err
+}
+
+// add stores the entry, replacing an existing ban of the same target
+func (l *List) add(entry *Entry, reason string, duration time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry.Reason = reason
+	entry.Created = l.clock.Now().UTC().Truncate(time.Second)
+	if duration > 0 {
+		entry.Expires = entry.Created.Add(duration)
+	}
+	l.entries = slices.DeleteFunc(l.entries, func(e Entry) bool {
+		return e.IP == entry.IP && e.UserID == entry.UserID
+	})
+	l.entries = append(l.entries, *entry)
+	return l.save()
+}
+
+// Unban removes the ban of an IP address, CIDR range or user ID
+// It returns false if there was no such ban
+func (l *List) Unban(target string) (bool, error) {
+	ip := target
+	if network, err := parseNetwork(target); err == nil {
+		ip = network.String()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := len(l.entries)
+	l.entries = slices.DeleteFunc(l.entries, func(e Entry) bool {
+		return (e.IP != "" && e.IP == ip) || (e.UserID != "" && e.UserID == target)
+	})
+	if len(l.entries) == n {
+		return false, nil
+	}
+	return true, l.save()
+}
+
+// Entries returns all bans that are not expired
+func (l *List) Entries() []Entry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	now := l.clock.Now()
+	entries := make([]Entry, 0, len(l.entries))
+	for _, e := range l.entries {
+		if !e.Expired(now) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// IPBanned checks if the IP address is in a banned range
+func (l *List) IPBanned(ip net.IP, now time.Time) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for i := range l.entries {
+		e := &l.entries[i]
+		if e.network != nil && !e.Expired(now) && e.network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// UserBanned checks if the user ID is banned
+func (l *List) UserBanned(userID string, now time.Time) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for i := range l.entries {
+		e := &l.entries[i]
+		if e.UserID != "" && e.UserID == userID && !e.Expired(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// save writes the list without expired entries to its file
+// The caller has to hold the lock
+func (l *List) save() error {
+	now := l.clock.Now()
+	l.entries = slices.DeleteFunc(l.entries, func(e Entry) bool {
+		return e.Expired(now)
+	})
+	if l.path == "" {
+		return nil
+	}
+	data, err := yaml.Marshal(file{Bans: l.entries})
+	if err != nil {
+		return fmt.Errorf("encode ban list: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return fmt.Errorf("mkdir ban list dir: %w", err)
+	}
+	// Write to a temporary file first, so a crash never leaves a half written list
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write ban list: %w", err)
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return fmt.Errorf("write ban list: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package banlist_test
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/banlist"
+	"github.com/aura-speak/networking/pkg/clock"
+)
+
+var start = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestBansExpireOnClock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.yml")
+	bans, err := banlist.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := clock.NewFake(start)
+	bans.SetClock(fake)
+
+	entry, err := bans.BanIP("203.0.113.0/24", "flooding", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !entry.Created.Equal(start) || !entry.Expires.Equal(start.Add(time.Hour)) {
+		t.Fatalf("ban created %s expiring %s, want %s and one hour later", entry.Created, entry.Expires, start)
+	}
+	if _, err := bans.BanUser("mallory", "spam", 0); err != nil {
+		t.Fatal(err)
+	}
+	ip := net.ParseIP("203.0.113.7")
+	if !bans.IPBanned(ip, fake.Now()) || len(bans.Entries()) != 2 {
+		t.Fatalf("ban not active, %d entries", len(bans.Entries()))
+	}
+
+	fake.Advance(time.Hour)
+	if bans.IPBanned(ip, fake.Now()) {
+		t.Fatal("ban active after it expired")
+	}
+	if entries := bans.Entries(); len(entries) != 1 || entries[0].UserID != "mallory" {
+		t.Fatalf("entries after the expiry: %+v", entries)
+	}
+
+	// the expired ban is not written with the next change
+	if _, err := bans.Unban("mallory"); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := banlist.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := reloaded.Entries(); len(entries) != 0 {
+		t.Fatalf("saved entries: %+v", entries)
+	}
+}
@@ -0,0 +1,377 @@
+// Package Certs contains the reloadable certificate provider for DTLS
+// It is responsible for loading the server certificate, the client CA and the revocations from file
+// The files are watched and reloaded when they change, so rotated certificates are used for new handshakes
+// while established sessions keep running
+// Certificates that expire soon are logged and exposed as warnings
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/clock"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultReloadInterval is the default interval in which the files are checked for changes
+const DefaultReloadInterval = 30 * time.Second
+
+// DefaultWarnBefore is the default time before the expiry of a certificate from which on a warning is emitted
+const DefaultWarnBefore = 30 * 24 * time.Hour
+
+// warnRepeat is the interval in which a warning for the same certificate is logged again
+const warnRepeat = 24 * time.Hour
+
+// Options are the files and settings of a Provider
+// CRLFile and DenylistFile are optional
+type Options struct {
+	CertFile     string
+	KeyFile      string
+	CAFile       string
+	CRLFile      string
+	DenylistFile string
+	WarnBefore   time.Duration
+}
+
+// Warning is an expiry warning for one certificate
+type Warning struct {
+	File     string    `json:"file"`
+	Subject  string    `json:"subject"`
+	NotAfter time.Time `json:"notAfter"`
+	DaysLeft int       `json:"daysLeft"`
+	Expired  bool      `json:"expired"`
+}
+
+func (w Warning) String() string {
+	if w.Expired {
+		return fmt.Sprintf("certificate %q in %s expired at %s", w.Subject, w.File, w.NotAfter.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("certificate %q in %s expires in %d days at %s", w.Subject, w.File, w.DaysLeft, w.NotAfter.Format(time.RFC3339))
+}
+
+// CertInfo describes a loaded certificate
+type CertInfo struct {
+	File      string    `json:"file"`
+	Subject   string    `json:"subject"`
+	Serial    string    `json:"serial"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+}
+
+// Status is a snapshot of the state of a Provider
+type Status struct {
+	Certificates []CertInfo `json:"certificates"`
+	Warnings     []Warning  `json:"warnings"`
+	Revoked      int        `json:"revoked"`
+	LoadedAt     time.Time  `json:"loadedAt"`
+	LastError    string     `json:"lastError,omitempty"`
+}
+
+// state is one consistent set of loaded files
+type state struct {
+	cert     *tls.Certificate
+	leaf     *x509.Certificate
+	cas      []*x509.Certificate
+	pool     *x509.CertPool
+	revoked  *revocations
+	modTimes map[string]time.Time
+	loadedAt time.Time
+}
+
+// Provider provides the server certificate and verifies client certificates for DTLS
+// It contains the currently loaded files
+// The time an expiry warning was logged the last time per file
+type Provider struct {
+	opts  Options
+	state atomic.Pointer[state]
+
+	mu        sync.Mutex
+	warned    map[string]time.Time
+	lastError error
+	clock     clock.Clock
+}
+
+// NewProvider creates a new Provider and loads the files
+// It returns an error if the files can not be loaded
+//
+// Example:
+//
+//	provider, err := certs.NewProvider(certs.Options{
+//		CertFile: "certs/server.crt",
+//		KeyFile:  "certs/server.key",
+//		CAFile:   "certs/ca.crt",
+//		CRLFile:  "certs/ca.crl",
+//	})
+func NewProvider(opts Options) (*Provider, error) {
+	if opts.WarnBefore == 0 {
+		opts.WarnBefore = DefaultWarnBefore
+	}
+	p := &Provider{
+		opts:   opts,
+		warned: make(map[string]time.Time),
+		clock:  clock.Real,
+	}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SetClock replaces the Clock the expiries and the file checks of Watch run on
+// It is called before Watch
+func (p *Provider) SetClock(clk clock.Clock) {
+	p.mu.Lock()
+	p.clock = clk
+	p.mu.Unlock()
+}
+
+// now returns the time of the Clock
+func (p *Provider) now() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.clock.Now()
+}
+
+// Reload loads all files again
+// If loading fails the previously loaded files stay in use
+func (p *Provider) Reload() error {
+	st, err := p.load()
+	p.mu.Lock()
+	p.lastError = err
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	p.state.Store(st)
+	log.WithField("caller", "certs").Infof("Loaded certificate %q valid until %s, %d revoked", st.leaf.Subject.CommonName, st.leaf.NotAfter.Format(time.RFC3339), st.revoked.len())
+	p.checkExpiry(p.now())
+	return nil
+}
+
+// load reads all files into a new state
+func (p *Provider) load() (*state, error) {
+	st := &state{
+		modTimes: make(map[string]time.Time),
+		loadedAt: p.now(),
+	}
+	for _, file := range p.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		st.modTimes[file] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(p.opts.CertFile, p.opts.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load server certificate: %w", err)
+	}
+	st.cert = &cert
+	st.leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse server certificate: %w", err)
+	}
+	cert.Leaf = st.leaf
+
+	st.cas, err = readCertificates(p.opts.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("load ca: %w", err)
+	}
+	st.pool = x509.NewCertPool()
+	for _, ca := range st.cas {
+		st.pool.AddCert(ca)
+	}
+
+	st.revoked = newRevocations()
+	if p.opts.CRLFile != "" {
+		if err := st.revoked.loadCRL(p.opts.CRLFile, st.cas); err != nil {
+			return nil, fmt.Errorf("load crl: %w", err)
+		}
+	}
+	if p.opts.DenylistFile != "" {
+		if err := st.revoked.loadDenylist(p.opts.DenylistFile); err != nil {
+			return nil, fmt.Errorf("load denylist: %w", err)
+		}
+	}
+	return st, nil
+}
+
+// files returns all files the provider depends on
+func (p *Provider) files() []string {
+	files := []string{p.opts.CertFile, p.opts.KeyFile, p.opts.CAFile}
+	if p.opts.CRLFile != "" {
+		files = append(files, p.opts.CRLFile)
+	}
+	if p.opts.DenylistFile != "" {
+		files = append(files, p.opts.DenylistFile)
+	}
+	return files
+}
+
+// changed reports if one of the files was modified since the current state was loaded
+func (p *Provider) changed() bool {
+	st := p.state.Load()
+	for _, file := range p.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			// a file that is being replaced is picked up on the next check
+			continue
+		}
+		if !info.ModTime().Equal(st.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch checks the files for changes in the given interval and reloads them
+// It also logs the expiry warnings again once a day
+// It returns when the context is done
+func (p *Provider) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+	p.mu.Lock()
+	ticker := p.clock.NewTicker(interval)
+	p.mu.Unlock()
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+		if p.changed() {
+			if err := p.Reload(); err != nil {
+				log.WithField("caller", "certs").WithError(err).Error("Failed to reload certificates, keeping the previous ones")
+			}
+			continue
+		}
+		p.checkExpiry(p.now())
+	}
+}
+
+// GetCertificate returns the current server certificate
+// It is used as dtls.Config.GetCertificate so every handshake uses the latest certificate
+func (p *Provider) GetCertificate() (*tls.Certificate, error) {
+	return p.state.Load().cert, nil
+}
+
+// VerifyClient verifies the certificate chain of a client against the current CA
+// and checks the client certificate against the CRL and the denylist
+// It is used as dtls.Config.VerifyPeerCertificate
+func (p *Provider) VerifyClient(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return errors.New("no client certificate")
+	}
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("parse client certificate: %w", err)
+		}
+		certs[i] = cert
+	}
+	st := p.state.Load()
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	leaf := certs[0]
+	now := p.now()
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		CurrentTime:   now,
+		Roots:         st.pool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return err
+	}
+	if reason, ok := st.revoked.revoked(leaf); ok {
+		log.WithField("caller", "certs").Warnf("Rejecting client certificate %q (serial %s): %s", leaf.Subject.CommonName, serialString(leaf.SerialNumber), reason)
+		return fmt.Errorf("client certificate %q is revoked", leaf.Subject.CommonName)
+	}
+	if leaf.NotAfter.Sub(now) < p.opts.WarnBefore {
+		log.WithField("caller", "certs").Warnf("Client certificate %q expires at %s", leaf.Subject.CommonName, leaf.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Warnings returns the expiry warnings for the loaded certificates
+func (p *Provider) Warnings() []Warning {
+	return p.warnings(p.state.Load(), p.now())
+}
+
+// Status returns a snapshot of the loaded certificates, the warnings and the last reload error
+func (p *Provider) Status() Status {
+	st := p.state.Load()
+	status := Status{
+		Certificates: []CertInfo{certInfo(p.opts.CertFile, st.leaf)},
+		Warnings:     p.warnings(st, p.now()),
+		Revoked:      st.revoked.len(),
+		LoadedAt:     st.loadedAt,
+	}
+	for _, ca := range st.cas {
+		status.Certificates = append(status.Certificates, certInfo(p.opts.CAFile, ca))
+	}
+	p.mu.Lock()
+	if p.lastError != nil {
+		status.LastError = p.lastError.Error()
+	}
+	p.mu.Unlock()
+	return status
+}
+
+// warnings returns the certificates of the state that expire within WarnBefore
+func (p *Provider) warnings(st *state, now time.Time) []Warning {
+	var warnings []Warning
+	check := func(file string, cert *x509.Certificate) {
+		left := cert.NotAfter.Sub(now)
+		if left >= p.opts.WarnBefore {
+			return
+		}
+		warnings = append(warnings, Warning{
+			File:     file,
+			Subject:  cert.Subject.CommonName,
+			NotAfter: cert.NotAfter,
+			DaysLeft: int(left.Hours() / 24),
+			Expired:  left <= 0,
+		})
+	}
+	check(p.opts.CertFile, st.leaf)
+	for _, ca := range st.cas {
+		check(p.opts.CAFile, ca)
+	}
+	return warnings
+}
+
+// checkExpiry logs the expiry warnings, each certificate at most once per day
+func (p *Provider) checkExpiry(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, w := range p.warnings(p.state.Load(), now) {
+		key := w.File + "\x00" + w.Subject
+		if last, ok := p.warned[key]; ok && now.Sub(last) < warnRepeat {
+			continue
+		}
+		p.warned[key] = now
+		log.WithField("caller", "certs").Warn(w.String())
+	}
+}
+
+func certInfo(file string, cert *x509.Certificate) CertInfo {
+	return CertInfo{
+		File:      file,
+		Subject:   cert.Subject.CommonName,
+		Serial:    serialString(cert.SerialNumber),
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+	}
+}
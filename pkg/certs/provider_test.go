@@ -0,0 +1,109 @@
+package certs_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/certs"
+	"github.com/aura-speak/networking/pkg/clock"
+)
+
+// start is the time of the fake clock, the certificates are only valid around it
+var start = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type issued struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func issue(t *testing.T, name string, parent *issued, usage x509.ExtKeyUsage, notAfter time.Time) *issued {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    start.Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &issued{cert: cert, key: key, der: der}
+}
+
+func writePEM(t *testing.T, path, blockType string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: data}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExpiryOnClock(t *testing.T) {
+	dir := t.TempDir()
+	ca := issue(t, "ca", nil, x509.ExtKeyUsageAny, start.Add(365*24*time.Hour))
+	server := issue(t, "server", ca, x509.ExtKeyUsageServerAuth, start.Add(40*24*time.Hour))
+	client := issue(t, "client", ca, x509.ExtKeyUsageClientAuth, start.Add(24*time.Hour))
+	opts := certs.Options{
+		CertFile: filepath.Join(dir, "server.crt"),
+		KeyFile:  filepath.Join(dir, "server.key"),
+		CAFile:   filepath.Join(dir, "ca.crt"),
+	}
+	writePEM(t, opts.CertFile, "CERTIFICATE", server.der)
+	writePEM(t, opts.CAFile, "CERTIFICATE", ca.der)
+	key, err := x509.MarshalECPrivateKey(server.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, opts.KeyFile, "EC PRIVATE KEY", key)
+
+	p, err := certs.NewProvider(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := clock.NewFake(start)
+	p.SetClock(fake)
+
+	// the certificates are not valid yet on the real clock
+	if err := p.VerifyClient([][]byte{client.der}, nil); err != nil {
+		t.Fatalf("client certificate on the clock: %v", err)
+	}
+	if warnings := p.Warnings(); len(warnings) != 0 {
+		t.Fatalf("warnings 40 days before the expiry: %v", warnings)
+	}
+
+	fake.Advance(11 * 24 * time.Hour)
+	warnings := p.Warnings()
+	if len(warnings) != 1 || warnings[0].Subject != "server" || warnings[0].DaysLeft != 29 || warnings[0].Expired {
+		t.Fatalf("warnings 29 days before the expiry: %v", warnings)
+	}
+	if err := p.VerifyClient([][]byte{client.der}, nil); err == nil {
+		t.Fatal("expired client certificate verified")
+	}
+}
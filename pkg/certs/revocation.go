@@ -0,0 +1,134 @@
+package certs
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// revocations are the revoked serial numbers and the denied common names
+type revocations struct {
+	serials map[string]string // serial -> reason
+	names   map[string]string // common name -> reason
+}
+
+func newRevocations() *revocations {
+	return &revocations{
+		serials: make(map[string]string),
+		names:   make(map[string]string),
+	}
+}
+
+func (r *revocations) len() int {
+	return len(r.serials) + len(r.names)
+}
+
+// revoked reports if the certificate is revoked and why
+func (r *revocations) revoked(cert *x509.Certificate) (string, bool) {
+	if reason, ok := r.serials[serialString(cert.SerialNumber)]; ok {
+		return reason, true
+	}
+	if reason, ok := r.names[cert.Subject.CommonName]; ok {
+		return reason, true
+	}
+	return "", false
+}
+
+// loadCRL loads a PEM or DER encoded CRL
+// The CRL has to be signed by one of the CAs
+func (r *revocations) loadCRL(path string, cas []*x509.Certificate) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "X509 CRL" {
+			return fmt.Errorf("%s: unexpected pem block %q", path, block.Type)
+		}
+		data = block.Bytes
+	}
+	crl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return err
+	}
+	signed := false
+	for _, ca := range cas {
+		if crl.CheckSignatureFrom(ca) == nil {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return fmt.Errorf("%s is not signed by the ca", path)
+	}
+	for _, entry := range crl.RevokedCertificateEntries {
+		r.serials[serialString(entry.SerialNumber)] = "revoked by crl"
+	}
+	return nil
+}
+
+// loadDenylist loads a denylist file
+// Every line is a serial number in hex (colons are allowed) or a common name (user ID)
+// Empty lines and lines starting with # are ignored
+func (r *revocations) loadDenylist(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r.names[line] = "denied by denylist"
+		if serial, ok := parseSerial(line); ok {
+			r.serials[serialString(serial)] = "denied by denylist"
+		}
+	}
+	return scanner.Err()
+}
+
+// parseSerial parses a hex serial number like "3f:a2:01" or "3fa201"
+func parseSerial(s string) (*big.Int, bool) {
+	return new(big.Int).SetString(strings.ReplaceAll(strings.TrimPrefix(strings.ToLower(s), "0x"), ":", ""), 16)
+}
+
+// serialString formats a serial number as lower case hex
+func serialString(serial *big.Int) string {
+	return serial.Text(16)
+}
+
+// readCertificates reads all certificates of a PEM file
+func readCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate found in " + path)
+	}
+	return certs, nil
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+// JoinChannel asks the Server to move the Client into a channel
+// The Server answers with protocol.PacketTypeChannelJoin or with an error reply if the Client may not listen in it
+//
+// Example:
+//
+//	client.OnPacket(protocol.PacketTypeChannelJoin, func(packet *protocol.Packet) error {
+//		fmt.Println("Joined channel:", string(packet.Payload))
+//		return nil
+//	})
+//	if err := client.JoinChannel("lobby"); err != nil {
+//		fmt.Println("Error joining channel:", err)
+//	}
+func (c *Client) JoinChannel(name string) error {
+	if err := protocol.ValidChannelName([]byte(name)); err != nil {
+		return err
+	}
+	return c.sendPacket(protocol.PacketTypeChannelJoin, []byte(name))
+}
+
+// LeaveChannel asks the Server to remove the Client from its channel
+func (c *Client) LeaveChannel() error {
+	return c.sendPacket(protocol.PacketTypeChannelLeave, nil)
+}
+
+// RequestFloor asks for the floor of the channel of the Client
+// The Server answers with a grant, or a deny that tells the queue position or why the floor is not available
+//
+// Example:
+//
+//	client.OnPacket(protocol.PacketTypeFloorGrant, func(packet *protocol.Packet) error {
+//		grant, err := protocol.DecodeFloor(packet.Payload)
+//		if err == nil && grant.SSRC == client.SSRC() {
+//			fmt.Println("Talk now")
+//		}
+//		return err
+//	})
+//	client.RequestFloor()
+func (c *Client) RequestFloor() error {
+	return c.sendPacket(protocol.PacketTypeFloorRequest, nil)
+}
+
+// ReleaseFloor gives the floor back or withdraws a waiting request
+func (c *Client) ReleaseFloor() error {
+	return c.sendPacket(protocol.PacketTypeFloorRelease, nil)
+}
+
+func (c *Client) sendPacket(packetType protocol.PacketType, payload []byte) error {
+	packet := &protocol.Packet{
+		PacketHeader: protocol.Header{PacketType: packetType},
+		Payload:      payload,
+	}
+	return c.Send(packet.Encode())
+}
+
+// StartRecording asks the Server to record a channel, it needs auth.PermissionManageChannel in the channel
+// The Server answers with protocol.PacketTypeRecordStart or with an error reply
+func (c *Client) StartRecording(channel string) error {
+	if err := protocol.ValidChannelName([]byte(channel)); err != nil {
+		return err
+	}
+	return c.sendPacket(protocol.PacketTypeRecordStart, []byte(channel))
+}
+
+// StopRecording asks the Server to stop recording a channel
+func (c *Client) StopRecording(channel string) error {
+	if err := protocol.ValidChannelName([]byte(channel)); err != nil {
+		return err
+	}
+	return c.sendPacket(protocol.PacketTypeRecordStop, []byte(channel))
+}
@@ -9,16 +9,23 @@ package client
 import (
 	"context"
 	"errors"
-	"fmt"
 	"net"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/aura-speak/networking/pkg/clock"
 	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/report"
 	"github.com/aura-speak/networking/pkg/router"
+	"github.com/aura-speak/networking/pkg/transport"
 	log "github.com/sirupsen/logrus"
 )
 
+// sendTimeout is the longest time Send waits for the sendLoop to take a packet
+const sendTimeout = 5 * time.Second
+
 // Gedanken:
 // 	- ein isAlive wie im server, aber dies wird nachher über das protokoll gehändelt
 
@@ -33,17 +40,42 @@ import (
 // The recv channel for the Client
 // The err channel for the Client
 // The packet router for the Client
-// The running sign for the Client
+// The report state of the connection to the Server
+// The interval between two reports
+// The credential sent in the connect handshake
+// The interval and timeout of the connect retransmission
+// The connected sign for the Client
+// The transport the connection is opened with
+// The clock for timestamps, timeouts and tickers
+// The sequence number of the voice frames
+// The end-to-end encryption of the voice frames
 type Client struct {
 	Host string
 	Port int
 
+	// Credential is sent to the Server in the connect handshake, e.g. a signed token
+	Credential []byte
+	connected  int32
+
+	// ConnectRetry is the first interval between two connect attempts, it doubles up to maxConnectRetry
+	ConnectRetry time.Duration
+	// ConnectTimeout is the time after which the Client gives up the connect with ErrConnectTimeout
+	ConnectTimeout time.Duration
+	connectMu      sync.Mutex // guards Credential, cookie and connectErr after Run
+	cookie         []byte
+	connectErr     error
+	connectDone    chan struct{}
+	connectOnce    sync.Once
+
 	// TODO: uncomment later MessageLoop
 
-	conn *net.UDPConn
+	conn net.Conn
+	// Transport opens the connection to the Server, UDP if nil
+	Transport transport.Transport
 
-	ctx context.Context
-	wg  sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 
 	ClientState
 
@@ -57,27 +89,57 @@ type Client struct {
 
 	packetRouter *router.ClientPacketRouter
 
-	running bool
-
 	// OutCommandCh sends internal commands to the web server (only used in debug builds)
 	OutCommandCh chan InternalCommand
+
+	// Sender and receiver reports
+	report         *report.Peer
+	ReportInterval time.Duration
+
+	// Clock is the time source of the Client, a clock.Fake in tests
+	Clock clock.Clock
+
+	// sequence number of the next voice frame
+	voiceSeq atomic.Uint32
+	// SSRC the Server assigned with the connect accept
+	ssrc atomic.Uint32
+	// end-to-end encryption, nil until EnableE2EE
+	e2ee atomic.Pointer[e2eeState]
 }
 
 // NewClient creates a new UDP Client it takes the Host, Port and timeout of the Client
 func NewClient(Host string, Port int) *Client {
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
 	c := &Client{
-		Host:         Host,
-		Port:         Port,
-		sendCh:       make(chan []byte),
-		recvCh:       make(chan []byte),
-		errCh:        make(chan error),
-		ctx:          ctx,
-		packetRouter: router.NewClientPacketRouter(),
+		Host:           Host,
+		Port:           Port,
+		sendCh:         make(chan []byte),
+		recvCh:         make(chan []byte),
+		errCh:          make(chan error),
+		ctx:            ctx,
+		cancel:         cancel,
+		packetRouter:   router.NewClientPacketRouter(),
+		report:         report.NewPeer(),
+		ReportInterval: report.DefaultInterval,
+		ConnectRetry:   DefaultConnectRetry,
+		ConnectTimeout: DefaultConnectTimeout,
+		connectDone:    make(chan struct{}),
+		Clock:          clock.Real,
 	}
+	c.registerInternalHandlers()
 	return c
 }
 
+// registerInternalHandlers registers the default callbacks required for the client state
+func (c *Client) registerInternalHandlers() {
+	c.packetRouter.OnPacket(protocol.PacketTypeHelloVerify, c.handleHelloVerify)
+	c.packetRouter.OnPacket(protocol.PacketTypeConnectAccept, c.handleConnectAccept)
+	c.packetRouter.OnPacket(protocol.PacketTypeConnectReject, c.handleConnectReject)
+	c.packetRouter.OnPacket(protocol.PacketTypeError, c.handleError)
+	c.packetRouter.OnPacket(protocol.PacketTypeSenderReport, c.handleSenderReport)
+	c.packetRouter.OnPacket(protocol.PacketTypeReceiverReport, c.handleReceiverReport)
+}
+
 // OnPacket registers a new PacketHandler for a specific packet type
 //
 // Example:
@@ -92,17 +154,16 @@ func (c *Client) OnPacket(packetType protocol.PacketType, handler router.ClientP
 
 // Run starts the Client and connects to the Server
 func (c *Client) Run() error {
-	conncetionString := fmt.Sprintf("%s:%d", c.Host, c.Port)
-	s, err := net.ResolveUDPAddr("udp4", conncetionString)
-	if err != nil {
-		return err
+	t := c.Transport
+	if t == nil {
+		t = transport.UDP{}
 	}
-	c.conn, err = net.DialUDP("udp", nil, s)
+	var err error
+	c.conn, err = t.Dial(net.JoinHostPort(c.Host, strconv.Itoa(c.Port)))
 	if err != nil {
 		return err
 	}
 
-	c.running = true
 	c.SetRunningState(true)
 
 	c.wg.Go(func() {
@@ -116,12 +177,23 @@ func (c *Client) Run() error {
 	c.wg.Go(func() {
 		c.handleErrors()
 	})
+
+	c.wg.Go(func() {
+		c.reportLoop()
+	})
+
+	c.wg.Go(func() {
+		c.connectLoop()
+	})
+
+	c.wg.Go(func() {
+		c.keyLoop()
+	})
 	defer c.conn.Close()
 
 	log.WithField("caller", "client").Info("Starting client")
 	c.debugHello()
 	c.wg.Wait()
-	c.running = false
 	c.SetRunningState(false)
 	log.WithField("caller", "client").Info("Client Stopped")
 	return nil
@@ -129,9 +201,11 @@ func (c *Client) Run() error {
 
 // Stop stops the Client
 // It stops the Client and closes the connection to the Server
+// A stopped Client can not be started again
 func (c *Client) Stop() {
-	c.running = false
 	c.SetRunningState(false)
+	atomic.StoreInt32(&c.connected, 0)
+	c.cancel()
 	if c.conn != nil {
 		c.conn.Close()
 	}
@@ -145,13 +219,13 @@ func (c *Client) Stop() {
 //
 // client.Send([]byte("Hello, Server!"))
 func (c *Client) Send(msg []byte) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	timeout := c.Clock.NewTimer(sendTimeout)
+	defer timeout.Stop()
 
 	select {
 	case <-c.ctx.Done():
 		return errors.New("context cancelled")
-	case <-ctx.Done():
+	case <-timeout.C():
 		return errors.New("send timeout: sendLoop may not be running or is blocked")
 	case c.sendCh <- msg:
 		return nil
@@ -166,9 +240,10 @@ func (c *Client) sendLoop() {
 			return
 		case msg := <-c.sendCh:
 			if _, err := c.conn.Write(msg); err != nil {
-				c.errCh <- err
+				c.reportError(err)
 				continue
 			}
+			c.report.OnSent(msg)
 			c.SetRunningState(true)
 		}
 	}
@@ -176,8 +251,7 @@ func (c *Client) sendLoop() {
 
 // recvLoop receives packets from the Server
 func (c *Client) recvLoop() {
-	// TODO: change later the byte size
-	buffer := make([]byte, 1024)
+	buffer := make([]byte, protocol.BufferSize)
 	for {
 		select {
 		case <-c.ctx.Done():
@@ -185,28 +259,37 @@ func (c *Client) recvLoop() {
 		default:
 		}
 
-		n, _, err := c.conn.ReadFromUDP(buffer)
+		n, err := c.conn.Read(buffer)
 		if err != nil {
-			c.errCh <- err
+			if errors.Is(err, net.ErrClosed) {
+				// Ohne Verbindung gibt es nichts mehr zu tun, die anderen Loops werden mit beendet
+				c.cancel()
+				return
+			}
+			c.reportError(err)
 			continue
 		}
 		if n == 0 {
 			continue
 		}
-		// TODO: same here change later when we exacly know the max msg length of a packet in the Protocol
 		dst := make([]byte, n)
 		copy(dst, buffer[:n])
 		if string(dst) == "STOP" {
-			c.ctx.Done()
+			c.cancel()
 			log.WithField("caller", "client").Info("Received STOP message from server")
 			return
 		}
 
+		c.report.OnReceived(dst)
 		packet, err := protocol.Decode(dst)
 		if err != nil {
 			log.WithField("caller", "client").WithError(err).Error("Error decoding packet")
 			continue
 		}
+		c.onMedia(packet)
+		if !c.onE2EE(packet) {
+			continue
+		}
 		if err := c.packetRouter.HandlePacket(packet); err != nil {
 			log.WithField("caller", "client").WithError(err).Error("Error handling packet")
 			continue
@@ -214,6 +297,14 @@ func (c *Client) recvLoop() {
 	}
 }
 
+// reportError hands an error to handleErrors, it is dropped if the Client is stopped
+func (c *Client) reportError(err error) {
+	select {
+	case <-c.ctx.Done():
+	case c.errCh <- err:
+	}
+}
+
 func (c *Client) handleErrors() {
 	for {
 		select {
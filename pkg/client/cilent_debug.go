@@ -9,13 +9,15 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/aura-speak/networking/pkg/clock"
 	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/report"
 	"github.com/aura-speak/networking/pkg/router"
 	log "github.com/sirupsen/logrus"
 )
 
 func NewDebugClient(Host string, Port int, ID int) *Client {
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
 	c := &Client{
 		Host:         Host,
 		Port:         Port,
@@ -23,12 +25,20 @@ func NewDebugClient(Host string, Port int, ID int) *Client {
 		recvCh:       make(chan []byte),
 		errCh:        make(chan error),
 		ctx:          ctx,
+		cancel:       cancel,
 		packetRouter: router.NewClientPacketRouter(),
 		ClientState: ClientState{
 			ID: ID,
 		},
-		OutCommandCh: make(chan InternalCommand, 10),
+		OutCommandCh:   make(chan InternalCommand, 10),
+		report:         report.NewPeer(),
+		ReportInterval: report.DefaultInterval,
+		ConnectRetry:   DefaultConnectRetry,
+		ConnectTimeout: DefaultConnectTimeout,
+		connectDone:    make(chan struct{}),
+		Clock:          clock.Real,
 	}
+	c.registerInternalHandlers()
 	return c
 }
 
@@ -50,15 +60,17 @@ func (c *Client) SetRunningState(running bool) {
 }
 
 func (c *Client) debugHello() {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	timeout := c.Clock.NewTimer(5 * time.Second)
+	defer timeout.Stop()
 
-	for c.conn == nil {
+	for c.conn == nil || !c.Connected() {
 		select {
-		case <-ctx.Done():
+		case <-c.ctx.Done():
+			return
+		case <-timeout.C():
 			log.WithField("caller", "client").Warn("Timeout waiting for connection in debugHello")
 			return
-		case <-time.After(10 * time.Millisecond):
+		case <-c.Clock.After(10 * time.Millisecond):
 			// Kurz warten und erneut prüfen
 		}
 	}
@@ -0,0 +1,156 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultConnectRetry is the first interval between two connect attempts
+const DefaultConnectRetry = 250 * time.Millisecond
+
+// DefaultConnectTimeout is the time the Client tries to connect before it gives up
+const DefaultConnectTimeout = 10 * time.Second
+
+// maxConnectRetry is the longest interval between two connect attempts
+const maxConnectRetry = 4 * time.Second
+
+// ErrConnectTimeout is returned by ConnectErr if the Server did not answer the connect in time
+var ErrConnectTimeout = errors.New("connect timeout: no answer from server")
+
+// Connected tells if the Server accepted the connect handshake
+func (c *Client) Connected() bool {
+	return atomic.LoadInt32(&c.connected) == 1
+}
+
+// ConnectErr returns why the connect handshake failed
+// It is ErrConnectTimeout or the reject of the Server, nil while connecting and after the accept
+func (c *Client) ConnectErr() error {
+	c.connectMu.Lock()
+	defer c.connectMu.Unlock()
+	return c.connectErr
+}
+
+// Reauthenticate sends the connect handshake again with a fresh credential
+// The Server keeps the session of the Client and replaces its identity, so it does not expire
+//
+// Example:
+//
+//	if err := client.Reauthenticate(token); err != nil {
+//		fmt.Println("Error reauthenticating:", err)
+//	}
+func (c *Client) Reauthenticate(credential []byte) error {
+	c.connectMu.Lock()
+	c.Credential = credential
+	c.connectMu.Unlock()
+	return c.connect()
+}
+
+// connectLoop sends the connect handshake until the Server accepts or rejects it
+// Lost packets are retransmitted after ConnectRetry, the interval doubles up to maxConnectRetry
+// After ConnectTimeout the Client gives up and reports ErrConnectTimeout
+func (c *Client) connectLoop() {
+	retry := max(c.ConnectRetry, time.Millisecond)
+	deadline := c.Clock.NewTimer(c.ConnectTimeout)
+	defer deadline.Stop()
+	for {
+		if err := c.connect(); err != nil {
+			log.WithField("caller", "client").WithError(err).Error("Error sending connect")
+		}
+		next := c.Clock.NewTimer(retry)
+		select {
+		case <-c.ctx.Done():
+			next.Stop()
+			return
+		case <-c.connectDone:
+			next.Stop()
+			return
+		case <-deadline.C():
+			next.Stop()
+			c.finishConnect(ErrConnectTimeout)
+			c.reportError(ErrConnectTimeout)
+			return
+		case <-next.C():
+		}
+		retry = min(2*retry, maxConnectRetry)
+	}
+}
+
+// finishConnect ends the connect handshake with its result, nil if it was accepted
+func (c *Client) finishConnect(err error) {
+	c.connectMu.Lock()
+	c.connectErr = err
+	c.connectMu.Unlock()
+	c.connectOnce.Do(func() {
+		close(c.connectDone)
+	})
+}
+
+// connect sends the connect handshake with the credential of the Client
+// The cookie is empty until the Server sent a HelloVerify and its cookie afterwards
+func (c *Client) connect() error {
+	c.connectMu.Lock()
+	request := &protocol.ConnectRequest{Cookie: c.cookie, Credential: c.Credential}
+	c.connectMu.Unlock()
+	packet := &protocol.Packet{
+		PacketHeader: protocol.Header{PacketType: protocol.PacketTypeConnect},
+		Payload:      request.Encode(),
+	}
+	return c.Send(packet.Encode())
+}
+
+// handleHelloVerify repeats the connect with the cookie of the Server
+func (c *Client) handleHelloVerify(packet *protocol.Packet) error {
+	verify, err := protocol.DecodeHelloVerify(packet.Payload)
+	if err != nil {
+		return err
+	}
+	c.connectMu.Lock()
+	c.cookie = verify.Cookie
+	c.connectMu.Unlock()
+	return c.connect()
+}
+
+// SSRC returns the SSRC the Server stamps on the voice of the Client, 0 before the connect is accepted
+func (c *Client) SSRC() uint32 {
+	return c.ssrc.Load()
+}
+
+// handleConnectAccept marks the Client as connected and keeps its SSRC
+func (c *Client) handleConnectAccept(packet *protocol.Packet) error {
+	accept, err := protocol.DecodeConnectAccept(packet.Payload)
+	if err != nil {
+		return err
+	}
+	c.ssrc.Store(accept.SSRC)
+	atomic.StoreInt32(&c.connected, 1)
+	c.finishConnect(nil)
+	log.WithField("caller", "client").Info("Connect accepted by server")
+	return nil
+}
+
+// handleConnectReject marks the Client as not connected and reports the reason
+// The Server also sends it when the credential of a session expired
+func (c *Client) handleConnectReject(packet *protocol.Packet) error {
+	atomic.StoreInt32(&c.connected, 0)
+	reject, err := protocol.DecodeConnectReject(packet.Payload)
+	if err != nil {
+		return err
+	}
+	err = fmt.Errorf("connect rejected by server: %s", reject.Reason)
+	c.finishConnect(err)
+	return err
+}
+
+// handleError reports an error reply of the Server
+func (c *Client) handleError(packet *protocol.Packet) error {
+	reply, err := protocol.DecodeErrorReply(packet.Payload)
+	if err != nil {
+		return err
+	}
+	return &reply
+}
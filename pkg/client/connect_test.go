@@ -0,0 +1,77 @@
+package client_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/client"
+	"github.com/aura-speak/networking/pkg/clock"
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/transport"
+)
+
+func TestConnectRetransmitsUntilTimeout(t *testing.T) {
+	network := transport.NewMemory()
+	// a server that never answers
+	server, err := network.Listen("127.0.0.1:9000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	connects := make(chan struct{}, 16)
+	go func() {
+		buf := make([]byte, protocol.BufferSize)
+		for {
+			n, _, err := server.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if packet, err := protocol.Decode(buf[:n]); err == nil && packet.PacketHeader.PacketType == protocol.PacketTypeConnect {
+				connects <- struct{}{}
+			}
+		}
+	}()
+
+	fake := clock.NewFake(time.Unix(1_700_000_000, 0))
+	c := client.NewClient("127.0.0.1", 9000)
+	c.Transport = network
+	c.Clock = fake
+	c.ConnectRetry = time.Second
+	c.ConnectTimeout = 10 * time.Second
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run()
+	}()
+	defer func() {
+		c.Stop()
+		<-done
+	}()
+
+	// the attempts follow at 1s, 2s and 4s, the timeout comes before the next one
+	start := fake.Now()
+	var sent []time.Duration
+	for c.ConnectErr() == nil && fake.Since(start) < time.Minute {
+		select {
+		case <-connects:
+			sent = append(sent, fake.Since(start))
+		case <-time.After(time.Millisecond):
+			fake.Advance(10 * time.Millisecond)
+		}
+	}
+	if !errors.Is(c.ConnectErr(), client.ErrConnectTimeout) {
+		t.Fatalf("connect error %v", c.ConnectErr())
+	}
+	if c.Connected() {
+		t.Fatal("connected without an accept")
+	}
+	want := []time.Duration{0, time.Second, 3 * time.Second, 7 * time.Second}
+	if len(sent) != len(want) {
+		t.Fatalf("connects at %v, want %v", sent, want)
+	}
+	for i := range want {
+		if sent[i] < want[i] || sent[i] > want[i]+200*time.Millisecond {
+			t.Fatalf("connects at %v, want %v", sent, want)
+		}
+	}
+}
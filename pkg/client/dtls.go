@@ -0,0 +1,62 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/pion/dtls/v3"
+)
+
+// NewDTLSClientPSKConfig creates a DTLS config that authenticates the client with a pre-shared key
+// The identity is the PSK identity of the keyfile of the Server
+//
+// Example:
+//
+//	cfg := client.NewDTLSClientPSKConfig("bot-1", key)
+func NewDTLSClientPSKConfig(identity string, key []byte) *dtls.Config {
+	return &dtls.Config{
+		PSK: func([]byte) ([]byte, error) {
+			return key, nil
+		},
+		PSKIdentityHint: []byte(identity),
+		CipherSuites: []dtls.CipherSuiteID{
+			dtls.TLS_PSK_WITH_AES_128_GCM_SHA256,
+			dtls.TLS_PSK_WITH_AES_128_CCM,
+		},
+
+		MTU: 1200,
+	}
+}
+
+// NewDTLSClientMTLSConfig creates a DTLS config that authenticates the client with a client certificate
+// The server certificate is verified against the CA and the server name
+func NewDTLSClientMTLSConfig(certFile, keyFile, caFile, serverName string) (*dtls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	caPem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM(caPem) {
+		return nil, fmt.Errorf("no certificate found in %s", caFile)
+	}
+
+	return &dtls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      rootCAs,
+		ServerName:   serverName,
+
+		CipherSuites: []dtls.CipherSuiteID{
+			dtls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			dtls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			dtls.TLS_ECDHE_ECDSA_WITH_AES_128_CCM,
+		},
+
+		MTU: 1200,
+	}, nil
+}
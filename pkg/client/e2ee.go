@@ -0,0 +1,206 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/e2ee"
+	"github.com/aura-speak/networking/pkg/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// e2eeState is the end-to-end encryption of the Client, see EnableE2EE
+// member is nil outside of a channel, a channel join starts a new member
+// hellos are the times a hello was sent to a member whose frames could not be opened
+type e2eeState struct {
+	config e2ee.Config
+
+	mu     sync.Mutex
+	member *e2ee.Member
+	hellos map[uint32]time.Time
+}
+
+// EnableE2EE turns on the end-to-end encryption of the voice frames in the channels the Client joins
+// The Client runs the key exchange of pkg/e2ee on its own: it announces itself after every channel join,
+// answers and retransmits the key messages, seals the frames of SendVoice and opens the received frames
+// Frames that can not be opened are not handed to the packet handlers
+// A random identity is used if config.Identity is nil, its fingerprint is returned by E2EE
+// It is called before the Client joins a channel
+//
+// Example:
+//
+//	identity, err := e2ee.NewIdentity()
+//	if err := client.EnableE2EE(e2ee.Config{Identity: identity}); err != nil {
+//		fmt.Println("Error enabling e2ee:", err)
+//	}
+//	client.JoinChannel("lobby")
+func (c *Client) EnableE2EE(config e2ee.Config) error {
+	if config.Identity == nil {
+		identity, err := e2ee.NewIdentity()
+		if err != nil {
+			return err
+		}
+		config.Identity = identity
+	}
+	c.e2ee.Store(&e2eeState{config: config})
+	return nil
+}
+
+// E2EE returns the end-to-end encryption state in the current channel
+// It is nil without EnableE2EE and outside of a channel
+//
+// Example:
+//
+//	if member := client.E2EE(); member != nil {
+//		fmt.Println("Your fingerprint:", member.Fingerprint())
+//		for ssrc, fingerprint := range member.Peers() {
+//			fmt.Printf("%08x: %s\n", ssrc, fingerprint)
+//		}
+//	}
+func (c *Client) E2EE() *e2ee.Member {
+	state := c.e2ee.Load()
+	if state == nil {
+		return nil
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.member
+}
+
+// SendKeyMessage sends an end-to-end encryption key message to a member of the channel, see pkg/e2ee
+// to is the SSRC of the member, 0 sends the message to every other member of the channel
+// The Server sets the sender SSRC and relays the body unread
+// With EnableE2EE the Client sends the key messages on its own
+//
+// Example:
+//
+//	if err := client.SendKeyMessage(0, member.Hello()); err != nil {
+//		fmt.Println("Error sending key message:", err)
+//	}
+func (c *Client) SendKeyMessage(to uint32, body []byte) error {
+	message := &protocol.KeyMessage{To: to, Body: body}
+	packet := &protocol.Packet{
+		PacketHeader: protocol.Header{PacketType: protocol.PacketTypeKeyMessage},
+		Payload:      message.Encode(),
+	}
+	return c.Send(packet.Encode())
+}
+
+// sendKeyMessages sends the key messages of the member
+func (c *Client) sendKeyMessages(messages []protocol.KeyMessage) {
+	for _, message := range messages {
+		if err := c.SendKeyMessage(message.To, message.Body); err != nil {
+			log.WithField("caller", "client").WithError(err).Warn("Error sending key message")
+		}
+	}
+}
+
+// onE2EE runs the key exchange with a received packet and opens sealed voice frames in place
+// It returns false if the packet is a frame that can not be opened
+func (c *Client) onE2EE(packet *protocol.Packet) bool {
+	state := c.e2ee.Load()
+	if state == nil {
+		return true
+	}
+	switch packet.PacketHeader.PacketType {
+	case protocol.PacketTypeChannelJoin:
+		member, err := e2ee.NewMember(c.SSRC(), state.config)
+		if err != nil {
+			log.WithField("caller", "client").WithError(err).Error("Error starting e2ee")
+			return true
+		}
+		state.mu.Lock()
+		state.member = member
+		state.hellos = make(map[uint32]time.Time)
+		state.mu.Unlock()
+		c.sendKeyMessages([]protocol.KeyMessage{{Body: member.Hello()}})
+	case protocol.PacketTypeChannelLeave:
+		state.mu.Lock()
+		state.member = nil
+		state.mu.Unlock()
+	case protocol.PacketTypeKeyMessage:
+		member := c.E2EE()
+		message, err := protocol.DecodeKeyMessage(packet.Payload)
+		if member == nil || err != nil {
+			return true
+		}
+		replies, err := member.Handle(message.From, message.Body)
+		if err != nil {
+			log.WithField("caller", "client").WithError(err).Warnf("Error handling key message of %08x", message.From)
+		}
+		c.sendKeyMessages(replies)
+	case protocol.PacketTypeVoice:
+		return c.openVoice(state, packet)
+	}
+	return true
+}
+
+// openVoice replaces a sealed voice frame with the opened one
+// A member whose frames can not be opened may have missed the hello, it is sent to it again
+func (c *Client) openVoice(state *e2eeState, packet *protocol.Packet) bool {
+	voice, err := protocol.DecodeVoice(packet.Payload)
+	if err != nil || voice.Codec != protocol.CodecE2EE {
+		return true
+	}
+	state.mu.Lock()
+	member := state.member
+	state.mu.Unlock()
+	if member == nil {
+		return false
+	}
+	codec, frame, err := member.Decrypt(nil, voice)
+	if errors.Is(err, e2ee.ErrUnknownSender) {
+		now := c.Clock.Now()
+		state.mu.Lock()
+		last, sent := state.hellos[voice.SSRC]
+		hello := state.member == member && (!sent || now.Sub(last) >= e2ee.RetransmitInterval)
+		if hello {
+			state.hellos[voice.SSRC] = now
+		}
+		state.mu.Unlock()
+		if hello {
+			c.sendKeyMessages([]protocol.KeyMessage{{To: voice.SSRC, Body: member.Hello()}})
+		}
+	}
+	if err != nil {
+		log.WithField("caller", "client").WithError(err).Debugf("Dropping voice of %08x", voice.SSRC)
+		return false
+	}
+	voice.Codec, voice.Frame = codec, frame
+	packet.Payload = voice.Encode()
+	return true
+}
+
+// sealVoice seals a frame for the channel, it returns the frame unchanged without a member
+func (c *Client) sealVoice(codec protocol.Codec, timestamp uint32, frame []byte) (protocol.Codec, []byte, error) {
+	member := c.E2EE()
+	if member == nil || codec == protocol.CodecE2EE {
+		return codec, frame, nil
+	}
+	sealed, err := member.Encrypt(nil, timestamp, codec, frame)
+	return protocol.CodecE2EE, sealed, err
+}
+
+// keyLoop retransmits the sender keys the other members did not acknowledge yet
+// It returns when the Client is stopped
+func (c *Client) keyLoop() {
+	ticker := c.Clock.NewTicker(e2ee.RetransmitInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C():
+		}
+		member := c.E2EE()
+		if member == nil {
+			continue
+		}
+		messages, err := member.Retransmit()
+		if err != nil {
+			log.WithField("caller", "client").WithError(err).Warn("Error retransmitting keys")
+		}
+		c.sendKeyMessages(messages)
+	}
+}
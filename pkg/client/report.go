@@ -0,0 +1,68 @@
+package client
+
+import (
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/report"
+	log "github.com/sirupsen/logrus"
+)
+
+// Stats returns the report statistics for the connection to the Server
+//
+// Example:
+//
+//	stats := client.Stats()
+//	fmt.Printf("round trip: %.2fms\n", stats.RoundTripMs)
+func (c *Client) Stats() report.Stats {
+	return c.report.Stats()
+}
+
+// handleSenderReport consumes a sender report from the Server
+func (c *Client) handleSenderReport(packet *protocol.Packet) error {
+	sr, err := protocol.DecodeSenderReport(packet.Payload)
+	if err != nil {
+		return err
+	}
+	c.report.HandleSenderReport(sr, c.Clock.Now())
+	return nil
+}
+
+// handleReceiverReport consumes a receiver report from the Server
+func (c *Client) handleReceiverReport(packet *protocol.Packet) error {
+	rr, err := protocol.DecodeReceiverReport(packet.Payload)
+	if err != nil {
+		return err
+	}
+	c.report.HandleReceiverReport(rr, c.Clock.Now())
+	return nil
+}
+
+// reportLoop periodically sends a sender report and, if possible, a receiver report to the Server
+// It returns when the Client is stopped
+func (c *Client) reportLoop() {
+	ticker := c.Clock.NewTicker(c.ReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C():
+		}
+		now := c.Clock.Now()
+		sr := c.report.SenderReport(now)
+		packets := []*protocol.Packet{{
+			PacketHeader: protocol.Header{PacketType: protocol.PacketTypeSenderReport},
+			Payload:      sr.Encode(),
+		}}
+		if rr, ok := c.report.ReceiverReport(now); ok {
+			packets = append(packets, &protocol.Packet{
+				PacketHeader: protocol.Header{PacketType: protocol.PacketTypeReceiverReport},
+				Payload:      rr.Encode(),
+			})
+		}
+		for _, packet := range packets {
+			if err := c.Send(packet.Encode()); err != nil {
+				log.WithField("caller", "client").WithError(err).Warn("Error sending report")
+			}
+		}
+	}
+}
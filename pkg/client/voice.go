@@ -0,0 +1,48 @@
+package client
+
+import (
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+// SendVoice sends a voice frame to the Server
+// The Client counts the sequence number, the Server replaces the SSRC with the one of the session
+// timestamp is the sampling instant of the first sample in units of the codec clock rate
+// With EnableE2EE the frame is sealed for the channel and sent with protocol.CodecE2EE
+//
+// Example:
+//
+//	timestamp += 960 // 20ms at 48kHz
+//	if err := client.SendVoice(protocol.CodecOpus, timestamp, frame); err != nil {
+//		fmt.Println("Error sending voice:", err)
+//	}
+func (c *Client) SendVoice(codec protocol.Codec, timestamp uint32, frame []byte) error {
+	codec, frame, err := c.sealVoice(codec, timestamp, frame)
+	if err != nil {
+		return err
+	}
+	voice := &protocol.Voice{
+		Sequence:  uint16(c.voiceSeq.Add(1) - 1),
+		Timestamp: timestamp,
+		Codec:     codec,
+		Frame:     frame,
+	}
+	packet := &protocol.Packet{
+		PacketHeader: protocol.Header{PacketType: protocol.PacketTypeVoice},
+		Payload:      voice.Encode(),
+	}
+	return c.Send(packet.Encode())
+}
+
+// onMedia updates the jitter estimation with a received media packet
+func (c *Client) onMedia(packet *protocol.Packet) {
+	if !protocol.IsMediaPacket(packet.PacketHeader.PacketType) {
+		return
+	}
+	voice, err := protocol.DecodeVoice(packet.Payload)
+	if err != nil {
+		return
+	}
+	if info, ok := voice.Codec.Info(); ok {
+		c.report.OnMedia(voice.SSRC, voice.Sequence, voice.Timestamp, info.ClockRate, c.Clock.Now())
+	}
+}
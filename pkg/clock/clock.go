@@ -0,0 +1,75 @@
+// Package Clock contains the time source of the client, the server and the tracing
+// It is responsible for making timestamps, timeouts and tickers replaceable,
+// so tests can advance the time by hand with a Fake instead of waiting for it
+package clock
+
+import "time"
+
+// Clock is a source of the current time and of timers
+//
+// Example:
+//
+//	ticker := c.NewTicker(time.Second)
+//	defer ticker.Stop()
+//	timeout := c.NewTimer(5 * time.Second)
+//	defer timeout.Stop()
+//	select {
+//	case <-ticker.C():
+//	case <-timeout.C():
+//	}
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	// After returns a channel that receives the time once after d
+	// Use NewTimer if the timeout is usually not reached, a Fake keeps it pending until then
+	After(d time.Duration) <-chan time.Time
+	// AfterFunc calls f in its own goroutine after d, or in Fake.Advance for a Fake
+	AfterFunc(d time.Duration, f func()) Timer
+	// NewTimer returns a Timer that receives the time once on C after d
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is a scheduled function or channel of a Clock
+type Timer interface {
+	// C receives the time when the timer fires, it is nil for AfterFunc
+	C() <-chan time.Time
+	// Stop cancels the timer, it returns false if it already fired or was stopped
+	Stop() bool
+}
+
+// Ticker delivers the time on C in a fixed interval
+// Ticks are dropped if the receiver is too slow, like with time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real is the Clock of the time package
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) Since(t time.Time) time.Duration { return time.Since(t) }
+
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer { return realTimer{time.AfterFunc(d, f)} }
+
+func (realClock) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+func (realClock) NewTicker(d time.Duration) Ticker { return realTicker{time.NewTicker(d)} }
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time { return t.Timer.C }
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time { return t.Ticker.C }
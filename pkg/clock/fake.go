@@ -0,0 +1,195 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a Clock that only moves when Advance is called
+// Timers, tickers and After channels fire in the order of their due time while advancing,
+// AfterFunc functions run in the goroutine that calls Advance
+//
+// Example:
+//
+//	fake := clock.NewFake(time.Unix(0, 0))
+//	srv.Clock = fake
+//	go srv.Run()
+//	fake.BlockUntil(1) // the report ticker is registered
+//	fake.Advance(srv.ReportInterval)
+type Fake struct {
+	mu      sync.Mutex
+	added   *sync.Cond
+	now     time.Time
+	waiters []*fakeTimer
+	seq     uint64
+}
+
+// fakeTimer is a pending timer, ticker or After channel of a Fake
+type fakeTimer struct {
+	fake   *Fake
+	when   time.Time
+	seq    uint64 // keeps the order of timers with the same due time
+	period time.Duration
+	f      func()
+	ch     chan time.Time
+}
+
+// NewFake creates a Fake that starts at start
+func NewFake(start time.Time) *Fake {
+	f := &Fake{now: start}
+	f.added = sync.NewCond(&f.mu)
+	return f
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	f.add(&fakeTimer{ch: ch}, d)
+	return ch
+}
+
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	t := &fakeTimer{f: fn}
+	f.add(t, d)
+	return t
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{ch: make(chan time.Time, 1)}
+	f.add(t, d)
+	return t
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	t := &fakeTimer{period: d, ch: make(chan time.Time, 1)}
+	f.add(t, d)
+	return fakeTicker{t}
+}
+
+// Advance moves the time forward by d and fires every timer that becomes due on the way
+// Timers that are added by a fired function are fired too if they are due before the end
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	end := f.now.Add(d)
+	f.mu.Unlock()
+	for f.fireNext(end) {
+	}
+}
+
+// BlockUntil waits until at least n timers, tickers or After channels are pending
+// It is used to wait for a goroutine to reach its timer before calling Advance
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.waiters) < n {
+		f.added.Wait()
+	}
+}
+
+// Pending returns the number of pending timers, tickers and After channels
+func (f *Fake) Pending() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+func (f *Fake) add(t *fakeTimer, d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t.fake = f
+	t.when = f.now.Add(d)
+	f.seq++
+	t.seq = f.seq
+	f.waiters = append(f.waiters, t)
+	f.added.Broadcast()
+}
+
+// fireNext fires the earliest timer that is due at end
+// It returns false and moves the time to end if there is none
+func (f *Fake) fireNext(end time.Time) bool {
+	f.mu.Lock()
+	next := -1
+	for i, t := range f.waiters {
+		if t.when.After(end) {
+			continue
+		}
+		if next < 0 || t.when.Before(f.waiters[next].when) ||
+			(t.when.Equal(f.waiters[next].when) && t.seq < f.waiters[next].seq) {
+			next = i
+		}
+	}
+	if next < 0 {
+		f.now = end
+		f.mu.Unlock()
+		return false
+	}
+	t := f.waiters[next]
+	if t.when.After(f.now) {
+		f.now = t.when
+	}
+	now := f.now
+	if t.period > 0 {
+		t.when = t.when.Add(t.period)
+		f.seq++
+		t.seq = f.seq
+	} else {
+		f.waiters = append(f.waiters[:next], f.waiters[next+1:]...)
+	}
+	f.mu.Unlock()
+
+	if t.f != nil {
+		t.f()
+		return true
+	}
+	select {
+	case t.ch <- now:
+	default:
+	}
+	return true
+}
+
+func (t *fakeTimer) remove() bool {
+	f := t.fake
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, w := range f.waiters {
+		if w == t {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Stop() bool {
+	return t.remove()
+}
+
+// fakeTicker is the Ticker view of a periodic fakeTimer
+type fakeTicker struct {
+	t *fakeTimer
+}
+
+func (t fakeTicker) C() <-chan time.Time {
+	return t.t.ch
+}
+
+func (t fakeTicker) Stop() {
+	t.t.remove()
+}
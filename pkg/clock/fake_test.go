@@ -0,0 +1,171 @@
+package clock_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/clock"
+)
+
+var start = time.Unix(1_700_000_000, 0)
+
+func TestAdvanceFiresInOrder(t *testing.T) {
+	fake := clock.NewFake(start)
+	var fired []string
+	at := make(map[string]time.Time)
+	schedule := func(name string, d time.Duration) {
+		fake.AfterFunc(d, func() {
+			fired = append(fired, name)
+			at[name] = fake.Now()
+		})
+	}
+	schedule("late", 2*time.Second)
+	schedule("first", time.Second)
+	schedule("second", time.Second)
+
+	fake.Advance(999 * time.Millisecond)
+	if len(fired) != 0 {
+		t.Fatalf("fired %v before the time", fired)
+	}
+	fake.Advance(5 * time.Second)
+	if !slices.Equal(fired, []string{"first", "second", "late"}) {
+		t.Fatalf("fired %v, want the order of the due times and of the scheduling", fired)
+	}
+	// every function sees the time it was due at, the clock ends at the end of the advance
+	if !at["first"].Equal(start.Add(time.Second)) || !at["late"].Equal(start.Add(2*time.Second)) {
+		t.Fatalf("functions ran at %v", at)
+	}
+	if want := start.Add(5999 * time.Millisecond); !fake.Now().Equal(want) {
+		t.Fatalf("clock at %s, want %s", fake.Now(), want)
+	}
+}
+
+func TestTimersAddedWhileAdvancing(t *testing.T) {
+	fake := clock.NewFake(start)
+	var fired []time.Duration
+	var rearm func()
+	rearm = func() {
+		fired = append(fired, fake.Since(start))
+		fake.AfterFunc(time.Second, rearm)
+	}
+	fake.AfterFunc(time.Second, rearm)
+
+	fake.Advance(3500 * time.Millisecond)
+	if !slices.Equal(fired, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}) {
+		t.Fatalf("fired at %v, want every second until the end of the advance", fired)
+	}
+	if fake.Pending() != 1 {
+		t.Fatalf("%d timers pending, want the one due after the advance", fake.Pending())
+	}
+}
+
+func TestStoppedTimersDoNotFire(t *testing.T) {
+	fake := clock.NewFake(start)
+	fired := false
+	timer := fake.AfterFunc(time.Second, func() { fired = true })
+	if !timer.Stop() {
+		t.Fatal("Stop of a pending timer returned false")
+	}
+	if timer.Stop() {
+		t.Fatal("second Stop returned true")
+	}
+	fake.Advance(time.Minute)
+	if fired {
+		t.Fatal("stopped timer fired")
+	}
+
+	done := fake.AfterFunc(time.Second, func() {})
+	fake.Advance(time.Second)
+	if done.Stop() {
+		t.Fatal("Stop of a fired timer returned true")
+	}
+	if fake.Pending() != 0 {
+		t.Fatalf("%d timers pending", fake.Pending())
+	}
+}
+
+func TestDeadlines(t *testing.T) {
+	fake := clock.NewFake(start)
+	deadline := fake.NewTimer(5 * time.Second)
+	after := fake.After(5 * time.Second)
+	expired := func() bool {
+		select {
+		case now := <-deadline.C():
+			if !now.Equal(start.Add(5 * time.Second)) {
+				t.Fatalf("deadline fired with %s", now)
+			}
+			return true
+		default:
+			return false
+		}
+	}
+
+	fake.Advance(4 * time.Second)
+	if expired() {
+		t.Fatal("deadline fired early")
+	}
+	fake.Advance(time.Second)
+	if !expired() {
+		t.Fatal("deadline did not fire on time")
+	}
+	select {
+	case <-after:
+	default:
+		t.Fatal("After did not fire with the deadline")
+	}
+
+	// a stopped deadline never fires
+	stopped := fake.NewTimer(time.Second)
+	stopped.Stop()
+	fake.Advance(time.Minute)
+	select {
+	case <-stopped.C():
+		t.Fatal("stopped deadline fired")
+	default:
+	}
+}
+
+func TestTickerDropsTicks(t *testing.T) {
+	fake := clock.NewFake(start)
+	ticker := fake.NewTicker(time.Second)
+	fake.Advance(3 * time.Second)
+	// the channel holds one tick like time.Ticker, the first one
+	if now := <-ticker.C(); !now.Equal(start.Add(time.Second)) {
+		t.Fatalf("tick at %s, want the first one", now)
+	}
+	select {
+	case now := <-ticker.C():
+		t.Fatalf("second tick at %s was not dropped", now)
+	default:
+	}
+	fake.Advance(time.Second)
+	if now := <-ticker.C(); !now.Equal(start.Add(4 * time.Second)) {
+		t.Fatalf("tick at %s, want after 4s", now)
+	}
+
+	ticker.Stop()
+	fake.Advance(time.Minute)
+	select {
+	case <-ticker.C():
+		t.Fatal("stopped ticker ticked")
+	default:
+	}
+}
+
+func TestBlockUntil(t *testing.T) {
+	fake := clock.NewFake(start)
+	registered := make(chan struct{})
+	go func() {
+		timer := fake.NewTimer(time.Second)
+		close(registered)
+		<-timer.C()
+	}()
+	fake.BlockUntil(1)
+	select {
+	case <-registered:
+	case <-time.After(time.Second):
+		t.Fatal("BlockUntil returned before the timer was registered")
+	}
+	fake.Advance(time.Second)
+}
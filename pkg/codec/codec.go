@@ -0,0 +1,67 @@
+// Package codec contains the audio codecs the Server can decode and encode
+// The Server forwards voice frames without decoding them, a codec is only needed to mix or record a channel
+// Samples are 16 bit signed mono PCM at the clock rate of the codec
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+// Codec decodes voice frames into samples and encodes samples into voice frames
+type Codec interface {
+	// Type returns the codec of the voice frames
+	Type() protocol.Codec
+	// Decode appends the samples of a frame to dst and returns the extended slice
+	Decode(dst []int16, frame []byte) ([]int16, error)
+	// Encode appends the frame of the samples to dst and returns the extended slice
+	Encode(dst []byte, pcm []int16) ([]byte, error)
+}
+
+// For returns the Codec of a voice frame codec
+// Opus needs libopus, which is not linked, so only protocol.CodecL16 is available
+//
+// Example:
+//
+//	c, ok := codec.For(voice.Codec)
+//	if !ok {
+//		return fmt.Errorf("codec %s can not be decoded", voice.Codec)
+//	}
+//	pcm, err := c.Decode(nil, voice.Frame)
+func For(c protocol.Codec) (Codec, bool) {
+	switch c {
+	case protocol.CodecL16:
+		return L16{}, true
+	}
+	return nil, false
+}
+
+// L16 is linear PCM with big endian samples as in RTP (RFC 3551)
+type L16 struct{}
+
+// Type returns protocol.CodecL16
+func (L16) Type() protocol.Codec {
+	return protocol.CodecL16
+}
+
+// Decode appends the samples of a L16 frame to dst
+// It returns an error if the frame has an odd number of bytes
+func (L16) Decode(dst []int16, frame []byte) ([]int16, error) {
+	if len(frame)%2 != 0 {
+		return dst, errors.New("L16 frame with an odd number of bytes")
+	}
+	for i := 0; i < len(frame); i += 2 {
+		dst = append(dst, int16(binary.BigEndian.Uint16(frame[i:])))
+	}
+	return dst, nil
+}
+
+// Encode appends the samples as L16 frame to dst
+func (L16) Encode(dst []byte, pcm []int16) ([]byte, error) {
+	for _, sample := range pcm {
+		dst = binary.BigEndian.AppendUint16(dst, uint16(sample))
+	}
+	return dst, nil
+}
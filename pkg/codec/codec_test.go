@@ -0,0 +1,42 @@
+package codec
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+func TestL16RoundTrip(t *testing.T) {
+	pcm := []int16{0, 1, -1, 32767, -32768, 0x1234}
+	frame, err := L16{}.Encode(nil, pcm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// big endian like RTP L16
+	if !bytes.Equal(frame[:4], []byte{0x00, 0x00, 0x00, 0x01}) || !bytes.Equal(frame[10:], []byte{0x12, 0x34}) {
+		t.Fatalf("encoded % x", frame)
+	}
+	got, err := L16{}.Decode(nil, frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, pcm) {
+		t.Fatalf("decoded %v, want %v", got, pcm)
+	}
+	if _, err := (L16{}).Decode(nil, frame[:3]); err == nil {
+		t.Fatal("odd frame decoded")
+	}
+}
+
+func TestFor(t *testing.T) {
+	if c, ok := For(protocol.CodecL16); !ok || c.Type() != protocol.CodecL16 {
+		t.Fatal("no L16 codec")
+	}
+	for _, c := range []protocol.Codec{protocol.CodecNone, protocol.CodecOpus} {
+		if _, ok := For(c); ok {
+			t.Errorf("codec %s available", c)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package conformance
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// Result is the outcome of one check
+type Result struct {
+	Check  string `json:"check"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Failed counts the results that are not OK
+func Failed(results []Result) int {
+	failed := 0
+	for _, result := range results {
+		if !result.OK {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Verify decodes every vector and transcript step of the set with pkg/protocol and compares the result
+// A set from another implementation passes if it agrees with this one on every datagram
+//
+// Example:
+//
+//	set, _ := conformance.LoadFile("vectors.json")
+//	for _, result := range conformance.Verify(set) {
+//		fmt.Println(result.Check, result.OK, result.Detail)
+//	}
+func Verify(set Set) []Result {
+	var results []Result
+	for _, v := range set.Vectors {
+		results = append(results, verifyVector("vector "+v.Name, v.Hex, v.Decoded, v.Error))
+	}
+	for _, t := range set.Transcripts {
+		for i, s := range t.Steps {
+			if s.Silent || s.Decoded == nil {
+				continue
+			}
+			results = append(results, verifyVector(fmt.Sprintf("transcript %s step %d", t.Name, i+1), s.Hex, s.Decoded, ""))
+		}
+	}
+	return results
+}
+
+// verifyVector compares the decoding of one datagram with the expected result
+// Only the presence of an error is compared, the messages differ between implementations
+func verifyVector(check, hexData string, expected *Decoded, expectedError string) Result {
+	data, err := hex.DecodeString(hexData)
+	if err != nil {
+		return Result{Check: check, Detail: fmt.Sprintf("invalid hex: %v", err)}
+	}
+	decoded, err := Describe(data)
+	switch {
+	case err != nil && expectedError == "":
+		return Result{Check: check, Detail: fmt.Sprintf("rejected as packet: %v", err)}
+	case err == nil && expectedError != "":
+		return Result{Check: check, Detail: fmt.Sprintf("accepted as %s, expected an error (%s)", decoded.PacketType, expectedError)}
+	case err != nil:
+		return Result{Check: check, OK: true}
+	}
+	if expected == nil {
+		return Result{Check: check, Detail: "vector has neither decoded nor error"}
+	}
+	if (expected.PayloadError == "") != (decoded.PayloadError == "") {
+		return Result{Check: check, Detail: fmt.Sprintf("payload error %q, expected %q", decoded.PayloadError, expected.PayloadError)}
+	}
+	// the messages of payload errors are as free as the ones of packet errors
+	got, want := *decoded, *expected
+	got.PayloadError, want.PayloadError = "", ""
+	if !sameJSON(got, want) {
+		return Result{Check: check, Detail: fmt.Sprintf("decoded %s, expected %s", toJSON(got), toJSON(want))}
+	}
+	return Result{Check: check, OK: true}
+}
@@ -0,0 +1,175 @@
+package conformance
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+// Decoded is the expected result of decoding a datagram
+// Fields holds the decoded payload of the packet types with a payload format
+// PayloadError is set if the packet decodes but its payload must be rejected
+type Decoded struct {
+	PacketType   string         `json:"packetType"`
+	TypeCode     uint8          `json:"typeCode"`
+	PayloadHex   string         `json:"payloadHex"`
+	Fields       map[string]any `json:"fields,omitempty"`
+	PayloadError string         `json:"payloadError,omitempty"`
+}
+
+// Describe decodes a datagram with pkg/protocol into its Decoded form
+// It returns an error if the datagram is no packet at all
+func Describe(data []byte) (*Decoded, error) {
+	packet, err := protocol.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	packetType := packet.PacketHeader.PacketType
+	decoded := &Decoded{
+		PacketType: typeName(packetType),
+		TypeCode:   uint8(packetType),
+		PayloadHex: hex.EncodeToString(packet.Payload),
+	}
+	decoded.Fields, err = fields(packetType, packet.Payload)
+	if err != nil {
+		decoded.Fields = nil
+		decoded.PayloadError = err.Error()
+	}
+	return decoded, nil
+}
+
+// fields decodes the payload of the packet types with a payload format
+func fields(packetType protocol.PacketType, payload []byte) (map[string]any, error) {
+	switch packetType {
+	case protocol.PacketTypeConnect:
+		request, err := protocol.DecodeConnectRequest(payload)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{
+			"cookie":     hex.EncodeToString(request.Cookie),
+			"credential": hex.EncodeToString(request.Credential),
+		}, nil
+	case protocol.PacketTypeConnectAccept:
+		accept, err := protocol.DecodeConnectAccept(payload)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"ssrc": accept.SSRC}, nil
+	case protocol.PacketTypeHelloVerify:
+		verify, err := protocol.DecodeHelloVerify(payload)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"cookie": hex.EncodeToString(verify.Cookie)}, nil
+	case protocol.PacketTypeConnectReject:
+		reject, err := protocol.DecodeConnectReject(payload)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"reason": uint8(reject.Reason), "reasonName": reject.Reason.String()}, nil
+	case protocol.PacketTypeError:
+		reply, err := protocol.DecodeErrorReply(payload)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{
+			"code":       uint8(reply.Code),
+			"codeName":   reply.Code.String(),
+			"packetType": uint8(reply.PacketType),
+			"message":    reply.Message,
+		}, nil
+	case protocol.PacketTypeSenderReport:
+		report, err := protocol.DecodeSenderReport(payload)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{
+			"ntpTimestamp": report.NTPTimestamp,
+			"packetCount":  report.PacketCount,
+			"octetCount":   report.OctetCount,
+		}, nil
+	case protocol.PacketTypeReceiverReport:
+		report, err := protocol.DecodeReceiverReport(payload)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{
+			"senderPacketCount": report.SenderPacketCount,
+			"highestSequence":   report.HighestSequence,
+			"cumulativeLost":    report.CumulativeLost,
+			"fractionLost":      report.FractionLost,
+			"jitter":            report.Jitter,
+			"lastSR":            report.LastSR,
+			"delaySinceLastSR":  report.DelaySinceLastSR,
+		}, nil
+	case protocol.PacketTypeVoice:
+		voice, err := protocol.DecodeVoice(payload)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{
+			"ssrc":      voice.SSRC,
+			"sequence":  voice.Sequence,
+			"timestamp": voice.Timestamp,
+			"codec":     uint8(voice.Codec),
+			"codecName": voice.Codec.String(),
+			"frame":     hex.EncodeToString(voice.Frame),
+		}, nil
+	case protocol.PacketTypeChannelJoin, protocol.PacketTypeRecordStart, protocol.PacketTypeRecordStop:
+		if err := protocol.ValidChannelName(payload); err != nil {
+			return nil, err
+		}
+		return map[string]any{"channel": string(payload)}, nil
+	case protocol.PacketTypeFloorGrant, protocol.PacketTypeFloorDeny, protocol.PacketTypeFloorRelease, protocol.PacketTypeFloorRevoke:
+		floor, err := protocol.DecodeFloor(payload)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{
+			"ssrc":       floor.SSRC,
+			"reason":     uint8(floor.Reason),
+			"reasonName": floor.Reason.String(),
+			"position":   floor.Position,
+			"maxTalkMs":  floor.MaxTalkMs,
+		}, nil
+	case protocol.PacketTypeKeyMessage:
+		message, err := protocol.DecodeKeyMessage(payload)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{
+			"to":   message.To,
+			"from": message.From,
+			"body": hex.EncodeToString(message.Body),
+		}, nil
+	}
+	return nil, nil
+}
+
+// typeName returns the name of a packet type, unknown types keep their code
+func typeName(packetType protocol.PacketType) string {
+	if name, ok := protocol.PacketTypeMapType[packetType]; ok {
+		return name
+	}
+	return fmt.Sprintf("Unknown(0x%02X)", uint8(packetType))
+}
+
+// sameJSON tells if two values have the same JSON encoding
+// Decoded values from a file and from Describe differ in their number types, their JSON does not
+func sameJSON(a, b any) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
+
+// toJSON returns the JSON encoding of a value for messages
+func toJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
@@ -0,0 +1,369 @@
+package conformance
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/report"
+)
+
+// DefaultQuiet is how long a peer has to stay silent for a packet that must not be answered
+const DefaultQuiet = 500 * time.Millisecond
+
+// ServerOptions configure CheckServer
+// Credential is sent with the connect, Reject and Reason are the expected answer to it
+// Reports exchanges sender and receiver reports after the handshake, this takes up to ReportTimeout
+type ServerOptions struct {
+	Credential    []byte
+	Reject        bool
+	Reason        protocol.RejectReason
+	Reports       bool
+	Timeout       time.Duration
+	Quiet         time.Duration
+	ReportTimeout time.Duration
+}
+
+// ClientOptions configure CheckClient
+// Timeout is how long to wait for the client to connect, it has to be started by hand
+type ClientOptions struct {
+	Reports       bool
+	Timeout       time.Duration
+	ReportTimeout time.Duration
+}
+
+func (o *ServerOptions) defaults() {
+	if o.Timeout == 0 {
+		o.Timeout = 2 * time.Second
+	}
+	if o.Quiet == 0 {
+		o.Quiet = DefaultQuiet
+	}
+	if o.ReportTimeout == 0 {
+		o.ReportTimeout = 2*report.DefaultInterval + time.Second
+	}
+}
+
+func (o *ClientOptions) defaults() {
+	if o.Timeout == 0 {
+		o.Timeout = 30 * time.Second
+	}
+	if o.ReportTimeout == 0 {
+		o.ReportTimeout = 2*report.DefaultInterval + time.Second
+	}
+}
+
+// CheckServer drives the server at addr through the transcripts over plain UDP
+// It stops at the first failed step the following steps depend on
+//
+// Example:
+//
+//	results, err := conformance.CheckServer("127.0.0.1:8080", conformance.ServerOptions{Reports: true})
+func CheckServer(addr string, opts ServerOptions) ([]Result, error) {
+	opts.defaults()
+	remote, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, remote)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	p := &peer{conn: conn, dialed: true}
+
+	var results []Result
+	add := func(check string, err error) bool {
+		results = append(results, result(check, err))
+		return err == nil
+	}
+
+	add("datagram that is no packet is dropped", p.silent(opts.Quiet, []byte{0x00}, nil))
+	add("packet before the handshake is dropped", p.silent(opts.Quiet, encode(protocol.PacketTypeDebugAny, []byte("Hello, Server!"))))
+	add("connect smaller than a hello verify gets no answer", p.silent(opts.Quiet, encode(protocol.PacketTypeConnect, []byte{0x00, 0x00, 0x00})))
+
+	first := encode(protocol.PacketTypeConnect, (&protocol.ConnectRequest{Credential: opts.Credential}).Encode())
+	p.send(first)
+	answer, err := p.expect(opts.Timeout, protocol.PacketTypeHelloVerify)
+	if !add("connect without cookie gets a hello verify", err) {
+		return results, nil
+	}
+	verify, err := protocol.DecodeHelloVerify(answer.Payload)
+	if !add("hello verify has a cookie of CookieSize bytes", err) {
+		return results, nil
+	}
+	cookie := bytes.Clone(verify.Cookie)
+	var amplification error
+	if size := protocol.HeaderSize + len(answer.Payload); size > len(first) {
+		amplification = fmt.Errorf("hello verify of %d bytes answers a connect of %d bytes", size, len(first))
+	}
+	add("hello verify is not larger than the connect", amplification)
+
+	wrong := bytes.Clone(cookie)
+	wrong[0] ^= 0xFF
+	p.send(encode(protocol.PacketTypeConnect, (&protocol.ConnectRequest{Cookie: wrong, Credential: opts.Credential}).Encode()))
+	_, err = p.expect(opts.Timeout, protocol.PacketTypeHelloVerify)
+	add("connect with a wrong cookie gets a new hello verify", err)
+
+	p.send(encode(protocol.PacketTypeConnect, (&protocol.ConnectRequest{Cookie: cookie, Credential: opts.Credential}).Encode()))
+	answer, err = p.expect(opts.Timeout, protocol.PacketTypeConnectAccept, protocol.PacketTypeConnectReject)
+	if !add("connect with the cookie is answered", err) {
+		return results, nil
+	}
+	if !add("connect is answered as expected", expectedAnswer(answer, opts)) || opts.Reject || !opts.Reports {
+		return results, nil
+	}
+
+	// the server sends its reports on its own interval, it only answers with a receiver report once it has a sender report
+	ntp := report.ToNTP(time.Now())
+	p.send(encode(protocol.PacketTypeSenderReport, (&protocol.SenderReport{NTPTimestamp: ntp}).Encode()))
+	results = append(results, p.reports(opts.ReportTimeout, ntp)...)
+	return results, nil
+}
+
+// expectedAnswer compares the answer to a connect with the cookie with the options
+func expectedAnswer(answer *protocol.Packet, opts ServerOptions) error {
+	if answer.PacketHeader.PacketType == protocol.PacketTypeConnectAccept {
+		if opts.Reject {
+			return fmt.Errorf("accepted, expected a reject with %s", opts.Reason)
+		}
+		return nil
+	}
+	reject, err := protocol.DecodeConnectReject(answer.Payload)
+	if err != nil {
+		return err
+	}
+	if !opts.Reject {
+		return fmt.Errorf("rejected with %s, expected an accept", reject.Reason)
+	}
+	if reject.Reason != opts.Reason {
+		return fmt.Errorf("rejected with %s, expected %s", reject.Reason, opts.Reason)
+	}
+	return nil
+}
+
+// CheckClient acts as the server for one client connecting to listen
+// It answers the first connect with a hello verify and the repeated one with an accept
+//
+// Example:
+//
+//	results, err := conformance.CheckClient(":8080", conformance.ClientOptions{Reports: true})
+func CheckClient(listen string, opts ClientOptions) ([]Result, error) {
+	opts.defaults()
+	local, err := net.ResolveUDPAddr("udp", listen)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", local)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	p := &peer{conn: conn}
+
+	var results []Result
+	add := func(check string, err error) bool {
+		results = append(results, result(check, err))
+		return err == nil
+	}
+
+	packet, err := p.expect(opts.Timeout, protocol.PacketTypeConnect)
+	if !add("client sends a connect", err) {
+		return results, nil
+	}
+	var padding error
+	if size := protocol.HeaderSize + len(packet.Payload); size < protocol.MinConnectSize {
+		padding = fmt.Errorf("connect has %d bytes, expected at least %d", size, protocol.MinConnectSize)
+	}
+	add("connect is padded to MinConnectSize", padding)
+	request, err := protocol.DecodeConnectRequest(packet.Payload)
+	if !add("connect request decodes", err) {
+		return results, nil
+	}
+	var cookieErr error
+	if len(request.Cookie) != 0 {
+		cookieErr = fmt.Errorf("first connect has a cookie of %d bytes", len(request.Cookie))
+	}
+	add("first connect has no cookie", cookieErr)
+	credential := bytes.Clone(request.Credential)
+
+	cookie := make([]byte, protocol.CookieSize)
+	rand.Read(cookie)
+	p.send(encode(protocol.PacketTypeHelloVerify, (&protocol.HelloVerify{Cookie: cookie}).Encode()))
+	packet, err = p.expect(opts.Timeout, protocol.PacketTypeConnect)
+	if !add("hello verify is answered with a connect", err) {
+		return results, nil
+	}
+	request, err = protocol.DecodeConnectRequest(packet.Payload)
+	if !add("repeated connect request decodes", err) {
+		return results, nil
+	}
+	var repeatErr error
+	switch {
+	case !bytes.Equal(request.Cookie, cookie):
+		repeatErr = fmt.Errorf("cookie %x, expected %x", request.Cookie, cookie)
+	case !bytes.Equal(request.Credential, credential):
+		repeatErr = errors.New("credential differs from the first connect")
+	}
+	if !add("repeated connect has the cookie and the credential", repeatErr) {
+		return results, nil
+	}
+
+	p.send(encode(protocol.PacketTypeConnectAccept, exampleAccept.Encode()))
+	if !opts.Reports {
+		return results, nil
+	}
+	ntp := report.ToNTP(time.Now())
+	p.send(encode(protocol.PacketTypeSenderReport, (&protocol.SenderReport{NTPTimestamp: ntp}).Encode()))
+	results = append(results, p.reports(opts.ReportTimeout, ntp)...)
+	return results, nil
+}
+
+func result(check string, err error) Result {
+	if err != nil {
+		return Result{Check: check, Detail: err.Error()}
+	}
+	return Result{Check: check, OK: true}
+}
+
+// peer is the UDP socket of a check
+// A dialed socket talks to its remote, a listening one to the first remote that sends a packet
+type peer struct {
+	conn   *net.UDPConn
+	dialed bool
+	remote *net.UDPAddr
+	buf    [protocol.MaxPacketSize + 1]byte
+}
+
+func (p *peer) send(data []byte) {
+	if p.dialed {
+		p.conn.Write(data)
+		return
+	}
+	p.conn.WriteToUDP(data, p.remote)
+}
+
+// read returns the next packet of the remote until the deadline
+// Datagrams that do not decode are returned as error, the remote must not send them
+func (p *peer) read(deadline time.Time) (*protocol.Packet, error) {
+	p.conn.SetReadDeadline(deadline)
+	for {
+		n, addr, err := p.conn.ReadFromUDP(p.buf[:])
+		if err != nil {
+			return nil, err
+		}
+		if !p.dialed {
+			if p.remote == nil {
+				p.remote = addr
+			} else if addr.String() != p.remote.String() {
+				continue
+			}
+		}
+		packet, err := protocol.Decode(bytes.Clone(p.buf[:n]))
+		if err != nil {
+			return nil, fmt.Errorf("remote sent a datagram that is no packet: %w", err)
+		}
+		return packet, nil
+	}
+}
+
+// background are the packets a peer may send at any time, they are skipped unless expected
+func background(packetType protocol.PacketType) bool {
+	return protocol.IsReportPacket(packetType) ||
+		packetType == protocol.PacketTypeDebugHello ||
+		packetType == protocol.PacketTypeDebugAny
+}
+
+// expect waits for a packet of one of the types
+func (p *peer) expect(timeout time.Duration, types ...protocol.PacketType) (*protocol.Packet, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		packet, err := p.read(deadline)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return nil, fmt.Errorf("no %s within %s", typeNames(types), timeout)
+			}
+			return nil, err
+		}
+		packetType := packet.PacketHeader.PacketType
+		if slices.Contains(types, packetType) {
+			return packet, nil
+		}
+		if !background(packetType) {
+			return nil, fmt.Errorf("got %s, expected %s", typeName(packetType), typeNames(types))
+		}
+	}
+}
+
+// silent sends the datagrams and checks that nothing but background packets come back within quiet
+func (p *peer) silent(quiet time.Duration, datagrams ...[]byte) error {
+	for _, data := range datagrams {
+		p.send(data)
+	}
+	deadline := time.Now().Add(quiet)
+	for {
+		packet, err := p.read(deadline)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return nil
+			}
+			return err
+		}
+		if !background(packet.PacketHeader.PacketType) {
+			return fmt.Errorf("answered with %s", typeName(packet.PacketHeader.PacketType))
+		}
+	}
+}
+
+// reports waits for a sender report of the remote and a receiver report that refers to the sender report with ntp
+func (p *peer) reports(timeout time.Duration, ntp uint64) []Result {
+	var sr, rr error = fmt.Errorf("no sender report within %s", timeout), fmt.Errorf("no receiver report within %s", timeout)
+	lastSR := uint32(ntp >> 16)
+	deadline := time.Now().Add(timeout)
+	for (sr != nil || rr != nil) && time.Now().Before(deadline) {
+		packet, err := p.read(deadline)
+		if err != nil {
+			var netErr net.Error
+			if !errors.As(err, &netErr) || !netErr.Timeout() {
+				sr, rr = err, err
+			}
+			break
+		}
+		switch packet.PacketHeader.PacketType {
+		case protocol.PacketTypeSenderReport:
+			_, sr = protocol.DecodeSenderReport(packet.Payload)
+		case protocol.PacketTypeReceiverReport:
+			report, err := protocol.DecodeReceiverReport(packet.Payload)
+			switch {
+			case err != nil:
+				rr = err
+			case report.LastSR == lastSR:
+				rr = nil
+			case rr != nil:
+				rr = fmt.Errorf("receiver report has LastSR %08x, expected %08x", report.LastSR, lastSR)
+			}
+		}
+	}
+	return []Result{
+		result("remote sends sender reports", sr),
+		result("receiver report refers to the last sender report", rr),
+	}
+}
+
+func typeNames(types []protocol.PacketType) string {
+	names := ""
+	for i, packetType := range types {
+		if i > 0 {
+			names += " or "
+		}
+		names += typeName(packetType)
+	}
+	return names
+}
@@ -0,0 +1,365 @@
+// Package Conformance contains the wire format test vectors of the protocol and scripted checks of other implementations
+// It is responsible for generating the vectors from pkg/protocol, verifying an implementation against them
+// and driving a remote server or client through the handshake to report where it differs
+// The vectors are versioned, a change of the wire format needs a new Version and a new file in vectors/
+package conformance
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+// Version is the version of the vectors Generate creates
+const Version = 2
+
+// published is the vectors file of the current Version
+//
+//go:embed vectors/v2.json
+var published []byte
+
+// Set is a versioned set of test vectors and transcripts
+type Set struct {
+	Version     int          `json:"version"`
+	Constants   Constants    `json:"constants"`
+	Vectors     []Vector     `json:"vectors"`
+	Transcripts []Transcript `json:"transcripts"`
+}
+
+// Constants are the sizes and codes of the wire format
+type Constants struct {
+	HeaderSize           int              `json:"headerSize"`
+	MaxPacketSize        int              `json:"maxPacketSize"`
+	CookieSize           int              `json:"cookieSize"`
+	MinConnectSize       int              `json:"minConnectSize"`
+	SenderReportSize     int              `json:"senderReportSize"`
+	ReceiverReportSize   int              `json:"receiverReportSize"`
+	VoiceHeaderSize      int              `json:"voiceHeaderSize"`
+	ConnectAcceptSize    int              `json:"connectAcceptSize"`
+	MaxChannelNameSize   int              `json:"maxChannelNameSize"`
+	FloorSize            int              `json:"floorSize"`
+	KeyMessageHeaderSize int              `json:"keyMessageHeaderSize"`
+	PacketTypes          map[string]uint8 `json:"packetTypes"`
+	RejectReasons        map[string]uint8 `json:"rejectReasons"`
+	ErrorCodes           map[string]uint8 `json:"errorCodes"`
+	Codecs               map[string]uint8 `json:"codecs"`
+	FloorReasons         map[string]uint8 `json:"floorReasons"`
+}
+
+// Vector is one datagram and how it decodes
+// Error is set instead of Decoded if the datagram must be rejected as packet
+type Vector struct {
+	Name    string   `json:"name"`
+	Hex     string   `json:"hex"`
+	Decoded *Decoded `json:"decoded,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// Transcript is a scripted exchange between a client and a server
+type Transcript struct {
+	Name  string `json:"name"`
+	Notes string `json:"notes"`
+	Steps []Step `json:"steps"`
+}
+
+// Step is one datagram of a Transcript, or the absence of an answer if Silent is set
+// Variable lists the fields that differ between runs, e.g. the cookie, they are compared by size only
+type Step struct {
+	From     string   `json:"from"`
+	Hex      string   `json:"hex,omitempty"`
+	Decoded  *Decoded `json:"decoded,omitempty"`
+	Silent   bool     `json:"silent,omitempty"`
+	Variable []string `json:"variable,omitempty"`
+	Note     string   `json:"note,omitempty"`
+}
+
+// Step senders
+const (
+	FromClient = "client"
+	FromServer = "server"
+)
+
+// Published returns the vectors file of the current Version
+func Published() (Set, error) {
+	return Load(bytes.NewReader(published))
+}
+
+// Load reads a vectors file
+// Numbers are kept exact, so 64 bit fields survive the round trip
+func Load(r io.Reader) (Set, error) {
+	var set Set
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	if err := decoder.Decode(&set); err != nil {
+		return Set{}, err
+	}
+	if set.Version != Version {
+		return Set{}, fmt.Errorf("vectors have version %d, this implementation speaks version %d", set.Version, Version)
+	}
+	return set, nil
+}
+
+// LoadFile reads a vectors file from path
+func LoadFile(path string) (Set, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Set{}, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// Write writes the set as indented JSON
+func (s Set) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s)
+}
+
+// Generate creates the vectors and transcripts from pkg/protocol
+// The output only depends on the code, so it can be compared with the published file
+func Generate() Set {
+	return Set{
+		Version:     Version,
+		Constants:   constants(),
+		Vectors:     vectors(),
+		Transcripts: transcripts(),
+	}
+}
+
+func constants() Constants {
+	c := Constants{
+		HeaderSize:           protocol.HeaderSize,
+		MaxPacketSize:        protocol.MaxPacketSize,
+		CookieSize:           protocol.CookieSize,
+		MinConnectSize:       protocol.MinConnectSize,
+		SenderReportSize:     protocol.SenderReportSize,
+		ReceiverReportSize:   protocol.ReceiverReportSize,
+		VoiceHeaderSize:      protocol.VoiceHeaderSize,
+		ConnectAcceptSize:    protocol.ConnectAcceptSize,
+		MaxChannelNameSize:   protocol.MaxChannelNameSize,
+		FloorSize:            protocol.FloorSize,
+		KeyMessageHeaderSize: protocol.KeyMessageHeaderSize,
+		PacketTypes:          make(map[string]uint8),
+		RejectReasons:        make(map[string]uint8),
+		ErrorCodes:           make(map[string]uint8),
+		Codecs:               make(map[string]uint8),
+		FloorReasons:         make(map[string]uint8),
+	}
+	for _, mapping := range protocol.PacketTypeMap {
+		c.PacketTypes[mapping.String] = uint8(mapping.PacketType)
+	}
+	for reason := protocol.RejectReasonUnknown; reason <= protocol.RejectReasonBanned; reason++ {
+		c.RejectReasons[reason.String()] = uint8(reason)
+	}
+	for code := protocol.ErrorCodeUnknown; code <= protocol.ErrorCodeInvalidState; code++ {
+		c.ErrorCodes[code.String()] = uint8(code)
+	}
+	for codec := protocol.CodecL16; codec <= protocol.CodecE2EE; codec++ {
+		c.Codecs[codec.String()] = uint8(codec)
+	}
+	for reason := protocol.FloorReasonNone; reason <= protocol.FloorReasonTimeout; reason++ {
+		c.FloorReasons[reason.String()] = uint8(reason)
+	}
+	return c
+}
+
+// vector describes data with Describe
+func vector(name string, data []byte) Vector {
+	v := Vector{Name: name, Hex: hex.EncodeToString(data)}
+	decoded, err := Describe(data)
+	if err != nil {
+		v.Error = err.Error()
+		return v
+	}
+	v.Decoded = decoded
+	return v
+}
+
+// step describes data with Describe for a Transcript
+func step(from string, data []byte, note string, variable ...string) Step {
+	decoded, err := Describe(data)
+	if err != nil {
+		return Step{From: from, Hex: hex.EncodeToString(data), Note: note + " (" + err.Error() + ")"}
+	}
+	return Step{From: from, Hex: hex.EncodeToString(data), Decoded: decoded, Note: note, Variable: variable}
+}
+
+func encode(packetType protocol.PacketType, payload []byte) []byte {
+	packet := &protocol.Packet{
+		PacketHeader: protocol.Header{PacketType: packetType},
+		Payload:      payload,
+	}
+	return packet.Encode()
+}
+
+// exampleCookie and exampleCredential are the fixed values of the vectors, real cookies are random
+var (
+	exampleCookie     = []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f}
+	exampleCredential = []byte("eyJ1c2VyIjoiYWxpY2UifQ.c2lnbmF0dXJl")
+	exampleSR         = protocol.SenderReport{NTPTimestamp: 0xEA1B2C3D_80000000, PacketCount: 250, OctetCount: 40000}
+	exampleRR         = protocol.ReceiverReport{SenderPacketCount: 250, HighestSequence: 0x1002A, CumulativeLost: 3, FractionLost: 2, Jitter: 1500, LastSR: 0x2C3D8000, DelaySinceLastSR: 0x00008000}
+	exampleVoice      = protocol.Voice{SSRC: 0x1A2B3C4D, Sequence: 0xFFFF, Timestamp: 0x00012C00, Codec: protocol.CodecOpus, Frame: []byte{0xFC, 0xFF, 0xFE}}
+	exampleAccept     = protocol.ConnectAccept{SSRC: 0x1A2B3C4D}
+	exampleGrant      = protocol.Floor{SSRC: 0x1A2B3C4D, MaxTalkMs: 30000}
+)
+
+func vectors() []Vector {
+	first := &protocol.ConnectRequest{}
+	withCredential := &protocol.ConnectRequest{Credential: exampleCredential}
+	withCookie := &protocol.ConnectRequest{Cookie: exampleCookie, Credential: exampleCredential}
+	verify := &protocol.HelloVerify{Cookie: exampleCookie}
+	denied := &protocol.ErrorReply{Code: protocol.ErrorCodePermissionDenied, PacketType: protocol.PacketTypeDebugAny, Message: "speak"}
+	malformed := &protocol.ErrorReply{Code: protocol.ErrorCodeMalformed, PacketType: protocol.PacketTypeChannelJoin, Message: "channel name contains control characters"}
+	duplicated := protocol.ReceiverReport{SenderPacketCount: 10, CumulativeLost: -2}
+	sr := exampleSR
+	rr := exampleRR
+	voice := exampleVoice
+	silence := protocol.Voice{SSRC: 1, Codec: protocol.CodecL16}
+	accept := exampleAccept
+	grant := exampleGrant
+	queued := protocol.Floor{Reason: protocol.FloorReasonQueued, Position: 2}
+	preempted := protocol.Floor{SSRC: 0x1A2B3C4D, Reason: protocol.FloorReasonPreempted}
+	keyMessage := protocol.KeyMessage{To: 0x1A2B3C4D, From: 0x5E6F7081, Body: []byte{0x01, 0xAA, 0xBB}}
+	keyLeft := protocol.KeyMessage{From: 0x5E6F7081}
+	sealed := protocol.Voice{SSRC: 0x1A2B3C4D, Sequence: 1, Timestamp: 960, Codec: protocol.CodecE2EE, Frame: []byte{0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x5A}}
+
+	v := []Vector{
+		vector("empty datagram", nil),
+		vector("packet type none", []byte{0x00}),
+		vector("packet type none with payload", []byte{0x00, 0x01, 0x02}),
+		vector("larger than MaxPacketSize", bytes.Repeat([]byte{byte(protocol.PacketTypeDebugAny)}, protocol.MaxPacketSize+1)),
+		vector("exactly MaxPacketSize", encode(protocol.PacketTypeDebugAny, bytes.Repeat([]byte{0xAA}, protocol.MaxPacketSize-protocol.HeaderSize))),
+		vector("unknown packet type is accepted as packet", encode(0x42, []byte{0x01})),
+		vector("client needs disconnect", encode(protocol.PacketTypeClientNeedsDisconnect, nil)),
+		vector("connect, first attempt without credential, padded", encode(protocol.PacketTypeConnect, first.Encode())),
+		vector("connect, first attempt with credential", encode(protocol.PacketTypeConnect, withCredential.Encode())),
+		vector("connect, second attempt with cookie", encode(protocol.PacketTypeConnect, withCookie.Encode())),
+		vector("connect without padding", encode(protocol.PacketTypeConnect, []byte{0x00, 0x00, 0x00})),
+		vector("connect with trailing padding after the credential", encode(protocol.PacketTypeConnect, append(withCredential.Encode(), 0x00, 0x00))),
+		vector("connect, cookie length past the end", encode(protocol.PacketTypeConnect, []byte{0x10, 0x00})),
+		vector("connect, credential length past the end", encode(protocol.PacketTypeConnect, []byte{0x00, 0x00, 0x05, 'a'})),
+		vector("connect, empty payload", encode(protocol.PacketTypeConnect, nil)),
+		vector("connect accept", encode(protocol.PacketTypeConnectAccept, accept.Encode())),
+		vector("connect accept without SSRC", encode(protocol.PacketTypeConnectAccept, nil)),
+		vector("connect accept, SSRC too short", encode(protocol.PacketTypeConnectAccept, accept.Encode()[:protocol.ConnectAcceptSize-1])),
+		vector("hello verify", encode(protocol.PacketTypeHelloVerify, verify.Encode())),
+		vector("hello verify, cookie too short", encode(protocol.PacketTypeHelloVerify, exampleCookie[:protocol.CookieSize-1])),
+		vector("hello verify, cookie too long", encode(protocol.PacketTypeHelloVerify, append(verify.Encode(), 0x10))),
+		vector("connect reject, empty payload", encode(protocol.PacketTypeConnectReject, nil)),
+		vector("connect reject, unknown reason", encode(protocol.PacketTypeConnectReject, []byte{0xFF})),
+		vector("error reply, permission denied", encode(protocol.PacketTypeError, denied.Encode())),
+		vector("error reply, malformed", encode(protocol.PacketTypeError, malformed.Encode())),
+		vector("error reply without message", encode(protocol.PacketTypeError, []byte{byte(protocol.ErrorCodeUnknown), byte(protocol.PacketTypeDebugHello)})),
+		vector("error reply, too short", encode(protocol.PacketTypeError, []byte{byte(protocol.ErrorCodePermissionDenied)})),
+		vector("sender report", encode(protocol.PacketTypeSenderReport, sr.Encode())),
+		vector("sender report, too short", encode(protocol.PacketTypeSenderReport, sr.Encode()[:protocol.SenderReportSize-1])),
+		vector("sender report with trailing bytes", encode(protocol.PacketTypeSenderReport, append(sr.Encode(), 0xFF))),
+		vector("receiver report", encode(protocol.PacketTypeReceiverReport, rr.Encode())),
+		vector("receiver report, negative cumulative lost", encode(protocol.PacketTypeReceiverReport, duplicated.Encode())),
+		vector("receiver report, too short", encode(protocol.PacketTypeReceiverReport, rr.Encode()[:protocol.ReceiverReportSize-1])),
+		vector("voice", encode(protocol.PacketTypeVoice, voice.Encode())),
+		vector("voice without frame", encode(protocol.PacketTypeVoice, silence.Encode())),
+		vector("voice, too short", encode(protocol.PacketTypeVoice, voice.Encode()[:protocol.VoiceHeaderSize-1])),
+		vector("channel join", encode(protocol.PacketTypeChannelJoin, []byte("lobby"))),
+		vector("channel join, empty name", encode(protocol.PacketTypeChannelJoin, nil)),
+		vector("channel join, name too long", encode(protocol.PacketTypeChannelJoin, bytes.Repeat([]byte{'a'}, protocol.MaxChannelNameSize+1))),
+		vector("channel join, control character", encode(protocol.PacketTypeChannelJoin, []byte("lob\nby"))),
+		vector("channel leave", encode(protocol.PacketTypeChannelLeave, nil)),
+		vector("floor request", encode(protocol.PacketTypeFloorRequest, nil)),
+		vector("floor grant", encode(protocol.PacketTypeFloorGrant, grant.Encode())),
+		vector("floor grant, too short", encode(protocol.PacketTypeFloorGrant, grant.Encode()[:protocol.FloorSize-1])),
+		vector("floor deny, queued", encode(protocol.PacketTypeFloorDeny, queued.Encode())),
+		vector("floor release", encode(protocol.PacketTypeFloorRelease, (&protocol.Floor{SSRC: 0x1A2B3C4D}).Encode())),
+		vector("floor revoke, preempted", encode(protocol.PacketTypeFloorRevoke, preempted.Encode())),
+		vector("record start", encode(protocol.PacketTypeRecordStart, []byte("lobby"))),
+		vector("record stop", encode(protocol.PacketTypeRecordStop, []byte("lobby"))),
+		vector("record start without channel", encode(protocol.PacketTypeRecordStart, nil)),
+		vector("key message", encode(protocol.PacketTypeKeyMessage, keyMessage.Encode())),
+		vector("key message, member left", encode(protocol.PacketTypeKeyMessage, keyLeft.Encode())),
+		vector("key message, header too short", encode(protocol.PacketTypeKeyMessage, keyMessage.Encode()[:protocol.KeyMessageHeaderSize-1])),
+		vector("voice, end-to-end encrypted", encode(protocol.PacketTypeVoice, sealed.Encode())),
+		vector("debug hello", encode(protocol.PacketTypeDebugHello, []byte("42"))),
+		vector("debug any", encode(protocol.PacketTypeDebugAny, []byte("Hello, Server!"))),
+	}
+	for reason := protocol.RejectReasonUnknown; reason <= protocol.RejectReasonBanned; reason++ {
+		reject := &protocol.ConnectReject{Reason: reason}
+		v = append(v, vector("connect reject, "+reason.String(), encode(protocol.PacketTypeConnectReject, reject.Encode())))
+	}
+	return v
+}
+
+func transcripts() []Transcript {
+	first := &protocol.ConnectRequest{Credential: exampleCredential}
+	second := &protocol.ConnectRequest{Cookie: exampleCookie, Credential: exampleCredential}
+	verify := &protocol.HelloVerify{Cookie: exampleCookie}
+	reject := &protocol.ConnectReject{Reason: protocol.RejectReasonInvalidCredential}
+	denied := &protocol.ErrorReply{Code: protocol.ErrorCodePermissionDenied, PacketType: protocol.PacketTypeDebugAny, Message: "speak"}
+	sr := exampleSR
+	rr := exampleRR
+	accept := exampleAccept
+
+	return []Transcript{
+		{
+			Name: "handshake",
+			Notes: "The server answers a connect without a valid cookie with a hello verify and stores nothing. " +
+				"The cookie is bound to the address of the client and changes with the secret of the server.",
+			Steps: []Step{
+				step(FromClient, encode(protocol.PacketTypeConnect, first.Encode()), "first connect, padded to MinConnectSize"),
+				step(FromServer, encode(protocol.PacketTypeHelloVerify, verify.Encode()), "never larger than the connect", "fields.cookie"),
+				step(FromClient, encode(protocol.PacketTypeConnect, second.Encode()), "repeats the credential with the cookie", "fields.cookie"),
+				step(FromServer, encode(protocol.PacketTypeConnectAccept, accept.Encode()), "the session exists from now on, with the SSRC of its voice", "fields.ssrc"),
+			},
+		},
+		{
+			Name:  "handshake rejected",
+			Notes: "The credential is only checked once the cookie is valid.",
+			Steps: []Step{
+				step(FromClient, encode(protocol.PacketTypeConnect, first.Encode()), "first connect"),
+				step(FromServer, encode(protocol.PacketTypeHelloVerify, verify.Encode()), "cookie challenge", "fields.cookie"),
+				step(FromClient, encode(protocol.PacketTypeConnect, second.Encode()), "connect with cookie", "fields.cookie"),
+				step(FromServer, encode(protocol.PacketTypeConnectReject, reject.Encode()), "the reason depends on the credential"),
+			},
+		},
+		{
+			Name:  "no amplification",
+			Notes: "A connect shorter than the hello verify gets no answer, so the server can not be used to amplify traffic.",
+			Steps: []Step{
+				step(FromClient, encode(protocol.PacketTypeConnect, []byte{0x00, 0x00, 0x00}), "unpadded connect of 4 bytes"),
+				{From: FromServer, Silent: true, Note: "no hello verify"},
+			},
+		},
+		{
+			Name:  "unverified remote",
+			Notes: "Everything but a connect from a remote without a session is dropped.",
+			Steps: []Step{
+				step(FromClient, encode(protocol.PacketTypeDebugAny, []byte("Hello, Server!")), "before the handshake"),
+				{From: FromServer, Silent: true, Note: "dropped"},
+				{From: FromClient, Hex: "00", Note: "packet type none, not a packet"},
+				{From: FromServer, Silent: true, Note: "dropped"},
+			},
+		},
+		{
+			Name:  "reports",
+			Notes: "Both sides send a sender report every report interval and a receiver report once they got a sender report. LastSR is the middle 32 bits of the NTP timestamp of the last sender report.",
+			Steps: []Step{
+				step(FromServer, encode(protocol.PacketTypeSenderReport, sr.Encode()), "after the handshake", "fields.ntpTimestamp", "fields.packetCount", "fields.octetCount"),
+				step(FromClient, encode(protocol.PacketTypeReceiverReport, rr.Encode()), "lastSR refers to the sender report", "fields.senderPacketCount", "fields.cumulativeLost", "fields.fractionLost", "fields.jitter", "fields.delaySinceLastSR"),
+			},
+		},
+		{
+			Name:  "permission denied",
+			Notes: "A packet of a connected client that lacks the permission of the handler is answered with an error reply naming the refused packet type.",
+			Steps: []Step{
+				step(FromClient, encode(protocol.PacketTypeDebugAny, []byte("Hello, Server!")), "handler requires the speak permission"),
+				step(FromServer, encode(protocol.PacketTypeError, denied.Encode()), "message is the missing permission"),
+			},
+		},
+	}
+}
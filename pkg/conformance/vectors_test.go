@@ -0,0 +1,51 @@
+package conformance
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// TestPublishedVectorsUpToDate fails when the wire format changed without publishing new vectors
+// Publish them with: go run ./cmd/conformance vectors -out pkg/conformance/vectors/v2.json
+func TestPublishedVectorsUpToDate(t *testing.T) {
+	published, err := Published()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want, got bytes.Buffer
+	if err := published.Write(&want); err != nil {
+		t.Fatal(err)
+	}
+	if err := Generate().Write(&got); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(got.Bytes(), want.Bytes()) {
+		return
+	}
+
+	// name what changed, the diff of the files is too long for the test output
+	reloaded, err := Load(bytes.NewReader(got.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reloaded.Constants, published.Constants) {
+		t.Errorf("constants changed from %+v to %+v", published.Constants, reloaded.Constants)
+	}
+	vectors := make(map[string]Vector)
+	for _, vector := range published.Vectors {
+		vectors[vector.Name] = vector
+	}
+	for _, vector := range reloaded.Vectors {
+		if old, ok := vectors[vector.Name]; !ok {
+			t.Errorf("vector %q is not published", vector.Name)
+		} else if !reflect.DeepEqual(old, vector) {
+			t.Errorf("vector %q changed from %+v to %+v", vector.Name, old, vector)
+		}
+		delete(vectors, vector.Name)
+	}
+	for name := range vectors {
+		t.Errorf("published vector %q is no longer generated", name)
+	}
+	t.Fatalf("generated vectors differ from the published vectors version %d", Version)
+}
@@ -0,0 +1,532 @@
+// Package E2EE contains the end-to-end encryption of voice frames between the members of a channel
+// It is responsible for the keys of a member and for sealing and opening its voice frames
+// Every member has a X25519 key pair and a random sender key per epoch, frames are sealed with AES-256-GCM
+// The nonce of a frame is the epoch and a frame counter, so a sender key never seals two frames with the same nonce
+// A sender key is sent to every other member wrapped with the X25519 shared secret of both
+// Whenever a member joins or leaves, the sender key is ratcheted to a new epoch,
+// so a member can not open the voice from before it joined or after it left
+// The Server forwards the key messages and the sealed frames and only reads their routing headers
+//
+// Every member signs its key messages with a long-term Ed25519 identity, the signature binds the X25519 key
+// and the SSRCs of the sender and the receiver, so the Server can not swap the keys of a member
+// The Server can still pose as a member with an identity of its own, the members compare the fingerprints
+// of their identities out of band or accept only known identities with Config.Trust
+//
+// Key messages are datagrams, a sender key is sent again by Retransmit until the member acknowledged it
+// A member that never acknowledges is removed after MaxRetransmits
+// A lost hello is repaired by the receiver of a frame it can not open, it sends its hello to the sender
+// The Server tells which members left the channel, the membership itself is not authenticated
+package e2ee
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+// Kinds of the key message bodies
+const (
+	messageHello     = 0x01 // identity and public key of a member that joined
+	messageSenderKey = 0x02 // identity, public key and wrapped sender key of a member
+	messageAck       = 0x03 // a sender key of an epoch arrived
+)
+
+const (
+	keySize         = 32
+	nonceSize       = 12
+	tagSize         = 16
+	identitySize    = ed25519.PublicKeySize
+	signatureSize   = ed25519.SignatureSize
+	announceSize    = 1 + identitySize + keySize // kind, identity and public key
+	helloSize       = announceSize + signatureSize
+	senderKeySize   = announceSize + 4 + nonceSize + keySize + tagSize + signatureSize
+	ackSize         = 1 + 4
+	frameHeaderSize = 4 + 8 // epoch and frame counter
+)
+
+// signatureContext separates the signatures of the key messages from other uses of the identity
+const signatureContext = "aura-speak e2ee key message"
+
+// Overhead is the number of bytes a sealed frame is larger than the frame, the codec included
+const Overhead = frameHeaderSize + 1 + tagSize
+
+// RetransmitInterval is the interval in which Retransmit should be called
+const RetransmitInterval = 500 * time.Millisecond
+
+// MaxRetransmits is the number of times a sender key is sent again before the member is removed
+const MaxRetransmits = 10
+
+// Errors returned by a Member
+var (
+	ErrMalformed     = errors.New("malformed e2ee message")
+	ErrUnknownSender = errors.New("no sender key of the member")
+	ErrBadSignature  = errors.New("e2ee message with a bad signature")
+	ErrUntrusted     = errors.New("identity of the member not trusted")
+)
+
+// Config are the settings of a Member
+type Config struct {
+	// Identity is the long-term signing key of the member, see NewIdentity and Fingerprint
+	// A random identity is generated if nil
+	Identity ed25519.PrivateKey
+	// Trust decides whether the identity of another member is accepted, every identity is accepted if nil
+	// The identity of a member can not change while it is in the channel
+	Trust func(ssrc uint32, identity ed25519.PublicKey) bool
+}
+
+// sender is a sender key of one epoch
+type sender struct {
+	epoch uint32
+	key   []byte
+	aead  cipher.AEAD
+}
+
+// peer is another member of the channel
+// keys are its sender keys of the current and the previous epoch, frames of the previous one may still arrive
+type peer struct {
+	identity ed25519.PublicKey
+	public   *ecdh.PublicKey
+	keys     []sender
+}
+
+// pending is a wrapped sender key that was not acknowledged yet
+type pending struct {
+	epoch uint32
+	body  []byte
+	tries int
+}
+
+// Member is the end-to-end encryption state of one member of a channel
+// pkg/client runs the key exchange of a Member, see client.EnableE2EE
+//
+// Example:
+//
+//	member, err := e2ee.NewMember(client.SSRC(), e2ee.Config{Identity: identity})
+//	client.SendKeyMessage(0, member.Hello())
+//	client.OnPacket(protocol.PacketTypeKeyMessage, func(packet *protocol.Packet) error {
+//		message, err := protocol.DecodeKeyMessage(packet.Payload)
+//		if err != nil {
+//			return err
+//		}
+//		replies, err := member.Handle(message.From, message.Body)
+//		for _, reply := range replies {
+//			client.SendKeyMessage(reply.To, reply.Body)
+//		}
+//		return err
+//	})
+//	sealed, err := member.Encrypt(nil, timestamp, protocol.CodecOpus, frame)
+//	client.SendVoice(protocol.CodecE2EE, timestamp, sealed)
+type Member struct {
+	mu       sync.Mutex
+	ssrc     uint32
+	identity ed25519.PrivateKey
+	trust    func(ssrc uint32, identity ed25519.PublicKey) bool
+	private  *ecdh.PrivateKey
+	send     sender
+	counter  uint64
+	peers    map[uint32]*peer
+	pending  map[uint32]*pending
+}
+
+// NewIdentity creates a random identity for Config.Identity
+// The identity is kept across channels and sessions, so other members can verify its fingerprint once
+func NewIdentity() (ed25519.PrivateKey, error) {
+	_, identity, err := ed25519.GenerateKey(rand.Reader)
+	return identity, err
+}
+
+// Fingerprint returns the fingerprint of an identity that members compare out of band
+//
+// Example:
+//
+//	fmt.Println("Your fingerprint:", e2ee.Fingerprint(identity.Public().(ed25519.PublicKey)))
+func Fingerprint(identity ed25519.PublicKey) string {
+	sum := sha256.Sum256(identity)
+	groups := make([]string, 0, 8)
+	for i := 0; i < 16; i += 2 {
+		groups = append(groups, hex.EncodeToString(sum[i:i+2]))
+	}
+	return strings.Join(groups, " ")
+}
+
+// NewMember creates the state of the member with the SSRC the Server assigned to it
+func NewMember(ssrc uint32, config Config) (*Member, error) {
+	identity := config.Identity
+	if identity == nil {
+		var err error
+		if identity, err = NewIdentity(); err != nil {
+			return nil, err
+		}
+	}
+	if len(identity) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("e2ee identity of %d bytes, want %d", len(identity), ed25519.PrivateKeySize)
+	}
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	m := &Member{
+		ssrc:     ssrc,
+		identity: identity,
+		trust:    config.Trust,
+		private:  private,
+		peers:    make(map[uint32]*peer),
+		pending:  make(map[uint32]*pending),
+	}
+	if err := m.ratchet(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Epoch returns the epoch of the own sender key, it grows with every membership change
+func (m *Member) Epoch() uint32 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.send.epoch
+}
+
+// Fingerprint returns the fingerprint of the own identity
+func (m *Member) Fingerprint() string {
+	return Fingerprint(m.identity.Public().(ed25519.PublicKey))
+}
+
+// Peers returns the fingerprints of the other members by SSRC
+func (m *Member) Peers() map[uint32]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	peers := make(map[uint32]string, len(m.peers))
+	for ssrc, p := range m.peers {
+		peers[ssrc] = Fingerprint(p.identity)
+	}
+	return peers
+}
+
+// Hello returns the key message body that announces the member to the channel
+// It is sent to every member after joining, with To 0, and to a member whose frames can not be opened
+func (m *Member) Hello() []byte {
+	body := m.announce(messageHello, helloSize)
+	return m.sign(body, 0)
+}
+
+// Handle processes the body of a key message from another member
+// A member that is new or left ratchets the sender key, Handle returns the key messages to send then
+func (m *Member) Handle(from uint32, body []byte) ([]protocol.KeyMessage, error) {
+	if len(body) == 0 {
+		return m.Remove(from)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case body[0] == messageHello && len(body) == helloSize:
+		if err := verify(body, from, 0); err != nil {
+			return nil, err
+		}
+		joined, err := m.addPeer(from, body[1:1+identitySize], body[1+identitySize:announceSize])
+		if err != nil {
+			return nil, err
+		}
+		if !joined {
+			// the member knows us already, it may have missed the sender key
+			body, err := m.wrap(from, m.peers[from])
+			if err != nil {
+				return nil, err
+			}
+			return []protocol.KeyMessage{{To: from, Body: body}}, nil
+		}
+		return m.ratchetAll()
+	case body[0] == messageSenderKey && len(body) == senderKeySize:
+		if err := verify(body, from, m.ssrc); err != nil {
+			return nil, err
+		}
+		joined, err := m.addPeer(from, body[1:1+identitySize], body[1+identitySize:announceSize])
+		if err != nil {
+			return nil, err
+		}
+		epoch, err := m.unwrap(from, body[announceSize:len(body)-signatureSize])
+		if err != nil {
+			return nil, err
+		}
+		// the ack is sent for every copy, the last one may have been lost
+		ack := protocol.KeyMessage{To: from, Body: binary.BigEndian.AppendUint32([]byte{messageAck}, epoch)}
+		if !joined {
+			return []protocol.KeyMessage{ack}, nil
+		}
+		messages, err := m.ratchetAll()
+		return append(messages, ack), err
+	case body[0] == messageAck && len(body) == ackSize:
+		if p, ok := m.pending[from]; ok && p.epoch == binary.BigEndian.Uint32(body[1:]) {
+			delete(m.pending, from)
+		}
+		return nil, nil
+	default:
+		return nil, ErrMalformed
+	}
+}
+
+// Remove removes a member that left the channel and ratchets the sender key
+// It returns the key messages to send to the remaining members
+func (m *Member) Remove(ssrc uint32) ([]protocol.KeyMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.peers[ssrc]; !ok {
+		return nil, nil
+	}
+	delete(m.peers, ssrc)
+	delete(m.pending, ssrc)
+	return m.ratchetAll()
+}
+
+// Retransmit returns the sender keys that were not acknowledged yet, it is called every RetransmitInterval
+// A member that did not acknowledge after MaxRetransmits is removed and the sender key is ratcheted
+func (m *Member) Retransmit() ([]protocol.KeyMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var messages []protocol.KeyMessage
+	gone := false
+	for ssrc, p := range m.pending {
+		if p.tries >= MaxRetransmits {
+			delete(m.peers, ssrc)
+			delete(m.pending, ssrc)
+			gone = true
+			continue
+		}
+		p.tries++
+		messages = append(messages, protocol.KeyMessage{To: ssrc, Body: p.body})
+	}
+	if gone {
+		return m.ratchetAll()
+	}
+	return messages, nil
+}
+
+// Encrypt seals a frame of the codec and appends it to dst
+// The timestamp and the SSRC of the member are authenticated, so the frame can not be moved to another stream
+// The sealed frame is sent as voice with protocol.CodecE2EE and the same timestamp
+func (m *Member) Encrypt(dst []byte, timestamp uint32, codec protocol.Codec, frame []byte) ([]byte, error) {
+	m.mu.Lock()
+	send := m.send
+	counter := m.counter
+	m.counter++
+	m.mu.Unlock()
+
+	var nonce [nonceSize]byte
+	binary.BigEndian.PutUint32(nonce[0:4], send.epoch)
+	binary.BigEndian.PutUint64(nonce[4:12], counter)
+	dst = append(dst, nonce[:]...)
+	plain := append(make([]byte, 0, 1+len(frame)), byte(codec))
+	plain = append(plain, frame...)
+	return send.aead.Seal(dst, nonce[:], plain, frameAAD(m.ssrc, timestamp)), nil
+}
+
+// Decrypt opens a voice frame with protocol.CodecE2EE of another member
+// It returns the codec and the frame appended to dst
+func (m *Member) Decrypt(dst []byte, voice protocol.Voice) (protocol.Codec, []byte, error) {
+	if voice.Codec != protocol.CodecE2EE || len(voice.Frame) < Overhead {
+		return protocol.CodecNone, nil, ErrMalformed
+	}
+	nonce := voice.Frame[:nonceSize]
+	epoch := binary.BigEndian.Uint32(nonce[0:4])
+	m.mu.Lock()
+	var aead cipher.AEAD
+	if p, ok := m.peers[voice.SSRC]; ok {
+		for _, key := range p.keys {
+			if key.epoch == epoch {
+				aead = key.aead
+			}
+		}
+	}
+	m.mu.Unlock()
+	if aead == nil {
+		return protocol.CodecNone, nil, fmt.Errorf("%w %08x in epoch %d", ErrUnknownSender, voice.SSRC, epoch)
+	}
+	start := len(dst)
+	dst, err := aead.Open(dst, nonce, voice.Frame[nonceSize:], frameAAD(voice.SSRC, voice.Timestamp))
+	if err != nil {
+		return protocol.CodecNone, nil, err
+	}
+	codec := protocol.Codec(dst[start])
+	return codec, append(dst[:start], dst[start+1:]...), nil
+}
+
+// addPeer adds a member or replaces its public key, it returns true if the member is new or changed its key
+// The identity of a known member must not change
+func (m *Member) addPeer(ssrc uint32, identity, public []byte) (bool, error) {
+	if ssrc == m.ssrc || ssrc == 0 {
+		return false, ErrMalformed
+	}
+	key, err := ecdh.X25519().NewPublicKey(public)
+	if err != nil {
+		return false, err
+	}
+	p, ok := m.peers[ssrc]
+	if ok && !bytes.Equal(p.identity, identity) {
+		return false, fmt.Errorf("%w: member %08x changed its identity", ErrUntrusted, ssrc)
+	}
+	if !ok && m.trust != nil && !m.trust(ssrc, ed25519.PublicKey(bytes.Clone(identity))) {
+		return false, fmt.Errorf("%w: member %08x with fingerprint %s", ErrUntrusted, ssrc, Fingerprint(identity))
+	}
+	if ok && p.public.Equal(key) {
+		return false, nil
+	}
+	m.peers[ssrc] = &peer{identity: bytes.Clone(identity), public: key}
+	return true, nil
+}
+
+// ratchetAll replaces the sender key and wraps it for every member
+func (m *Member) ratchetAll() ([]protocol.KeyMessage, error) {
+	if err := m.ratchet(); err != nil {
+		return nil, err
+	}
+	messages := make([]protocol.KeyMessage, 0, len(m.peers))
+	for ssrc, p := range m.peers {
+		body, err := m.wrap(ssrc, p)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, protocol.KeyMessage{To: ssrc, Body: body})
+	}
+	return messages, nil
+}
+
+// ratchet replaces the sender key with a random key of the next epoch
+// The key is random and not derived from the previous one, so a member that joins can not open older frames
+func (m *Member) ratchet() error {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	m.send = sender{epoch: m.send.epoch + 1, key: key, aead: aead}
+	m.counter = 0
+	return nil
+}
+
+// announce starts a key message body with the kind, the identity and the public key
+func (m *Member) announce(kind byte, size int) []byte {
+	body := make([]byte, 0, size)
+	body = append(body, kind)
+	body = append(body, m.identity.Public().(ed25519.PublicKey)...)
+	return append(body, m.private.PublicKey().Bytes()...)
+}
+
+// sign appends the signature of the body for the receiver, 0 for every member
+func (m *Member) sign(body []byte, to uint32) []byte {
+	return append(body, ed25519.Sign(m.identity, signed(body, m.ssrc, to))...)
+}
+
+// verify checks the signature at the end of a body with the identity it announces
+func verify(body []byte, from, to uint32) error {
+	identity := ed25519.PublicKey(body[1 : 1+identitySize])
+	message, signature := body[:len(body)-signatureSize], body[len(body)-signatureSize:]
+	if !ed25519.Verify(identity, signed(message, from, to), signature) {
+		return fmt.Errorf("%w from member %08x", ErrBadSignature, from)
+	}
+	return nil
+}
+
+// signed is the message a signature covers, the body bound to the SSRCs of the sender and the receiver
+func signed(body []byte, from, to uint32) []byte {
+	message := make([]byte, 0, len(signatureContext)+8+len(body))
+	message = append(message, signatureContext...)
+	message = binary.BigEndian.AppendUint32(message, from)
+	message = binary.BigEndian.AppendUint32(message, to)
+	return append(message, body...)
+}
+
+// wrap seals the sender key for one member and keeps it until the member acknowledged it
+// The body is the kind, the identity, the public key, the epoch, the nonce, the sealed key and the signature
+func (m *Member) wrap(to uint32, p *peer) ([]byte, error) {
+	aead, err := m.keyWrap(p.public, m.ssrc, to)
+	if err != nil {
+		return nil, err
+	}
+	body := m.announce(messageSenderKey, senderKeySize)
+	body = binary.BigEndian.AppendUint32(body, m.send.epoch)
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	body = append(body, nonce...)
+	body = aead.Seal(body, nonce, m.send.key, body[announceSize:announceSize+4])
+	body = m.sign(body, to)
+	m.pending[to] = &pending{epoch: m.send.epoch, body: body}
+	return body, nil
+}
+
+// unwrap opens the sender key of a member and keeps it with the one of the previous epoch
+// It returns the epoch of the key
+func (m *Member) unwrap(from uint32, data []byte) (uint32, error) {
+	p := m.peers[from]
+	aead, err := m.keyWrap(p.public, from, m.ssrc)
+	if err != nil {
+		return 0, err
+	}
+	epoch := binary.BigEndian.Uint32(data[0:4])
+	key, err := aead.Open(nil, data[4:4+nonceSize], data[4+nonceSize:], data[0:4])
+	if err != nil {
+		return 0, err
+	}
+	for _, known := range p.keys {
+		if known.epoch == epoch {
+			if !bytes.Equal(known.key, key) {
+				return 0, fmt.Errorf("%w: member %08x sent two keys for epoch %d", ErrMalformed, from, epoch)
+			}
+			return epoch, nil
+		}
+	}
+	frames, err := newAEAD(key)
+	if err != nil {
+		return 0, err
+	}
+	p.keys = append(p.keys, sender{epoch: epoch, key: key, aead: frames})
+	if len(p.keys) > 2 {
+		p.keys = p.keys[len(p.keys)-2:]
+	}
+	return epoch, nil
+}
+
+// keyWrap derives the key that wraps the sender keys from one member to another
+func (m *Member) keyWrap(public *ecdh.PublicKey, from, to uint32) (cipher.AEAD, error) {
+	shared, err := m.private.ECDH(public)
+	if err != nil {
+		return nil, err
+	}
+	info := fmt.Sprintf("aura-speak e2ee sender key %08x %08x", from, to)
+	key, err := hkdf.Key(sha256.New, shared, nil, info, keySize)
+	if err != nil {
+		return nil, err
+	}
+	return newAEAD(key)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// frameAAD is the authenticated routing header of a frame
+func frameAAD(ssrc, timestamp uint32) []byte {
+	aad := binary.BigEndian.AppendUint32(make([]byte, 0, 8), ssrc)
+	return binary.BigEndian.AppendUint32(aad, timestamp)
+}
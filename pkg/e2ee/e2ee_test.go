@@ -0,0 +1,266 @@
+package e2ee_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+
+	"github.com/aura-speak/networking/pkg/e2ee"
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+// channel relays key messages between members like the Server does
+// drop decides which messages are lost, none if nil
+type channel struct {
+	t       *testing.T
+	members map[uint32]*e2ee.Member
+	drop    func(from, to uint32, body []byte) bool
+}
+
+func newChannel(t *testing.T) *channel {
+	return &channel{t: t, members: make(map[uint32]*e2ee.Member)}
+}
+
+func (c *channel) join(ssrc uint32) *e2ee.Member {
+	c.t.Helper()
+	return c.joinWith(ssrc, e2ee.Config{})
+}
+
+func (c *channel) joinWith(ssrc uint32, config e2ee.Config) *e2ee.Member {
+	c.t.Helper()
+	m, err := e2ee.NewMember(ssrc, config)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.members[ssrc] = m
+	c.relay(ssrc, 0, m.Hello())
+	return m
+}
+
+func (c *channel) leave(ssrc uint32) {
+	delete(c.members, ssrc)
+	c.relay(ssrc, 0, nil)
+}
+
+// relay delivers a body to its receivers and the replies until no member has anything to send
+func (c *channel) relay(from, to uint32, body []byte) {
+	c.t.Helper()
+	for ssrc, m := range c.members {
+		if ssrc == from || (to != 0 && ssrc != to) {
+			continue
+		}
+		if c.drop != nil && c.drop(from, ssrc, body) {
+			continue
+		}
+		replies, err := m.Handle(from, body)
+		if err != nil {
+			c.t.Fatalf("member %d handling a message of %d: %v", ssrc, from, err)
+		}
+		c.send(ssrc, replies)
+	}
+}
+
+func (c *channel) send(from uint32, messages []protocol.KeyMessage) {
+	c.t.Helper()
+	for _, message := range messages {
+		c.relay(from, message.To, message.Body)
+	}
+}
+
+// retransmit lets every member send its unacknowledged sender keys again
+func (c *channel) retransmit() {
+	c.t.Helper()
+	for ssrc, m := range c.members {
+		messages, err := m.Retransmit()
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		c.send(ssrc, messages)
+	}
+}
+
+func seal(t *testing.T, m *e2ee.Member, ssrc, timestamp uint32, frame []byte) protocol.Voice {
+	t.Helper()
+	sealed, err := m.Encrypt(nil, timestamp, protocol.CodecOpus, frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return protocol.Voice{SSRC: ssrc, Timestamp: timestamp, Codec: protocol.CodecE2EE, Frame: sealed}
+}
+
+func open(t *testing.T, m *e2ee.Member, voice protocol.Voice, want []byte) {
+	t.Helper()
+	codec, frame, err := m.Decrypt(nil, voice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codec != protocol.CodecOpus || !bytes.Equal(frame, want) {
+		t.Fatalf("opened %s %x, want opus %x", codec, frame, want)
+	}
+}
+
+func TestMembershipRatchets(t *testing.T) {
+	c := newChannel(t)
+	alice := c.join(1)
+	bob := c.join(2)
+	frame := []byte{0xFC, 0x01}
+
+	before := seal(t, alice, 1, 960, frame)
+	open(t, bob, before, frame)
+
+	carol := c.join(3)
+	if _, _, err := carol.Decrypt(nil, before); !errors.Is(err, e2ee.ErrUnknownSender) {
+		t.Fatalf("a joined member opened a frame from before it joined: %v", err)
+	}
+	joined := seal(t, alice, 1, 1920, frame)
+	open(t, bob, joined, frame)
+	open(t, carol, joined, frame)
+
+	epoch := alice.Epoch()
+	c.leave(3)
+	if alice.Epoch() == epoch {
+		t.Fatal("the sender key was not ratcheted when a member left")
+	}
+	after := seal(t, alice, 1, 2880, frame)
+	open(t, bob, after, frame)
+	if _, _, err := carol.Decrypt(nil, after); !errors.Is(err, e2ee.ErrUnknownSender) {
+		t.Fatalf("a member that left opened a frame from after it left: %v", err)
+	}
+}
+
+func TestFramesAreAuthenticated(t *testing.T) {
+	c := newChannel(t)
+	alice := c.join(1)
+	bob := c.join(2)
+
+	voice := seal(t, alice, 1, 960, []byte{0xFC})
+	if len(voice.Frame) != 1+e2ee.Overhead {
+		t.Fatalf("sealed frame of %d bytes, want %d", len(voice.Frame), 1+e2ee.Overhead)
+	}
+	tampered := voice
+	tampered.Frame = bytes.Clone(voice.Frame)
+	tampered.Frame[len(tampered.Frame)-1] ^= 0x01
+	if _, _, err := bob.Decrypt(nil, tampered); err == nil {
+		t.Fatal("opened a tampered frame")
+	}
+	moved := voice
+	moved.Timestamp++
+	if _, _, err := bob.Decrypt(nil, moved); err == nil {
+		t.Fatal("opened a frame with another timestamp")
+	}
+	if _, err := bob.Handle(1, []byte{0x02, 0x00}); !errors.Is(err, e2ee.ErrMalformed) {
+		t.Fatalf("handled a truncated sender key: %v", err)
+	}
+}
+
+func TestKeyMessagesAreSigned(t *testing.T) {
+	c := newChannel(t)
+	alice := c.join(1)
+	c.join(2)
+	if peers := alice.Peers(); len(peers) != 1 || peers[2] != c.members[2].Fingerprint() {
+		t.Fatalf("peers of alice %v, want the fingerprint %s of bob", peers, c.members[2].Fingerprint())
+	}
+
+	// the Server can not swap the public key of a member
+	mallory, err := e2ee.NewMember(3, e2ee.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hello := alice.Hello()
+	swapped := bytes.Clone(hello)
+	copy(swapped[1+ed25519.PublicKeySize:], mallory.Hello()[1+ed25519.PublicKeySize:1+ed25519.PublicKeySize+32])
+	if _, err := c.members[2].Handle(1, swapped); !errors.Is(err, e2ee.ErrBadSignature) {
+		t.Fatalf("handled a hello with a swapped key: %v", err)
+	}
+	// nor move a hello to another member
+	if _, err := c.members[2].Handle(3, hello); !errors.Is(err, e2ee.ErrBadSignature) {
+		t.Fatalf("handled a hello of another member: %v", err)
+	}
+	// nor replace a member with an identity of its own
+	if _, err := c.members[2].Handle(1, func() []byte {
+		impostor, err := e2ee.NewMember(1, e2ee.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return impostor.Hello()
+	}()); !errors.Is(err, e2ee.ErrUntrusted) {
+		t.Fatalf("a member changed its identity: %v", err)
+	}
+}
+
+func TestTrustedIdentities(t *testing.T) {
+	identity, err := e2ee.NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted := identity.Public().(ed25519.PublicKey)
+	c := newChannel(t)
+	alice := c.joinWith(1, e2ee.Config{Trust: func(ssrc uint32, identity ed25519.PublicKey) bool {
+		return identity.Equal(trusted)
+	}})
+	bob := c.joinWith(2, e2ee.Config{Identity: identity})
+	if bob.Fingerprint() != e2ee.Fingerprint(trusted) {
+		t.Fatalf("fingerprint %s, want %s", bob.Fingerprint(), e2ee.Fingerprint(trusted))
+	}
+	open(t, alice, seal(t, bob, 2, 960, []byte{0xFC}), []byte{0xFC})
+
+	mallory, err := e2ee.NewMember(3, e2ee.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.Handle(3, mallory.Hello()); !errors.Is(err, e2ee.ErrUntrusted) {
+		t.Fatalf("handled the hello of an unknown identity: %v", err)
+	}
+}
+
+func TestLostSenderKeysAreRetransmitted(t *testing.T) {
+	c := newChannel(t)
+	alice := c.join(1)
+	// every first sender key and every first ack is lost
+	seen := make(map[string]bool)
+	c.drop = func(from, to uint32, body []byte) bool {
+		key := string(body)
+		lost := !seen[key] && body[0] != 0x01
+		seen[key] = true
+		return lost
+	}
+	bob := c.join(2)
+
+	voice := seal(t, alice, 1, 960, []byte{0xFC})
+	if _, _, err := bob.Decrypt(nil, voice); !errors.Is(err, e2ee.ErrUnknownSender) {
+		t.Fatalf("opened a frame without the sender key: %v", err)
+	}
+	c.retransmit()
+	c.retransmit()
+	open(t, bob, voice, []byte{0xFC})
+	open(t, alice, seal(t, bob, 2, 960, []byte{0xFC}), []byte{0xFC})
+
+	// the acks of the copies arrived, nothing is left to send
+	c.retransmit()
+	for ssrc, m := range c.members {
+		if messages, err := m.Retransmit(); err != nil || len(messages) != 0 {
+			t.Fatalf("member %d retransmits %d messages after the acks, %v", ssrc, len(messages), err)
+		}
+	}
+}
+
+func TestSilentMemberIsRemoved(t *testing.T) {
+	c := newChannel(t)
+	alice := c.join(1)
+	c.join(2)
+	// bob is gone without a leave notice and misses the keys of the next epoch
+	delete(c.members, 2)
+	c.join(3)
+
+	epoch := alice.Epoch()
+	for range e2ee.MaxRetransmits + 1 {
+		c.retransmit()
+	}
+	if alice.Epoch() == epoch {
+		t.Fatal("the sender key was not ratcheted when a member stopped acknowledging")
+	}
+	if _, ok := alice.Peers()[2]; ok {
+		t.Fatal("a member that never acknowledged is still a peer")
+	}
+}
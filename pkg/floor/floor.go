@@ -0,0 +1,326 @@
+// Package Floor contains the floor control of radio style channels
+// It is responsible for deciding who may talk in a channel with floor control
+// One member holds the floor at a time, further requests wait in a queue
+// Priority talkers preempt the holder and a talk time limit revokes the floor
+// The Manager reports every change as Event, the Server turns them into packets
+package floor
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/clock"
+)
+
+// DefaultQueueSize is the number of waiting talkers of a channel if its Config sets none
+const DefaultQueueSize = 16
+
+// Priority is the priority of a floor request
+type Priority int
+
+const (
+	PriorityNormal Priority = iota
+	// PriorityHigh preempts a holder with normal priority and waits before normal requests
+	PriorityHigh
+)
+
+// Kind is the kind of an Event
+type Kind int
+
+const (
+	Granted  Kind = iota // Key holds the floor
+	Queued               // Key waits at Position
+	Denied               // Key may not wait, the queue is full
+	Released             // Key gave the floor back
+	Revoked              // Key lost the floor, Reason tells why
+)
+
+// Reason tells why a floor was revoked
+type Reason int
+
+const (
+	ReasonNone Reason = iota
+	ReasonPreempted
+	ReasonTimeout
+)
+
+// Event is a change of the floor of a channel
+// Key is the member the event is about, Position counts the queue from 1
+type Event struct {
+	Kind     Kind
+	Key      string
+	Reason   Reason
+	Position int
+}
+
+// Config is the floor control of one channel
+// A MaxTalk of zero lets the holder talk until it releases the floor
+// A QueueSize of zero uses DefaultQueueSize
+type Config struct {
+	MaxTalk   time.Duration
+	QueueSize int
+}
+
+// Notify receives the events of a channel
+// It is called without a lock held, so it may call the Manager again
+type Notify func(channel string, events []Event)
+
+type waiter struct {
+	key      string
+	priority Priority
+}
+
+// channelFloor is the floor of one channel
+// generation tells the timer of the talk time whether the grant it belongs to is still current
+type channelFloor struct {
+	config     Config
+	holder     string
+	priority   Priority
+	holding    bool
+	queue      []waiter
+	timer      clock.Timer
+	generation uint64
+}
+
+// Manager is the floor control of all channels
+//
+// Example:
+//
+//	floors := floor.NewManager(clock.Real, func(channel string, events []floor.Event) {
+//		for _, e := range events {
+//			fmt.Println(channel, e.Kind, e.Key)
+//		}
+//	})
+//	floors.Configure("radio", floor.Config{MaxTalk: 30 * time.Second})
+//	floors.Request("radio", "alice", floor.PriorityNormal)
+type Manager struct {
+	mu     sync.Mutex
+	clock  clock.Clock
+	notify Notify
+	floors map[string]*channelFloor
+}
+
+// NewManager creates a Manager without controlled channels
+func NewManager(clk clock.Clock, notify Notify) *Manager {
+	return &Manager{clock: clk, notify: notify, floors: make(map[string]*channelFloor)}
+}
+
+// Configure puts a channel under floor control or changes its Config
+// The holder and the queue are kept, a new talk time applies from the next grant on
+func (m *Manager) Configure(channel string, config Config) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f, ok := m.floors[channel]; ok {
+		f.config = config
+		return
+	}
+	m.floors[channel] = &channelFloor{config: config}
+}
+
+// Remove ends the floor control of a channel
+// The holder loses the floor, the waiting requests are dropped and everybody may talk again
+func (m *Manager) Remove(channel string) {
+	m.mu.Lock()
+	f, ok := m.floors[channel]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	var events []Event
+	if f.holding {
+		events = append(events, m.revoke(f, ReasonNone))
+	}
+	delete(m.floors, channel)
+	m.mu.Unlock()
+	m.notify(channel, events)
+}
+
+// Controlled tells if a channel is under floor control
+func (m *Manager) Controlled(channel string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.floors[channel]
+	return ok
+}
+
+// MaxTalk returns the talk time of a channel, zero if it is unlimited or the channel is not controlled
+func (m *Manager) MaxTalk(channel string) time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f, ok := m.floors[channel]; ok {
+		return f.config.MaxTalk
+	}
+	return 0
+}
+
+// MayTalk tells if a member may send voice into a channel
+// Everybody may talk in a channel without floor control
+func (m *Manager) MayTalk(channel, key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.floors[channel]
+	return !ok || (f.holding && f.holder == key)
+}
+
+// Request asks for the floor of a controlled channel
+// The floor is granted if it is free or the request preempts the holder, otherwise the request is queued
+// Requests of uncontrolled channels are ignored
+func (m *Manager) Request(channel, key string, priority Priority) {
+	m.mu.Lock()
+	f, ok := m.floors[channel]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	var events []Event
+	switch {
+	case f.holding && f.holder == key:
+		events = append(events, Event{Kind: Granted, Key: key})
+	case !f.holding:
+		events = m.grant(channel, f, key, priority, events)
+	case priority > f.priority:
+		events = append(events, m.revoke(f, ReasonPreempted))
+		events = m.grant(channel, f, key, priority, events)
+		if f.remove(key) {
+			events = f.positions(events)
+		}
+	default:
+		events = f.enqueue(key, priority, events)
+	}
+	m.mu.Unlock()
+	m.notify(channel, events)
+}
+
+// Release gives the floor back or withdraws a queued request
+// The next waiting talker gets the floor
+func (m *Manager) Release(channel, key string) {
+	m.mu.Lock()
+	f, ok := m.floors[channel]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	var events []Event
+	if f.holding && f.holder == key {
+		m.stop(f)
+		events = append(events, Event{Kind: Released, Key: key})
+		events = m.next(channel, f, events)
+	} else if f.remove(key) {
+		events = f.positions(events)
+	}
+	m.mu.Unlock()
+	m.notify(channel, events)
+}
+
+// Reset stops all talk time timers and removes every channel
+func (m *Manager) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, f := range m.floors {
+		m.stop(f)
+	}
+	clear(m.floors)
+}
+
+// expire revokes the floor once the talk time of a grant is over
+func (m *Manager) expire(channel string, generation uint64) {
+	m.mu.Lock()
+	f, ok := m.floors[channel]
+	if !ok || !f.holding || f.generation != generation {
+		m.mu.Unlock()
+		return
+	}
+	events := []Event{m.revoke(f, ReasonTimeout)}
+	events = m.next(channel, f, events)
+	m.mu.Unlock()
+	m.notify(channel, events)
+}
+
+// grant hands the floor to key and starts the talk time
+func (m *Manager) grant(channel string, f *channelFloor, key string, priority Priority, events []Event) []Event {
+	f.holder, f.priority, f.holding = key, priority, true
+	f.generation++
+	if f.config.MaxTalk > 0 {
+		generation := f.generation
+		f.timer = m.clock.AfterFunc(f.config.MaxTalk, func() {
+			m.expire(channel, generation)
+		})
+	}
+	return append(events, Event{Kind: Granted, Key: key})
+}
+
+// revoke takes the floor from the holder
+func (m *Manager) revoke(f *channelFloor, reason Reason) Event {
+	holder := f.holder
+	m.stop(f)
+	return Event{Kind: Revoked, Key: holder, Reason: reason}
+}
+
+// stop ends the grant of the holder
+func (m *Manager) stop(f *channelFloor) {
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	f.holder, f.priority, f.holding = "", PriorityNormal, false
+}
+
+// next grants the floor to the first waiting talker and tells the others their new position
+func (m *Manager) next(channel string, f *channelFloor, events []Event) []Event {
+	if len(f.queue) == 0 {
+		return events
+	}
+	first := f.queue[0]
+	f.queue = f.queue[1:]
+	events = m.grant(channel, f, first.key, first.priority, events)
+	return f.positions(events)
+}
+
+// positions tells every waiting talker its position
+func (f *channelFloor) positions(events []Event) []Event {
+	for i, w := range f.queue {
+		events = append(events, Event{Kind: Queued, Key: w.key, Position: i + 1})
+	}
+	return events
+}
+
+// enqueue adds a request behind the waiters of the same or a higher priority
+// A repeated request keeps its place, unless its priority changed, then it is queued again with the new priority
+// and every waiter is told its position
+func (f *channelFloor) enqueue(key string, priority Priority, events []Event) []Event {
+	if i := slices.IndexFunc(f.queue, func(w waiter) bool { return w.key == key }); i >= 0 {
+		if f.queue[i].priority == priority {
+			return append(events, Event{Kind: Queued, Key: key, Position: i + 1})
+		}
+		f.queue = slices.Delete(f.queue, i, i+1)
+		f.insert(key, priority)
+		return f.positions(events)
+	}
+	size := f.config.QueueSize
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	if len(f.queue) >= size {
+		return append(events, Event{Kind: Denied, Key: key})
+	}
+	i := f.insert(key, priority)
+	return append(events, Event{Kind: Queued, Key: key, Position: i + 1})
+}
+
+// insert puts a waiter behind the waiters of the same or a higher priority and returns its index
+func (f *channelFloor) insert(key string, priority Priority) int {
+	i := slices.IndexFunc(f.queue, func(w waiter) bool { return w.priority < priority })
+	if i < 0 {
+		i = len(f.queue)
+	}
+	f.queue = slices.Insert(f.queue, i, waiter{key: key, priority: priority})
+	return i
+}
+
+// remove withdraws a queued request, it returns false if key was not waiting
+func (f *channelFloor) remove(key string) bool {
+	n := len(f.queue)
+	f.queue = slices.DeleteFunc(f.queue, func(w waiter) bool { return w.key == key })
+	return len(f.queue) != n
+}
@@ -0,0 +1,206 @@
+package floor
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/clock"
+)
+
+// recorder collects the events of a Manager
+type recorder struct {
+	events []Event
+}
+
+func (r *recorder) notify(channel string, events []Event) {
+	r.events = append(r.events, events...)
+}
+
+// take returns the events since the last call
+func (r *recorder) take() []Event {
+	events := r.events
+	r.events = nil
+	return events
+}
+
+func newManager(t *testing.T, config Config) (*Manager, *recorder, *clock.Fake) {
+	t.Helper()
+	fake := clock.NewFake(time.Unix(0, 0))
+	r := &recorder{}
+	m := NewManager(fake, r.notify)
+	m.Configure("radio", config)
+	return m, r, fake
+}
+
+func expect(t *testing.T, got []Event, want ...Event) {
+	t.Helper()
+	if !slices.Equal(got, want) {
+		t.Fatalf("events %+v, want %+v", got, want)
+	}
+}
+
+func TestGrantAndRelease(t *testing.T) {
+	m, r, _ := newManager(t, Config{})
+	m.Request("radio", "alice", PriorityNormal)
+	expect(t, r.take(), Event{Kind: Granted, Key: "alice"})
+	if !m.MayTalk("radio", "alice") || m.MayTalk("radio", "bob") {
+		t.Fatal("only the holder may talk")
+	}
+
+	// a repeated request confirms the grant
+	m.Request("radio", "alice", PriorityNormal)
+	expect(t, r.take(), Event{Kind: Granted, Key: "alice"})
+
+	m.Release("radio", "alice")
+	expect(t, r.take(), Event{Kind: Released, Key: "alice"})
+	if m.MayTalk("radio", "alice") {
+		t.Fatal("released holder may still talk")
+	}
+}
+
+func TestQueue(t *testing.T) {
+	m, r, _ := newManager(t, Config{QueueSize: 2})
+	m.Request("radio", "alice", PriorityNormal)
+	m.Request("radio", "bob", PriorityNormal)
+	m.Request("radio", "carol", PriorityNormal)
+	m.Request("radio", "dave", PriorityNormal)
+	expect(t, r.take(),
+		Event{Kind: Granted, Key: "alice"},
+		Event{Kind: Queued, Key: "bob", Position: 1},
+		Event{Kind: Queued, Key: "carol", Position: 2},
+		Event{Kind: Denied, Key: "dave"},
+	)
+
+	m.Release("radio", "alice")
+	expect(t, r.take(),
+		Event{Kind: Released, Key: "alice"},
+		Event{Kind: Granted, Key: "bob"},
+		Event{Kind: Queued, Key: "carol", Position: 1},
+	)
+}
+
+func TestWithdrawQueuedRequest(t *testing.T) {
+	m, r, _ := newManager(t, Config{})
+	m.Request("radio", "alice", PriorityNormal)
+	m.Request("radio", "bob", PriorityNormal)
+	m.Request("radio", "carol", PriorityNormal)
+	r.take()
+
+	m.Release("radio", "bob")
+	expect(t, r.take(), Event{Kind: Queued, Key: "carol", Position: 1})
+	m.Release("radio", "alice")
+	expect(t, r.take(), Event{Kind: Released, Key: "alice"}, Event{Kind: Granted, Key: "carol"})
+}
+
+func TestPriorityPreempts(t *testing.T) {
+	m, r, _ := newManager(t, Config{})
+	m.Request("radio", "alice", PriorityNormal)
+	m.Request("radio", "bob", PriorityNormal)
+	r.take()
+
+	m.Request("radio", "mod", PriorityHigh)
+	expect(t, r.take(),
+		Event{Kind: Revoked, Key: "alice", Reason: ReasonPreempted},
+		Event{Kind: Granted, Key: "mod"},
+	)
+
+	// a second priority talker waits before the normal ones, but does not preempt an equal priority
+	m.Request("radio", "admin", PriorityHigh)
+	expect(t, r.take(), Event{Kind: Queued, Key: "admin", Position: 1})
+	m.Release("radio", "mod")
+	expect(t, r.take(),
+		Event{Kind: Released, Key: "mod"},
+		Event{Kind: Granted, Key: "admin"},
+		Event{Kind: Queued, Key: "bob", Position: 1},
+	)
+}
+
+func TestRepeatedRequestChangesPriority(t *testing.T) {
+	m, r, _ := newManager(t, Config{})
+	m.Request("radio", "mod", PriorityHigh)
+	m.Request("radio", "bob", PriorityNormal)
+	m.Request("radio", "carol", PriorityNormal)
+	r.take()
+
+	// carol became a priority speaker while waiting and moves in front of bob
+	m.Request("radio", "carol", PriorityHigh)
+	expect(t, r.take(),
+		Event{Kind: Queued, Key: "carol", Position: 1},
+		Event{Kind: Queued, Key: "bob", Position: 2},
+	)
+	// the same priority again keeps the place
+	m.Request("radio", "carol", PriorityHigh)
+	expect(t, r.take(), Event{Kind: Queued, Key: "carol", Position: 1})
+
+	m.Release("radio", "mod")
+	expect(t, r.take(),
+		Event{Kind: Released, Key: "mod"},
+		Event{Kind: Granted, Key: "carol"},
+		Event{Kind: Queued, Key: "bob", Position: 1},
+	)
+	// the grant keeps the new priority, bob cannot take the floor from carol
+	m.Request("radio", "bob", PriorityHigh)
+	expect(t, r.take(), Event{Kind: Queued, Key: "bob", Position: 1})
+}
+
+func TestMaxTalk(t *testing.T) {
+	m, r, fake := newManager(t, Config{MaxTalk: 30 * time.Second})
+	m.Request("radio", "alice", PriorityNormal)
+	m.Request("radio", "bob", PriorityNormal)
+	r.take()
+
+	fake.Advance(29 * time.Second)
+	expect(t, r.take())
+	fake.Advance(time.Second)
+	expect(t, r.take(),
+		Event{Kind: Revoked, Key: "alice", Reason: ReasonTimeout},
+		Event{Kind: Granted, Key: "bob"},
+	)
+
+	// the talk time of bob starts with his grant and ends with his release
+	m.Release("radio", "bob")
+	r.take()
+	fake.Advance(time.Minute)
+	expect(t, r.take())
+	if fake.Pending() != 0 {
+		t.Fatalf("%d timers pending after the release", fake.Pending())
+	}
+}
+
+func TestUncontrolledChannel(t *testing.T) {
+	m, r, _ := newManager(t, Config{})
+	if m.Controlled("lobby") || !m.MayTalk("lobby", "alice") {
+		t.Fatal("uncontrolled channel restricts talking")
+	}
+	m.Request("lobby", "alice", PriorityNormal)
+	m.Release("lobby", "alice")
+	expect(t, r.take())
+}
+
+func TestReset(t *testing.T) {
+	m, r, fake := newManager(t, Config{MaxTalk: time.Second})
+	m.Request("radio", "alice", PriorityNormal)
+	r.take()
+	m.Reset()
+	fake.Advance(time.Minute)
+	expect(t, r.take())
+	if m.Controlled("radio") {
+		t.Fatal("channel is still controlled after Reset")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	m, r, fake := newManager(t, Config{MaxTalk: time.Second})
+	m.Request("radio", "alice", PriorityNormal)
+	m.Request("radio", "bob", PriorityNormal)
+	r.take()
+
+	m.Remove("radio")
+	expect(t, r.take(), Event{Kind: Revoked, Key: "alice", Reason: ReasonNone})
+	if m.Controlled("radio") || !m.MayTalk("radio", "bob") {
+		t.Fatal("the channel still restricts talking after Remove")
+	}
+	fake.Advance(time.Minute)
+	expect(t, r.take())
+}
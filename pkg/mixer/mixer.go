@@ -0,0 +1,276 @@
+// Package mixer contains the audio mixer of channels in mix mode
+// It is responsible for turning the voice of all speakers into one stream per listener
+// The frames of a speaker are placed by their timestamp, so jitter, reordering and gaps are evened out
+// Every Frame the Mixer sums the speakers with their gain, leaves out the own voice of each listener
+// and scales a frame down instead of clipping it
+package mixer
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/clock"
+	"github.com/aura-speak/networking/pkg/codec"
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+// DefaultFrame is the length of a mixed frame
+// 10ms of L16 at 48kHz fit into protocol.MaxPacketSize
+const DefaultFrame = 10 * time.Millisecond
+
+// DefaultDelay is the time a frame is held back to wait for late frames of other speakers
+const DefaultDelay = 40 * time.Millisecond
+
+// DefaultIdle is the time after which a speaker without frames is removed
+const DefaultIdle = time.Second
+
+// ringSize is the number of samples a speaker buffers, a power of two so the timestamps wrap with the ring
+const ringSize = 1 << 15
+
+// Config are the settings of a Mixer
+// Codec encodes the mixed frames, the samples run at its clock rate
+type Config struct {
+	Codec codec.Codec
+	SSRC  uint32
+	Frame time.Duration
+	Delay time.Duration
+	Idle  time.Duration
+}
+
+// Output receives the mixed frame of one listener
+// The frame is only valid until Output returns
+type Output func(listener string, voice protocol.Voice)
+
+// speaker is the buffered voice of one speaker
+// cursor is the timestamp of the next sample to mix, start the first and until the end of the latest frame
+// mixed is the share of the speaker in the current frame
+type speaker struct {
+	ring     [ringSize]int16
+	cursor   uint32
+	start    uint32
+	until    uint32
+	lastPush time.Time
+	mixed    []int32
+}
+
+// Mixer mixes the speakers of one channel
+//
+// Example:
+//
+//	m := mixer.New(clock.Real, mixer.Config{Codec: codec.L16{}}, func() []string {
+//		return server.Members("lobby")
+//	}, func(listener string, voice protocol.Voice) {
+//		send(listener, voice)
+//	})
+//	go m.Run(ctx)
+//	m.Push("alice", voice.Timestamp, pcm)
+type Mixer struct {
+	clock     clock.Clock
+	config    Config
+	samples   int // samples per frame
+	delay     uint32
+	listeners func() []string
+	output    Output
+
+	mu       sync.Mutex
+	speakers map[string]*speaker
+	gains    map[string]float64
+
+	// state of the mix loop
+	sequence  uint16
+	timestamp uint32
+	sum       []int32
+	own       map[string][]int32 // speaker -> its share of the frame
+	out       []int16
+	frame     []byte
+}
+
+// New creates a Mixer, listeners returns the listeners of the channel at every frame
+func New(clk clock.Clock, config Config, listeners func() []string, output Output) *Mixer {
+	if config.Frame <= 0 {
+		config.Frame = DefaultFrame
+	}
+	if config.Delay <= 0 {
+		config.Delay = DefaultDelay
+	}
+	if config.Idle <= 0 {
+		config.Idle = DefaultIdle
+	}
+	rate := uint32(48000)
+	if info, ok := config.Codec.Type().Info(); ok {
+		rate = info.ClockRate
+	}
+	samples := int(config.Frame * time.Duration(rate) / time.Second)
+	return &Mixer{
+		clock:     clk,
+		config:    config,
+		samples:   samples,
+		delay:     uint32(config.Delay * time.Duration(rate) / time.Second),
+		listeners: listeners,
+		output:    output,
+		speakers:  make(map[string]*speaker),
+		gains:     make(map[string]float64),
+		sum:       make([]int32, samples),
+		own:       make(map[string][]int32),
+		out:       make([]int16, samples),
+	}
+}
+
+// SetGain sets the gain of a speaker, 1 keeps the volume and 0 mutes it
+// The gain is kept when the speaker leaves and comes back
+func (m *Mixer) SetGain(key string, gain float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if gain == 1 {
+		delete(m.gains, key)
+		return
+	}
+	m.gains[key] = max(gain, 0)
+}
+
+// Remove drops the buffered voice and the gain of a speaker
+func (m *Mixer) Remove(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.speakers, key)
+	delete(m.gains, key)
+}
+
+// Push adds the samples of a speaker at their timestamp
+// The first frame of a speaker is mixed after the Delay, later frames keep their distance to it
+// Samples that arrive after they were mixed are dropped, a jump too far ahead starts the speaker over
+func (m *Mixer) Push(key string, timestamp uint32, pcm []int16) {
+	if len(pcm) == 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.speakers[key]
+	if ok {
+		ahead := int64(int32(timestamp - s.cursor))
+		ok = ahead > -ringSize && ahead+int64(len(pcm)) <= ringSize-int64(m.samples)
+	}
+	if !ok {
+		s = &speaker{cursor: timestamp - m.delay, start: timestamp, until: timestamp, mixed: make([]int32, m.samples)}
+		m.speakers[key] = s
+	}
+	s.lastPush = m.clock.Now()
+	if late := int32(s.cursor - timestamp); late > 0 {
+		if int(late) >= len(pcm) {
+			return
+		}
+		pcm, timestamp = pcm[late:], s.cursor
+	}
+	for i, sample := range pcm {
+		s.ring[(timestamp+uint32(i))%ringSize] = sample
+	}
+	if int32(timestamp-s.start) < 0 {
+		s.start = timestamp
+	}
+	if end := timestamp + uint32(len(pcm)); int32(end-s.until) > 0 {
+		s.until = end
+	}
+}
+
+// Run mixes a frame every Frame until the context is done
+func (m *Mixer) Run(ctx context.Context) {
+	ticker := m.clock.NewTicker(m.config.Frame)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			m.Mix()
+		}
+	}
+}
+
+// Mix mixes the next frame and sends it to every listener, Run calls it every Frame
+// Nothing is sent while nobody speaks
+// Mix is not safe for concurrent use, it is called either by Run or directly, e.g. in tests
+func (m *Mixer) Mix() {
+	m.mu.Lock()
+	now := m.clock.Now()
+	clear(m.sum)
+	clear(m.own)
+	for key, s := range m.speakers {
+		if now.Sub(s.lastPush) > m.config.Idle {
+			delete(m.speakers, key)
+			continue
+		}
+		// the frame overlaps the voice of the speaker, the delay before its first frame is not sent
+		active := int32(s.until-s.cursor) > 0 && int32(s.cursor+uint32(m.samples)-s.start) > 0
+		gain, scaled := m.gains[key]
+		own := s.mixed
+		for i := range m.samples {
+			j := (s.cursor + uint32(i)) % ringSize
+			sample := int32(s.ring[j])
+			s.ring[j] = 0
+			if !active {
+				continue
+			}
+			if scaled {
+				sample = int32(float64(sample) * gain)
+			}
+			own[i] = sample
+			m.sum[i] += sample
+		}
+		s.cursor += uint32(m.samples)
+		if active {
+			m.own[key] = own
+		}
+	}
+	m.mu.Unlock()
+
+	timestamp := m.timestamp
+	m.timestamp += uint32(m.samples)
+	if len(m.own) == 0 {
+		return
+	}
+	m.sequence++
+	for _, listener := range m.listeners() {
+		own := m.own[listener]
+		// a listener that is the only speaker hears nothing
+		if own != nil && len(m.own) == 1 {
+			continue
+		}
+		limit(m.out, m.sum, own)
+		frame, err := m.config.Codec.Encode(m.frame[:0], m.out)
+		if err != nil {
+			continue
+		}
+		m.frame = frame
+		m.output(listener, protocol.Voice{
+			SSRC:      m.config.SSRC,
+			Sequence:  m.sequence,
+			Timestamp: timestamp,
+			Codec:     m.config.Codec.Type(),
+			Frame:     frame,
+		})
+	}
+}
+
+// limit writes sum without own to out
+// A frame that would clip is scaled down as a whole, so it keeps its shape
+func limit(out []int16, sum []int32, own []int32) {
+	var peak int32
+	for i, sample := range sum {
+		if own != nil {
+			sample -= own[i]
+		}
+		peak = max(peak, sample, -sample)
+	}
+	scale := 1.0
+	if peak > math.MaxInt16 {
+		scale = float64(math.MaxInt16) / float64(peak)
+	}
+	for i, sample := range sum {
+		if own != nil {
+			sample -= own[i]
+		}
+		out[i] = int16(float64(sample) * scale)
+	}
+}
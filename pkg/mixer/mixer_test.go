@@ -0,0 +1,159 @@
+package mixer
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/clock"
+	"github.com/aura-speak/networking/pkg/codec"
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+// frames collects the decoded output of a Mixer per listener
+type frames map[string][][]int16
+
+func newMixer(t *testing.T, listeners ...string) (*Mixer, frames, *clock.Fake) {
+	t.Helper()
+	fake := clock.NewFake(time.Unix(0, 0))
+	got := frames{}
+	// 1ms frames of 48 samples, mixed 2 frames after the first push
+	m := New(fake, Config{Codec: codec.L16{}, Frame: time.Millisecond, Delay: 2 * time.Millisecond}, func() []string {
+		return listeners
+	}, func(listener string, voice protocol.Voice) {
+		pcm, err := codec.L16{}.Decode(nil, voice.Frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[listener] = append(got[listener], pcm)
+	})
+	return m, got, fake
+}
+
+func constant(value int16) []int16 {
+	pcm := make([]int16, 48)
+	for i := range pcm {
+		pcm[i] = value
+	}
+	return pcm
+}
+
+func TestMixExcludesOwnVoice(t *testing.T) {
+	m, got, _ := newMixer(t, "alice", "bob", "carol")
+	m.Push("alice", 1000, constant(100))
+	m.Push("bob", 5000, constant(20))
+	for range 3 {
+		m.Mix()
+	}
+	want := map[string]int16{"alice": 20, "bob": 100, "carol": 120}
+	for listener, value := range want {
+		if len(got[listener]) != 1 || !slices.Equal(got[listener][0], constant(value)) {
+			t.Errorf("%s heard %v, want one frame of %d", listener, got[listener], value)
+		}
+	}
+}
+
+func TestMixAlone(t *testing.T) {
+	m, got, _ := newMixer(t, "alice", "bob")
+	m.Push("alice", 0, constant(100))
+	for range 4 {
+		m.Mix()
+	}
+	if len(got["alice"]) != 0 || len(got["bob"]) != 1 {
+		t.Fatalf("alice heard %d frames, bob %d, want 0 and 1", len(got["alice"]), len(got["bob"]))
+	}
+}
+
+func TestMixGain(t *testing.T) {
+	m, got, _ := newMixer(t, "carol")
+	m.SetGain("alice", 0.5)
+	m.SetGain("bob", 0)
+	m.Push("alice", 0, constant(100))
+	m.Push("bob", 0, constant(100))
+	for range 3 {
+		m.Mix()
+	}
+	if len(got["carol"]) != 1 || !slices.Equal(got["carol"][0], constant(50)) {
+		t.Fatalf("carol heard %v", got["carol"])
+	}
+}
+
+func TestMixLimitsInsteadOfClipping(t *testing.T) {
+	m, got, _ := newMixer(t, "carol")
+	loud := constant(math.MaxInt16)
+	loud[0] = 16384
+	m.Push("alice", 0, loud)
+	m.Push("bob", 0, loud)
+	for range 3 {
+		m.Mix()
+	}
+	frame := got["carol"][0]
+	if frame[1] != math.MaxInt16 || frame[0] != 16384 {
+		t.Fatalf("mixed %d and %d, want %d and the half of it", frame[0], frame[1], math.MaxInt16)
+	}
+}
+
+func TestMixKeepsGapsAndOrder(t *testing.T) {
+	m, got, _ := newMixer(t, "carol")
+	// frames 0 and 2 arrive, 2 before 0, frame 1 is missing
+	m.Push("alice", 96, constant(3))
+	m.Push("alice", 0, constant(1))
+	for range 5 {
+		m.Mix()
+	}
+	want := [][]int16{constant(1), constant(0), constant(3)}
+	if len(got["carol"]) != len(want) {
+		t.Fatalf("carol heard %d frames, want %d", len(got["carol"]), len(want))
+	}
+	for i := range want {
+		if !slices.Equal(got["carol"][i], want[i]) {
+			t.Errorf("frame %d = %v, want %v", i, got["carol"][i][:1], want[i][:1])
+		}
+	}
+
+	// a frame that arrives after it was mixed is dropped
+	m.Push("alice", 48, constant(2))
+	m.Mix()
+	if len(got["carol"]) != len(want) {
+		t.Fatal("late frame was mixed")
+	}
+}
+
+func TestIdleSpeakerRemoved(t *testing.T) {
+	m, _, fake := newMixer(t, "carol")
+	m.Push("alice", 0, constant(1))
+	fake.Advance(DefaultIdle + time.Millisecond)
+	m.Mix()
+	if len(m.speakers) != 0 {
+		t.Fatal("idle speaker kept")
+	}
+}
+
+func TestRun(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	mixed := make(chan protocol.Voice, 1)
+	m := New(fake, Config{Codec: codec.L16{}, Frame: time.Millisecond, Delay: time.Millisecond}, func() []string {
+		return []string{"carol"}
+	}, func(listener string, voice protocol.Voice) {
+		mixed <- voice
+	})
+	go m.Run(t.Context())
+	fake.BlockUntil(1)
+	m.Push("alice", 0, constant(7))
+	// a tick is dropped while the mixer is busy, so the clock advances until the frame arrives
+	deadline := time.After(time.Second)
+	for {
+		fake.Advance(time.Millisecond)
+		select {
+		case voice := <-mixed:
+			if voice.Sequence != 1 || voice.Codec != protocol.CodecL16 {
+				t.Fatalf("mixed %+v", voice)
+			}
+			return
+		case <-deadline:
+			t.Fatal("Run mixed no frame")
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
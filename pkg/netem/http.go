@@ -0,0 +1,119 @@
+package netem
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/simnet"
+)
+
+// Presets are named profiles for typical networks, they are used for both directions
+var Presets = map[string]simnet.Profile{
+	"none": {},
+	"lan": {
+		Delay:  time.Millisecond,
+		Jitter: 500 * time.Microsecond,
+	},
+	"wifi": {
+		Delay:  5 * time.Millisecond,
+		Jitter: 5 * time.Millisecond,
+		Burst:  &simnet.GilbertElliott{GoodToBad: 0.002, BadToGood: 0.3, LossBad: 0.7},
+	},
+	"mobile": {
+		Delay:    40 * time.Millisecond,
+		Jitter:   20 * time.Millisecond,
+		Burst:    &simnet.GilbertElliott{GoodToBad: 0.01, BadToGood: 0.25, LossGood: 0.002, LossBad: 0.6},
+		Rate:     250_000,
+		MaxQueue: 300 * time.Millisecond,
+	},
+	"bad": {
+		Delay:     150 * time.Millisecond,
+		Jitter:    60 * time.Millisecond,
+		Burst:     &simnet.GilbertElliott{GoodToBad: 0.03, BadToGood: 0.2, LossGood: 0.01, LossBad: 0.8},
+		Duplicate: 0.01,
+		Reorder:   0.02,
+		Rate:      64_000,
+		MaxQueue:  200 * time.Millisecond,
+	},
+}
+
+// PresetNames returns the names of the presets in alphabetical order
+func PresetNames() []string {
+	names := make([]string, 0, len(Presets))
+	for name := range Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProfileRequest changes the profiles of a Proxy
+// The preset is applied first, then Both and then Up and Down, empty fields keep the current profile
+type ProfileRequest struct {
+	Preset string          `json:"preset,omitempty"`
+	Both   *simnet.Profile `json:"both,omitempty"`
+	Up     *simnet.Profile `json:"up,omitempty"`
+	Down   *simnet.Profile `json:"down,omitempty"`
+}
+
+// Apply changes the profiles of the proxy
+// It returns an error for an unknown preset
+func (r ProfileRequest) Apply(p *Proxy) error {
+	status := p.Status()
+	up, down := status.Up, status.Down
+	if r.Preset != "" {
+		preset, ok := Presets[r.Preset]
+		if !ok {
+			return fmt.Errorf("unknown preset %q", r.Preset)
+		}
+		up, down = preset, preset
+	}
+	if r.Both != nil {
+		up, down = *r.Both, *r.Both
+	}
+	if r.Up != nil {
+		up = *r.Up
+	}
+	if r.Down != nil {
+		down = *r.Down
+	}
+	p.SetProfiles(up, down)
+	return nil
+}
+
+// Handler returns the HTTP API of the proxy
+//
+//	GET /status   profiles, counters and number of clients
+//	PUT /profile  changes the profiles with a ProfileRequest, e.g. {"preset": "mobile"} or {"up": {"loss": 0.1, "delay": "80ms"}}
+//	GET /presets  the names and profiles of the presets
+func (p *Proxy) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, p.Status())
+	})
+	mux.HandleFunc("PUT /profile", func(w http.ResponseWriter, r *http.Request) {
+		var req ProfileRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := req.Apply(p); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, p.Status())
+	})
+	mux.HandleFunc("GET /presets", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, Presets)
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,64 @@
+package netem_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/netem"
+)
+
+func request(t *testing.T, handler http.Handler, method, path, body string) (int, netem.Status) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	var status netem.Status
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return rec.Code, status
+}
+
+func TestHandlerChangesProfiles(t *testing.T) {
+	proxy := startProxy(t, netem.Options{})
+	handler := proxy.Handler()
+
+	code, status := request(t, handler, http.MethodPut, "/profile", `{"preset": "mobile"}`)
+	if code != http.StatusOK || status.Up.Delay != netem.Presets["mobile"].Delay || status.Down.Rate != netem.Presets["mobile"].Rate {
+		t.Fatalf("%d with up %+v, want the mobile preset", code, status.Up)
+	}
+	// Up and Down are applied after the preset
+	code, status = request(t, handler, http.MethodPut, "/profile", `{"preset": "lan", "up": {"loss": 0.1, "delay": "80ms"}}`)
+	if code != http.StatusOK || status.Up.Loss != 0.1 || status.Up.Delay != 80*time.Millisecond || status.Down.Delay != netem.Presets["lan"].Delay {
+		t.Fatalf("%d with up %+v and down %+v", code, status.Up, status.Down)
+	}
+	if _, status := request(t, handler, http.MethodGet, "/status", ""); status.Up.Loss != 0.1 {
+		t.Fatalf("status with up %+v after the change", status.Up)
+	}
+
+	for _, body := range []string{`{"preset": "moon"}`, `{"up": {"loss": 2}}`, `{`} {
+		if code, _ := request(t, handler, http.MethodPut, "/profile", body); code != http.StatusBadRequest {
+			t.Errorf("%s answered with %d, want 400", body, code)
+		}
+	}
+}
+
+func TestHandlerPresets(t *testing.T) {
+	proxy := startProxy(t, netem.Options{})
+	rec := httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/presets", nil))
+	var presets map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &presets); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range netem.PresetNames() {
+		if _, ok := presets[name]; !ok {
+			t.Errorf("preset %s missing", name)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+// Package Netem contains a UDP proxy that impairs the traffic between clients and a server
+// It is responsible for forwarding the datagrams of every client over an own upstream socket,
+// so the server sees one remote per client like without the proxy
+// Both directions have a simnet.Profile with loss, latency, jitter, reordering and a rate limit
+// The profiles can be changed while the proxy runs, e.g. over the HTTP API of Handler
+package netem
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/clock"
+	"github.com/aura-speak/networking/pkg/simnet"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultIdleTimeout is the time after which the upstream socket of a silent client is closed
+const DefaultIdleTimeout = 2 * time.Minute
+
+// maxDatagramSize is the largest datagram the proxy forwards
+const maxDatagramSize = 64 * 1024
+
+// Options are the settings of a Proxy
+type Options struct {
+	// Listen is the address the clients send to, e.g. "127.0.0.1:9000"
+	Listen string
+	// Upstream is the address of the server, e.g. "127.0.0.1:8080"
+	Upstream string
+	// Seed of the random decisions of both directions
+	Seed uint64
+	// Up is the profile from the clients to the server, Down the one from the server to the clients
+	Up   simnet.Profile
+	Down simnet.Profile
+	// IdleTimeout closes the upstream socket of a client after this time without traffic, DefaultIdleTimeout if zero
+	IdleTimeout time.Duration
+	// Clock delays the datagrams and expires idle clients, clock.Real if nil
+	Clock clock.Clock
+}
+
+// Status is the state of a Proxy
+type Status struct {
+	Listen    string           `json:"listen"`
+	Upstream  string           `json:"upstream"`
+	Up        simnet.Profile   `json:"up"`
+	Down      simnet.Profile   `json:"down"`
+	UpStats   simnet.LinkStats `json:"upStats"`
+	DownStats simnet.LinkStats `json:"downStats"`
+	Sessions  int              `json:"sessions"`
+}
+
+// Proxy is a UDP proxy between clients and a server
+//
+// Example:
+//
+//	proxy, err := netem.NewProxy(netem.Options{
+//		Listen:   "127.0.0.1:9000",
+//		Upstream: "127.0.0.1:8080",
+//		Up:       simnet.Profile{Loss: 0.02, Delay: 40 * time.Millisecond},
+//		Down:     simnet.Profile{Loss: 0.02, Delay: 40 * time.Millisecond},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	go proxy.Run(ctx)
+type Proxy struct {
+	opts      Options
+	conn      *net.UDPConn
+	upstream  *net.UDPAddr
+	up        *simnet.Link
+	down      *simnet.Link
+	scheduler *simnet.Scheduler
+
+	mu       sync.Mutex
+	sessions map[string]*session // client addr -> session
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	wg        sync.WaitGroup
+}
+
+// session is the upstream socket of one client
+type session struct {
+	client   *net.UDPAddr
+	conn     *net.UDPConn
+	lastSeen atomic.Int64 // unix nanoseconds of the last datagram in either direction
+}
+
+// NewProxy opens the listening socket of the proxy
+// The proxy does not forward anything before Run is called
+func NewProxy(opts Options) (*Proxy, error) {
+	if err := opts.Up.Validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.Down.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = DefaultIdleTimeout
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.Real
+	}
+	upstream, err := net.ResolveUDPAddr("udp", opts.Upstream)
+	if err != nil {
+		return nil, err
+	}
+	laddr, err := net.ResolveUDPAddr("udp", opts.Listen)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+	return &Proxy{
+		opts:      opts,
+		conn:      conn,
+		upstream:  upstream,
+		up:        simnet.NewLink(opts.Seed, opts.Clock, opts.Up),
+		down:      simnet.NewLink(opts.Seed+1, opts.Clock, opts.Down),
+		scheduler: simnet.NewScheduler(opts.Clock),
+		sessions:  make(map[string]*session),
+		closed:    make(chan struct{}),
+	}, nil
+}
+
+// Addr returns the address the clients send to
+func (p *Proxy) Addr() *net.UDPAddr {
+	return p.conn.LocalAddr().(*net.UDPAddr)
+}
+
+// SetProfiles changes the profiles of both directions
+func (p *Proxy) SetProfiles(up, down simnet.Profile) {
+	p.up.SetProfile(up)
+	p.down.SetProfile(down)
+	log.WithField("caller", "netem").Infof("Changed profiles, up %+v, down %+v", up, down)
+}
+
+// Status returns the profiles, the counters and the number of clients
+func (p *Proxy) Status() Status {
+	p.mu.Lock()
+	sessions := len(p.sessions)
+	p.mu.Unlock()
+	return Status{
+		Listen:    p.Addr().String(),
+		Upstream:  p.upstream.String(),
+		Up:        p.up.Profile(),
+		Down:      p.down.Profile(),
+		UpStats:   p.up.Stats(),
+		DownStats: p.down.Stats(),
+		Sessions:  sessions,
+	}
+}
+
+// Run forwards datagrams until the context is done or the proxy is closed
+func (p *Proxy) Run(ctx context.Context) error {
+	log.WithField("caller", "netem").Infof("Proxy listening on %s, forwarding to %s", p.Addr(), p.upstream)
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.Close()
+		case <-p.closed:
+		}
+	}()
+	p.wg.Go(p.expireLoop)
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := p.conn.ReadFromUDP(buf)
+		if err != nil {
+			if p.isClosed() {
+				p.wg.Wait()
+				return nil
+			}
+			log.WithField("caller", "netem").WithError(err).Error("Error reading from client")
+			continue
+		}
+		s, err := p.session(addr)
+		if err != nil {
+			log.WithField("caller", "netem").WithError(err).Errorf("Can't open upstream socket for %s", addr)
+			continue
+		}
+		s.lastSeen.Store(p.opts.Clock.Now().UnixNano())
+		data := make([]byte, n)
+		copy(data, buf[:n])
+		p.forward(p.up, data, func() {
+			s.conn.Write(data)
+		})
+	}
+}
+
+// Close stops the proxy and closes all sockets
+func (p *Proxy) Close() error {
+	var err error
+	p.closeOnce.Do(func() {
+		close(p.closed)
+		err = p.conn.Close()
+		p.mu.Lock()
+		for key, s := range p.sessions {
+			s.conn.Close()
+			delete(p.sessions, key)
+		}
+		p.mu.Unlock()
+	})
+	return err
+}
+
+func (p *Proxy) isClosed() bool {
+	select {
+	case <-p.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// forward sends a datagram over a link, write is called once per delivered copy
+func (p *Proxy) forward(link *simnet.Link, data []byte, write func()) {
+	for _, delay := range link.Send(len(data)) {
+		deliver := func() {
+			if p.isClosed() {
+				return
+			}
+			write()
+			link.Delivered()
+		}
+		if delay <= 0 {
+			deliver()
+			continue
+		}
+		p.scheduler.After(delay, deliver)
+	}
+}
+
+// session returns the session of a client and opens its upstream socket on the first datagram
+func (p *Proxy) session(client *net.UDPAddr) (*session, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.isClosed() {
+		return nil, net.ErrClosed
+	}
+	if s, ok := p.sessions[client.String()]; ok {
+		return s, nil
+	}
+	conn, err := net.DialUDP("udp", nil, p.upstream)
+	if err != nil {
+		return nil, err
+	}
+	s := &session{client: client, conn: conn}
+	p.sessions[client.String()] = s
+	p.wg.Go(func() {
+		p.readUpstream(s)
+	})
+	log.WithField("caller", "netem").Infof("New client %s via %s", client, conn.LocalAddr())
+	return s, nil
+}
+
+// readUpstream forwards the datagrams of the server to a client until the upstream socket is closed
+func (p *Proxy) readUpstream(s *session) {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, err := s.conn.Read(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// e.g. ICMP port unreachable while the server is down
+			continue
+		}
+		s.lastSeen.Store(p.opts.Clock.Now().UnixNano())
+		data := make([]byte, n)
+		copy(data, buf[:n])
+		p.forward(p.down, data, func() {
+			p.conn.WriteToUDP(data, s.client)
+		})
+	}
+}
+
+// expireLoop closes the upstream sockets of silent clients
+func (p *Proxy) expireLoop() {
+	ticker := p.opts.Clock.NewTicker(p.opts.IdleTimeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.closed:
+			return
+		case now := <-ticker.C():
+			p.mu.Lock()
+			for key, s := range p.sessions {
+				if now.Sub(time.Unix(0, s.lastSeen.Load())) > p.opts.IdleTimeout {
+					s.conn.Close()
+					delete(p.sessions, key)
+					log.WithField("caller", "netem").Infof("Client %s idle, closed upstream socket", key)
+				}
+			}
+			p.mu.Unlock()
+		}
+	}
+}
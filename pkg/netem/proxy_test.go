@@ -0,0 +1,166 @@
+package netem_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/clock"
+	"github.com/aura-speak/networking/pkg/netem"
+	"github.com/aura-speak/networking/pkg/simnet"
+)
+
+// echo starts a UDP server that sends every datagram back with a prefix
+func echo(t *testing.T) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteToUDP(append([]byte("echo "), buf[:n]...), addr)
+		}
+	}()
+	return conn
+}
+
+// startProxy runs a proxy in front of an echo server until the test ends
+func startProxy(t *testing.T, opts netem.Options) *netem.Proxy {
+	t.Helper()
+	opts.Listen = "127.0.0.1:0"
+	opts.Upstream = echo(t).LocalAddr().String()
+	proxy, err := netem.NewProxy(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- proxy.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("proxy stopped with %v", err)
+		}
+	})
+	return proxy
+}
+
+func dial(t *testing.T, proxy *netem.Proxy) *net.UDPConn {
+	t.Helper()
+	conn, err := net.DialUDP("udp", nil, proxy.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// roundTrip sends a datagram through the proxy and returns the answer, false if none arrives within wait
+func roundTrip(t *testing.T, conn *net.UDPConn, data string, wait time.Duration) (string, bool) {
+	t.Helper()
+	if _, err := conn.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(wait))
+	buf := make([]byte, 1500)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return "", false
+	}
+	return string(buf[:n]), true
+}
+
+func TestProxyForwards(t *testing.T) {
+	proxy := startProxy(t, netem.Options{})
+	alice, bob := dial(t, proxy), dial(t, proxy)
+	for _, c := range []*net.UDPConn{alice, bob} {
+		if got, ok := roundTrip(t, c, "hello", time.Second); !ok || got != "echo hello" {
+			t.Fatalf("answer %q, %v", got, ok)
+		}
+	}
+	status := proxy.Status()
+	if status.Sessions != 2 {
+		t.Fatalf("%d sessions, want one per client", status.Sessions)
+	}
+	if status.UpStats.Delivered != 2 || status.DownStats.Delivered != 2 {
+		t.Fatalf("stats up %+v, down %+v, want two datagrams each way", status.UpStats, status.DownStats)
+	}
+}
+
+func TestProxyImpairs(t *testing.T) {
+	proxy := startProxy(t, netem.Options{Up: simnet.Profile{Loss: 1}})
+	c := dial(t, proxy)
+	if got, ok := roundTrip(t, c, "lost", 100*time.Millisecond); ok {
+		t.Fatalf("answer %q through a lossy link", got)
+	}
+	if stats := proxy.Status().UpStats; stats.Lost != 1 {
+		t.Fatalf("up stats %+v, want one lost datagram", stats)
+	}
+
+	// the profiles change while the proxy runs
+	proxy.SetProfiles(simnet.Profile{}, simnet.Profile{})
+	if got, ok := roundTrip(t, c, "changed", time.Second); !ok || got != "echo changed" {
+		t.Fatalf("answer %q, %v", got, ok)
+	}
+}
+
+func TestProxyDelaysOnTheClock(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1_700_000_000, 0))
+	proxy := startProxy(t, netem.Options{Down: simnet.Profile{Delay: 50 * time.Millisecond}, Clock: fake})
+	c := dial(t, proxy)
+	if got, ok := roundTrip(t, c, "slow", 100*time.Millisecond); ok {
+		t.Fatalf("answer %q before the clock moved", got)
+	}
+	if stats := proxy.Status().DownStats; stats.Sent != 1 {
+		t.Fatalf("down stats %+v, want the answer on its way", stats)
+	}
+	fake.Advance(50 * time.Millisecond)
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 1500)
+	if n, err := c.Read(buf); err != nil || string(buf[:n]) != "echo slow" {
+		t.Fatalf("answer %q, %v after the delay", buf[:n], err)
+	}
+}
+
+func TestProxyExpiresIdleClients(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1_700_000_000, 0))
+	proxy := startProxy(t, netem.Options{IdleTimeout: time.Minute, Clock: fake})
+	c := dial(t, proxy)
+	if _, ok := roundTrip(t, c, "hello", time.Second); !ok {
+		t.Fatal("no answer")
+	}
+	// the expiry ticker runs every quarter of the IdleTimeout
+	fake.BlockUntil(1)
+	fake.Advance(time.Minute)
+	if proxy.Status().Sessions != 1 {
+		t.Fatal("the session of a client closed before the IdleTimeout")
+	}
+	deadline := time.Now().Add(time.Second)
+	for proxy.Status().Sessions != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the session of an idle client was not closed")
+		}
+		fake.Advance(15 * time.Second)
+		time.Sleep(10 * time.Millisecond)
+	}
+	// the client gets a new upstream socket
+	if _, ok := roundTrip(t, c, "again", time.Second); !ok {
+		t.Fatal("no answer after the session expired")
+	}
+}
+
+func TestNewProxyValidatesProfiles(t *testing.T) {
+	if _, err := netem.NewProxy(netem.Options{Listen: "127.0.0.1:0", Upstream: "127.0.0.1:9", Down: simnet.Profile{Loss: 2}}); err == nil {
+		t.Fatal("proxy with a loss of 200% created")
+	}
+}
@@ -0,0 +1,35 @@
+package protocol
+
+import "sync"
+
+// BufferSize is the size of the pooled datagram buffers, the MTU of Ethernet
+// It is larger than MaxPacketSize, so oversized datagrams are read whole and rejected by Decode instead of truncated
+const BufferSize = 1500
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, BufferSize)
+		return &buf
+	},
+}
+
+// GetBuffer returns a buffer of BufferSize bytes from the pool
+// Return it with PutBuffer once nothing refers to its content anymore
+//
+// Example:
+//
+//	buf := protocol.GetBuffer()
+//	defer protocol.PutBuffer(buf)
+//	n, addr, err := conn.ReadFrom(*buf)
+func GetBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+// PutBuffer returns a buffer of GetBuffer to the pool
+func PutBuffer(buf *[]byte) {
+	if buf == nil || cap(*buf) < BufferSize {
+		return
+	}
+	*buf = (*buf)[:BufferSize]
+	bufferPool.Put(buf)
+}
@@ -0,0 +1,103 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxChannelNameSize is the longest channel name in bytes
+const MaxChannelNameSize = 64
+
+// ValidChannelName checks the payload of a PacketTypeChannelJoin
+// A channel name is 1 to MaxChannelNameSize bytes of UTF-8 without control characters
+func ValidChannelName(name []byte) error {
+	if len(name) == 0 || len(name) > MaxChannelNameSize {
+		return malformedError(fmt.Sprintf("channel name must be 1 to %d bytes", MaxChannelNameSize))
+	}
+	if !utf8.Valid(name) {
+		return malformedError("channel name is no valid UTF-8")
+	}
+	for _, r := range string(name) {
+		if unicode.IsControl(r) {
+			return malformedError("channel name contains control characters")
+		}
+	}
+	return nil
+}
+
+// FloorReason tells why a floor request was denied or a floor revoked
+type FloorReason uint8
+
+const (
+	FloorReasonNone         FloorReason = 0x00 // No reason, e.g. a grant
+	FloorReasonQueued       FloorReason = 0x01 // Deny: the request waits at Position
+	FloorReasonQueueFull    FloorReason = 0x02 // Deny: nobody else may wait for the floor
+	FloorReasonNotInChannel FloorReason = 0x03 // Deny: the client joined no channel
+	FloorReasonOpen         FloorReason = 0x04 // Deny: the channel has no floor control, everybody may talk
+	FloorReasonPreempted    FloorReason = 0x05 // Revoke: a priority talker took the floor
+	FloorReasonTimeout      FloorReason = 0x06 // Revoke: the talk time is over
+)
+
+var floorReasonStrings = map[FloorReason]string{
+	FloorReasonNone:         "None",
+	FloorReasonQueued:       "Queued",
+	FloorReasonQueueFull:    "QueueFull",
+	FloorReasonNotInChannel: "NotInChannel",
+	FloorReasonOpen:         "Open",
+	FloorReasonPreempted:    "Preempted",
+	FloorReasonTimeout:      "Timeout",
+}
+
+// String returns the name of the floor reason
+func (r FloorReason) String() string {
+	if s, ok := floorReasonStrings[r]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown(0x%02X)", uint8(r))
+}
+
+// FloorSize is the size of an encoded Floor payload in bytes
+const FloorSize = 10
+
+// Floor is the payload of the floor packets the Server sends
+// SSRC is the talker the packet is about
+// Reason and Position are set for a deny and a revoke, Position counts from 1
+// MaxTalkMs is the talk time of a grant in milliseconds, 0 if it is unlimited
+// The floor packets of the client have no payload
+type Floor struct {
+	SSRC      uint32
+	Reason    FloorReason
+	Position  uint8
+	MaxTalkMs uint32
+}
+
+// Encode encodes the floor payload into a byte slice
+// Example:
+//
+//	grant := &Floor{SSRC: ssrc, MaxTalkMs: 30000}
+//	packet := &Packet{
+//		PacketHeader: Header{PacketType: PacketTypeFloorGrant},
+//		Payload:      grant.Encode(),
+//	}
+func (f *Floor) Encode() []byte {
+	buf := make([]byte, 0, FloorSize)
+	buf = binary.BigEndian.AppendUint32(buf, f.SSRC)
+	buf = append(buf, byte(f.Reason), f.Position)
+	return binary.BigEndian.AppendUint32(buf, f.MaxTalkMs)
+}
+
+// DecodeFloor decodes a floor payload
+// It returns an error if the payload is too short
+func DecodeFloor(data []byte) (Floor, error) {
+	if len(data) < FloorSize {
+		return Floor{}, malformedError("floor payload too short")
+	}
+	return Floor{
+		SSRC:      binary.BigEndian.Uint32(data[0:4]),
+		Reason:    FloorReason(data[4]),
+		Position:  data[5],
+		MaxTalkMs: binary.BigEndian.Uint32(data[6:10]),
+	}, nil
+}
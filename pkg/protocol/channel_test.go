@@ -0,0 +1,60 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestValidChannelName(t *testing.T) {
+	valid := [][]byte{[]byte("lobby"), []byte("Kanal ü"), bytes.Repeat([]byte{'a'}, MaxChannelNameSize)}
+	for _, name := range valid {
+		if err := ValidChannelName(name); err != nil {
+			t.Errorf("%q: %v", name, err)
+		}
+	}
+	invalid := [][]byte{nil, bytes.Repeat([]byte{'a'}, MaxChannelNameSize+1), []byte("lob\nby"), {0xFF, 0xFE}}
+	for _, name := range invalid {
+		if err := ValidChannelName(name); err == nil {
+			t.Errorf("%q accepted", name)
+		}
+	}
+}
+
+func TestFloorRoundTrip(t *testing.T) {
+	tests := []Floor{
+		{SSRC: 0xCAFEBABE, MaxTalkMs: 30000},
+		{Reason: FloorReasonQueued, Position: 255},
+		{SSRC: 1, Reason: FloorReasonPreempted},
+	}
+	for _, want := range tests {
+		data := want.Encode()
+		if len(data) != FloorSize {
+			t.Fatalf("encoded size = %d, want %d", len(data), FloorSize)
+		}
+		got, err := DecodeFloor(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("decoded %+v, want %+v", got, want)
+		}
+	}
+	if _, err := DecodeFloor(make([]byte, FloorSize-1)); err == nil {
+		t.Fatal("truncated floor payload decoded")
+	}
+}
+
+func TestConnectAccept(t *testing.T) {
+	accept := &ConnectAccept{SSRC: 0x1A2B3C4D}
+	got, err := DecodeConnectAccept(accept.Encode())
+	if err != nil || got.SSRC != accept.SSRC {
+		t.Fatalf("decoded %+v, %v", got, err)
+	}
+	// servers before the SSRC sent an empty accept
+	if got, err := DecodeConnectAccept(nil); err != nil || got.SSRC != 0 {
+		t.Fatalf("empty accept decoded %+v, %v", got, err)
+	}
+	if _, err := DecodeConnectAccept(accept.Encode()[:ConnectAcceptSize-1]); err == nil {
+		t.Fatal("truncated accept decoded")
+	}
+}
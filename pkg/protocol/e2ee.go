@@ -0,0 +1,56 @@
+package protocol
+
+import "encoding/binary"
+
+// KeyMessageHeaderSize is the size of the routing header of a KeyMessage payload in bytes
+const KeyMessageHeaderSize = 8
+
+// KeyMessage is the payload of a PacketTypeKeyMessage packet
+// It carries the end-to-end encryption keys between the members of a channel, see pkg/e2ee
+// To is the SSRC of the receiving member, 0 sends the message to every other member of the channel
+// From is the SSRC of the sending member, the Server replaces it with the SSRC of the session
+// The Server only reads the routing header, the Body is opaque to it
+// A message of the Server with an empty Body tells that the member From left the channel
+type KeyMessage struct {
+	To   uint32
+	From uint32
+	Body []byte
+}
+
+// Encode encodes the key message into a byte slice
+// Example:
+//
+//	message := &KeyMessage{To: ssrc, Body: body}
+//	packet := &Packet{
+//		PacketHeader: Header{PacketType: PacketTypeKeyMessage},
+//		Payload:      message.Encode(),
+//	}
+func (m *KeyMessage) Encode() []byte {
+	buf := make([]byte, 0, KeyMessageHeaderSize+len(m.Body))
+	buf = binary.BigEndian.AppendUint32(buf, m.To)
+	buf = binary.BigEndian.AppendUint32(buf, m.From)
+	return append(buf, m.Body...)
+}
+
+// DecodeKeyMessage decodes a key message payload
+// The Body points into data, it returns an error if the routing header is too short
+func DecodeKeyMessage(data []byte) (KeyMessage, error) {
+	if len(data) < KeyMessageHeaderSize {
+		return KeyMessage{}, malformedError("key message too short")
+	}
+	return KeyMessage{
+		To:   binary.BigEndian.Uint32(data[0:4]),
+		From: binary.BigEndian.Uint32(data[4:8]),
+		Body: data[KeyMessageHeaderSize:],
+	}, nil
+}
+
+// SetKeyMessageFrom replaces the sender SSRC of an encoded key message in place
+// It returns false if the payload is too short
+func SetKeyMessageFrom(data []byte, ssrc uint32) bool {
+	if len(data) < KeyMessageHeaderSize {
+		return false
+	}
+	binary.BigEndian.PutUint32(data[4:8], ssrc)
+	return true
+}
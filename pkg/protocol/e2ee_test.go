@@ -0,0 +1,31 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestKeyMessageRoundTrip(t *testing.T) {
+	want := KeyMessage{To: 0xCAFEBABE, From: 7, Body: []byte{0x01, 0x02, 0x03}}
+	data := want.Encode()
+	if len(data) != KeyMessageHeaderSize+len(want.Body) {
+		t.Fatalf("encoded size = %d", len(data))
+	}
+	if !SetKeyMessageFrom(data, 9) {
+		t.Fatal("routing header too short")
+	}
+	got, err := DecodeKeyMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.To != want.To || got.From != 9 || !bytes.Equal(got.Body, want.Body) {
+		t.Errorf("decoded %+v, want %+v from 9", got, want)
+	}
+
+	if _, err := DecodeKeyMessage(data[:KeyMessageHeaderSize-1]); err == nil {
+		t.Error("truncated routing header accepted")
+	}
+	if SetKeyMessageFrom(data[:KeyMessageHeaderSize-1], 1) {
+		t.Error("truncated routing header changed")
+	}
+}
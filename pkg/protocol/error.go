@@ -0,0 +1,97 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorCode tells the client why the Server refused a packet
+type ErrorCode uint8
+
+const (
+	ErrorCodeUnknown          ErrorCode = 0x00 // Unspecified error
+	ErrorCodePermissionDenied ErrorCode = 0x01 // Client lacks the permission required for the packet
+	ErrorCodeMalformed        ErrorCode = 0x02 // Payload of the packet could not be parsed
+	ErrorCodeUnsupported      ErrorCode = 0x03 // Server has no handler for the packet type
+	ErrorCodeInvalidState     ErrorCode = 0x04 // Packet does not fit the state of the client, e.g. voice outside of a channel
+)
+
+var errorCodeStrings = map[ErrorCode]string{
+	ErrorCodeUnknown:          "Unknown",
+	ErrorCodePermissionDenied: "PermissionDenied",
+	ErrorCodeMalformed:        "Malformed",
+	ErrorCodeUnsupported:      "Unsupported",
+	ErrorCodeInvalidState:     "InvalidState",
+}
+
+// ErrMalformed is matched by the errors of the Decode functions and ValidChannelName
+//
+// Example:
+//
+//	if _, err := protocol.DecodeVoice(payload); errors.Is(err, protocol.ErrMalformed) {
+//		fmt.Println("Dropping malformed voice frame:", err)
+//	}
+var ErrMalformed = errors.New("malformed payload")
+
+// malformedError is an error of a payload that could not be parsed, it matches ErrMalformed
+type malformedError string
+
+func (e malformedError) Error() string { return string(e) }
+
+func (e malformedError) Is(target error) bool { return target == ErrMalformed }
+
+// String returns the name of the error code
+func (c ErrorCode) String() string {
+	if s, ok := errorCodeStrings[c]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown(0x%02X)", uint8(c))
+}
+
+// ErrorReply is the payload of a PacketTypeError packet
+// It contains the error code, the type of the refused packet and an optional message
+type ErrorReply struct {
+	Code       ErrorCode
+	PacketType PacketType
+	Message    string
+}
+
+// Encode encodes the error reply into a byte slice
+// Example:
+//
+//	reply := &ErrorReply{Code: ErrorCodePermissionDenied, PacketType: PacketTypeDebugAny}
+//	packet := &Packet{
+//		PacketHeader: Header{PacketType: PacketTypeError},
+//		Payload:      reply.Encode(),
+//	}
+func (e *ErrorReply) Encode() []byte {
+	buf := make([]byte, 2+len(e.Message))
+	buf[0] = byte(e.Code)
+	buf[1] = byte(e.PacketType)
+	copy(buf[2:], e.Message)
+	return buf
+}
+
+// DecodeErrorReply decodes an error reply from a packet payload
+func DecodeErrorReply(data []byte) (ErrorReply, error) {
+	if len(data) < 2 {
+		return ErrorReply{}, malformedError("error reply too short")
+	}
+	return ErrorReply{
+		Code:       ErrorCode(data[0]),
+		PacketType: PacketType(data[1]),
+		Message:    string(data[2:]),
+	}, nil
+}
+
+// Error makes the error reply usable as error on the client side
+func (e *ErrorReply) Error() string {
+	strPacketType, ok := PacketTypeMapType[e.PacketType]
+	if !ok {
+		strPacketType = fmt.Sprintf("Unknown(0x%02X)", uint8(e.PacketType))
+	}
+	if e.Message == "" {
+		return fmt.Sprintf("server refused %s: %s", strPacketType, e.Code)
+	}
+	return fmt.Sprintf("server refused %s: %s: %s", strPacketType, e.Code, e.Message)
+}
@@ -0,0 +1,137 @@
+package protocol_test
+
+import (
+	"bytes"
+
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+// packet encodes a packet for the seeds
+func packet(packetType protocol.PacketType, payload []byte) []byte {
+	p := &protocol.Packet{
+		PacketHeader: protocol.Header{PacketType: packetType},
+		Payload:      payload,
+	}
+	return p.Encode()
+}
+
+// packetSeeds are valid packets of every type and the edge cases of the header
+func packetSeeds() [][]byte {
+	seeds := [][]byte{
+		{},
+		{0x00},
+		{0xFF},
+		bytes.Repeat([]byte{0x91}, protocol.MaxPacketSize),
+		bytes.Repeat([]byte{0x91}, protocol.MaxPacketSize+1),
+		packet(protocol.PacketTypeDebugHello, []byte("1")),
+		packet(protocol.PacketTypeDebugAny, []byte("Hello, Server!")),
+		packet(protocol.PacketTypeClientNeedsDisconnect, nil),
+	}
+	for _, payload := range connectRequestSeeds() {
+		seeds = append(seeds, packet(protocol.PacketTypeConnect, payload))
+	}
+	seeds = append(seeds,
+		packet(protocol.PacketTypeConnectAccept, nil),
+		packet(protocol.PacketTypeConnectAccept, (&protocol.ConnectAccept{SSRC: 0x1A2B3C4D}).Encode()),
+		packet(protocol.PacketTypeConnectReject, []byte{byte(protocol.RejectReasonExpired)}),
+		packet(protocol.PacketTypeHelloVerify, bytes.Repeat([]byte{0x5A}, protocol.CookieSize)),
+	)
+	for _, payload := range errorReplySeeds() {
+		seeds = append(seeds, packet(protocol.PacketTypeError, payload))
+	}
+	for _, payload := range senderReportSeeds() {
+		seeds = append(seeds, packet(protocol.PacketTypeSenderReport, payload))
+	}
+	for _, payload := range receiverReportSeeds() {
+		seeds = append(seeds, packet(protocol.PacketTypeReceiverReport, payload))
+	}
+	for _, payload := range voiceSeeds() {
+		seeds = append(seeds, packet(protocol.PacketTypeVoice, payload))
+	}
+	for _, payload := range floorSeeds() {
+		seeds = append(seeds, packet(protocol.PacketTypeFloorGrant, payload), packet(protocol.PacketTypeFloorRevoke, payload))
+	}
+	for _, payload := range keyMessageSeeds() {
+		seeds = append(seeds, packet(protocol.PacketTypeKeyMessage, payload))
+	}
+	return seeds
+}
+
+// connectRequestSeeds are connect requests with and without cookie and lengths that point past the end
+func connectRequestSeeds() [][]byte {
+	first := &protocol.ConnectRequest{Credential: []byte("token")}
+	second := &protocol.ConnectRequest{Cookie: bytes.Repeat([]byte{0x5A}, protocol.CookieSize), Credential: []byte("token")}
+	return [][]byte{
+		{},
+		{0x00},
+		{0x00, 0x00},
+		{0xFF, 0x00, 0x00},
+		{0x00, 0xFF, 0xFF, 0x01},
+		first.Encode(),
+		second.Encode(),
+	}
+}
+
+// connectSeeds are the payloads of the connect handshake
+func connectSeeds() [][]byte {
+	return append(connectRequestSeeds(),
+		bytes.Repeat([]byte{0xAB}, protocol.CookieSize),
+		make([]byte, protocol.CookieSize+1),
+		[]byte{byte(protocol.RejectReasonBanned)},
+		[]byte{0xFF, 0x00},
+	)
+}
+
+// reportSeeds are the payloads of sender and receiver reports
+func reportSeeds() [][]byte {
+	return append(senderReportSeeds(), receiverReportSeeds()...)
+}
+
+func errorReplySeeds() [][]byte {
+	reply := &protocol.ErrorReply{Code: protocol.ErrorCodePermissionDenied, PacketType: protocol.PacketTypeDebugAny, Message: "no"}
+	return [][]byte{{}, {0x01}, {0x01, 0x91}, reply.Encode(), {0xFF, 0xFF, 0xFF}}
+}
+
+func senderReportSeeds() [][]byte {
+	report := &protocol.SenderReport{NTPTimestamp: 0xE8_00_00_00_80_00_00_00, PacketCount: 10, OctetCount: 1200}
+	encoded := report.Encode()
+	return [][]byte{{}, encoded[:protocol.SenderReportSize-1], encoded, append(encoded, 0x00)}
+}
+
+func receiverReportSeeds() [][]byte {
+	report := &protocol.ReceiverReport{SenderPacketCount: 10, HighestSequence: 0x10005, CumulativeLost: -1, FractionLost: 128, Jitter: 500, LastSR: 0x8000, DelaySinceLastSR: 65536}
+	encoded := report.Encode()
+	return [][]byte{{}, encoded[:protocol.ReceiverReportSize-1], encoded, append(encoded, 0x00)}
+}
+
+// connectAcceptSeeds are the accepts of old and new Servers and the lengths in between
+func connectAcceptSeeds() [][]byte {
+	accept := &protocol.ConnectAccept{SSRC: 0x1A2B3C4D}
+	encoded := accept.Encode()
+	return [][]byte{{}, encoded[:protocol.ConnectAcceptSize-1], encoded, append(encoded, 0x00)}
+}
+
+// voiceSeeds are voice frames of every codec, an empty frame and a header cut short
+func voiceSeeds() [][]byte {
+	opus := &protocol.Voice{SSRC: 0x1A2B3C4D, Sequence: 0xFFFF, Timestamp: 0xFFFFFC40, Codec: protocol.CodecOpus, Frame: []byte{0xFC, 0xFF, 0xFE}}
+	l16 := &protocol.Voice{Sequence: 1, Timestamp: 960, Codec: protocol.CodecL16, Frame: make([]byte, 1920)}
+	empty := &protocol.Voice{Codec: 0xFF}
+	encoded := opus.Encode()
+	return [][]byte{{}, encoded[:protocol.VoiceHeaderSize-1], encoded, l16.Encode(), empty.Encode()}
+}
+
+func floorSeeds() [][]byte {
+	deny := &protocol.Floor{SSRC: 7, Reason: protocol.FloorReasonQueued, Position: 2}
+	grant := &protocol.Floor{SSRC: 7, MaxTalkMs: 30000}
+	encoded := deny.Encode()
+	return [][]byte{{}, encoded[:protocol.FloorSize-1], encoded, grant.Encode(), append(encoded, 0x00), bytes.Repeat([]byte{0xFF}, protocol.FloorSize)}
+}
+
+// keyMessageSeeds are key messages to one member and to all, and the leave notice of the Server
+func keyMessageSeeds() [][]byte {
+	direct := &protocol.KeyMessage{To: 7, From: 9, Body: []byte{0x02, 0x5A, 0x5A}}
+	broadcast := &protocol.KeyMessage{From: 9, Body: []byte{0x01}}
+	leave := &protocol.KeyMessage{From: 9}
+	encoded := direct.Encode()
+	return [][]byte{{}, encoded[:protocol.KeyMessageHeaderSize-1], encoded, broadcast.Encode(), leave.Encode()}
+}
@@ -0,0 +1,290 @@
+package protocol_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aura-speak/networking/pkg/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// The fuzz tests check that no input makes a decoder panic
+// and that everything a decoder accepts encodes back to the same value
+// The corpus in testdata/fuzz/<name of the fuzz test> is added by the testing package
+//
+// Example:
+//
+//	go test ./pkg/protocol -run '^$' -fuzz '^FuzzVoice$' -fuzztime 30s
+
+// fuzzTarget seeds the fuzz test and runs every check on every input
+// A check returns an error if an input breaks an invariant, a panic is a failure too
+func fuzzTarget(f *testing.F, seeds [][]byte, checks ...func(data []byte) error) {
+	// Decoders log on debug level, that would only slow down the fuzzing
+	log.SetLevel(log.WarnLevel)
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var errs []error
+		for _, check := range checks {
+			errs = append(errs, check(data))
+		}
+		if err := errors.Join(errs...); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func FuzzDecode(f *testing.F) {
+	fuzzTarget(f, packetSeeds(), fuzzPacket, fuzzHeader, fuzzPayload)
+}
+
+func FuzzConnect(f *testing.F) {
+	fuzzTarget(f, connectSeeds(), fuzzConnectRequest, fuzzHelloVerify, fuzzConnectReject)
+}
+
+func FuzzConnectAccept(f *testing.F) {
+	fuzzTarget(f, connectAcceptSeeds(), fuzzConnectAccept)
+}
+
+func FuzzReports(f *testing.F) {
+	fuzzTarget(f, reportSeeds(), fuzzSenderReport, fuzzReceiverReport)
+}
+
+func FuzzVoice(f *testing.F) {
+	fuzzTarget(f, voiceSeeds(), fuzzVoice)
+}
+
+func FuzzFloor(f *testing.F) {
+	fuzzTarget(f, floorSeeds(), fuzzFloor)
+}
+
+func FuzzKeyMessage(f *testing.F) {
+	fuzzTarget(f, keyMessageSeeds(), fuzzKeyMessage)
+}
+
+// fuzzPacket checks that a decoded packet encodes to the same bytes
+func fuzzPacket(data []byte) error {
+	packet, err := protocol.Decode(data)
+	if err != nil {
+		if packet != nil {
+			return fmt.Errorf("decode returned a packet with error %v", err)
+		}
+		return nil
+	}
+	if packet == nil {
+		return fmt.Errorf("decode returned no packet and no error")
+	}
+	if len(data) > protocol.MaxPacketSize {
+		return fmt.Errorf("decode accepted %d bytes, the maximum is %d", len(data), protocol.MaxPacketSize)
+	}
+	if !protocol.IsValidPacketType(packet.PacketHeader.PacketType) {
+		return fmt.Errorf("decode accepted invalid packet type 0x%02x", uint8(packet.PacketHeader.PacketType))
+	}
+	if encoded := packet.Encode(); !bytes.Equal(encoded, data) {
+		return fmt.Errorf("packet encodes to %x, decoded from %x", encoded, data)
+	}
+	return nil
+}
+
+// fuzzHeader checks that a decoded header encodes to the first byte
+func fuzzHeader(data []byte) error {
+	header, err := protocol.DecodeHeader(data)
+	if err != nil {
+		return nil
+	}
+	if encoded := protocol.EncodeHeader(header); !bytes.Equal(encoded, data[:protocol.HeaderSize]) {
+		return fmt.Errorf("header encodes to %x, decoded from %x", encoded, data[:protocol.HeaderSize])
+	}
+	return nil
+}
+
+// fuzzPayload decodes a packet and its payload with the decoder of its type, like the Server and the Client do
+func fuzzPayload(data []byte) error {
+	packet, err := protocol.Decode(data)
+	if err != nil {
+		return nil
+	}
+	payload := packet.Payload
+	switch packet.PacketHeader.PacketType {
+	case protocol.PacketTypeConnect:
+		return fuzzConnectRequest(payload)
+	case protocol.PacketTypeConnectAccept:
+		return fuzzConnectAccept(payload)
+	case protocol.PacketTypeHelloVerify:
+		return fuzzHelloVerify(payload)
+	case protocol.PacketTypeConnectReject:
+		return fuzzConnectReject(payload)
+	case protocol.PacketTypeError:
+		return fuzzErrorReply(payload)
+	case protocol.PacketTypeSenderReport:
+		return fuzzSenderReport(payload)
+	case protocol.PacketTypeReceiverReport:
+		return fuzzReceiverReport(payload)
+	case protocol.PacketTypeVoice:
+		return fuzzVoice(payload)
+	case protocol.PacketTypeFloorGrant, protocol.PacketTypeFloorDeny, protocol.PacketTypeFloorRelease, protocol.PacketTypeFloorRevoke:
+		return fuzzFloor(payload)
+	case protocol.PacketTypeKeyMessage:
+		return fuzzKeyMessage(payload)
+	}
+	return nil
+}
+
+// fuzzConnectRequest checks that a decoded connect request survives another encode and decode
+// The encoding is padded, so only the fields are compared
+func fuzzConnectRequest(data []byte) error {
+	request, err := protocol.DecodeConnectRequest(data)
+	if err != nil {
+		return nil
+	}
+	encoded := request.Encode()
+	if len(encoded) < protocol.MinConnectSize-protocol.HeaderSize {
+		return fmt.Errorf("connect request encodes to %d bytes, less than the padding", len(encoded))
+	}
+	again, err := protocol.DecodeConnectRequest(encoded)
+	if err != nil {
+		return fmt.Errorf("encoded connect request does not decode: %v", err)
+	}
+	if !bytes.Equal(again.Cookie, request.Cookie) || !bytes.Equal(again.Credential, request.Credential) {
+		return fmt.Errorf("connect request changed from %+v to %+v", request, again)
+	}
+	return nil
+}
+
+// fuzzConnectAccept checks that a decoded connect accept encodes to the SSRC it was decoded from
+// An empty payload is the accept of an older Server without SSRC
+func fuzzConnectAccept(data []byte) error {
+	accept, err := protocol.DecodeConnectAccept(data)
+	if err != nil {
+		return nil
+	}
+	if len(data) == 0 {
+		if accept.SSRC != 0 {
+			return fmt.Errorf("empty connect accept decodes to ssrc %d", accept.SSRC)
+		}
+		return nil
+	}
+	if encoded := accept.Encode(); !bytes.Equal(encoded, data[:protocol.ConnectAcceptSize]) {
+		return fmt.Errorf("connect accept encodes to %x, decoded from %x", encoded, data[:protocol.ConnectAcceptSize])
+	}
+	return nil
+}
+
+func fuzzHelloVerify(data []byte) error {
+	verify, err := protocol.DecodeHelloVerify(data)
+	if err != nil {
+		return nil
+	}
+	if encoded := verify.Encode(); !bytes.Equal(encoded, data) {
+		return fmt.Errorf("hello verify encodes to %x, decoded from %x", encoded, data)
+	}
+	return nil
+}
+
+func fuzzConnectReject(data []byte) error {
+	reject, err := protocol.DecodeConnectReject(data)
+	if err != nil {
+		return nil
+	}
+	if encoded := reject.Encode(); !bytes.Equal(encoded, data[:1]) {
+		return fmt.Errorf("connect reject encodes to %x, decoded from %x", encoded, data[:1])
+	}
+	_ = reject.Reason.String()
+	return nil
+}
+
+func fuzzErrorReply(data []byte) error {
+	reply, err := protocol.DecodeErrorReply(data)
+	if err != nil {
+		return nil
+	}
+	if encoded := reply.Encode(); !bytes.Equal(encoded, data) {
+		return fmt.Errorf("error reply encodes to %x, decoded from %x", encoded, data)
+	}
+	_ = reply.Error()
+	return nil
+}
+
+func fuzzSenderReport(data []byte) error {
+	report, err := protocol.DecodeSenderReport(data)
+	if err != nil {
+		return nil
+	}
+	if encoded := report.Encode(); !bytes.Equal(encoded, data[:protocol.SenderReportSize]) {
+		return fmt.Errorf("sender report encodes to %x, decoded from %x", encoded, data[:protocol.SenderReportSize])
+	}
+	return nil
+}
+
+func fuzzReceiverReport(data []byte) error {
+	report, err := protocol.DecodeReceiverReport(data)
+	if err != nil {
+		return nil
+	}
+	if encoded := report.Encode(); !bytes.Equal(encoded, data[:protocol.ReceiverReportSize]) {
+		return fmt.Errorf("receiver report encodes to %x, decoded from %x", encoded, data[:protocol.ReceiverReportSize])
+	}
+	return nil
+}
+
+// fuzzVoice checks that a decoded voice frame encodes to the same bytes
+// and that the Server can stamp its SSRC into every payload the decoder accepts
+func fuzzVoice(data []byte) error {
+	voice, err := protocol.DecodeVoice(data)
+	if err != nil {
+		if protocol.SetVoiceSSRC(bytes.Clone(data), 1) {
+			return fmt.Errorf("ssrc set in voice frame that does not decode: %v", err)
+		}
+		return nil
+	}
+	if encoded := voice.Encode(); !bytes.Equal(encoded, data) {
+		return fmt.Errorf("voice frame encodes to %x, decoded from %x", encoded, data)
+	}
+	_ = voice.Codec.String()
+	stamped := bytes.Clone(data)
+	if !protocol.SetVoiceSSRC(stamped, voice.SSRC+1) {
+		return fmt.Errorf("ssrc not set in voice frame %x", data)
+	}
+	if again, err := protocol.DecodeVoice(stamped); err != nil || again.SSRC != voice.SSRC+1 || !bytes.Equal(again.Frame, voice.Frame) {
+		return fmt.Errorf("stamped voice frame decodes to %+v, %v", again, err)
+	}
+	return nil
+}
+
+func fuzzFloor(data []byte) error {
+	floor, err := protocol.DecodeFloor(data)
+	if err != nil {
+		return nil
+	}
+	if encoded := floor.Encode(); !bytes.Equal(encoded, data[:protocol.FloorSize]) {
+		return fmt.Errorf("floor encodes to %x, decoded from %x", encoded, data[:protocol.FloorSize])
+	}
+	_ = floor.Reason.String()
+	return nil
+}
+
+// fuzzKeyMessage checks that a decoded key message encodes to the same bytes
+// and that the Server can stamp the sender into every payload the decoder accepts
+func fuzzKeyMessage(data []byte) error {
+	message, err := protocol.DecodeKeyMessage(data)
+	if err != nil {
+		if protocol.SetKeyMessageFrom(bytes.Clone(data), 1) {
+			return fmt.Errorf("sender set in key message that does not decode: %v", err)
+		}
+		return nil
+	}
+	if encoded := message.Encode(); !bytes.Equal(encoded, data) {
+		return fmt.Errorf("key message encodes to %x, decoded from %x", encoded, data)
+	}
+	stamped := bytes.Clone(data)
+	if !protocol.SetKeyMessageFrom(stamped, message.From+1) {
+		return fmt.Errorf("sender not set in key message %x", data)
+	}
+	if again, err := protocol.DecodeKeyMessage(stamped); err != nil || again.From != message.From+1 || again.To != message.To || !bytes.Equal(again.Body, message.Body) {
+		return fmt.Errorf("stamped key message decodes to %+v, %v", again, err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// RejectReason tells the client why its connect was rejected
+type RejectReason uint8
+
+const (
+	RejectReasonUnknown           RejectReason = 0x00 // Unspecified error
+	RejectReasonMalformed         RejectReason = 0x01 // Connect packet or credential could not be parsed
+	RejectReasonMissingCredential RejectReason = 0x02 // Server requires a credential
+	RejectReasonInvalidCredential RejectReason = 0x03 // Credential signature is invalid
+	RejectReasonExpired           RejectReason = 0x04 // Credential is expired
+	RejectReasonUnknownUser       RejectReason = 0x05 // User of the credential is unknown
+	RejectReasonUserDisabled      RejectReason = 0x06 // User of the credential is disabled
+	RejectReasonBanned            RejectReason = 0x07 // User or address is banned
+)
+
+var rejectReasonStrings = map[RejectReason]string{
+	RejectReasonUnknown:           "Unknown",
+	RejectReasonMalformed:         "Malformed",
+	RejectReasonMissingCredential: "MissingCredential",
+	RejectReasonInvalidCredential: "InvalidCredential",
+	RejectReasonExpired:           "Expired",
+	RejectReasonUnknownUser:       "UnknownUser",
+	RejectReasonUserDisabled:      "UserDisabled",
+	RejectReasonBanned:            "Banned",
+}
+
+// String returns the name of the reject reason
+func (r RejectReason) String() string {
+	if s, ok := rejectReasonStrings[r]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown(0x%02X)", uint8(r))
+}
+
+// CookieSize is the size of the cookie of a HelloVerify in bytes
+const CookieSize = 16
+
+// MinConnectSize is the minimum size of an encoded connect packet in bytes
+// Clients pad their connect packets, so the HelloVerify answer is never larger than the request
+const MinConnectSize = 32
+
+// ConnectRequest is the payload of a PacketTypeConnect packet
+// It contains the cookie of the last HelloVerify, empty on the first attempt
+// And the credential of the client, e.g. a signed token
+// The cookie is length prefixed with an uint8, the credential with an uint16
+// Trailing bytes are padding and ignored
+type ConnectRequest struct {
+	Cookie     []byte
+	Credential []byte
+}
+
+// Encode encodes the connect request into a byte slice
+// The result is padded so the encoded packet is at least MinConnectSize bytes long
+// Example:
+//
+//	request := &ConnectRequest{Credential: []byte(token)}
+//	packet := &Packet{
+//		PacketHeader: Header{PacketType: PacketTypeConnect},
+//		Payload:      request.Encode(),
+//	}
+func (r *ConnectRequest) Encode() []byte {
+	size := 1 + len(r.Cookie) + 2 + len(r.Credential)
+	buf := make([]byte, max(size, MinConnectSize-HeaderSize))
+	buf[0] = uint8(len(r.Cookie))
+	copy(buf[1:], r.Cookie)
+	offset := 1 + len(r.Cookie)
+	binary.BigEndian.PutUint16(buf[offset:offset+2], uint16(len(r.Credential)))
+	copy(buf[offset+2:], r.Credential)
+	return buf
+}
+
+// DecodeConnectRequest decodes a connect request from a packet payload
+// It returns an error if the payload is shorter than the announced cookie or credential
+// The cookie and the credential point into data
+func DecodeConnectRequest(data []byte) (ConnectRequest, error) {
+	if len(data) < 1 {
+		return ConnectRequest{}, malformedError("connect request too short")
+	}
+	cookieLen := int(data[0])
+	if len(data) < 1+cookieLen+2 {
+		return ConnectRequest{}, malformedError("connect request cookie truncated")
+	}
+	cookie := data[1 : 1+cookieLen]
+	offset := 1 + cookieLen
+	credLen := int(binary.BigEndian.Uint16(data[offset : offset+2]))
+	if len(data) < offset+2+credLen {
+		return ConnectRequest{}, malformedError("connect request credential truncated")
+	}
+	return ConnectRequest{
+		Cookie:     cookie,
+		Credential: data[offset+2 : offset+2+credLen],
+	}, nil
+}
+
+// HelloVerify is the payload of a PacketTypeHelloVerify packet
+// The client has to repeat its connect with the cookie to prove it owns its address
+type HelloVerify struct {
+	Cookie []byte
+}
+
+// Encode encodes the hello verify into a byte slice
+func (h *HelloVerify) Encode() []byte {
+	buf := make([]byte, len(h.Cookie))
+	copy(buf, h.Cookie)
+	return buf
+}
+
+// DecodeHelloVerify decodes a hello verify from a packet payload
+// The cookie points into data
+func DecodeHelloVerify(data []byte) (HelloVerify, error) {
+	if len(data) != CookieSize {
+		return HelloVerify{}, malformedError("hello verify has invalid cookie size")
+	}
+	return HelloVerify{Cookie: data}, nil
+}
+
+// ConnectAcceptSize is the size of an encoded ConnectAccept payload in bytes
+const ConnectAcceptSize = 4
+
+// ConnectAccept is the payload of a PacketTypeConnectAccept packet
+// SSRC is the source the Server stamps into the voice frames of the session
+// Servers before the voice transport sent no payload, the SSRC is zero then
+type ConnectAccept struct {
+	SSRC uint32
+}
+
+// Encode encodes the connect accept into a byte slice
+func (a *ConnectAccept) Encode() []byte {
+	return binary.BigEndian.AppendUint32(make([]byte, 0, ConnectAcceptSize), a.SSRC)
+}
+
+// DecodeConnectAccept decodes a connect accept from a packet payload
+// An empty payload is a connect accept without SSRC
+func DecodeConnectAccept(data []byte) (ConnectAccept, error) {
+	if len(data) == 0 {
+		return ConnectAccept{}, nil
+	}
+	if len(data) < ConnectAcceptSize {
+		return ConnectAccept{}, malformedError("connect accept too short")
+	}
+	return ConnectAccept{SSRC: binary.BigEndian.Uint32(data)}, nil
+}
+
+// ConnectReject is the payload of a PacketTypeConnectReject packet
+type ConnectReject struct {
+	Reason RejectReason
+}
+
+// Encode encodes the connect reject into a byte slice
+func (r *ConnectReject) Encode() []byte {
+	return []byte{byte(r.Reason)}
+}
+
+// DecodeConnectReject decodes a connect reject from a packet payload
+func DecodeConnectReject(data []byte) (ConnectReject, error) {
+	if len(data) < 1 {
+		return ConnectReject{}, malformedError("connect reject too short")
+	}
+	return ConnectReject{Reason: RejectReason(data[0])}, nil
+}
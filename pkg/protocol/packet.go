@@ -2,7 +2,6 @@ package protocol
 
 import (
 	"bytes"
-	"errors"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -11,6 +10,16 @@ import (
 // It is the size of the packet type
 const HeaderSize = 1
 
+// MaxPacketSize is the size of the largest encoded packet in bytes
+// Decode rejects larger packets, the Server and the Client read datagrams into buffers of BufferSize
+const MaxPacketSize = 1024
+
+var (
+	errTooShort          error = malformedError("data too short")
+	errTooLong           error = malformedError("data too long")
+	errInvalidPacketType error = malformedError("invalid packet type")
+)
+
 // Header is the header of the packet
 // It contains the packet type
 type Header struct {
@@ -34,13 +43,24 @@ type Packet struct {
 //	encoded := packet.Encode()
 //	fmt.Println(encoded)
 func (p *Packet) Encode() []byte {
-	buf := bytes.NewBuffer(make([]byte, 0, len(p.Payload)+HeaderSize))
-	buf.Write(EncodeHeader(p.PacketHeader))
-	buf.Write(p.Payload)
-	return buf.Bytes()
+	return p.AppendEncode(make([]byte, 0, len(p.Payload)+HeaderSize))
+}
+
+// AppendEncode appends the encoded packet to dst and returns the extended slice
+// With a pooled buffer as dst the packet is encoded without an allocation
+// Example:
+//
+//	buf := protocol.GetBuffer()
+//	defer protocol.PutBuffer(buf)
+//	data := packet.AppendEncode((*buf)[:0])
+func (p *Packet) AppendEncode(dst []byte) []byte {
+	dst = append(dst, byte(p.PacketHeader.PacketType))
+	return append(dst, p.Payload...)
 }
 
 // Decode decodes the packet from a byte slice
+// The payload points into data, so data must not be reused while the packet is in use
+// It returns an error and no packet for data that is empty, too large or has an invalid packet type
 // Example:
 //
 //	packet, err := Decode(Header{PacketType: PacketTypeDebugHello}, []byte("Hello, Server!"))
@@ -49,18 +69,35 @@ func (p *Packet) Encode() []byte {
 //	}
 //	fmt.Println(packet.Payload)
 func Decode(data []byte) (*Packet, error) {
+	packet := &Packet{}
+	if err := DecodeInto(packet, data); err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
+
+// DecodeInto decodes the packet from a byte slice into an existing packet
+// It is Decode without an allocation, the payload points into data as well
+// Example:
+//
+//	var packet Packet
+//	if err := DecodeInto(&packet, data); err != nil {
+//		fmt.Println("Error decoding packet:", err)
+//	}
+func DecodeInto(packet *Packet, data []byte) error {
 	if len(data) < HeaderSize {
-		return nil, errors.New("data too short")
+		return errTooShort
+	}
+	if len(data) > MaxPacketSize {
+		return errTooLong
 	}
 	packetHeader, err := DecodeHeader(data[:HeaderSize])
 	if err != nil {
-		return nil, err
+		return err
 	}
-	payload := data[HeaderSize:]
-	return &Packet{
-		PacketHeader: packetHeader,
-		Payload:      payload,
-	}, nil
+	packet.PacketHeader = packetHeader
+	packet.Payload = data[HeaderSize:]
+	return nil
 }
 
 // DecodeHeader decodes the header from a byte slice
@@ -73,13 +110,16 @@ func Decode(data []byte) (*Packet, error) {
 //	fmt.Println(header.PacketType)
 func DecodeHeader(data []byte) (Header, error) {
 	if len(data) < HeaderSize {
-		return Header{}, errors.New("data too short")
+		return Header{}, errTooShort
 	}
 	packetType := PacketType(data[0])
 	if !IsValidPacketType(packetType) {
-		return Header{}, errors.New("invalid packet type")
+		return Header{}, errInvalidPacketType
+	}
+	// the arguments of a disabled log call still allocate
+	if log.IsLevelEnabled(log.DebugLevel) {
+		log.WithField("caller", "protocol").Debugf("Decoded header: %s", PacketTypeMapType[packetType])
 	}
-	log.WithField("caller", "protocol").Infof("Decoded header: %s", PacketTypeMapType[packetType])
 	return Header{PacketType: packetType}, nil
 }
 
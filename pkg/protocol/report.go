@@ -0,0 +1,110 @@
+package protocol
+
+import (
+	"encoding/binary"
+)
+
+// SenderReportSize is the size of an encoded SenderReport payload in bytes
+const SenderReportSize = 16
+
+// ReceiverReportSize is the size of an encoded ReceiverReport payload in bytes
+const ReceiverReportSize = 25
+
+// SenderReport is the payload of a PacketTypeSenderReport packet
+// It tells the receiver what the sender has sent so far
+// The NTPTimestamp is the wall clock time of the sender in NTP format (32.32 fixed point)
+// PacketCount and OctetCount count all packets sent to the receiver except the handshake and the reports
+type SenderReport struct {
+	NTPTimestamp uint64
+	PacketCount  uint32
+	OctetCount   uint32
+}
+
+// ReceiverReport is the payload of a PacketTypeReceiverReport packet
+// It tells a sender what the receiver actually got from it
+// SenderPacketCount is the packet count of the last sender report that was accounted for
+// Only the media packets carry a sequence number, so the loss is counted against the packet count of the sender reports
+// HighestSequence is the extended highest sequence number of the media received from the sender (RFC 3550 A.1)
+// The upper 16 bits count the wraps of the 16 bit sequence number, a sender relaying several sources reports the source heard last
+// CumulativeLost is the number of packets lost since the start of the session
+// It may be negative if packets were duplicated
+// FractionLost is the fraction of packets lost since the last report as a fixed point number (lost*256/expected)
+// Jitter is the interarrival jitter of the media packets in microseconds (RFC 3550 A.8)
+// It is estimated per source from every received media packet, the report carries the largest one
+// LastSR is the middle 32 bits of the NTP timestamp of the last sender report received
+// DelaySinceLastSR is the delay between receiving the last sender report and sending this report in 1/65536 seconds
+type ReceiverReport struct {
+	SenderPacketCount uint32
+	HighestSequence   uint32
+	CumulativeLost    int32
+	FractionLost      uint8
+	Jitter            uint32
+	LastSR            uint32
+	DelaySinceLastSR  uint32
+}
+
+// Encode encodes the sender report into a byte slice
+// Example:
+//
+//	report := &SenderReport{NTPTimestamp: ntp, PacketCount: 10, OctetCount: 1200}
+//	packet := &Packet{
+//		PacketHeader: Header{PacketType: PacketTypeSenderReport},
+//		Payload:      report.Encode(),
+//	}
+func (r *SenderReport) Encode() []byte {
+	buf := make([]byte, SenderReportSize)
+	binary.BigEndian.PutUint64(buf[0:8], r.NTPTimestamp)
+	binary.BigEndian.PutUint32(buf[8:12], r.PacketCount)
+	binary.BigEndian.PutUint32(buf[12:16], r.OctetCount)
+	return buf
+}
+
+// DecodeSenderReport decodes a sender report from a packet payload
+// It returns an error if the payload is too short
+func DecodeSenderReport(data []byte) (SenderReport, error) {
+	if len(data) < SenderReportSize {
+		return SenderReport{}, malformedError("sender report too short")
+	}
+	return SenderReport{
+		NTPTimestamp: binary.BigEndian.Uint64(data[0:8]),
+		PacketCount:  binary.BigEndian.Uint32(data[8:12]),
+		OctetCount:   binary.BigEndian.Uint32(data[12:16]),
+	}, nil
+}
+
+// Encode encodes the receiver report into a byte slice
+// Example:
+//
+//	report := &ReceiverReport{SenderPacketCount: 10, HighestSequence: 0x1FFFF, FractionLost: 0}
+//	packet := &Packet{
+//		PacketHeader: Header{PacketType: PacketTypeReceiverReport},
+//		Payload:      report.Encode(),
+//	}
+func (r *ReceiverReport) Encode() []byte {
+	buf := make([]byte, ReceiverReportSize)
+	binary.BigEndian.PutUint32(buf[0:4], r.SenderPacketCount)
+	binary.BigEndian.PutUint32(buf[4:8], r.HighestSequence)
+	binary.BigEndian.PutUint32(buf[8:12], uint32(r.CumulativeLost))
+	buf[12] = r.FractionLost
+	binary.BigEndian.PutUint32(buf[13:17], r.Jitter)
+	binary.BigEndian.PutUint32(buf[17:21], r.LastSR)
+	binary.BigEndian.PutUint32(buf[21:25], r.DelaySinceLastSR)
+	return buf
+}
+
+// DecodeReceiverReport decodes a receiver report from a packet payload
+// It returns an error if the payload is too short
+func DecodeReceiverReport(data []byte) (ReceiverReport, error) {
+	if len(data) < ReceiverReportSize {
+		return ReceiverReport{}, malformedError("receiver report too short")
+	}
+	return ReceiverReport{
+		SenderPacketCount: binary.BigEndian.Uint32(data[0:4]),
+		HighestSequence:   binary.BigEndian.Uint32(data[4:8]),
+		CumulativeLost:    int32(binary.BigEndian.Uint32(data[8:12])),
+		FractionLost:      data[12],
+		Jitter:            binary.BigEndian.Uint32(data[13:17]),
+		LastSR:            binary.BigEndian.Uint32(data[17:21]),
+		DelaySinceLastSR:  binary.BigEndian.Uint32(data[21:25]),
+	}, nil
+}
@@ -0,0 +1,63 @@
+package protocol
+
+import "testing"
+
+func TestSenderReportRoundTrip(t *testing.T) {
+	want := SenderReport{NTPTimestamp: 0xEA1B2C3D_80000000, PacketCount: 250, OctetCount: 40000}
+	data := want.Encode()
+	if len(data) != SenderReportSize {
+		t.Fatalf("encoded size = %d, want %d", len(data), SenderReportSize)
+	}
+	got, err := DecodeSenderReport(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("decoded %+v, want %+v", got, want)
+	}
+}
+
+func TestReceiverReportRoundTrip(t *testing.T) {
+	tests := []ReceiverReport{
+		{},
+		{SenderPacketCount: 250, HighestSequence: 0x1002A, CumulativeLost: 3, FractionLost: 2, Jitter: 1500, LastSR: 0x2C3D8000, DelaySinceLastSR: 0x8000},
+		// duplicated packets make the loss negative
+		{SenderPacketCount: 10, CumulativeLost: -2},
+		{SenderPacketCount: ^uint32(0), HighestSequence: ^uint32(0), CumulativeLost: -1 << 31, FractionLost: 255, Jitter: ^uint32(0), LastSR: ^uint32(0), DelaySinceLastSR: ^uint32(0)},
+	}
+	for _, want := range tests {
+		data := want.Encode()
+		if len(data) != ReceiverReportSize {
+			t.Fatalf("encoded size = %d, want %d", len(data), ReceiverReportSize)
+		}
+		got, err := DecodeReceiverReport(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("decoded %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestReportsTooShort(t *testing.T) {
+	sr := (&SenderReport{PacketCount: 1}).Encode()
+	if _, err := DecodeSenderReport(sr[:SenderReportSize-1]); err == nil {
+		t.Error("truncated sender report decoded")
+	}
+	rr := (&ReceiverReport{SenderPacketCount: 1}).Encode()
+	if _, err := DecodeReceiverReport(rr[:ReceiverReportSize-1]); err == nil {
+		t.Error("truncated receiver report decoded")
+	}
+}
+
+func TestReportsIgnoreTrailingBytes(t *testing.T) {
+	want := ReceiverReport{SenderPacketCount: 7, Jitter: 20}
+	got, err := DecodeReceiverReport(append(want.Encode(), 0xFF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("decoded %+v, want %+v", got, want)
+	}
+}
@@ -12,6 +12,40 @@ const (
 	PacketTypeNone                  PacketType = 0x00
 	PacketTypeClientNeedsDisconnect PacketType = 0x01 // Client needs to disconnect
 
+	// Handshake Packets
+	PacketTypeConnect       PacketType = 0x02 // Client: connect with credential
+	PacketTypeConnectAccept PacketType = 0x03 // Server: connect accepted
+	PacketTypeConnectReject PacketType = 0x04 // Server: connect rejected with reason
+	PacketTypeHelloVerify   PacketType = 0x05 // Server: cookie challenge before the connect is processed
+
+	// Control Packets
+	PacketTypeError PacketType = 0x0F // Server: packet refused with error code
+
+	// Report Packets
+	PacketTypeSenderReport   PacketType = 0x10 // Sender statistics with NTP timestamp
+	PacketTypeReceiverReport PacketType = 0x11 // Receiver feedback about a sender
+
+	// Media Packets
+	PacketTypeVoice PacketType = 0x20 // Voice frame with routing header, see Voice
+
+	// Channel Packets
+	PacketTypeChannelJoin  PacketType = 0x30 // Client: join the channel of the payload; Server: joined it
+	PacketTypeChannelLeave PacketType = 0x31 // Client: leave the channel; Server: left it
+
+	// Floor Control Packets
+	PacketTypeFloorRequest PacketType = 0x38 // Client: ask for the floor of its channel
+	PacketTypeFloorGrant   PacketType = 0x39 // Server: the SSRC holds the floor
+	PacketTypeFloorDeny    PacketType = 0x3A // Server: the request is queued or refused
+	PacketTypeFloorRelease PacketType = 0x3B // Client: give the floor back; Server: the floor is free
+	PacketTypeFloorRevoke  PacketType = 0x3C // Server: the SSRC lost the floor
+
+	// Recording Packets
+	PacketTypeRecordStart PacketType = 0x40 // Client: record the channel of the payload; Server: recording it
+	PacketTypeRecordStop  PacketType = 0x41 // Client: stop recording the channel of the payload; Server: stopped
+
+	// End-to-End Encryption Packets
+	PacketTypeKeyMessage PacketType = 0x48 // Client: key message for members of its channel; Server: key message of a member, see KeyMessage
+
 	// Debug Packets
 	PacketTypeDebugHello PacketType = 0x90 // Debug: Hello
 	PacketTypeDebugAny   PacketType = 0x91 // Debug: Any
@@ -21,6 +55,24 @@ var (
 	PacketTypeMap = []PacketTypeMapping{
 		{PacketType: PacketTypeNone, String: "None"},
 		{PacketType: PacketTypeClientNeedsDisconnect, String: "ClientNeedsDisconnect"},
+		{PacketType: PacketTypeConnect, String: "Connect"},
+		{PacketType: PacketTypeConnectAccept, String: "ConnectAccept"},
+		{PacketType: PacketTypeConnectReject, String: "ConnectReject"},
+		{PacketType: PacketTypeHelloVerify, String: "HelloVerify"},
+		{PacketType: PacketTypeError, String: "Error"},
+		{PacketType: PacketTypeSenderReport, String: "SenderReport"},
+		{PacketType: PacketTypeReceiverReport, String: "ReceiverReport"},
+		{PacketType: PacketTypeVoice, String: "Voice"},
+		{PacketType: PacketTypeChannelJoin, String: "ChannelJoin"},
+		{PacketType: PacketTypeChannelLeave, String: "ChannelLeave"},
+		{PacketType: PacketTypeFloorRequest, String: "FloorRequest"},
+		{PacketType: PacketTypeFloorGrant, String: "FloorGrant"},
+		{PacketType: PacketTypeFloorDeny, String: "FloorDeny"},
+		{PacketType: PacketTypeFloorRelease, String: "FloorRelease"},
+		{PacketType: PacketTypeFloorRevoke, String: "FloorRevoke"},
+		{PacketType: PacketTypeRecordStart, String: "RecordStart"},
+		{PacketType: PacketTypeRecordStop, String: "RecordStop"},
+		{PacketType: PacketTypeKeyMessage, String: "KeyMessage"},
 		{PacketType: PacketTypeDebugHello, String: "DebugHello"},
 		{PacketType: PacketTypeDebugAny, String: "DebugAny"},
 	}
@@ -34,8 +86,41 @@ var (
 	}()
 )
 
+// ParsePacketType looks up a packet type by its name, e.g. "DebugAny"
+// It returns false if the name is unknown
+func ParsePacketType(name string) (PacketType, bool) {
+	for _, mapping := range PacketTypeMap {
+		if mapping.String == name {
+			return mapping.PacketType, true
+		}
+	}
+	return PacketTypeNone, false
+}
+
 // IsValidPacketType checks if the packet type is valid
 // It returns true if the packet type is valid, false otherwise
 func IsValidPacketType(packetType PacketType) bool {
 	return packetType != PacketTypeNone
 }
+
+// IsReportPacket checks if the packet type is a sender or receiver report
+// Report packets are not counted in the packet statistics they describe
+func IsReportPacket(packetType PacketType) bool {
+	return packetType == PacketTypeSenderReport || packetType == PacketTypeReceiverReport
+}
+
+// IsHandshakePacket checks if the packet type belongs to the connect handshake
+// The handshake happens before the session exists, so it is not counted in the packet statistics either
+func IsHandshakePacket(packetType PacketType) bool {
+	switch packetType {
+	case PacketTypeConnect, PacketTypeConnectAccept, PacketTypeConnectReject, PacketTypeHelloVerify:
+		return true
+	}
+	return false
+}
+
+// IsMediaPacket checks if the packet type carries media
+// The receiver estimates the jitter of media packets
+func IsMediaPacket(packetType PacketType) bool {
+	return packetType == PacketTypeVoice
+}
@@ -0,0 +1,108 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Codec identifies the encoding of a voice frame
+type Codec uint8
+
+const (
+	CodecNone Codec = 0x00 // No codec, the frame is dropped
+	CodecL16  Codec = 0x01 // Linear PCM, 16 bit signed big endian samples, 48kHz mono (RFC 3551 L16)
+	CodecOpus Codec = 0x02 // Opus, the RTP clock runs at 48kHz for every mode (RFC 7587)
+	CodecE2EE Codec = 0x03 // End-to-end encrypted frame of another codec at 48kHz, see pkg/e2ee
+)
+
+// CodecInfo describes a codec
+// ClockRate is the number of timestamp units per second
+type CodecInfo struct {
+	Name      string
+	ClockRate uint32
+}
+
+var codecInfos = map[Codec]CodecInfo{
+	CodecL16:  {Name: "L16", ClockRate: 48000},
+	CodecOpus: {Name: "opus", ClockRate: 48000},
+	CodecE2EE: {Name: "e2ee", ClockRate: 48000},
+}
+
+// Info returns the description of the codec
+// It returns false for unknown codecs
+func (c Codec) Info() (CodecInfo, bool) {
+	info, ok := codecInfos[c]
+	return info, ok
+}
+
+// String returns the name of the codec
+func (c Codec) String() string {
+	if info, ok := codecInfos[c]; ok {
+		return info.Name
+	}
+	return fmt.Sprintf("Unknown(0x%02X)", uint8(c))
+}
+
+// VoiceHeaderSize is the size of the routing header of a Voice payload in bytes
+const VoiceHeaderSize = 11
+
+// Voice is the payload of a PacketTypeVoice packet
+// SSRC identifies the source of the stream, the Server replaces it with the SSRC of the session
+// Sequence is incremented by one per frame of the source and wraps around
+// Timestamp is the sampling instant of the first sample in units of the codec clock rate
+// Codec is the encoding of the Frame
+// The fields match the RTP header, so a Voice packet translates to RTP and back without state
+type Voice struct {
+	SSRC      uint32
+	Sequence  uint16
+	Timestamp uint32
+	Codec     Codec
+	Frame     []byte
+}
+
+// Encode encodes the voice frame into a byte slice
+// Example:
+//
+//	voice := &Voice{Sequence: seq, Timestamp: ts, Codec: CodecOpus, Frame: frame}
+//	packet := &Packet{
+//		PacketHeader: Header{PacketType: PacketTypeVoice},
+//		Payload:      voice.Encode(),
+//	}
+func (v *Voice) Encode() []byte {
+	return v.AppendEncode(make([]byte, 0, VoiceHeaderSize+len(v.Frame)))
+}
+
+// AppendEncode appends the encoded voice frame to dst and returns the extended slice
+func (v *Voice) AppendEncode(dst []byte) []byte {
+	dst = binary.BigEndian.AppendUint32(dst, v.SSRC)
+	dst = binary.BigEndian.AppendUint16(dst, v.Sequence)
+	dst = binary.BigEndian.AppendUint32(dst, v.Timestamp)
+	dst = append(dst, byte(v.Codec))
+	return append(dst, v.Frame...)
+}
+
+// DecodeVoice decodes a voice frame from a packet payload
+// The frame points into data
+// It returns an error if the payload is shorter than the header
+func DecodeVoice(data []byte) (Voice, error) {
+	if len(data) < VoiceHeaderSize {
+		return Voice{}, malformedError("voice frame too short")
+	}
+	return Voice{
+		SSRC:      binary.BigEndian.Uint32(data[0:4]),
+		Sequence:  binary.BigEndian.Uint16(data[4:6]),
+		Timestamp: binary.BigEndian.Uint32(data[6:10]),
+		Codec:     Codec(data[10]),
+		Frame:     data[VoiceHeaderSize:],
+	}, nil
+}
+
+// SetVoiceSSRC replaces the SSRC of an encoded voice payload in place
+// It returns false if the payload is too short
+func SetVoiceSSRC(data []byte, ssrc uint32) bool {
+	if len(data) < VoiceHeaderSize {
+		return false
+	}
+	binary.BigEndian.PutUint32(data[0:4], ssrc)
+	return true
+}
@@ -0,0 +1,59 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestVoiceRoundTrip(t *testing.T) {
+	tests := []Voice{
+		{SSRC: 0x1A2B3C4D, Sequence: 0xFFFF, Timestamp: 0xFFFFFC40, Codec: CodecOpus, Frame: []byte{0xFC, 0xFF, 0xFE}},
+		{Codec: CodecL16, Frame: []byte{}},
+	}
+	for _, want := range tests {
+		data := want.Encode()
+		if len(data) != VoiceHeaderSize+len(want.Frame) {
+			t.Fatalf("encoded size = %d, want %d", len(data), VoiceHeaderSize+len(want.Frame))
+		}
+		got, err := DecodeVoice(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.SSRC != want.SSRC || got.Sequence != want.Sequence || got.Timestamp != want.Timestamp || got.Codec != want.Codec || !bytes.Equal(got.Frame, want.Frame) {
+			t.Errorf("decoded %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestVoiceTooShort(t *testing.T) {
+	voice := &Voice{Codec: CodecOpus}
+	if _, err := DecodeVoice(voice.Encode()[:VoiceHeaderSize-1]); err == nil {
+		t.Fatal("truncated voice frame decoded")
+	}
+	if SetVoiceSSRC(make([]byte, VoiceHeaderSize-1), 1) {
+		t.Fatal("SSRC set in a truncated voice frame")
+	}
+}
+
+func TestSetVoiceSSRC(t *testing.T) {
+	voice := &Voice{SSRC: 1, Sequence: 7, Codec: CodecL16, Frame: []byte{1, 2}}
+	data := voice.Encode()
+	if !SetVoiceSSRC(data, 0xCAFEBABE) {
+		t.Fatal("SSRC not set")
+	}
+	got, _ := DecodeVoice(data)
+	if got.SSRC != 0xCAFEBABE || got.Sequence != 7 || !bytes.Equal(got.Frame, voice.Frame) {
+		t.Fatalf("decoded %+v", got)
+	}
+}
+
+func TestCodecInfo(t *testing.T) {
+	for _, codec := range []Codec{CodecL16, CodecOpus} {
+		if info, ok := codec.Info(); !ok || info.ClockRate == 0 {
+			t.Errorf("codec %s has no clock rate", codec)
+		}
+	}
+	if _, ok := CodecNone.Info(); ok {
+		t.Error("codec none has an info")
+	}
+}
@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// BanPolicy decides when a key that violates its limits gets banned
+// Violations within Window lead to a ban of Duration
+// Every further ban doubles the duration up to MaxDuration
+// The escalation is reset after the key behaved for MaxDuration
+// A Violations value of zero disables automatic bans
+type BanPolicy struct {
+	Violations  int           `yaml:"violations"`
+	Window      time.Duration `yaml:"window"`
+	Duration    time.Duration `yaml:"duration"`
+	MaxDuration time.Duration `yaml:"max_duration"`
+}
+
+// offender is the violation history of one key
+type offender struct {
+	violations  int
+	windowStart time.Time
+	bannedUntil time.Time
+	level       int
+	lastBan     time.Time
+}
+
+// Escalator counts violations and bans keys temporarily
+type Escalator struct {
+	mu        sync.Mutex
+	policy    BanPolicy
+	offenders map[string]*offender
+}
+
+// NewEscalator creates a new Escalator with the policy
+func NewEscalator(policy BanPolicy) *Escalator {
+	return &Escalator{
+		policy:    policy,
+		offenders: make(map[string]*offender),
+	}
+}
+
+// SetPolicy replaces the policy
+// Running bans are kept
+func (e *Escalator) SetPolicy(policy BanPolicy) {
+	e.mu.Lock()
+	e.policy = policy
+	e.mu.Unlock()
+}
+
+// Violation records a violation of the key
+// It returns true and the end of the ban if the key got banned by this violation
+func (e *Escalator) Violation(key string, now time.Time) (bool, time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.policy.Violations <= 0 {
+		return false, time.Time{}
+	}
+
+	o, ok := e.offenders[key]
+	if !ok {
+		o = &offender{windowStart: now}
+		e.offenders[key] = o
+	}
+	if now.Before(o.bannedUntil) {
+		return false, o.bannedUntil
+	}
+	if now.Sub(o.windowStart) > e.policy.Window {
+		o.violations = 0
+		o.windowStart = now
+	}
+	o.violations++
+	if o.violations < e.policy.Violations {
+		return false, time.Time{}
+	}
+
+	if !o.lastBan.IsZero() && now.Sub(o.lastBan) > e.policy.MaxDuration {
+		o.level = 0
+	}
+	duration := e.policy.Duration << o.level
+	if duration > e.policy.MaxDuration || duration <= 0 {
+		duration = e.policy.MaxDuration
+	} else {
+		o.level++
+	}
+	o.bannedUntil = now.Add(duration)
+	o.lastBan = now
+	o.violations = 0
+	return true, o.bannedUntil
+}
+
+// Banned checks if the key is currently banned
+func (e *Escalator) Banned(key string, now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	o, ok := e.offenders[key]
+	if !ok {
+		return false
+	}
+	if now.Before(o.bannedUntil) {
+		return true
+	}
+	// Forget offenders that behaved long enough
+	if now.Sub(o.lastBan) > 2*e.policy.MaxDuration && now.Sub(o.windowStart) > e.policy.Window {
+		delete(e.offenders, key)
+	}
+	return false
+}
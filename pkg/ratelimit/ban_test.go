@@ -0,0 +1,75 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/ratelimit"
+)
+
+var policy = ratelimit.BanPolicy{Violations: 3, Window: 10 * time.Second, Duration: time.Minute, MaxDuration: 4 * time.Minute}
+
+// violate records violations until the key is banned and returns the end of the ban
+func violate(t *testing.T, e *ratelimit.Escalator, key string, now time.Time) time.Time {
+	t.Helper()
+	for i := range policy.Violations {
+		banned, until := e.Violation(key, now)
+		if banned != (i == policy.Violations-1) {
+			t.Fatalf("violation %d banned %v", i+1, banned)
+		}
+		if banned {
+			return until
+		}
+	}
+	return time.Time{}
+}
+
+func TestBanAfterViolations(t *testing.T) {
+	e := ratelimit.NewEscalator(policy)
+	if until := violate(t, e, "203.0.113.7", start); !until.Equal(start.Add(time.Minute)) {
+		t.Fatalf("banned until %s, want a minute", until)
+	}
+	if !e.Banned("203.0.113.7", start.Add(59*time.Second)) || e.Banned("203.0.113.7", start.Add(time.Minute)) {
+		t.Fatal("the ban does not last a minute")
+	}
+	if e.Banned("203.0.113.8", start) {
+		t.Fatal("another key is banned")
+	}
+}
+
+func TestViolationsOutsideTheWindow(t *testing.T) {
+	e := ratelimit.NewEscalator(policy)
+	for i := range 10 {
+		if banned, _ := e.Violation("203.0.113.7", start.Add(time.Duration(i)*policy.Window)); banned {
+			t.Fatalf("banned after violation %d, one per window", i+1)
+		}
+	}
+}
+
+func TestBansEscalate(t *testing.T) {
+	e := ratelimit.NewEscalator(policy)
+	now := start
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 4 * time.Minute} {
+		until := violate(t, e, "203.0.113.7", now)
+		if got := until.Sub(now); got != want {
+			t.Fatalf("ban of %s, want %s", got, want)
+		}
+		now = until
+	}
+	// the escalation starts over after the key behaved for MaxDuration
+	now = now.Add(policy.MaxDuration + time.Second)
+	if until := violate(t, e, "203.0.113.7", now); until.Sub(now) != time.Minute {
+		t.Fatalf("ban of %s after behaving, want a minute", until.Sub(now))
+	}
+}
+
+func TestBansDisabled(t *testing.T) {
+	e := ratelimit.NewEscalator(ratelimit.BanPolicy{})
+	for range 100 {
+		if banned, _ := e.Violation("203.0.113.7", start); banned {
+			t.Fatal("banned without a policy")
+		}
+	}
+	e.SetPolicy(policy)
+	violate(t, e, "203.0.113.7", start)
+}
@@ -0,0 +1,214 @@
+// Package Ratelimit contains the rate limiting for the Server
+// It is responsible for limiting packets and bytes per key, e.g. a source IP or a session
+// The implementation is based on token buckets
+// Limits can be overridden per packet type
+// Repeated violations lead to temporary bans that grow exponentially
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+// idleTimeout is the time after which the buckets of an inactive key are removed
+const idleTimeout = time.Minute
+
+// DefaultMaxKeys is the number of keys a Limiter keeps buckets for, see SetMaxKeys
+const DefaultMaxKeys = 1 << 16
+
+// evictionSample is the number of keys of which the least recently seen is evicted from a full Limiter
+const evictionSample = 8
+
+// Limit is the rate limit for packets and bytes
+// A rate of zero disables the limit, a burst of zero defaults to one second worth of the rate
+type Limit struct {
+	PacketsPerSecond float64 `yaml:"packets_per_second"`
+	PacketBurst      float64 `yaml:"packet_burst"`
+	BytesPerSecond   float64 `yaml:"bytes_per_second"`
+	ByteBurst        float64 `yaml:"byte_burst"`
+}
+
+// Limits is the default Limit and the overrides per packet type
+// Packets of an overridden type use their own buckets, all other packets share the default buckets
+type Limits struct {
+	Default     Limit
+	PacketTypes map[protocol.PacketType]Limit
+}
+
+// bucket is a token bucket
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take refills the bucket and takes n tokens
+// It returns false if there are not enough tokens
+func (b *bucket) take(rate, burst, n float64, now time.Time) bool {
+	if rate <= 0 {
+		return true
+	}
+	if burst <= 0 {
+		burst = rate
+	}
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else {
+		b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	}
+	b.last = now
+	if b.tokens < n {
+		return false
+	}
+	b.tokens -= n
+	return true
+}
+
+// buckets is the packet and byte bucket of one limit
+type buckets struct {
+	packets bucket
+	bytes   bucket
+}
+
+func (b *buckets) allow(limit Limit, size int, now time.Time) bool {
+	if !b.packets.take(limit.PacketsPerSecond, limit.PacketBurst, 1, now) {
+		return false
+	}
+	if !b.bytes.take(limit.BytesPerSecond, limit.ByteBurst, float64(size), now) {
+		// The packet is dropped, so give its packet token back
+		b.packets.tokens++
+		return false
+	}
+	return true
+}
+
+// entry is the state of one key
+type entry struct {
+	defaults buckets
+	types    map[protocol.PacketType]*buckets
+	lastSeen time.Time
+}
+
+// Limiter limits packets and bytes per key
+// It keeps the buckets of at most maxKeys keys, a flood from spoofed sources can not grow it without bounds
+// A new key replaces the least recently seen of a few keys once it is full
+type Limiter struct {
+	mu        sync.Mutex
+	limits    Limits
+	entries   map[string]*entry
+	maxKeys   int
+	lastSweep time.Time
+}
+
+// NewLimiter creates a new Limiter with the limits
+func NewLimiter(limits Limits) *Limiter {
+	return &Limiter{
+		limits:  limits,
+		entries: make(map[string]*entry),
+		maxKeys: DefaultMaxKeys,
+	}
+}
+
+// SetMaxKeys sets the number of keys the Limiter keeps buckets for, DefaultMaxKeys if n is not positive
+// Keys over the new maximum are evicted
+func (l *Limiter) SetMaxKeys(n int) {
+	if n <= 0 {
+		n = DefaultMaxKeys
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxKeys = n
+	for len(l.entries) > n {
+		l.evict()
+	}
+}
+
+// Len returns the number of keys the Limiter keeps buckets for
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries)
+}
+
+// SetLimits replaces the limits
+// The buckets of all keys are kept
+func (l *Limiter) SetLimits(limits Limits) {
+	l.mu.Lock()
+	l.limits = limits
+	l.mu.Unlock()
+}
+
+// Allow checks if a packet of the type and size from the key is within the limits
+//
+// Example:
+//
+//	if !limiter.Allow(remoteAddr.IP.String(), packetType, n, time.Now()) {
+//		continue // drop the packet
+//	}
+func (l *Limiter) Allow(key string, packetType protocol.PacketType, size int, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= idleTimeout {
+		l.sweep(now)
+	}
+
+	e, ok := l.entries[key]
+	if !ok {
+		if len(l.entries) >= l.maxKeys {
+			l.evict()
+		}
+		e = &entry{}
+		l.entries[key] = e
+	}
+	e.lastSeen = now
+
+	if limit, ok := l.limits.PacketTypes[packetType]; ok {
+		if e.types == nil {
+			e.types = make(map[protocol.PacketType]*buckets)
+		}
+		b, ok := e.types[packetType]
+		if !ok {
+			b = &buckets{}
+			e.types[packetType] = b
+		}
+		return b.allow(limit, size, now)
+	}
+	return e.defaults.allow(l.limits.Default, size, now)
+}
+
+// Forget removes the buckets of a key
+func (l *Limiter) Forget(key string) {
+	l.mu.Lock()
+	delete(l.entries, key)
+	l.mu.Unlock()
+}
+
+// sweep removes keys that were idle for idleTimeout
+func (l *Limiter) sweep(now time.Time) {
+	for key, e := range l.entries {
+		if now.Sub(e.lastSeen) >= idleTimeout {
+			delete(l.entries, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// evict removes the least recently seen key of a sample
+// The map iteration starts at a random key, so the sample is different every time
+// Keys that are still active are seen recently and stay, e.g. the spoofed sources of a flood are evicted first
+func (l *Limiter) evict() {
+	var oldest string
+	var oldestSeen time.Time
+	n := 0
+	for key, e := range l.entries {
+		if n == 0 || e.lastSeen.Before(oldestSeen) {
+			oldest, oldestSeen = key, e.lastSeen
+		}
+		if n++; n == evictionSample {
+			break
+		}
+	}
+	delete(l.entries, oldest)
+}
@@ -0,0 +1,101 @@
+package ratelimit_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/ratelimit"
+)
+
+var start = time.Unix(1_700_000_000, 0)
+
+func TestBurstAndRefill(t *testing.T) {
+	l := ratelimit.NewLimiter(ratelimit.Limits{Default: ratelimit.Limit{PacketsPerSecond: 10, PacketBurst: 2}})
+	for i := range 2 {
+		if !l.Allow("alice", protocol.PacketTypeVoice, 100, start) {
+			t.Fatalf("packet %d of the burst dropped", i)
+		}
+	}
+	if l.Allow("alice", protocol.PacketTypeVoice, 100, start) {
+		t.Fatal("packet over the burst allowed")
+	}
+	// other keys have their own buckets
+	if !l.Allow("bob", protocol.PacketTypeVoice, 100, start) {
+		t.Fatal("packet of another key dropped")
+	}
+	if !l.Allow("alice", protocol.PacketTypeVoice, 100, start.Add(100*time.Millisecond)) {
+		t.Fatal("packet dropped after the bucket refilled")
+	}
+}
+
+func TestByteLimitKeepsPacketToken(t *testing.T) {
+	l := ratelimit.NewLimiter(ratelimit.Limits{Default: ratelimit.Limit{PacketsPerSecond: 1, PacketBurst: 1, BytesPerSecond: 100}})
+	if l.Allow("alice", protocol.PacketTypeVoice, 101, start) {
+		t.Fatal("packet over the byte burst allowed")
+	}
+	// the dropped packet did not use up the packet token
+	if !l.Allow("alice", protocol.PacketTypeVoice, 100, start) {
+		t.Fatal("packet dropped after a packet over the byte limit")
+	}
+}
+
+func TestPacketTypeOverride(t *testing.T) {
+	l := ratelimit.NewLimiter(ratelimit.Limits{
+		Default:     ratelimit.Limit{PacketsPerSecond: 1, PacketBurst: 1},
+		PacketTypes: map[protocol.PacketType]ratelimit.Limit{protocol.PacketTypeVoice: {}},
+	})
+	for range 100 {
+		if !l.Allow("alice", protocol.PacketTypeVoice, 100, start) {
+			t.Fatal("voice dropped without a voice limit")
+		}
+	}
+	if !l.Allow("alice", protocol.PacketTypeConnect, 10, start) || l.Allow("alice", protocol.PacketTypeConnect, 10, start) {
+		t.Fatal("the default limit is not applied to the other packet types")
+	}
+
+	l.SetLimits(ratelimit.Limits{})
+	if !l.Allow("alice", protocol.PacketTypeConnect, 10, start) {
+		t.Fatal("packet dropped after the limits were removed")
+	}
+}
+
+func TestIdleKeysAreRemoved(t *testing.T) {
+	l := ratelimit.NewLimiter(ratelimit.Limits{})
+	l.Allow("alice", protocol.PacketTypeVoice, 100, start)
+	l.Allow("bob", protocol.PacketTypeVoice, 100, start.Add(30*time.Second))
+	l.Allow("bob", protocol.PacketTypeVoice, 100, start.Add(time.Minute))
+	if n := l.Len(); n != 1 {
+		t.Fatalf("%d keys after alice was idle for a minute, want bob only", n)
+	}
+	l.Forget("bob")
+	if n := l.Len(); n != 0 {
+		t.Fatalf("%d keys after Forget", n)
+	}
+}
+
+func TestMaxKeys(t *testing.T) {
+	l := ratelimit.NewLimiter(ratelimit.Limits{Default: ratelimit.Limit{PacketsPerSecond: 0.001, PacketBurst: 1}})
+	l.SetMaxKeys(100)
+	now := start
+	if !l.Allow("alice", protocol.PacketTypeVoice, 100, now) {
+		t.Fatal("first packet of alice dropped")
+	}
+	// a flood from spoofed sources, alice keeps sending
+	for i := range 10_000 {
+		now = now.Add(time.Millisecond)
+		l.Allow("198.51.100."+strconv.Itoa(i), protocol.PacketTypeVoice, 100, now)
+		if i%10 == 0 && l.Allow("alice", protocol.PacketTypeVoice, 100, now) {
+			t.Fatalf("alice got a new bucket after %d spoofed sources", i)
+		}
+	}
+	if n := l.Len(); n > 100 {
+		t.Fatalf("%d keys, want at most 100", n)
+	}
+
+	l.SetMaxKeys(10)
+	if n := l.Len(); n != 10 {
+		t.Fatalf("%d keys after lowering the maximum to 10", n)
+	}
+}
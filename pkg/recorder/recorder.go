@@ -0,0 +1,348 @@
+// Package recorder contains the recording of channels and sessions to WAV files
+// It is responsible for writing the voice of every speaker into its own 16 bit mono WAV file
+// Gaps between the frames of a speaker are written as silence, so the files keep the timing of the voice
+// A gap is never longer than the pause that actually passed, so a sender can not make the files grow faster than in real time
+// The frames are written by a goroutine of the recording, Write only queues them
+// A file is rotated with the first frame after it reached the size or duration limit or after a long pause
+// A JSON sidecar describes the speakers and when each of their files starts in the recording
+package recorder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/clock"
+	"github.com/aura-speak/networking/pkg/codec"
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+// DefaultMaxGap is the longest pause written as silence, a longer pause starts a new file
+const DefaultMaxGap = 10 * time.Second
+
+// DefaultQueueSize is the number of frames that wait for the writer of a recording
+// Frames that arrive while the queue is full are dropped
+const DefaultQueueSize = 256
+
+// earlyArrival is how much longer than the pause since the last frame a gap may be
+// Frames arrive in bursts after the network held them back, their gaps are a little longer than the pause
+const earlyArrival = 200 * time.Millisecond
+
+// clockRate is the sample rate of the recordings, the rate of every codec of pkg/protocol
+const clockRate = 48000
+
+// Config are the settings of a Recorder
+// MaxSize and MaxDuration limit one file, zero does not limit it
+// MaxGap and QueueSize are DefaultMaxGap and DefaultQueueSize if zero
+type Config struct {
+	Dir         string
+	MaxSize     int64
+	MaxDuration time.Duration
+	MaxGap      time.Duration
+	QueueSize   int
+}
+
+// File is one WAV file of a speaker
+// Start is the offset of the first sample from the start of the recording
+type File struct {
+	Path    string        `json:"path"`
+	Start   time.Duration `json:"startNs"`
+	Samples int64         `json:"samples"`
+}
+
+// Speaker is a speaker of a recording with its files
+type Speaker struct {
+	Key   string `json:"key"`
+	User  string `json:"user,omitempty"`
+	SSRC  uint32 `json:"ssrc"`
+	Files []File `json:"files"`
+}
+
+// Sidecar is the JSON description of a recording
+// Dropped counts the frames that were not recorded because their codec can not be decoded or the queue was full
+type Sidecar struct {
+	Name      string    `json:"name"`
+	Started   time.Time `json:"started"`
+	Stopped   time.Time `json:"stopped,omitzero"`
+	ClockRate int       `json:"clockRate"`
+	Speakers  []Speaker `json:"speakers"`
+	Dropped   int       `json:"dropped"`
+}
+
+// track is the recording of one speaker
+// next is the timestamp of the sample after the last one written, fileTs the timestamp of the first sample of the file
+// arrival is when the last frame was queued, the gap to the next frame can not be longer than the pause since
+type track struct {
+	info    Speaker
+	file    *wavFile
+	fileTs  uint32
+	next    uint32
+	arrival time.Time
+}
+
+// queued is a frame waiting for the writer
+type queued struct {
+	key   string
+	user  string
+	voice protocol.Voice
+	at    time.Time
+}
+
+// Recorder records the voice of one channel or session
+//
+// Example:
+//
+//	rec, err := recorder.Start(clock.Real, recorder.Config{Dir: "recordings"}, "lobby")
+//	if err != nil {
+//		return err
+//	}
+//	rec.Write(clientAddr, "alice", voice)
+//	sidecar, err := rec.Stop()
+type Recorder struct {
+	clock   clock.Clock
+	config  Config
+	base    string // path of the files without extension
+	sidecar Sidecar
+
+	mu       sync.Mutex
+	queue    chan queued
+	dropped  int
+	stopped  bool
+	done     chan struct{}
+	stopOnce sync.Once
+
+	// owned by the writer until it is done
+	tracks map[string]*track
+	order  []string // keys of the tracks in the order they started
+	errs   []error
+}
+
+// Start starts a recording in the directory of the Config
+// The files are named after the recording and its start time
+func Start(clk clock.Clock, config Config, name string) (*Recorder, error) {
+	if config.MaxGap <= 0 {
+		config.MaxGap = DefaultMaxGap
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultQueueSize
+	}
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	started := clk.Now()
+	r := &Recorder{
+		clock:   clk,
+		config:  config,
+		base:    filepath.Join(config.Dir, fileName(name)+"-"+started.UTC().Format("20060102-150405")),
+		sidecar: Sidecar{Name: name, Started: started, ClockRate: clockRate},
+		queue:   make(chan queued, config.QueueSize),
+		done:    make(chan struct{}),
+		tracks:  make(map[string]*track),
+	}
+	if err := r.writeSidecar(); err != nil {
+		return nil, err
+	}
+	go r.run()
+	return r, nil
+}
+
+// Name returns the name of the recording
+func (r *Recorder) Name() string {
+	return r.sidecar.Name
+}
+
+// Write queues a voice frame of a speaker for the writer of the recording
+// The frame is copied, it may point into a receive buffer
+// Frames that arrive late or out of order are dropped, the files only grow
+func (r *Recorder) Write(key, user string, voice protocol.Voice) error {
+	_, ok := codec.For(voice.Codec)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped {
+		return errors.New("recording " + r.sidecar.Name + " is stopped")
+	}
+	if !ok {
+		r.dropped++
+		return fmt.Errorf("voice with codec %s can not be recorded", voice.Codec)
+	}
+	voice.Frame = append([]byte(nil), voice.Frame...)
+	select {
+	case r.queue <- queued{key: key, user: user, voice: voice, at: r.clock.Now()}:
+		return nil
+	default:
+		r.dropped++
+		return errors.New("recording " + r.sidecar.Name + " is behind, frame dropped")
+	}
+}
+
+// run writes the queued frames until the queue is closed
+// The errors of the files are returned by Stop
+func (r *Recorder) run() {
+	defer close(r.done)
+	for q := range r.queue {
+		if err := r.write(q); err != nil {
+			r.errs = append(r.errs, err)
+		}
+	}
+}
+
+// write writes a queued frame into the file of its speaker
+func (r *Recorder) write(q queued) error {
+	c, _ := codec.For(q.voice.Codec)
+	pcm, err := c.Decode(nil, q.voice.Frame)
+	if err != nil {
+		return err
+	}
+
+	voice := q.voice
+	t, ok := r.tracks[q.key]
+	if !ok {
+		t = &track{info: Speaker{Key: q.key, User: q.user, SSRC: voice.SSRC}, arrival: q.at}
+		r.tracks[q.key] = t
+		r.order = append(r.order, q.key)
+		if err := r.open(t, voice.Timestamp, q.at.Sub(r.sidecar.Started)); err != nil {
+			return err
+		}
+	}
+	gap := int64(int32(voice.Timestamp - t.next))
+	if gap < 0 {
+		return nil
+	}
+	// the timestamps come from the sender, the gap is limited to the pause that actually passed
+	gap = min(gap, int64((q.at.Sub(t.arrival)+earlyArrival).Seconds()*clockRate))
+	t.arrival = q.at
+	switch {
+	case gap > int64(r.config.MaxGap.Seconds()*clockRate) || r.full(t):
+		if err := r.rotate(t, voice.Timestamp); err != nil {
+			return err
+		}
+	case gap > 0:
+		if err := t.file.silence(int(gap)); err != nil {
+			return err
+		}
+	}
+	if err := t.file.write(pcm); err != nil {
+		return err
+	}
+	t.next = voice.Timestamp + uint32(len(pcm))
+	return nil
+}
+
+// Stop writes the queued frames, closes the files and writes the sidecar
+// It returns the sidecar, further calls return it again
+func (r *Recorder) Stop() (Sidecar, error) {
+	var err error
+	r.stopOnce.Do(func() {
+		err = r.stop()
+	})
+	return r.sidecar, err
+}
+
+// stop ends the writer and finishes the files
+func (r *Recorder) stop() error {
+	r.mu.Lock()
+	r.stopped = true
+	close(r.queue)
+	r.mu.Unlock()
+	<-r.done
+
+	errs := r.errs
+	r.sidecar.Dropped = r.dropped
+	for _, key := range r.order {
+		errs = append(errs, r.closeFile(r.tracks[key]))
+	}
+	r.sidecar.Stopped = r.clock.Now()
+	errs = append(errs, r.writeSidecar())
+	return errors.Join(errs...)
+}
+
+// full tells if the file of a track reached a limit
+func (r *Recorder) full(t *track) bool {
+	if r.config.MaxSize > 0 && t.file.size() >= r.config.MaxSize {
+		return true
+	}
+	return r.config.MaxDuration > 0 && t.file.samples >= int64(r.config.MaxDuration.Seconds()*clockRate)
+}
+
+// rotate closes the file of a track and opens the next one at timestamp
+// The start of the next file follows from the timestamps, so pauses keep their length
+func (r *Recorder) rotate(t *track, timestamp uint32) error {
+	files := t.info.Files
+	start := files[len(files)-1].Start + samplesDuration(int64(timestamp-t.fileTs))
+	if err := r.closeFile(t); err != nil {
+		return err
+	}
+	return r.open(t, timestamp, start)
+}
+
+// open opens the next file of a track
+func (r *Recorder) open(t *track, timestamp uint32, start time.Duration) error {
+	path := fmt.Sprintf("%s-%d-%d.wav", r.base, r.index(t.info.Key), len(t.info.Files)+1)
+	file, err := createWAV(path, clockRate)
+	if err != nil {
+		return err
+	}
+	t.file, t.fileTs, t.next = file, timestamp, timestamp
+	t.info.Files = append(t.info.Files, File{Path: filepath.Base(path), Start: start})
+	r.sidecar.Speakers = r.speakers()
+	return r.writeSidecar()
+}
+
+// closeFile closes the file of a track and updates the sidecar
+func (r *Recorder) closeFile(t *track) error {
+	if t.file == nil {
+		return nil
+	}
+	t.info.Files[len(t.info.Files)-1].Samples = t.file.samples
+	err := t.file.close()
+	t.file = nil
+	r.sidecar.Speakers = r.speakers()
+	return errors.Join(err, r.writeSidecar())
+}
+
+// speakers returns the speakers in the order they started
+func (r *Recorder) speakers() []Speaker {
+	speakers := make([]Speaker, 0, len(r.order))
+	for _, key := range r.order {
+		speakers = append(speakers, r.tracks[key].info)
+	}
+	return speakers
+}
+
+// index returns the number of a speaker in the file names, counted from 1
+func (r *Recorder) index(key string) int {
+	for i, k := range r.order {
+		if k == key {
+			return i + 1
+		}
+	}
+	return len(r.order) + 1
+}
+
+// writeSidecar writes the sidecar next to the WAV files
+func (r *Recorder) writeSidecar() error {
+	data, err := json.MarshalIndent(r.sidecar, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.base+".json", append(data, '\n'), 0o644)
+}
+
+func samplesDuration(samples int64) time.Duration {
+	return time.Duration(samples) * time.Second / clockRate
+}
+
+// fileName replaces the characters of a name that do not belong into a file name
+func fileName(name string) string {
+	out := []rune(name)
+	for i, c := range out {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			out[i] = '_'
+		}
+	}
+	return string(out)
+}
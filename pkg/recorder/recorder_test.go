@@ -0,0 +1,179 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/clock"
+	"github.com/aura-speak/networking/pkg/codec"
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+// frame returns a voice frame of 10ms L16 with a constant value
+func frame(timestamp uint32, value int16) protocol.Voice {
+	pcm := make([]int16, 480)
+	for i := range pcm {
+		pcm[i] = value
+	}
+	data, _ := codec.L16{}.Encode(nil, pcm)
+	return protocol.Voice{SSRC: 7, Timestamp: timestamp, Codec: protocol.CodecL16, Frame: data}
+}
+
+// readWAV returns the samples of a WAV file and checks its header
+func readWAV(t *testing.T, path string) []int16 {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data[:4]) != "RIFF" || string(data[8:12]) != "WAVE" || binary.LittleEndian.Uint32(data[24:]) != clockRate {
+		t.Fatalf("%s has no WAV header", path)
+	}
+	if size := binary.LittleEndian.Uint32(data[40:]); int(size) != len(data)-wavHeaderSize {
+		t.Fatalf("%s: data size %d, file has %d bytes of samples", path, size, len(data)-wavHeaderSize)
+	}
+	pcm := make([]int16, (len(data)-wavHeaderSize)/2)
+	for i := range pcm {
+		pcm[i] = int16(binary.LittleEndian.Uint16(data[wavHeaderSize+2*i:]))
+	}
+	return pcm
+}
+
+func start(t *testing.T, config Config) (*Recorder, *clock.Fake) {
+	t.Helper()
+	fake := clock.NewFake(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC))
+	config.Dir = t.TempDir()
+	r, err := Start(fake, config, "lobby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, fake
+}
+
+func TestRecordKeepsGaps(t *testing.T) {
+	r, fake := start(t, Config{})
+	fake.Advance(time.Second)
+	r.Write("alice", "alice", frame(1000, 1))
+	// one frame is missing, a late frame is dropped
+	r.Write("alice", "alice", frame(1960, 3))
+	r.Write("alice", "alice", frame(1480, 2))
+	r.Write("bob", "", frame(0, 5))
+	sidecar, err := r.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sidecar.Speakers) != 2 || sidecar.Speakers[0].Key != "alice" || sidecar.Speakers[0].SSRC != 7 {
+		t.Fatalf("speakers %+v", sidecar.Speakers)
+	}
+	alice := sidecar.Speakers[0].Files
+	if len(alice) != 1 || alice[0].Start != time.Second || alice[0].Samples != 3*480 {
+		t.Fatalf("files of alice %+v", alice)
+	}
+	pcm := readWAV(t, filepath.Join(r.config.Dir, alice[0].Path))
+	if len(pcm) != 3*480 || pcm[0] != 1 || pcm[480] != 0 || pcm[959] != 0 || pcm[960] != 3 {
+		t.Fatalf("samples %d, %d, %d, %d", pcm[0], pcm[480], pcm[959], pcm[960])
+	}
+
+	// the sidecar on disk matches
+	var stored Sidecar
+	data, err := os.ReadFile(r.base + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Name != "lobby" || len(stored.Speakers) != 2 || stored.Stopped.IsZero() {
+		t.Fatalf("stored sidecar %+v", stored)
+	}
+}
+
+func TestRotateBySize(t *testing.T) {
+	r, _ := start(t, Config{MaxSize: wavHeaderSize + 2*960})
+	for i := range 5 {
+		r.Write("alice", "", frame(uint32(i*480), int16(i)))
+	}
+	sidecar, _ := r.Stop()
+	files := sidecar.Speakers[0].Files
+	if len(files) != 3 || files[0].Samples != 960 || files[2].Samples != 480 {
+		t.Fatalf("files %+v", files)
+	}
+	if files[1].Start != 20*time.Millisecond || files[2].Start != 40*time.Millisecond {
+		t.Fatalf("files start at %s and %s", files[1].Start, files[2].Start)
+	}
+	if pcm := readWAV(t, filepath.Join(r.config.Dir, files[2].Path)); pcm[0] != 4 {
+		t.Fatalf("third file starts with %d", pcm[0])
+	}
+}
+
+func TestRotateByDuration(t *testing.T) {
+	r, _ := start(t, Config{MaxDuration: 10 * time.Millisecond})
+	r.Write("alice", "", frame(0, 1))
+	r.Write("alice", "", frame(480, 2))
+	sidecar, _ := r.Stop()
+	if files := sidecar.Speakers[0].Files; len(files) != 2 || files[1].Samples != 480 || files[1].Start != 10*time.Millisecond {
+		t.Fatalf("files %+v", files)
+	}
+}
+
+func TestLongPauseStartsNewFile(t *testing.T) {
+	r, fake := start(t, Config{MaxGap: time.Second})
+	r.Write("alice", "", frame(0, 1))
+	fake.Advance(2 * time.Second)
+	r.Write("alice", "", frame(480+2*clockRate, 2))
+	sidecar, _ := r.Stop()
+	files := sidecar.Speakers[0].Files
+	if len(files) != 2 || files[0].Samples != 480 || files[1].Start != 2*time.Second+10*time.Millisecond {
+		t.Fatalf("files %+v", files)
+	}
+}
+
+func TestGapLimitedToPause(t *testing.T) {
+	r, fake := start(t, Config{})
+	r.Write("alice", "", frame(0, 1))
+	// the timestamp claims a pause of 9s, only 100ms passed
+	fake.Advance(100 * time.Millisecond)
+	r.Write("alice", "", frame(480+9*clockRate, 2))
+	sidecar, err := r.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := sidecar.Speakers[0].Files
+	if want := int64(2*480) + int64((100*time.Millisecond+earlyArrival).Seconds()*clockRate); len(files) != 1 || files[0].Samples != want {
+		t.Fatalf("files %+v, want one with %d samples", files, want)
+	}
+}
+
+func TestFullQueueDrops(t *testing.T) {
+	r, _ := start(t, Config{QueueSize: 1})
+	// the writer may already have taken the first frame, but not all of them
+	var errs int
+	for i := range 100 {
+		if r.Write("alice", "", frame(uint32(i*480), 1)) != nil {
+			errs++
+		}
+	}
+	sidecar, _ := r.Stop()
+	if errs == 0 || sidecar.Dropped != errs || sidecar.Speakers[0].Files[0].Samples != int64((100-errs)*480) {
+		t.Fatalf("%d frames refused, sidecar %+v", errs, sidecar)
+	}
+}
+
+func TestUndecodableAndStopped(t *testing.T) {
+	r, _ := start(t, Config{})
+	if err := r.Write("alice", "", protocol.Voice{Codec: protocol.CodecOpus, Frame: []byte{0xFC}}); err == nil {
+		t.Fatal("opus recorded")
+	}
+	sidecar, _ := r.Stop()
+	if sidecar.Dropped != 1 || len(sidecar.Speakers) != 0 {
+		t.Fatalf("sidecar %+v", sidecar)
+	}
+	if err := r.Write("alice", "", frame(0, 1)); err == nil {
+		t.Fatal("stopped recorder wrote")
+	}
+}
@@ -0,0 +1,92 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"os"
+)
+
+// wavHeaderSize is the size of the RIFF header of a PCM WAV file
+const wavHeaderSize = 44
+
+// wavFile is a WAV file with 16 bit mono PCM
+// The sizes in the header are written by close, a file that was not closed has a header without sizes
+type wavFile struct {
+	f       *os.File
+	samples int64
+	buf     []byte
+}
+
+// createWAV creates a WAV file with the header of an empty recording
+func createWAV(path string, rate uint32) (*wavFile, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 0, wavHeaderSize)
+	header = append(header, "RIFF"...)
+	header = binary.LittleEndian.AppendUint32(header, 0)
+	header = append(header, "WAVEfmt "...)
+	header = binary.LittleEndian.AppendUint32(header, 16)     // size of the fmt chunk
+	header = binary.LittleEndian.AppendUint16(header, 1)      // PCM
+	header = binary.LittleEndian.AppendUint16(header, 1)      // mono
+	header = binary.LittleEndian.AppendUint32(header, rate)   // sample rate
+	header = binary.LittleEndian.AppendUint32(header, rate*2) // byte rate
+	header = binary.LittleEndian.AppendUint16(header, 2)      // block align
+	header = binary.LittleEndian.AppendUint16(header, 16)     // bits per sample
+	header = append(header, "data"...)
+	header = binary.LittleEndian.AppendUint32(header, 0)
+	if _, err := f.Write(header); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &wavFile{f: f}, nil
+}
+
+// write appends samples, WAV stores them little endian
+func (w *wavFile) write(pcm []int16) error {
+	w.buf = w.buf[:0]
+	for _, sample := range pcm {
+		w.buf = binary.LittleEndian.AppendUint16(w.buf, uint16(sample))
+	}
+	if _, err := w.f.Write(w.buf); err != nil {
+		return err
+	}
+	w.samples += int64(len(pcm))
+	return nil
+}
+
+// silence appends n samples of silence
+func (w *wavFile) silence(n int) error {
+	const chunk = 4800
+	zeros := make([]int16, min(n, chunk))
+	for n > 0 {
+		k := min(n, chunk)
+		if err := w.write(zeros[:k]); err != nil {
+			return err
+		}
+		n -= k
+	}
+	return nil
+}
+
+// size returns the size of the file in bytes
+func (w *wavFile) size() int64 {
+	return wavHeaderSize + 2*w.samples
+}
+
+// close writes the sizes into the header and closes the file
+func (w *wavFile) close() error {
+	data := uint32(2 * w.samples)
+	var sizes [4]byte
+	binary.LittleEndian.PutUint32(sizes[:], wavHeaderSize-8+data)
+	if _, err := w.f.WriteAt(sizes[:], 4); err != nil {
+		w.f.Close()
+		return err
+	}
+	binary.LittleEndian.PutUint32(sizes[:], data)
+	if _, err := w.f.WriteAt(sizes[:], wavHeaderSize-4); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
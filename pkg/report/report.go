@@ -0,0 +1,339 @@
+// Package Report contains the bookkeeping for sender and receiver reports
+// It is responsible for counting the packets exchanged with a peer
+// The reports work like RTCP: a sender periodically announces what it has sent
+// and the receiver answers with what it actually got
+// The server and the client keep one Peer per remote and expose the results as Stats
+package report
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+// DefaultInterval is the default interval between two reports
+const DefaultInterval = 5 * time.Second
+
+// ntpEpochOffset is the number of seconds between 1900-01-01 and 1970-01-01
+const ntpEpochOffset = 2208988800
+
+// ToNTP converts a time to the NTP timestamp format (32.32 fixed point seconds since 1900)
+func ToNTP(t time.Time) uint64 {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := (uint64(t.Nanosecond()) << 32) / uint64(time.Second)
+	return secs<<32 | frac
+}
+
+// FromNTP converts a NTP timestamp back to a time
+func FromNTP(ntp uint64) time.Time {
+	secs := int64(ntp>>32) - ntpEpochOffset
+	nanos := (int64(ntp&0xFFFFFFFF) * int64(time.Second)) >> 32
+	return time.Unix(secs, nanos)
+}
+
+// middle32 returns the middle 32 bits of a NTP timestamp (16.16 fixed point)
+// This is the compact format used for LastSR and DelaySinceLastSR
+func middle32(ntp uint64) uint32 {
+	return uint32(ntp >> 16)
+}
+
+// Stats is a snapshot of the report statistics for one peer
+// Inbound values describe the stream received from the peer
+// Outbound values describe the stream sent to the peer as reported back by the peer
+type Stats struct {
+	PacketsSent     uint32 `json:"packetsSent"`
+	OctetsSent      uint32 `json:"octetsSent"`
+	PacketsReceived uint32 `json:"packetsReceived"`
+	OctetsReceived  uint32 `json:"octetsReceived"`
+
+	InboundExpected     uint32  `json:"inboundExpected"`
+	InboundLost         int32   `json:"inboundLost"`
+	InboundFractionLost float64 `json:"inboundFractionLost"`
+	InboundJitterMs     float64 `json:"inboundJitterMs"`
+
+	OutboundLost         int32   `json:"outboundLost"`
+	OutboundFractionLost float64 `json:"outboundFractionLost"`
+	OutboundJitterMs     float64 `json:"outboundJitterMs"`
+	RoundTripMs          float64 `json:"roundTripMs"`
+
+	LastSenderReport   time.Time `json:"lastSenderReport"`
+	LastReceiverReport time.Time `json:"lastReceiverReport"`
+}
+
+// Peer is the report state for one remote
+// It contains the counters of the packets sent to and received from the remote
+// The last sender report received from the remote
+// The interval counters used for the fraction lost
+// The jitter estimation and the highest sequence number per media source
+// The last receiver report received from the remote
+type Peer struct {
+	mu sync.Mutex
+
+	packetsSent     uint32
+	octetsSent      uint32
+	packetsReceived uint32
+	octetsReceived  uint32
+
+	// last sender report of the remote and the local state when it arrived
+	hasSR         bool
+	lastSR        protocol.SenderReport
+	lastSRArrival time.Time
+	receivedAtSR  uint32
+
+	// interarrival jitter and sequence numbers of the media packets per source
+	sources map[uint32]*source
+	// source of the last media packet, its highest sequence number is reported
+	lastSource uint32
+
+	// expected and received at the time of the last receiver report
+	priorExpected uint32
+	priorReceived uint32
+	fractionLost  uint8
+
+	// last receiver report of the remote
+	hasRR         bool
+	remoteRR      protocol.ReceiverReport
+	rrArrival     time.Time
+	roundTripTime time.Duration
+}
+
+// MaxSources is the number of media sources a Peer estimates the jitter for
+// A client hears every talker through the same Server, the source heard longest ago is replaced first
+const MaxSources = 64
+
+// source is the jitter estimation (RFC 3550 A.8) and the extended highest sequence number (RFC 3550 A.1) of one media source
+type source struct {
+	clockRate   uint32
+	base        time.Time // arrival of the first packet, the arrival times are counted from it
+	lastTransit int64     // in timestamp units
+	lastArrival time.Time
+	jitter      float64 // in timestamp units
+	maxSeq      uint16
+	cycles      uint32 // wraps of the sequence number shifted by 16 bits
+}
+
+// NewPeer creates a new empty Peer
+func NewPeer() *Peer {
+	return &Peer{sources: make(map[uint32]*source)}
+}
+
+// counted checks if an encoded packet is counted in the reports
+// Both sides count the same packets: the handshake and the reports themselves are not counted
+func counted(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	packetType := protocol.PacketType(data[0])
+	return !protocol.IsReportPacket(packetType) && !protocol.IsHandshakePacket(packetType)
+}
+
+// OnSent counts an encoded packet sent to the remote
+// Handshake and report packets are ignored
+func (p *Peer) OnSent(data []byte) {
+	if !counted(data) {
+		return
+	}
+	p.mu.Lock()
+	p.packetsSent++
+	p.octetsSent += uint32(len(data))
+	p.mu.Unlock()
+}
+
+// OnReceived counts an encoded packet received from the remote
+// Handshake and report packets are ignored
+func (p *Peer) OnReceived(data []byte) {
+	if !counted(data) {
+		return
+	}
+	p.mu.Lock()
+	p.packetsReceived++
+	p.octetsReceived += uint32(len(data))
+	p.mu.Unlock()
+}
+
+// OnMedia updates the interarrival jitter (RFC 3550 A.8) and the highest sequence number with a received media packet
+// ssrc identifies the source of the packet, timestamp is its sampling instant in clockRate units per second
+// It is called for every media packet, the jitter of the report is the largest of all sources
+// and the highest sequence number is the one of the source heard last
+//
+// Example:
+//
+//	peer.OnMedia(voice.SSRC, voice.Sequence, voice.Timestamp, codec.ClockRate, clock.Now())
+func (p *Peer) OnMedia(ssrc uint32, sequence uint16, timestamp uint32, clockRate uint32, now time.Time) {
+	if clockRate == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastSource = ssrc
+	s, ok := p.sources[ssrc]
+	if !ok || s.clockRate != clockRate {
+		if !ok && len(p.sources) >= MaxSources {
+			p.evictSource()
+		}
+		s = &source{clockRate: clockRate, base: now, maxSeq: sequence}
+		p.sources[ssrc] = s
+		// the first packet only sets the transit time
+		s.lastTransit = s.transit(timestamp, now)
+		s.lastArrival = now
+		return
+	}
+	s.sequence(sequence)
+	transit := s.transit(timestamp, now)
+	d := float64(transit - s.lastTransit)
+	s.lastTransit = transit
+	s.lastArrival = now
+	s.jitter += (math.Abs(d) - s.jitter) / 16
+}
+
+// sequence records the sequence number of a packet of the source (RFC 3550 A.1 without probation)
+// A sequence number less than half the range ahead is newer, one that wrapped adds a cycle
+func (s *source) sequence(seq uint16) {
+	if delta := seq - s.maxSeq; delta != 0 && delta < 1<<15 {
+		if seq < s.maxSeq {
+			s.cycles += 1 << 16
+		}
+		s.maxSeq = seq
+	}
+}
+
+// highestSequence returns the extended highest sequence number of the source
+func (s *source) highestSequence() uint32 {
+	return s.cycles | uint32(s.maxSeq)
+}
+
+// transit is the difference between the arrival and the timestamp of a packet in timestamp units
+// Both wrap around, the difference of two transit times stays correct
+func (s *source) transit(timestamp uint32, now time.Time) int64 {
+	ticks := uint64(now.Sub(s.base)/time.Microsecond) * uint64(s.clockRate) / uint64(time.Second/time.Microsecond)
+	return int64(int32(uint32(ticks) - timestamp))
+}
+
+// jitterMicros returns the jitter of the source in microseconds
+func (s *source) jitterMicros() float64 {
+	return s.jitter * float64(time.Second/time.Microsecond) / float64(s.clockRate)
+}
+
+// evictSource removes the source heard longest ago
+func (p *Peer) evictSource() {
+	var oldest uint32
+	var oldestArrival time.Time
+	first := true
+	for ssrc, s := range p.sources {
+		if first || s.lastArrival.Before(oldestArrival) {
+			oldest, oldestArrival, first = ssrc, s.lastArrival, false
+		}
+	}
+	delete(p.sources, oldest)
+}
+
+// jitter returns the largest jitter of all sources in microseconds
+func (p *Peer) jitter() float64 {
+	var jitter float64
+	for _, s := range p.sources {
+		jitter = max(jitter, s.jitterMicros())
+	}
+	return jitter
+}
+
+// SenderReport builds the sender report for the remote
+func (p *Peer) SenderReport(now time.Time) protocol.SenderReport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return protocol.SenderReport{
+		NTPTimestamp: ToNTP(now),
+		PacketCount:  p.packetsSent,
+		OctetCount:   p.octetsSent,
+	}
+}
+
+// HandleSenderReport consumes a sender report received from the remote
+func (p *Peer) HandleSenderReport(sr protocol.SenderReport, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.hasSR = true
+	p.lastSR = sr
+	p.lastSRArrival = now
+	p.receivedAtSR = p.packetsReceived
+}
+
+// ReceiverReport builds the receiver report for the remote
+// It returns false if no sender report has been received from the remote yet
+func (p *Peer) ReceiverReport(now time.Time) (protocol.ReceiverReport, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.hasSR {
+		return protocol.ReceiverReport{}, false
+	}
+
+	expected := p.lastSR.PacketCount
+	received := p.receivedAtSR
+
+	expectedInterval := expected - p.priorExpected
+	receivedInterval := received - p.priorReceived
+	p.priorExpected = expected
+	p.priorReceived = received
+	if expectedInterval > 0 && expectedInterval > receivedInterval {
+		p.fractionLost = uint8((uint64(expectedInterval-receivedInterval) << 8) / uint64(expectedInterval))
+	} else {
+		p.fractionLost = 0
+	}
+
+	var highestSeq uint32
+	if s, ok := p.sources[p.lastSource]; ok {
+		highestSeq = s.highestSequence()
+	}
+	delay := now.Sub(p.lastSRArrival)
+	return protocol.ReceiverReport{
+		SenderPacketCount: expected,
+		HighestSequence:   highestSeq,
+		CumulativeLost:    int32(expected - received),
+		FractionLost:      p.fractionLost,
+		Jitter:            uint32(p.jitter()),
+		LastSR:            middle32(p.lastSR.NTPTimestamp),
+		DelaySinceLastSR:  uint32(delay * 65536 / time.Second),
+	}, true
+}
+
+// HandleReceiverReport consumes a receiver report received from the remote
+// The round trip time is calculated from LastSR and DelaySinceLastSR
+func (p *Peer) HandleReceiverReport(rr protocol.ReceiverReport, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.hasRR = true
+	p.remoteRR = rr
+	p.rrArrival = now
+	if rr.LastSR != 0 {
+		rtt := middle32(ToNTP(now)) - rr.LastSR - rr.DelaySinceLastSR
+		p.roundTripTime = time.Duration(rtt) * time.Second / 65536
+	}
+}
+
+// Stats returns a snapshot of the statistics for the remote
+func (p *Peer) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := Stats{
+		PacketsSent:     p.packetsSent,
+		OctetsSent:      p.octetsSent,
+		PacketsReceived: p.packetsReceived,
+		OctetsReceived:  p.octetsReceived,
+	}
+	if p.hasSR {
+		stats.InboundExpected = p.lastSR.PacketCount
+		stats.InboundLost = int32(p.lastSR.PacketCount - p.receivedAtSR)
+		stats.InboundFractionLost = float64(p.fractionLost) / 256
+		stats.LastSenderReport = p.lastSRArrival
+	}
+	stats.InboundJitterMs = p.jitter() / 1000
+	if p.hasRR {
+		stats.OutboundLost = p.remoteRR.CumulativeLost
+		stats.OutboundFractionLost = float64(p.remoteRR.FractionLost) / 256
+		stats.OutboundJitterMs = float64(p.remoteRR.Jitter) / 1000
+		stats.RoundTripMs = float64(p.roundTripTime.Microseconds()) / 1000
+		stats.LastReceiverReport = p.rrArrival
+	}
+	return stats
+}
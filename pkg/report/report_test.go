@@ -0,0 +1,186 @@
+package report
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+var start = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func encoded(packetType protocol.PacketType, size int) []byte {
+	data := make([]byte, size)
+	data[0] = byte(packetType)
+	return data
+}
+
+func TestNTPRoundTrip(t *testing.T) {
+	at := start.Add(123456789 * time.Nanosecond)
+	got := FromNTP(ToNTP(at))
+	if diff := got.Sub(at); diff < -time.Nanosecond || diff > time.Nanosecond {
+		t.Fatalf("FromNTP(ToNTP(%s)) = %s", at, got)
+	}
+}
+
+func TestCountersIgnoreReports(t *testing.T) {
+	p := NewPeer()
+	p.OnSent(encoded(protocol.PacketTypeDebugAny, 100))
+	p.OnSent(encoded(protocol.PacketTypeSenderReport, 17))
+	p.OnReceived(encoded(protocol.PacketTypeDebugAny, 50))
+	p.OnReceived(encoded(protocol.PacketTypeReceiverReport, 22))
+	p.OnReceived(nil)
+
+	stats := p.Stats()
+	if stats.PacketsSent != 1 || stats.OctetsSent != 100 {
+		t.Errorf("sent %d packets %d octets, want 1 and 100", stats.PacketsSent, stats.OctetsSent)
+	}
+	if stats.PacketsReceived != 1 || stats.OctetsReceived != 50 {
+		t.Errorf("received %d packets %d octets, want 1 and 50", stats.PacketsReceived, stats.OctetsReceived)
+	}
+	sr := p.SenderReport(start)
+	if sr.PacketCount != 1 || sr.OctetCount != 100 || sr.NTPTimestamp != ToNTP(start) {
+		t.Errorf("sender report %+v", sr)
+	}
+}
+
+func TestReceiverReportNeedsSenderReport(t *testing.T) {
+	p := NewPeer()
+	if _, ok := p.ReceiverReport(start); ok {
+		t.Fatal("receiver report without a sender report")
+	}
+}
+
+func TestLoss(t *testing.T) {
+	p := NewPeer()
+	for range 8 {
+		p.OnReceived(encoded(protocol.PacketTypeDebugAny, 10))
+	}
+	p.HandleSenderReport(protocol.SenderReport{NTPTimestamp: ToNTP(start), PacketCount: 10}, start)
+	rr, ok := p.ReceiverReport(start.Add(500 * time.Millisecond))
+	if !ok {
+		t.Fatal("no receiver report")
+	}
+	if rr.SenderPacketCount != 10 || rr.CumulativeLost != 2 {
+		t.Errorf("count %d lost %d, want 10 and 2", rr.SenderPacketCount, rr.CumulativeLost)
+	}
+	if rr.FractionLost != 2*256/10 {
+		t.Errorf("fraction lost %d, want %d", rr.FractionLost, 2*256/10)
+	}
+	if rr.LastSR != middle32(ToNTP(start)) || rr.DelaySinceLastSR != 65536/2 {
+		t.Errorf("last SR %x delay %d", rr.LastSR, rr.DelaySinceLastSR)
+	}
+
+	// the second interval loses nothing
+	for range 10 {
+		p.OnReceived(encoded(protocol.PacketTypeDebugAny, 10))
+	}
+	p.HandleSenderReport(protocol.SenderReport{NTPTimestamp: ToNTP(start.Add(time.Second)), PacketCount: 20}, start.Add(time.Second))
+	rr, _ = p.ReceiverReport(start.Add(time.Second))
+	if rr.CumulativeLost != 2 || rr.FractionLost != 0 {
+		t.Errorf("lost %d fraction %d, want 2 and 0", rr.CumulativeLost, rr.FractionLost)
+	}
+}
+
+func TestRoundTripTime(t *testing.T) {
+	sender, receiver := NewPeer(), NewPeer()
+	receiver.HandleSenderReport(sender.SenderReport(start), start.Add(20*time.Millisecond))
+	// the receiver holds the sender report for 100ms
+	rr, _ := receiver.ReceiverReport(start.Add(120 * time.Millisecond))
+	sender.HandleReceiverReport(rr, start.Add(140*time.Millisecond))
+
+	rtt := sender.Stats().RoundTripMs
+	if math.Abs(rtt-40) > 0.1 {
+		t.Fatalf("round trip %.3fms, want 40ms", rtt)
+	}
+}
+
+func TestJitterConstantDelay(t *testing.T) {
+	p := NewPeer()
+	// 20ms frames at 48kHz with a constant network delay
+	for i := range 100 {
+		at := start.Add(time.Duration(i)*20*time.Millisecond + 30*time.Millisecond)
+		p.OnMedia(1, uint16(i), uint32(1000+i*960), 48000, at)
+	}
+	if jitter := p.Stats().InboundJitterMs; jitter > 0.01 {
+		t.Fatalf("jitter %.3fms with constant delay", jitter)
+	}
+}
+
+func TestJitterConverges(t *testing.T) {
+	p := NewPeer()
+	// every other frame is 2ms late, so |D| is always 2ms and the estimate converges to 2ms
+	for i := range 500 {
+		delay := time.Duration(i%2) * 2 * time.Millisecond
+		p.OnMedia(1, uint16(i), uint32(i*960), 48000, start.Add(time.Duration(i)*20*time.Millisecond+delay))
+	}
+	jitter := p.Stats().InboundJitterMs
+	if math.Abs(jitter-2) > 0.05 {
+		t.Fatalf("jitter %.3fms, want 2ms", jitter)
+	}
+	rr := p.receiverReportAfterSR()
+	if rr.Jitter < 1950 || rr.Jitter > 2050 {
+		t.Fatalf("report jitter %dus, want 2000us", rr.Jitter)
+	}
+}
+
+func TestJitterPerSource(t *testing.T) {
+	p := NewPeer()
+	// two talkers with unrelated timestamp bases, neither has jitter on its own
+	for i := range 100 {
+		at := start.Add(time.Duration(i) * 20 * time.Millisecond)
+		p.OnMedia(1, uint16(i), uint32(i*960), 48000, at)
+		p.OnMedia(2, uint16(i), uint32(0x80000000+i*160), 8000, at.Add(5*time.Millisecond))
+	}
+	if jitter := p.Stats().InboundJitterMs; jitter > 0.01 {
+		t.Fatalf("jitter %.3fms, the sources were mixed", jitter)
+	}
+}
+
+func TestJitterTimestampWraps(t *testing.T) {
+	p := NewPeer()
+	for i := range 100 {
+		p.OnMedia(1, uint16(i), uint32(0xFFFFF000+i*960), 48000, start.Add(time.Duration(i)*20*time.Millisecond))
+	}
+	if jitter := p.Stats().InboundJitterMs; jitter > 0.01 {
+		t.Fatalf("jitter %.3fms across the timestamp wrap", jitter)
+	}
+}
+
+func TestHighestSequence(t *testing.T) {
+	p := NewPeer()
+	// the sequence number wraps, a late packet of the previous cycle does not lower it
+	for i, seq := range []uint16{0xFFFD, 0xFFFE, 0x0001, 0xFFFF, 0x0002} {
+		p.OnMedia(1, seq, uint32(i*960), 48000, start.Add(time.Duration(i)*20*time.Millisecond))
+	}
+	if rr := p.receiverReportAfterSR(); rr.HighestSequence != 0x10002 {
+		t.Fatalf("highest sequence %#x, want 0x10002", rr.HighestSequence)
+	}
+
+	// the report carries the source heard last
+	p.OnMedia(2, 7, 0, 48000, start)
+	if rr := p.receiverReportAfterSR(); rr.HighestSequence != 7 {
+		t.Fatalf("highest sequence %#x, want 7 of the source heard last", rr.HighestSequence)
+	}
+}
+
+func TestSourcesAreBounded(t *testing.T) {
+	p := NewPeer()
+	for ssrc := range uint32(MaxSources + 10) {
+		p.OnMedia(ssrc, 0, 0, 48000, start.Add(time.Duration(ssrc)*time.Millisecond))
+	}
+	if len(p.sources) != MaxSources {
+		t.Fatalf("%d sources, want %d", len(p.sources), MaxSources)
+	}
+	if _, ok := p.sources[0]; ok {
+		t.Fatal("the source heard longest ago was kept")
+	}
+}
+
+// receiverReportAfterSR returns a receiver report, the jitter does not depend on the sender report
+func (p *Peer) receiverReportAfterSR() protocol.ReceiverReport {
+	p.HandleSenderReport(protocol.SenderReport{NTPTimestamp: ToNTP(start)}, start)
+	rr, _ := p.ReceiverReport(start)
+	return rr
+}
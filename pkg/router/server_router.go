@@ -5,13 +5,55 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/aura-speak/networking/pkg/auth"
 	"github.com/aura-speak/networking/pkg/protocol"
 )
 
+// Errors of HandlePacket for packets the router can not route
+var (
+	ErrInvalidPacketType = errors.New("invalid packet type")
+	ErrNoHandler         = errors.New("no handler found")
+)
+
 type ServerPacketHandler func(packet *protocol.Packet, clientAddr string) error
 
+// Authorizer checks if a client holds a permission in a channel
+// An empty channel checks the server wide permissions
+type Authorizer func(clientAddr string, channel string, permission auth.Permission) bool
+
+// ChannelResolver returns the channel a packet of a client acts in, empty if it acts server wide
+type ChannelResolver func(packet *protocol.Packet, clientAddr string) string
+
+// PermissionDeniedError is returned by HandlePacket if the client lacks the permission of the route
+// Channel is the channel the permission was checked in, empty for the server wide permissions
+type PermissionDeniedError struct {
+	PacketType protocol.PacketType
+	Permission auth.Permission
+	Channel    string
+}
+
+func (e *PermissionDeniedError) Error() string {
+	strPacketType, exists := protocol.PacketTypeMapType[e.PacketType]
+	if !exists {
+		strPacketType = fmt.Sprintf("Unknown(0x%02X)", e.PacketType)
+	}
+	if e.Channel != "" {
+		return fmt.Sprintf("permission %s in channel %s required for packet type: %s", e.Permission, e.Channel, strPacketType)
+	}
+	return fmt.Sprintf("permission %s required for packet type: %s", e.Permission, strPacketType)
+}
+
+// serverRoute is a registered handler, the permission required to call it and where the permission is checked
+type serverRoute struct {
+	handler    ServerPacketHandler
+	permission auth.Permission
+	channel    ChannelResolver
+}
+
 type ServerPacketRouter struct {
-	handlers sync.Map // packetType -> PacketHandler
+	handlers   sync.Map // packetType -> serverRoute
+	authorizer Authorizer
+	channel    ChannelResolver
 }
 
 // NewServerPacketRouter creates a new ServerPacketRouter
@@ -21,6 +63,18 @@ func NewServerPacketRouter() *ServerPacketRouter {
 	}
 }
 
+// SetAuthorizer sets the Authorizer used for routes that require a permission
+// Without an Authorizer every route that requires a permission is denied
+func (r *ServerPacketRouter) SetAuthorizer(authorizer Authorizer) {
+	r.authorizer = authorizer
+}
+
+// SetChannelResolver sets the ChannelResolver of the routes registered without one
+// Without a ChannelResolver these routes check the server wide permissions
+func (r *ServerPacketRouter) SetChannelResolver(channel ChannelResolver) {
+	r.channel = channel
+}
+
 // OnPacket registers a new PacketHandler for a specific packet type
 // Example:
 //
@@ -29,10 +83,34 @@ func NewServerPacketRouter() *ServerPacketRouter {
 //		return nil
 //	})
 func (r *ServerPacketRouter) OnPacket(packetType protocol.PacketType, handler ServerPacketHandler) {
-	r.handlers.Store(packetType, handler)
+	r.OnPacketWithPermission(packetType, auth.PermissionNone, handler)
+}
+
+// OnPacketWithPermission registers a new PacketHandler for a specific packet type
+// The handler is only called if the Authorizer grants the permission to the client
+// Example:
+//
+//	router.OnPacketWithPermission(protocol.PacketTypeDebugAny, auth.PermissionSpeak, func(packet *protocol.Packet, clientAddr string) error {
+//		fmt.Println("Received packet from client allowed to speak:", clientAddr)
+//		return nil
+//	})
+func (r *ServerPacketRouter) OnPacketWithPermission(packetType protocol.PacketType, permission auth.Permission, handler ServerPacketHandler) {
+	r.OnPacketInChannel(packetType, permission, nil, handler)
+}
+
+// OnPacketInChannel registers a new PacketHandler that requires a permission in the channel the packet acts in
+// The channel resolves the channel from the packet, the ChannelResolver of the router is used if it is nil
+// Example:
+//
+//	router.OnPacketInChannel(protocol.PacketTypeChannelJoin, auth.PermissionListen, func(packet *protocol.Packet, clientAddr string) string {
+//		return string(packet.Payload)
+//	}, handleJoin)
+func (r *ServerPacketRouter) OnPacketInChannel(packetType protocol.PacketType, permission auth.Permission, channel ChannelResolver, handler ServerPacketHandler) {
+	r.handlers.Store(packetType, serverRoute{handler: handler, permission: permission, channel: channel})
 }
 
 // HandlePacket handles a packet from a client
+// It returns a *PermissionDeniedError if the client lacks the permission of the route
 // Example:
 //
 //	router.HandlePacket(packet, clientAddr)
@@ -41,7 +119,7 @@ func (r *ServerPacketRouter) OnPacket(packetType protocol.PacketType, handler Se
 //	}
 func (r *ServerPacketRouter) HandlePacket(packet *protocol.Packet, clientAddr string) error {
 	if !protocol.IsValidPacketType(packet.PacketHeader.PacketType) {
-		return errors.New("invalid packet type")
+		return ErrInvalidPacketType
 	}
 	handler, ok := r.handlers.Load(packet.PacketHeader.PacketType)
 	if !ok {
@@ -49,10 +127,27 @@ func (r *ServerPacketRouter) HandlePacket(packet *protocol.Packet, clientAddr st
 		if !exists {
 			strPacketType = fmt.Sprintf("Unknown(0x%02X)", packet.PacketHeader.PacketType)
 		}
-		return fmt.Errorf("no handler found for packet type: %s", strPacketType)
+		return fmt.Errorf("%w for packet type: %s", ErrNoHandler, strPacketType)
 	}
-	handlerFunc := handler.(ServerPacketHandler)
-	return handlerFunc(packet, clientAddr)
+	route := handler.(serverRoute)
+	if route.permission != auth.PermissionNone {
+		resolve := route.channel
+		if resolve == nil {
+			resolve = r.channel
+		}
+		var channel string
+		if resolve != nil {
+			channel = resolve(packet, clientAddr)
+		}
+		if r.authorizer == nil || !r.authorizer(clientAddr, channel, route.permission) {
+			return &PermissionDeniedError{
+				PacketType: packet.PacketHeader.PacketType,
+				Permission: route.permission,
+				Channel:    channel,
+			}
+		}
+	}
+	return route.handler(packet, clientAddr)
 }
 
 func (r *ServerPacketRouter) ListRoutes() {
@@ -61,6 +156,10 @@ func (r *ServerPacketRouter) ListRoutes() {
 		if !exists {
 			strPacketType = fmt.Sprintf("Unknown(0x%02X)", key.(protocol.PacketType))
 		}
+		if permission := value.(serverRoute).permission; permission != auth.PermissionNone {
+			fmt.Printf("Packet type: %s (requires %s)\n", strPacketType, permission)
+			return true
+		}
 		fmt.Printf("Packet type: %s\n", strPacketType)
 		return true
 	})
@@ -0,0 +1,142 @@
+package rtp
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+// FuzzDepacketize checks that no RTP packet makes Depacketize panic
+// and that every accepted packet packetizes to the same voice frame
+// Example:
+//
+//	go test ./pkg/rtp -run '^$' -fuzz '^FuzzDepacketize$' -fuzztime 30s
+func FuzzDepacketize(f *testing.F) {
+	plain, _ := Packetize(exampleVoice)
+	// CSRC count 1, extension with one word and two bytes of padding
+	optional := append([]byte{Version<<6 | 0x20 | 0x10 | 0x01}, plain[1:HeaderSize]...)
+	optional = append(optional, 0xCA, 0xFE, 0xBA, 0xBE, 0xBE, 0xDE, 0x00, 0x01, 0x01, 0x02, 0x03, 0x04)
+	optional = append(optional, exampleVoice.Frame...)
+	optional = append(optional, 0x00, 0x02)
+	seeds := [][]byte{
+		{},
+		plain[:HeaderSize-1],
+		plain,
+		plain[:HeaderSize],
+		optional,
+		append([]byte{0x00}, plain[1:]...),
+		append([]byte{plain[0], 0x7F}, plain[2:]...),
+		append([]byte{plain[0] | 0x20}, plain[1:HeaderSize]...),
+		append([]byte{plain[0] | 0x10}, plain[1:HeaderSize]...),
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if err := fuzzDepacketize(data); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func fuzzDepacketize(data []byte) error {
+	voice, err := Depacketize(data)
+	if err != nil {
+		return nil
+	}
+	if len(voice.Frame) > len(data)-HeaderSize {
+		return fmt.Errorf("frame of %d bytes from a packet of %d bytes", len(voice.Frame), len(data))
+	}
+	packet, err := Packetize(voice)
+	if err != nil {
+		return fmt.Errorf("depacketized voice frame does not packetize: %v", err)
+	}
+	again, err := Depacketize(packet)
+	if err != nil || !sameVoice(again, voice) {
+		return fmt.Errorf("voice frame changed from %+v to %+v, %v", voice, again, err)
+	}
+	// without marker, CSRCs, extension and padding the packet is exactly what Packetize writes
+	if data[0] == Version<<6 && data[1]&0x80 == 0 && !bytes.Equal(packet, data) {
+		return fmt.Errorf("rtp packet packetizes to %x, depacketized from %x", packet, data)
+	}
+	return nil
+}
+
+// FuzzDecodeReports checks that no compound RTCP packet makes DecodeReports panic
+// and that every accepted report survives another encode and decode
+// The jitter is converted with the clock rate and may only get smaller on the way
+func FuzzDecodeReports(f *testing.F) {
+	sr := protocol.SenderReport{NTPTimestamp: 0xE8_00_00_00_80_00_00_00, PacketCount: 10, OctetCount: 1200}
+	block := ReceptionReport{Source: 7, ReceiverReport: protocol.ReceiverReport{FractionLost: 128, CumulativeLost: -1, HighestSequence: 0x10005, Jitter: 500, LastSR: 0x8000, DelaySinceLastSR: 65536}}
+	sender := AppendReport(nil, Report{SSRC: 9, SenderReport: &sr, RTPTimestamp: 960, Blocks: []ReceptionReport{block, block}}, 48000)
+	receiver := AppendReport(nil, Report{SSRC: 9, Blocks: []ReceptionReport{block}}, 48000)
+	// SDES with one empty chunk, it is skipped
+	sdes := []byte{Version<<6 | 0x01, 202, 0x00, 0x01, 0x00, 0x00, 0x00, 0x09}
+	seeds := [][]byte{
+		{},
+		sender[:3],
+		sender[:len(sender)-1],
+		sender,
+		receiver,
+		append(append(append([]byte{}, sender...), sdes...), receiver...),
+		append([]byte{0x00}, receiver[1:]...),
+		append([]byte{receiver[0] | 0x1F}, receiver[1:]...),
+	}
+	for _, seed := range seeds {
+		for _, clockRate := range []uint32{48000, 8000, 1, 0} {
+			f.Add(seed, clockRate)
+		}
+	}
+	f.Fuzz(func(t *testing.T, data []byte, clockRate uint32) {
+		if err := fuzzDecodeReports(data, clockRate); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func fuzzDecodeReports(data []byte, clockRate uint32) error {
+	reports, err := DecodeReports(data, clockRate)
+	if err != nil {
+		return nil
+	}
+	var encoded []byte
+	for _, report := range reports {
+		encoded = AppendReport(encoded, report, clockRate)
+	}
+	again, err := DecodeReports(encoded, clockRate)
+	if err != nil {
+		return fmt.Errorf("encoded reports do not decode: %v", err)
+	}
+	if len(again) != len(reports) {
+		return fmt.Errorf("%d reports encode to %d", len(reports), len(again))
+	}
+	for i, report := range reports {
+		if err := sameReport(report, again[i]); err != nil {
+			return fmt.Errorf("report %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// sameReport compares two reports, the jitter of b may be smaller
+func sameReport(a, b Report) error {
+	if a.SSRC != b.SSRC || a.RTPTimestamp != b.RTPTimestamp || len(a.Blocks) != len(b.Blocks) {
+		return fmt.Errorf("changed from %+v to %+v", a, b)
+	}
+	if (a.SenderReport == nil) != (b.SenderReport == nil) || a.SenderReport != nil && *a.SenderReport != *b.SenderReport {
+		return fmt.Errorf("sender info changed from %+v to %+v", a.SenderReport, b.SenderReport)
+	}
+	for i, block := range a.Blocks {
+		other := b.Blocks[i]
+		if other.Jitter > block.Jitter {
+			return fmt.Errorf("jitter of block %d grew from %d to %d", i, block.Jitter, other.Jitter)
+		}
+		other.Jitter = block.Jitter
+		if other != block {
+			return fmt.Errorf("block %d changed from %+v to %+v", i, block, other)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package rtp
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+const (
+	typeSenderReport   = 200
+	typeReceiverReport = 201
+)
+
+const (
+	senderInfoSize      = 20
+	reportBlockSize     = 24
+	maxReportBlocks     = 31
+	maxCumulativeLost   = 1<<23 - 1
+	minCumulativeLost   = -1 << 23
+	microsecondsPerSec  = 1000000
+	rtcpHeaderAndSource = 8
+)
+
+// Report is one RTCP sender or receiver report
+// SSRC is the source that sends the report
+// SenderReport and RTPTimestamp are only set for a SR, RTPTimestamp is the NTP time in units of the codec clock rate
+// Blocks are the reception reports about other sources
+type Report struct {
+	SSRC         uint32
+	SenderReport *protocol.SenderReport
+	RTPTimestamp uint32
+	Blocks       []ReceptionReport
+}
+
+// ReceptionReport is a report block about the stream of Source
+// The ReceiverReport maps the fields of RTCP
+// A reception report has no packet count, SenderPacketCount is not sent, Jitter is converted to microseconds with the clock rate
+// CumulativeLost is limited to the 24 bits of RTCP
+type ReceptionReport struct {
+	Source uint32
+	protocol.ReceiverReport
+}
+
+// AppendReport appends the RTCP SR or RR of the report to dst and returns the extended slice
+// clockRate converts the jitter from microseconds to timestamp units
+// More than 31 blocks are dropped
+//
+// Example:
+//
+//	sr := peer.SenderReport(now)
+//	data := rtp.AppendReport(nil, rtp.Report{SSRC: ssrc, SenderReport: &sr, RTPTimestamp: ts}, 48000)
+func AppendReport(dst []byte, r Report, clockRate uint32) []byte {
+	blocks := r.Blocks[:min(len(r.Blocks), maxReportBlocks)]
+	packetType := byte(typeReceiverReport)
+	size := rtcpHeaderAndSource + reportBlockSize*len(blocks)
+	if r.SenderReport != nil {
+		packetType = typeSenderReport
+		size += senderInfoSize
+	}
+	dst = append(dst, Version<<6|byte(len(blocks)), packetType)
+	dst = binary.BigEndian.AppendUint16(dst, uint16(size/4-1))
+	dst = binary.BigEndian.AppendUint32(dst, r.SSRC)
+	if r.SenderReport != nil {
+		dst = binary.BigEndian.AppendUint64(dst, r.SenderReport.NTPTimestamp)
+		dst = binary.BigEndian.AppendUint32(dst, r.RTPTimestamp)
+		dst = binary.BigEndian.AppendUint32(dst, r.SenderReport.PacketCount)
+		dst = binary.BigEndian.AppendUint32(dst, r.SenderReport.OctetCount)
+	}
+	for _, block := range blocks {
+		lost := min(max(block.CumulativeLost, minCumulativeLost), maxCumulativeLost)
+		jitter := uint64(block.Jitter) * uint64(clockRate) / microsecondsPerSec
+		dst = binary.BigEndian.AppendUint32(dst, block.Source)
+		dst = append(dst, block.FractionLost, byte(lost>>16), byte(lost>>8), byte(lost))
+		dst = binary.BigEndian.AppendUint32(dst, block.HighestSequence)
+		dst = binary.BigEndian.AppendUint32(dst, uint32(min(jitter, 1<<32-1)))
+		dst = binary.BigEndian.AppendUint32(dst, block.LastSR)
+		dst = binary.BigEndian.AppendUint32(dst, block.DelaySinceLastSR)
+	}
+	return dst
+}
+
+// DecodeReports decodes the SR and RR of a compound RTCP packet
+// Other RTCP packets like SDES and BYE are skipped
+// clockRate converts the jitter from timestamp units to microseconds
+// It returns an error if a packet of the compound is malformed
+func DecodeReports(data []byte, clockRate uint32) ([]Report, error) {
+	var reports []Report
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, errors.New("rtcp packet too short")
+		}
+		if data[0]>>6 != Version {
+			return nil, errors.New("rtcp version is not 2")
+		}
+		size := 4 * (int(binary.BigEndian.Uint16(data[2:4])) + 1)
+		if size > len(data) {
+			return nil, errors.New("rtcp length exceeds the datagram")
+		}
+		packet := data[:size]
+		data = data[size:]
+		if packet[1] != typeSenderReport && packet[1] != typeReceiverReport {
+			continue
+		}
+		report, err := decodeReport(packet, clockRate)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+func decodeReport(packet []byte, clockRate uint32) (Report, error) {
+	count := int(packet[0] & 0x1F)
+	offset := rtcpHeaderAndSource
+	if packet[1] == typeSenderReport {
+		offset += senderInfoSize
+	}
+	if len(packet) < offset+count*reportBlockSize {
+		return Report{}, errors.New("rtcp report too short")
+	}
+	r := Report{SSRC: binary.BigEndian.Uint32(packet[4:8])}
+	if packet[1] == typeSenderReport {
+		r.SenderReport = &protocol.SenderReport{
+			NTPTimestamp: binary.BigEndian.Uint64(packet[8:16]),
+			PacketCount:  binary.BigEndian.Uint32(packet[20:24]),
+			OctetCount:   binary.BigEndian.Uint32(packet[24:28]),
+		}
+		r.RTPTimestamp = binary.BigEndian.Uint32(packet[16:20])
+	}
+	for i := range count {
+		block := packet[offset+i*reportBlockSize:]
+		// sign extend the 24 bit cumulative lost
+		lost := int32(uint32(block[5])<<24|uint32(block[6])<<16|uint32(block[7])<<8) >> 8
+		var jitter uint64
+		if clockRate > 0 {
+			jitter = uint64(binary.BigEndian.Uint32(block[12:16])) * microsecondsPerSec / uint64(clockRate)
+		}
+		r.Blocks = append(r.Blocks, ReceptionReport{
+			Source: binary.BigEndian.Uint32(block[0:4]),
+			ReceiverReport: protocol.ReceiverReport{
+				FractionLost:     block[4],
+				CumulativeLost:   lost,
+				HighestSequence:  binary.BigEndian.Uint32(block[8:12]),
+				Jitter:           uint32(min(jitter, 1<<32-1)),
+				LastSR:           binary.BigEndian.Uint32(block[16:20]),
+				DelaySinceLastSR: binary.BigEndian.Uint32(block[20:24]),
+			},
+		})
+	}
+	return r, nil
+}
@@ -0,0 +1,162 @@
+// Package RTP contains the translation between voice packets and standard RTP/RTCP
+// It is responsible for packetizing voice frames as RTP and depacketizing RTP into voice frames
+// The payload types are mapped from the codec IDs, the reports are mapped to RTCP SR and RR
+// RTP and RTCP share one port (RFC 5761), so tools like ffmpeg, GStreamer and Wireshark can follow a stream
+package rtp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+// Version is the RTP version of every packet
+const Version = 2
+
+// HeaderSize is the size of the fixed RTP header in bytes
+const HeaderSize = 12
+
+var (
+	errTooShort           = errors.New("rtp packet too short")
+	errVersion            = errors.New("rtp version is not 2")
+	errUnknownPayloadType = errors.New("unknown rtp payload type")
+)
+
+// payloadTypes maps the codecs to the dynamic payload types announced by SDP
+var payloadTypes = map[protocol.Codec]uint8{
+	protocol.CodecL16:  96,
+	protocol.CodecOpus: 111,
+}
+
+// PayloadType returns the RTP payload type of a codec
+// It returns false if the codec has no payload type
+func PayloadType(codec protocol.Codec) (uint8, bool) {
+	pt, ok := payloadTypes[codec]
+	return pt, ok
+}
+
+// CodecOf returns the codec of a RTP payload type
+// It returns false if the payload type is unknown
+func CodecOf(payloadType uint8) (protocol.Codec, bool) {
+	for codec, pt := range payloadTypes {
+		if pt == payloadType {
+			return codec, true
+		}
+	}
+	return protocol.CodecNone, false
+}
+
+// IsRTCP checks if a datagram on a multiplexed port is RTCP (RFC 5761 section 4)
+// The second byte of RTCP is a packet type between 192 and 223, RTP payload types stay below
+func IsRTCP(data []byte) bool {
+	return len(data) >= 2 && data[1] >= 192 && data[1] <= 223
+}
+
+// Packetize encodes a voice frame as RTP packet
+// It returns an error if the codec has no payload type
+//
+// Example:
+//
+//	data, err := rtp.Packetize(voice)
+//	if err != nil {
+//		return err
+//	}
+//	conn.WriteTo(data, addr)
+func Packetize(voice protocol.Voice) ([]byte, error) {
+	return AppendPacketize(make([]byte, 0, HeaderSize+len(voice.Frame)), voice)
+}
+
+// AppendPacketize appends the RTP packet of a voice frame to dst and returns the extended slice
+func AppendPacketize(dst []byte, voice protocol.Voice) ([]byte, error) {
+	pt, ok := PayloadType(voice.Codec)
+	if !ok {
+		return dst, fmt.Errorf("codec %s has no rtp payload type", voice.Codec)
+	}
+	dst = append(dst, Version<<6, pt)
+	dst = binary.BigEndian.AppendUint16(dst, voice.Sequence)
+	dst = binary.BigEndian.AppendUint32(dst, voice.Timestamp)
+	dst = binary.BigEndian.AppendUint32(dst, voice.SSRC)
+	return append(dst, voice.Frame...), nil
+}
+
+// Depacketize decodes a RTP packet into a voice frame
+// CSRCs, header extensions and padding are skipped, the marker bit is ignored
+// The frame points into data
+// It returns an error for malformed packets and unknown payload types
+func Depacketize(data []byte) (protocol.Voice, error) {
+	if len(data) < HeaderSize {
+		return protocol.Voice{}, errTooShort
+	}
+	if data[0]>>6 != Version {
+		return protocol.Voice{}, errVersion
+	}
+	codec, ok := CodecOf(data[1] & 0x7F)
+	if !ok {
+		return protocol.Voice{}, errUnknownPayloadType
+	}
+	end := len(data)
+	if data[0]&0x20 != 0 {
+		// the last byte counts the padding including itself
+		padding := int(data[end-1])
+		if padding == 0 || padding > end-HeaderSize {
+			return protocol.Voice{}, errors.New("invalid rtp padding")
+		}
+		end -= padding
+	}
+	start := HeaderSize + 4*int(data[0]&0x0F)
+	if data[0]&0x10 != 0 {
+		if start+4 > end {
+			return protocol.Voice{}, errTooShort
+		}
+		start += 4 + 4*int(binary.BigEndian.Uint16(data[start+2:start+4]))
+	}
+	if start > end {
+		return protocol.Voice{}, errTooShort
+	}
+	return protocol.Voice{
+		SSRC:      binary.BigEndian.Uint32(data[8:12]),
+		Sequence:  binary.BigEndian.Uint16(data[2:4]),
+		Timestamp: binary.BigEndian.Uint32(data[4:8]),
+		Codec:     codec,
+		Frame:     data[start:end],
+	}, nil
+}
+
+// SDP returns a session description for a stream of the codec sent to addr
+// ffmpeg and GStreamer need it to receive the dynamic payload types
+//
+// Example:
+//
+//	sdp, _ := rtp.SDP(protocol.CodecOpus, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5004})
+//	os.WriteFile("voice.sdp", []byte(sdp), 0o644)
+//	// ffplay -protocol_whitelist file,udp,rtp voice.sdp
+func SDP(codec protocol.Codec, addr *net.UDPAddr) (string, error) {
+	pt, ok := PayloadType(codec)
+	if !ok {
+		return "", fmt.Errorf("codec %s has no rtp payload type", codec)
+	}
+	info, _ := codec.Info()
+	family := "IP4"
+	if addr.IP.To4() == nil {
+		family = "IP6"
+	}
+	// Opus is always announced with two channels (RFC 7587 section 7)
+	channels := 1
+	if codec == protocol.CodecOpus {
+		channels = 2
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "v=0\r\n")
+	fmt.Fprintf(&b, "o=- 0 0 IN %s %s\r\n", family, addr.IP)
+	fmt.Fprintf(&b, "s=aura-speak\r\n")
+	fmt.Fprintf(&b, "c=IN %s %s\r\n", family, addr.IP)
+	fmt.Fprintf(&b, "t=0 0\r\n")
+	fmt.Fprintf(&b, "m=audio %d RTP/AVP %d\r\n", addr.Port, pt)
+	fmt.Fprintf(&b, "a=rtpmap:%d %s/%d/%d\r\n", pt, info.Name, info.ClockRate, channels)
+	fmt.Fprintf(&b, "a=rtcp-mux\r\n")
+	return b.String(), nil
+}
@@ -0,0 +1,200 @@
+package rtp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+var exampleVoice = protocol.Voice{SSRC: 0x1A2B3C4D, Sequence: 0xFFFF, Timestamp: 0x00012C00, Codec: protocol.CodecOpus, Frame: []byte{0xFC, 0xFF, 0xFE}}
+
+func sameVoice(a, b protocol.Voice) bool {
+	return a.SSRC == b.SSRC && a.Sequence == b.Sequence && a.Timestamp == b.Timestamp && a.Codec == b.Codec && bytes.Equal(a.Frame, b.Frame)
+}
+
+func TestPacketizeRoundTrip(t *testing.T) {
+	data, err := Packetize(exampleVoice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// V=2, no padding, extension or CSRC, payload type 111
+	want := []byte{0x80, 111, 0xFF, 0xFF, 0x00, 0x01, 0x2C, 0x00, 0x1A, 0x2B, 0x3C, 0x4D, 0xFC, 0xFF, 0xFE}
+	if !bytes.Equal(data, want) {
+		t.Fatalf("packetized % x, want % x", data, want)
+	}
+	got, err := Depacketize(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameVoice(got, exampleVoice) {
+		t.Fatalf("depacketized %+v, want %+v", got, exampleVoice)
+	}
+}
+
+func TestPacketizeUnknownCodec(t *testing.T) {
+	if _, err := Packetize(protocol.Voice{Codec: protocol.CodecNone}); err == nil {
+		t.Fatal("codec without payload type packetized")
+	}
+}
+
+func TestDepacketizeSkipsOptionalParts(t *testing.T) {
+	data, _ := Packetize(exampleVoice)
+	header, frame := data[:HeaderSize], data[HeaderSize:]
+
+	// marker bit, two CSRCs, one word of header extension and three bytes of padding
+	packet := append([]byte{}, header...)
+	packet[0] |= 0x20 | 0x10 | 2
+	packet[1] |= 0x80
+	packet = append(packet, 0, 0, 0, 1, 0, 0, 0, 2)
+	packet = append(packet, 0xBE, 0xDE, 0x00, 0x01, 0x10, 0xAA, 0x00, 0x00)
+	packet = append(packet, frame...)
+	packet = append(packet, 0, 0, 3)
+
+	got, err := Depacketize(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameVoice(got, exampleVoice) {
+		t.Fatalf("depacketized %+v, want %+v", got, exampleVoice)
+	}
+}
+
+func TestDepacketizeRejects(t *testing.T) {
+	data, _ := Packetize(exampleVoice)
+	version1 := append([]byte{}, data...)
+	version1[0] = 0x40
+	unknownType := append([]byte{}, data...)
+	unknownType[1] = 0
+	padding := append([]byte{}, data...)
+	padding[0] |= 0x20
+	padding[len(padding)-1] = 0xFF
+	csrc := append([]byte{}, data[:HeaderSize]...)
+	csrc[0] |= 0x0F
+	extension := append([]byte{}, data[:HeaderSize]...)
+	extension[0] |= 0x10
+	extension = append(extension, 0xBE, 0xDE, 0xFF, 0xFF)
+
+	tests := map[string][]byte{
+		"too short":            data[:HeaderSize-1],
+		"version 1":            version1,
+		"unknown payload type": unknownType,
+		"padding too long":     padding,
+		"csrc past the end":    csrc,
+		"extension too long":   extension,
+	}
+	for name, data := range tests {
+		if _, err := Depacketize(data); err == nil {
+			t.Errorf("%s: depacketized", name)
+		}
+	}
+}
+
+func TestPayloadTypes(t *testing.T) {
+	for _, codec := range []protocol.Codec{protocol.CodecL16, protocol.CodecOpus} {
+		pt, ok := PayloadType(codec)
+		if !ok || pt < 96 || pt > 127 {
+			t.Errorf("codec %s has payload type %d, want a dynamic one", codec, pt)
+		}
+		if got, ok := CodecOf(pt); !ok || got != codec {
+			t.Errorf("payload type %d maps to %s, want %s", pt, got, codec)
+		}
+	}
+}
+
+func TestIsRTCP(t *testing.T) {
+	data, _ := Packetize(exampleVoice)
+	if IsRTCP(data) {
+		t.Error("RTP classified as RTCP")
+	}
+	// the marker bit does not make a RTP packet RTCP
+	data[1] |= 0x80
+	if IsRTCP(data) {
+		t.Error("RTP with marker classified as RTCP")
+	}
+	if !IsRTCP(AppendReport(nil, Report{SSRC: 1}, 48000)) {
+		t.Error("RTCP not classified")
+	}
+}
+
+func TestSenderReportRoundTrip(t *testing.T) {
+	sr := protocol.SenderReport{NTPTimestamp: 0xEA1B2C3D_80000000, PacketCount: 250, OctetCount: 40000}
+	block := ReceptionReport{Source: 7, ReceiverReport: protocol.ReceiverReport{
+		HighestSequence: 0x1FFFF, CumulativeLost: -2, FractionLost: 12, Jitter: 2000, LastSR: 0x2C3D8000, DelaySinceLastSR: 0x8000,
+	}}
+	data := AppendReport(nil, Report{SSRC: 42, SenderReport: &sr, RTPTimestamp: 960, Blocks: []ReceptionReport{block}}, 48000)
+	if len(data) != 8+20+24 || data[1] != typeSenderReport || data[0]&0x1F != 1 {
+		t.Fatalf("unexpected SR header % x", data[:4])
+	}
+	if words := binary.BigEndian.Uint16(data[2:4]); int(words+1)*4 != len(data) {
+		t.Fatalf("length field %d for %d bytes", words, len(data))
+	}
+	// 2ms at 48kHz are 96 timestamp units
+	if jitter := binary.BigEndian.Uint32(data[28+12 : 28+16]); jitter != 96 {
+		t.Fatalf("jitter %d timestamp units, want 96", jitter)
+	}
+
+	reports, err := DecodeReports(data, 48000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("%d reports, want 1", len(reports))
+	}
+	got := reports[0]
+	if got.SSRC != 42 || got.SenderReport == nil || *got.SenderReport != sr || got.RTPTimestamp != 960 {
+		t.Fatalf("decoded %+v", got)
+	}
+	if len(got.Blocks) != 1 || got.Blocks[0] != block {
+		t.Fatalf("decoded blocks %+v, want %+v", got.Blocks, block)
+	}
+}
+
+func TestReceiverReportInCompound(t *testing.T) {
+	block := ReceptionReport{Source: 7, ReceiverReport: protocol.ReceiverReport{CumulativeLost: 1 << 30}}
+	data := AppendReport(nil, Report{SSRC: 42, Blocks: []ReceptionReport{block}}, 48000)
+	// a SDES with an empty chunk follows like in packets of other tools
+	data = append(data, 0x81, 202, 0x00, 0x01, 0x00, 0x00, 0x00, 42)
+
+	reports, err := DecodeReports(data, 48000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || reports[0].SenderReport != nil || len(reports[0].Blocks) != 1 {
+		t.Fatalf("decoded %+v", reports)
+	}
+	// the cumulative lost is limited to 24 bits
+	if lost := reports[0].Blocks[0].CumulativeLost; lost != 1<<23-1 {
+		t.Fatalf("cumulative lost %d, want %d", lost, 1<<23-1)
+	}
+}
+
+func TestDecodeReportsRejects(t *testing.T) {
+	data := AppendReport(nil, Report{SSRC: 42, Blocks: []ReceptionReport{{Source: 7}}}, 48000)
+	tests := map[string][]byte{
+		"truncated header":     data[:3],
+		"length past the end":  data[:len(data)-4],
+		"version 1":            append([]byte{0x41}, data[1:]...),
+		"block count too high": append([]byte{0x82}, data[1:]...),
+	}
+	for name, data := range tests {
+		if _, err := DecodeReports(data, 48000); err == nil {
+			t.Errorf("%s: decoded", name)
+		}
+	}
+}
+
+func TestSDP(t *testing.T) {
+	sdp, err := SDP(protocol.CodecOpus, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5004})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"c=IN IP4 127.0.0.1", "m=audio 5004 RTP/AVP 111", "a=rtpmap:111 opus/48000/2", "a=rtcp-mux"} {
+		if !strings.Contains(sdp, line+"\r\n") {
+			t.Errorf("sdp misses %q:\n%s", line, sdp)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/aura-speak/networking/internal/config"
+	"github.com/aura-speak/networking/pkg/auth"
+	"github.com/aura-speak/networking/pkg/floor"
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/router"
+	log "github.com/sirupsen/logrus"
+)
+
+// channelMap is the channel membership of the sessions
+// A session is in at most one channel
+type channelMap struct {
+	mu      sync.RWMutex
+	of      map[string]string              // remote addr -> channel
+	members map[string]map[string]struct{} // channel -> remote addrs
+}
+
+func newChannelMap() *channelMap {
+	return &channelMap{of: make(map[string]string), members: make(map[string]map[string]struct{})}
+}
+
+// join moves a remote into a channel and returns the channel it left, empty if it was in none
+func (c *channelMap) join(key, channel string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	previous := c.removeLocked(key)
+	c.of[key] = channel
+	if c.members[channel] == nil {
+		c.members[channel] = make(map[string]struct{})
+	}
+	c.members[channel][key] = struct{}{}
+	return previous
+}
+
+// leave removes a remote from its channel and returns the channel, empty if it was in none
+func (c *channelMap) leave(key string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.removeLocked(key)
+}
+
+func (c *channelMap) removeLocked(key string) string {
+	channel, ok := c.of[key]
+	if !ok {
+		return ""
+	}
+	delete(c.of, key)
+	delete(c.members[channel], key)
+	if len(c.members[channel]) == 0 {
+		delete(c.members, channel)
+	}
+	return channel
+}
+
+// channel returns the channel of a remote
+func (c *channelMap) channel(key string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	channel, ok := c.of[key]
+	return channel, ok
+}
+
+// in tells if a remote is a member of a channel
+func (c *channelMap) in(key, channel string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.members[channel][key]
+	return ok
+}
+
+// list returns the members of a channel
+func (c *channelMap) list(channel string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	keys := make([]string, 0, len(c.members[channel]))
+	for key := range c.members[channel] {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (c *channelMap) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.of)
+	clear(c.members)
+}
+
+// Channel returns the channel a client joined
+//
+// Example:
+//
+//	server.OnPacket(protocol.PacketTypeDebugAny, func(packet *protocol.Packet, clientAddr string) error {
+//		if channel, ok := server.Channel(clientAddr); ok {
+//			fmt.Println("Packet from channel:", channel)
+//		}
+//		return nil
+//	})
+func (s *Server) Channel(clientAddr string) (string, bool) {
+	return s.channels.channel(clientAddr)
+}
+
+// Members returns the addresses of the clients in a channel
+func (s *Server) Members(channel string) []string {
+	return s.channels.list(channel)
+}
+
+// handleChannelJoin moves the client into the channel of the payload
+// The route requires auth.PermissionListen in the channel, a floor held in the previous channel is released
+func (s *Server) handleChannelJoin(packet *protocol.Packet, clientAddr string) error {
+	if err := protocol.ValidChannelName(packet.Payload); err != nil {
+		return err
+	}
+	channel := string(packet.Payload)
+	if previous := s.channels.join(clientAddr, channel); previous != "" && previous != channel {
+		s.left(previous, clientAddr)
+	}
+	log.WithFields(log.Fields{"caller": "server", "remote": clientAddr, "channel": channel}).Info("Client joined channel")
+	return s.sendTo(clientAddr, protocol.PacketTypeChannelJoin, []byte(channel))
+}
+
+// handleChannelLeave removes the client from its channel
+func (s *Server) handleChannelLeave(packet *protocol.Packet, clientAddr string) error {
+	s.leaveChannel(clientAddr)
+	return s.sendTo(clientAddr, protocol.PacketTypeChannelLeave, nil)
+}
+
+// leaveChannel removes a remote from its channel
+func (s *Server) leaveChannel(key string) {
+	if channel := s.channels.leave(key); channel != "" {
+		s.left(channel, key)
+	}
+}
+
+// left releases the floor and drops the buffered voice of a remote that left a channel
+// The remaining members learn it with a key message, so they ratchet their end-to-end encryption keys
+func (s *Server) left(channel, key string) {
+	s.floors.Release(channel, key)
+	if m, ok := s.mixer(channel); ok {
+		m.Remove(key)
+	}
+	s.sendLeft(channel, s.ssrcOf(key))
+}
+
+// handleFloorRequest asks for the floor of the channel of the client
+// Requesting requires auth.PermissionSpeak in the channel, auth.PermissionPrioritySpeaker preempts other talkers
+func (s *Server) handleFloorRequest(packet *protocol.Packet, clientAddr string) error {
+	channel, ok := s.channels.channel(clientAddr)
+	if !ok {
+		return s.sendFloor(clientAddr, protocol.PacketTypeFloorDeny, protocol.Floor{Reason: protocol.FloorReasonNotInChannel})
+	}
+	if !s.Allowed(clientAddr, channel, auth.PermissionSpeak) {
+		return &router.PermissionDeniedError{PacketType: protocol.PacketTypeFloorRequest, Permission: auth.PermissionSpeak, Channel: channel}
+	}
+	if !s.floors.Controlled(channel) {
+		return s.sendFloor(clientAddr, protocol.PacketTypeFloorDeny, protocol.Floor{Reason: protocol.FloorReasonOpen})
+	}
+	priority := floor.PriorityNormal
+	if s.Allowed(clientAddr, channel, auth.PermissionPrioritySpeaker) {
+		priority = floor.PriorityHigh
+	}
+	s.floors.Request(channel, clientAddr, priority)
+	return nil
+}
+
+// handleFloorRelease gives the floor back or withdraws a waiting request
+func (s *Server) handleFloorRelease(packet *protocol.Packet, clientAddr string) error {
+	if channel, ok := s.channels.channel(clientAddr); ok {
+		s.floors.Release(channel, clientAddr)
+	}
+	return nil
+}
+
+// floorEvents turns the events of the floor control into packets
+// Grants, releases and revokes go to every member of the channel, the queue position only to the waiting client
+func (s *Server) floorEvents(channel string, events []floor.Event) {
+	for _, e := range events {
+		payload := protocol.Floor{SSRC: s.ssrcOf(e.Key)}
+		switch e.Kind {
+		case floor.Granted:
+			payload.MaxTalkMs = uint32(s.floors.MaxTalk(channel).Milliseconds())
+			s.sendChannel(channel, protocol.PacketTypeFloorGrant, payload)
+		case floor.Released:
+			s.sendChannel(channel, protocol.PacketTypeFloorRelease, payload)
+		case floor.Revoked:
+			payload.Reason = floorReasons[e.Reason]
+			s.sendChannel(channel, protocol.PacketTypeFloorRevoke, payload)
+			// a client that left the channel still learns that it lost the floor
+			if !s.channels.in(e.Key, channel) {
+				s.sendFloor(e.Key, protocol.PacketTypeFloorRevoke, payload)
+			}
+		case floor.Queued:
+			payload.Reason, payload.Position = protocol.FloorReasonQueued, uint8(min(e.Position, 255))
+			s.sendFloor(e.Key, protocol.PacketTypeFloorDeny, payload)
+		case floor.Denied:
+			payload.Reason = protocol.FloorReasonQueueFull
+			s.sendFloor(e.Key, protocol.PacketTypeFloorDeny, payload)
+		}
+	}
+}
+
+var floorReasons = map[floor.Reason]protocol.FloorReason{
+	floor.ReasonNone:      protocol.FloorReasonNone,
+	floor.ReasonPreempted: protocol.FloorReasonPreempted,
+	floor.ReasonTimeout:   protocol.FloorReasonTimeout,
+}
+
+// ssrcOf returns the SSRC of a session, 0 if the session is gone
+func (s *Server) ssrcOf(key string) uint32 {
+	if session, ok := s.Session(key); ok {
+		return session.SSRC
+	}
+	return 0
+}
+
+// sendFloor sends a floor packet to one client
+func (s *Server) sendFloor(key string, packetType protocol.PacketType, payload protocol.Floor) error {
+	return s.sendTo(key, packetType, payload.Encode())
+}
+
+// sendChannel sends a floor packet to every member of a channel
+func (s *Server) sendChannel(channel string, packetType protocol.PacketType, payload protocol.Floor) {
+	packet := &protocol.Packet{PacketHeader: protocol.Header{PacketType: packetType}, Payload: payload.Encode()}
+	s.send(packet.Encode(), func(key string) bool { return s.channels.in(key, channel) })
+}
+
+// sendTo sends a packet to one client
+func (s *Server) sendTo(key string, packetType protocol.PacketType, payload []byte) error {
+	v, ok := s.remoteConns.Load(key)
+	if !ok {
+		return errors.New("no connection to " + key)
+	}
+	addr := v.(*net.UDPAddr)
+	packet := &protocol.Packet{PacketHeader: protocol.Header{PacketType: packetType}, Payload: payload}
+	data := packet.Encode()
+	if _, err := s.conn.WriteTo(data, addr); err != nil {
+		return err
+	}
+	s.sent(key, addr, data)
+	return nil
+}
+
+// configureChannels applies the channels of a new config to the floor control and the mixers
+// previous are the channels of the config before, nil when the Server starts
+// The caller has to hold channelsMu
+func (s *Server) configureChannels(previous, channels map[string]config.ChannelConfig) {
+	if s.floors == nil {
+		// the Server does not run yet, Run configures the channels of the current config
+		return
+	}
+	s.configureFloors(previous, channels)
+	s.configureMixers(channels)
+}
+
+// configureFloors puts the channels with floor control of the config under the floor control of the Server
+// Channels of the previous config that lost their floor control are released, so everybody may talk there again
+func (s *Server) configureFloors(previous, channels map[string]config.ChannelConfig) {
+	for name, channel := range previous {
+		if channel.Floor && !channels[name].Floor {
+			s.floors.Remove(name)
+			log.WithFields(log.Fields{"caller": "server", "channel": name}).Info("Removed floor control of channel")
+		}
+	}
+	for name, channel := range channels {
+		if channel.Floor {
+			s.floors.Configure(name, floor.Config{MaxTalk: channel.MaxTalk, QueueSize: channel.QueueSize})
+		}
+	}
+}
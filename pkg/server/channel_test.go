@@ -0,0 +1,175 @@
+package server_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/internal/config"
+	"github.com/aura-speak/networking/pkg/auth"
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/testkit"
+)
+
+// startChannels starts a Server with the floor controlled channel "radio" where guests may speak
+func startChannels(t *testing.T) *testkit.Harness {
+	t.Helper()
+	cfg := &config.Default().ServerConfig
+	cfg.Server.DTLS.Path = t.TempDir() + "/"
+	cfg.Server.Channels = map[string]config.ChannelConfig{"radio": {Floor: true}}
+	h := testkit.Start(t, testkit.Options{Config: cfg})
+	h.Server.Policy.SetRole(auth.RoleGuest, auth.PermissionSpeak|auth.PermissionListen)
+	return h
+}
+
+func join(t *testing.T, c *testkit.Client, channel string) {
+	t.Helper()
+	if err := c.JoinChannel(channel); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(c.ExpectPacket(protocol.PacketTypeChannelJoin, 0).Payload); got != channel {
+		t.Fatalf("joined %q, want %q", got, channel)
+	}
+}
+
+func expectFloor(t *testing.T, c *testkit.Client, packetType protocol.PacketType) protocol.Floor {
+	t.Helper()
+	floor, err := protocol.DecodeFloor(c.ExpectPacket(packetType, 0).Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return floor
+}
+
+func TestVoiceStaysInChannel(t *testing.T) {
+	h := startChannels(t)
+	clients := h.ConnectN(3)
+	alice, bob, carol := clients[0], clients[1], clients[2]
+	join(t, alice, "lobby")
+	join(t, bob, "lobby")
+	join(t, carol, "other")
+
+	if err := alice.SendVoice(protocol.CodecOpus, 960, []byte{0xFC}); err != nil {
+		t.Fatal(err)
+	}
+	voice, err := protocol.DecodeVoice(bob.ExpectPacket(protocol.PacketTypeVoice, 0).Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if voice.SSRC != alice.SSRC() || alice.SSRC() == 0 {
+		t.Fatalf("voice with SSRC %08x, want %08x", voice.SSRC, alice.SSRC())
+	}
+	carol.ExpectNoPacket(protocol.PacketTypeVoice, 100*time.Millisecond)
+	alice.ExpectNoPacket(protocol.PacketTypeVoice, 0)
+
+	if err := alice.RequestFloor(); err != nil {
+		t.Fatal(err)
+	}
+	if deny := expectFloor(t, alice, protocol.PacketTypeFloorDeny); deny.Reason != protocol.FloorReasonOpen {
+		t.Fatalf("floor of an uncontrolled channel denied with %s", deny.Reason)
+	}
+}
+
+func TestFloorControl(t *testing.T) {
+	h := startChannels(t)
+	clients := h.ConnectN(2)
+	alice, bob := clients[0], clients[1]
+	join(t, alice, "radio")
+	join(t, bob, "radio")
+
+	// without the floor the voice is dropped
+	alice.SendVoice(protocol.CodecOpus, 960, []byte{0xFC})
+	bob.ExpectNoPacket(protocol.PacketTypeVoice, 100*time.Millisecond)
+
+	alice.RequestFloor()
+	for _, c := range clients {
+		if grant := expectFloor(t, c, protocol.PacketTypeFloorGrant); grant.SSRC != alice.SSRC() {
+			t.Fatalf("floor granted to %08x, want %08x", grant.SSRC, alice.SSRC())
+		}
+	}
+	bob.RequestFloor()
+	if deny := expectFloor(t, bob, protocol.PacketTypeFloorDeny); deny.Reason != protocol.FloorReasonQueued || deny.Position != 1 {
+		t.Fatalf("second request denied with %s at %d, want queued at 1", deny.Reason, deny.Position)
+	}
+
+	alice.SendVoice(protocol.CodecOpus, 1920, []byte{0xFC})
+	bob.ExpectPacket(protocol.PacketTypeVoice, 0)
+	bob.SendVoice(protocol.CodecOpus, 960, []byte{0xFC})
+	alice.ExpectNoPacket(protocol.PacketTypeVoice, 100*time.Millisecond)
+
+	alice.ReleaseFloor()
+	if release := expectFloor(t, bob, protocol.PacketTypeFloorRelease); release.SSRC != alice.SSRC() {
+		t.Fatalf("floor of %08x released, want %08x", release.SSRC, alice.SSRC())
+	}
+	if grant := expectFloor(t, bob, protocol.PacketTypeFloorGrant); grant.SSRC != bob.SSRC() {
+		t.Fatalf("floor granted to %08x, want %08x", grant.SSRC, bob.SSRC())
+	}
+}
+
+func TestGuestsSpeakWithoutAuthentication(t *testing.T) {
+	// the default config has no authentication, every client is a guest
+	h := testkit.Start(t, testkit.Options{})
+	clients := h.ConnectN(2)
+	alice, bob := clients[0], clients[1]
+	join(t, alice, "lobby")
+	join(t, bob, "lobby")
+
+	if err := alice.SendVoice(protocol.CodecOpus, 960, []byte{0xFC}); err != nil {
+		t.Fatal(err)
+	}
+	bob.ExpectPacket(protocol.PacketTypeVoice, 0)
+	alice.ExpectNoPacket(protocol.PacketTypeError, 0)
+}
+
+func TestFloorRequiresChannel(t *testing.T) {
+	h := startChannels(t)
+	alice := h.Connect()
+	alice.RequestFloor()
+	if deny := expectFloor(t, alice, protocol.PacketTypeFloorDeny); deny.Reason != protocol.FloorReasonNotInChannel {
+		t.Fatalf("floor outside of a channel denied with %s", deny.Reason)
+	}
+
+	// guests of the default policy only listen
+	h.Server.Policy.SetRole(auth.RoleGuest, auth.PermissionListen)
+	join(t, alice, "radio")
+	alice.RequestFloor()
+	reply, err := protocol.DecodeErrorReply(alice.ExpectPacket(protocol.PacketTypeError, 0).Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Code != protocol.ErrorCodePermissionDenied || reply.PacketType != protocol.PacketTypeFloorRequest {
+		t.Fatalf("error reply %+v, want permission denied for the floor request", reply)
+	}
+}
+
+func TestPermissionsInChannel(t *testing.T) {
+	h := startChannels(t)
+	// guests may speak server wide, but only listen on "stage"
+	h.Server.Policy.SetChannel("stage", auth.RoleGuest, auth.PermissionListen)
+	clients := h.ConnectN(2)
+	alice, bob := clients[0], clients[1]
+	join(t, alice, "stage")
+	join(t, bob, "stage")
+
+	if err := alice.SendVoice(protocol.CodecOpus, 960, []byte{0xFC}); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := protocol.DecodeErrorReply(alice.ExpectPacket(protocol.PacketTypeError, 0).Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Code != protocol.ErrorCodePermissionDenied || reply.PacketType != protocol.PacketTypeVoice {
+		t.Fatalf("error reply %+v, want permission denied for the voice", reply)
+	}
+	bob.ExpectNoPacket(protocol.PacketTypeVoice, 100*time.Millisecond)
+
+	// a channel override that takes the listen permission keeps guests out
+	h.Server.Policy.SetChannel("backstage", auth.RoleGuest, auth.PermissionNone)
+	alice.JoinChannel("backstage")
+	reply, err = protocol.DecodeErrorReply(alice.ExpectPacket(protocol.PacketTypeError, 0).Payload)
+	if err != nil || reply.PacketType != protocol.PacketTypeChannelJoin {
+		t.Fatalf("error reply %+v, %v, want permission denied for the join", reply, err)
+	}
+	if channel, _ := h.Server.Channel(alice.LocalAddr().String()); channel != "stage" {
+		t.Fatalf("client in %q after a denied join", channel)
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/clock"
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+// DefaultCookieRotation is the default interval after which the cookie secret is replaced
+const DefaultCookieRotation = 2 * time.Minute
+
+// cookieJar creates and verifies the stateless cookies of the connect handshake
+// A cookie is a HMAC of the remote address, so the Server does not have to remember it
+// The secret is rotated periodically, cookies of the previous secret stay valid for one more interval
+type cookieJar struct {
+	mu       sync.RWMutex
+	current  []byte
+	previous []byte
+}
+
+// newCookieJar creates a new cookieJar with a random secret
+func newCookieJar() *cookieJar {
+	return &cookieJar{
+		current: newCookieSecret(),
+	}
+}
+
+func newCookieSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic("crypto/rand failed: " + err.Error())
+	}
+	return secret
+}
+
+// rotate replaces the secret, the current one becomes the previous
+func (j *cookieJar) rotate() {
+	secret := newCookieSecret()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.previous = j.current
+	j.current = secret
+}
+
+// newCookieRotation returns the ticker of the cookie rotation on the Clock of the Server
+// It is nil if CookieRotation is zero, the secret is kept then
+func (s *Server) newCookieRotation() clock.Ticker {
+	if s.CookieRotation <= 0 {
+		return nil
+	}
+	return s.Clock.NewTicker(s.CookieRotation)
+}
+
+// cookieLoop rotates the cookie secret on every tick until the context is done and stops the ticker
+func (s *Server) cookieLoop(ctx context.Context, ticker clock.Ticker) {
+	if ticker == nil {
+		return
+	}
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			s.cookies.rotate()
+		}
+	}
+}
+
+// cookie returns the cookie for the remote address with the current secret
+func (j *cookieJar) cookie(addr *net.UDPAddr) []byte {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return cookieFor(j.current, addr)
+}
+
+// verify checks the cookie of the remote address against the current and the previous secret
+func (j *cookieJar) verify(addr *net.UDPAddr, cookie []byte) bool {
+	if len(cookie) != protocol.CookieSize {
+		return false
+	}
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if hmac.Equal(cookie, cookieFor(j.current, addr)) {
+		return true
+	}
+	return j.previous != nil && hmac.Equal(cookie, cookieFor(j.previous, addr))
+}
+
+func cookieFor(secret []byte, addr *net.UDPAddr) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(addr.IP.To16())
+	mac.Write([]byte{byte(addr.Port >> 8), byte(addr.Port)})
+	return mac.Sum(nil)[:protocol.CookieSize]
+}
@@ -3,35 +3,55 @@ package server
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
-	"os"
+	"net"
+	"path/filepath"
+	"time"
 
 	"github.com/aura-speak/networking/internal/config"
+	"github.com/aura-speak/networking/pkg/auth"
+	"github.com/aura-speak/networking/pkg/certs"
+	"github.com/aura-speak/networking/pkg/transport"
 	"github.com/pion/dtls/v3"
 )
 
-func NewDTLSServerMTLConfig(cfg *config.ServerConfig) (*dtls.Config, error) {
-	cert, err := tls.LoadX509KeyPair(
-		fmt.Sprintf("%s/%s", cfg.Server.DTLS.Path, cfg.Server.DTLS.Cert),
-		fmt.Sprintf("%s/%s", cfg.Server.DTLS.Path, cfg.Server.DTLS.Key),
-	)
-	if err != nil {
-		return nil, err
-	}
+// DTLS modes of the server config
+const (
+	DTLSModeMTLS = "mtls"
+	DTLSModePSK  = "psk"
+)
+
+// Transports of the server config
+const (
+	TransportUDP  = "udp"
+	TransportDTLS = "dtls"
+)
 
-	caPam, err := os.ReadFile(fmt.Sprintf("%s/%s", cfg.Server.DTLS.Path, cfg.Server.DTLS.CA))
+// PSKIdentityHint is the identity hint the Server sends in the PSK mode
+var PSKIdentityHint = []byte("aura-speak")
+
+// NewDTLSServerMTLConfig loads the certificates from config and creates a DTLS config with mutual TLS
+// The certificates are not reloaded, use NewDTLSConfig with a watched certs.Provider for that
+func NewDTLSServerMTLConfig(cfg *config.ServerConfig) (*dtls.Config, error) {
+	provider, err := certs.NewProvider(certOptions(cfg))
 	if err != nil {
 		return nil, err
 	}
-	clientCAs := x509.NewCertPool()
-	if !clientCAs.AppendCertsFromPEM(caPam) {
-		return nil, err
-	}
+	return NewDTLSConfig(provider), nil
+}
 
+// NewDTLSConfig creates a DTLS config with mutual TLS that takes the certificates from the provider
+// Every handshake uses the currently loaded server certificate and CA
+// Client certificates are checked against the CRL and the denylist of the provider
+func NewDTLSConfig(provider *certs.Provider) *dtls.Config {
 	return &dtls.Config{
-		Certificates: []tls.Certificate{cert},
-		ClientAuth:   dtls.RequireAndVerifyClientCert,
-		ClientCAs:    clientCAs,
+		GetCertificate: func(*dtls.ClientHelloInfo) (*tls.Certificate, error) {
+			return provider.GetCertificate()
+		},
+		// the chain is verified by the provider against the current CA
+		ClientAuth:            dtls.RequireAnyClientCert,
+		VerifyPeerCertificate: provider.VerifyClient,
 
 		CipherSuites: []dtls.CipherSuiteID{
 			dtls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
@@ -40,5 +60,156 @@ func NewDTLSServerMTLConfig(cfg *config.ServerConfig) (*dtls.Config, error) {
 		},
 
 		MTU: 1200,
+	}
+}
+
+// NewDTLSServerPSKConfig creates a DTLS config that authenticates clients with the pre-shared keys of the store
+// Clients send their PSK identity in the handshake, unknown and disabled identities fail the handshake
+func NewDTLSServerPSKConfig(store *auth.PSKStore) *dtls.Config {
+	return &dtls.Config{
+		PSK:             store.Key,
+		PSKIdentityHint: PSKIdentityHint,
+		CipherSuites: []dtls.CipherSuiteID{
+			dtls.TLS_PSK_WITH_AES_128_GCM_SHA256,
+			dtls.TLS_PSK_WITH_AES_128_CCM,
+		},
+
+		MTU: 1200,
+	}
+}
+
+// DTLSConfig returns the DTLS config for the configured mode
+// It returns an error if the certificates or the PSK keyfile could not be loaded
+func (s *Server) DTLSConfig() (*dtls.Config, error) {
+	switch s.dtlsMode {
+	case DTLSModePSK:
+		if s.psks == nil {
+			return nil, errors.New("psk keyfile is not loaded")
+		}
+		return NewDTLSServerPSKConfig(s.psks), nil
+	default:
+		if s.certs == nil {
+			return nil, errors.New("certificates are not loaded")
+		}
+		return NewDTLSConfig(s.certs), nil
+	}
+}
+
+// DTLSTransport returns a DTLS transport on top of inner in the configured mode, inner is UDP if nil
+// The identity of every completed handshake is stored with SetPeerIdentity, so the connect handshake uses it
+// and it is removed again when the DTLS connection is closed
+// Banned and rate limited IPs get no handshake state
+//
+// Example:
+//
+//	t, err := srv.DTLSTransport(transport.NewMemory())
+//	if err != nil {
+//		return err
+//	}
+//	srv.Transport = t
+func (s *Server) DTLSTransport(inner transport.Transport) (*transport.DTLS, error) {
+	cfg, err := s.DTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &transport.DTLS{
+		Config: cfg,
+		Inner:  inner,
+		Clock:  s.Clock,
+		OnHandshake: func(conn *dtls.Conn) error {
+			state, ok := conn.ConnectionState()
+			if !ok {
+				return errors.New("no connection state")
+			}
+			identity, err := s.DTLSPeerIdentity(&state)
+			if err != nil {
+				return err
+			}
+			s.SetPeerIdentity(conn.RemoteAddr().String(), identity)
+			return nil
+		},
+		OnClose: func(remote net.Addr) {
+			s.SetPeerIdentity(remote.String(), nil)
+		},
+		Admit: s.admitHandshake,
 	}, nil
 }
+
+// DTLSPeerIdentity returns the session identity of a completed DTLS handshake
+// In the PSK mode it is the identity mapped to the PSK identity of the client
+// In the mTLS mode it is the identity of the client certificate
+func (s *Server) DTLSPeerIdentity(state *dtls.State) (*auth.Identity, error) {
+	if len(state.IdentityHint) > 0 {
+		if s.psks == nil {
+			return nil, errors.New("psk handshake without psk keyfile")
+		}
+		return s.psks.Identity(state.IdentityHint)
+	}
+	if len(state.PeerCertificates) == 0 {
+		return nil, errors.New("no peer certificate")
+	}
+	cert, err := x509.ParseCertificate(state.PeerCertificates[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse peer certificate: %w", err)
+	}
+	return auth.CertificateIdentity(cert)
+}
+
+// SetPeerIdentity stores the identity a transport authenticated for a remote address
+// The connect handshake of the remote uses this identity instead of checking a credential
+// A nil identity removes the stored identity
+//
+// Example:
+//
+//	state, _ := dtlsConn.ConnectionState()
+//	identity, err := server.DTLSPeerIdentity(&state)
+//	if err == nil {
+//		server.SetPeerIdentity(dtlsConn.RemoteAddr().String(), identity)
+//	}
+func (s *Server) SetPeerIdentity(clientAddr string, identity *auth.Identity) {
+	if identity == nil {
+		s.peerIdentities.Delete(clientAddr)
+		return
+	}
+	s.peerIdentities.Store(clientAddr, identity)
+}
+
+// peerIdentity returns the identity a transport authenticated for a remote address
+func (s *Server) peerIdentity(clientAddr string) *auth.Identity {
+	if v, ok := s.peerIdentities.Load(clientAddr); ok {
+		return v.(*auth.Identity)
+	}
+	return nil
+}
+
+// certOptions returns the provider options from config
+func certOptions(cfg *config.ServerConfig) certs.Options {
+	dir := cfg.Server.DTLS.Path
+	opts := certs.Options{
+		CertFile:   filepath.Join(dir, cfg.Server.DTLS.Cert),
+		KeyFile:    filepath.Join(dir, cfg.Server.DTLS.Key),
+		CAFile:     filepath.Join(dir, cfg.Server.DTLS.CA),
+		WarnBefore: time.Duration(cfg.Server.DTLS.ExpiryWarningDays) * 24 * time.Hour,
+	}
+	if cfg.Server.DTLS.CRL != "" {
+		opts.CRLFile = filepath.Join(dir, cfg.Server.DTLS.CRL)
+	}
+	if cfg.Server.DTLS.Denylist != "" {
+		opts.DenylistFile = filepath.Join(dir, cfg.Server.DTLS.Denylist)
+	}
+	return opts
+}
+
+// CertStatus returns the loaded certificates and the expiry warnings
+// It returns false if the certificates could not be loaded
+func (s *Server) CertStatus() (certs.Status, bool) {
+	if s.certs == nil {
+		return certs.Status{}, false
+	}
+	return s.certs.Status(), true
+}
+
+// newPSKStore loads the PSK keyfile from config
+func newPSKStore(cfg *config.ServerConfig) (*auth.PSKStore, error) {
+	return auth.NewPSKStore(filepath.Join(cfg.Server.DTLS.Path, cfg.Server.DTLS.PSKFile))
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+// handleKeyMessage relays an end-to-end encryption key message to members of the channel of the client
+// The Server only reads the routing header and replaces the sender SSRC with the SSRC of the session,
+// the body stays opaque, see pkg/e2ee
+// The route requires auth.PermissionListen in the channel, a member that may not listen gets no keys
+func (s *Server) handleKeyMessage(packet *protocol.Packet, clientAddr string) error {
+	session, ok := s.Session(clientAddr)
+	if !ok {
+		return stateError("key message from " + clientAddr + " without session")
+	}
+	channel, ok := s.channels.channel(clientAddr)
+	if !ok {
+		return stateError("key message from " + clientAddr + " outside of a channel")
+	}
+	message, err := protocol.DecodeKeyMessage(packet.Payload)
+	if err != nil {
+		return err
+	}
+	// the payload is the receive buffer of the Server, it may be changed in place
+	protocol.SetKeyMessageFrom(packet.Payload, session.SSRC)
+	data := packet.Encode()
+	s.send(data, func(key string) bool {
+		if key == clientAddr || !s.channels.in(key, channel) {
+			return false
+		}
+		return message.To == 0 || s.ssrcOf(key) == message.To
+	})
+	return nil
+}
+
+// sendLeft tells the remaining members of a channel that a member left, so they ratchet their sender keys
+func (s *Server) sendLeft(channel string, ssrc uint32) {
+	if ssrc == 0 {
+		return
+	}
+	message := &protocol.KeyMessage{From: ssrc}
+	packet := &protocol.Packet{PacketHeader: protocol.Header{PacketType: protocol.PacketTypeKeyMessage}, Payload: message.Encode()}
+	s.send(packet.Encode(), func(key string) bool { return s.channels.in(key, channel) })
+}
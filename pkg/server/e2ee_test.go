@@ -0,0 +1,118 @@
+package server_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/e2ee"
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/testkit"
+)
+
+func expectKeyMessage(t *testing.T, c *testkit.Client) protocol.KeyMessage {
+	t.Helper()
+	message, err := protocol.DecodeKeyMessage(c.ExpectPacket(protocol.PacketTypeKeyMessage, 0).Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+func TestKeyMessagesAreRelayed(t *testing.T) {
+	h := startChannels(t)
+	clients := h.ConnectN(3)
+	alice, bob, carol := clients[0], clients[1], clients[2]
+	join(t, alice, "lobby")
+	join(t, bob, "lobby")
+	join(t, carol, "lobby")
+
+	// the sender SSRC is set by the Server
+	if err := alice.SendKeyMessage(0, []byte{0x01, 0xAA}); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*testkit.Client{bob, carol} {
+		message := expectKeyMessage(t, c)
+		if message.From != alice.SSRC() || !bytes.Equal(message.Body, []byte{0x01, 0xAA}) {
+			t.Fatalf("relayed key message from %08x with %x, want %08x", message.From, message.Body, alice.SSRC())
+		}
+	}
+	alice.ExpectNoPacket(protocol.PacketTypeKeyMessage, 0)
+
+	if err := bob.SendKeyMessage(alice.SSRC(), []byte{0x02, 0xBB}); err != nil {
+		t.Fatal(err)
+	}
+	if message := expectKeyMessage(t, alice); message.From != bob.SSRC() || message.To != alice.SSRC() {
+		t.Fatalf("key message from %08x to %08x", message.From, message.To)
+	}
+	carol.ExpectNoPacket(protocol.PacketTypeKeyMessage, 100*time.Millisecond)
+
+	// sealed voice is forwarded byte for byte
+	sealed := []byte{0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x5A}
+	if err := alice.SendVoice(protocol.CodecE2EE, 960, sealed); err != nil {
+		t.Fatal(err)
+	}
+	voice, err := protocol.DecodeVoice(bob.ExpectPacket(protocol.PacketTypeVoice, 0).Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if voice.Codec != protocol.CodecE2EE || !bytes.Equal(voice.Frame, sealed) {
+		t.Fatalf("forwarded %s %x, want e2ee %x", voice.Codec, voice.Frame, sealed)
+	}
+
+	// the remaining members learn that a member left
+	if err := carol.LeaveChannel(); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*testkit.Client{alice, bob} {
+		if message := expectKeyMessage(t, c); message.From != carol.SSRC() || len(message.Body) != 0 {
+			t.Fatalf("leave notice from %08x with %x, want %08x", message.From, message.Body, carol.SSRC())
+		}
+	}
+}
+
+func TestClientsExchangeKeys(t *testing.T) {
+	h := startChannels(t)
+	clients := h.ConnectN(2)
+	alice, bob := clients[0], clients[1]
+	opened := make(chan protocol.Voice, 16)
+	bob.OnPacket(protocol.PacketTypeVoice, func(packet *protocol.Packet) error {
+		voice, err := protocol.DecodeVoice(packet.Payload)
+		if err == nil {
+			opened <- voice
+		}
+		return err
+	})
+	for _, c := range clients {
+		if err := c.EnableE2EE(e2ee.Config{}); err != nil {
+			t.Fatal(err)
+		}
+		join(t, c, "lobby")
+	}
+
+	// the voice is sealed on the way through the Server and opened by bob once the keys arrived
+	frame := []byte{0xFC, 0x01}
+	testkit.Eventually(t, testkit.DefaultTimeout, func() bool {
+		if err := alice.SendVoice(protocol.CodecOpus, 960, frame); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case voice := <-opened:
+			if voice.Codec != protocol.CodecOpus || !bytes.Equal(voice.Frame, frame) {
+				t.Fatalf("opened %s %x, want opus %x", voice.Codec, voice.Frame, frame)
+			}
+			return true
+		case <-time.After(50 * time.Millisecond):
+			return false
+		}
+	}, "voice of alice opened by bob")
+	packet, _ := h.ExpectServerPacket(protocol.PacketTypeVoice, 0)
+	if voice, err := protocol.DecodeVoice(packet.Payload); err != nil || voice.Codec != protocol.CodecE2EE {
+		t.Fatalf("the Server received %s voice, %v", voice.Codec, err)
+	}
+
+	// the fingerprints are compared out of band
+	if got, want := alice.E2EE().Peers()[bob.SSRC()], bob.E2EE().Fingerprint(); got != want {
+		t.Fatalf("alice knows bob by %q, want %q", got, want)
+	}
+}
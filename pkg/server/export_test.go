@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+// HandleDatagram hands a datagram to the Server like a read loop does, so the fuzz tests skip the transport
+func (s *Server) HandleDatagram(data []byte, addrPort netip.AddrPort) {
+	s.handleDatagram(data, addrPort, new(protocol.Packet))
+}
+
+// CachedRemote tells if the remote with the key is in the cache of the Server
+func (s *Server) CachedRemote(key string) bool {
+	addrPort, err := netip.ParseAddrPort(key)
+	if err != nil {
+		return false
+	}
+	_, ok := s.remotes.get(normalize(addrPort))
+	return ok
+}
+
+// RTPAddr returns the address of the RTP listener of a running Server
+func (s *Server) RTPAddr() net.Addr {
+	return s.rtpConn.LocalAddr()
+}
+
+// RTPPeers returns how many RTP peers the Server keeps
+func (s *Server) RTPPeers() int {
+	return int(s.rtpCount.Load())
+}
@@ -0,0 +1,63 @@
+package server_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/aura-speak/networking/internal/config"
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/testkit"
+	log "github.com/sirupsen/logrus"
+)
+
+// datagram encodes a packet for the seeds
+func datagram(packetType protocol.PacketType, payload []byte) []byte {
+	return (&protocol.Packet{PacketHeader: protocol.Header{PacketType: packetType}, Payload: payload}).Encode()
+}
+
+// FuzzHandleDatagram hands every input to the Server as datagram of a connected client or of a stranger
+// It fails if a datagram makes the Server panic, a client may well disconnect itself on the way
+func FuzzHandleDatagram(f *testing.F) {
+	// The Server logs every dropped datagram, that would only slow down the fuzzing
+	log.SetLevel(log.WarnLevel)
+	cfg := &config.Default().ServerConfig
+	cfg.Server.DTLS.Path = f.TempDir() + "/"
+	cfg.Server.BanList = ""
+	cfg.Server.Recording.Dir = f.TempDir()
+	// without limits every input reaches the handlers
+	cfg.Server.RateLimit = config.RateLimitsConfig{}
+	h := testkit.Start(f, testkit.Options{Config: cfg})
+	client, err := netip.ParseAddrPort(h.Connect().LocalAddr().String())
+	if err != nil {
+		f.Fatal(err)
+	}
+	stranger := netip.MustParseAddrPort("192.0.2.1:40000")
+
+	seeds := [][]byte{
+		{},
+		{0xFF},
+		datagram(protocol.PacketTypeDebugAny, []byte("Hello, Server!")),
+		datagram(protocol.PacketTypeConnect, (&protocol.ConnectRequest{Credential: []byte("token")}).Encode()),
+		datagram(protocol.PacketTypeClientNeedsDisconnect, nil),
+		datagram(protocol.PacketTypeSenderReport, (&protocol.SenderReport{NTPTimestamp: 0xE8_00_00_00_80_00_00_00, PacketCount: 10, OctetCount: 1200}).Encode()),
+		datagram(protocol.PacketTypeReceiverReport, (&protocol.ReceiverReport{HighestSequence: 0x10005, CumulativeLost: -1}).Encode()),
+		datagram(protocol.PacketTypeChannelJoin, []byte("lobby")),
+		datagram(protocol.PacketTypeFloorRequest, nil),
+		datagram(protocol.PacketTypeVoice, (&protocol.Voice{Sequence: 1, Timestamp: 960, Codec: protocol.CodecOpus, Frame: []byte{0xF8, 0xFF, 0xFE}}).Encode()),
+		datagram(protocol.PacketTypeKeyMessage, (&protocol.KeyMessage{Body: []byte{0x01}}).Encode()),
+		datagram(protocol.PacketTypeFloorRelease, nil),
+		datagram(protocol.PacketTypeChannelLeave, nil),
+		datagram(protocol.PacketTypeRecordStart, []byte("lobby")),
+	}
+	for _, seed := range seeds {
+		f.Add(seed, true)
+		f.Add(seed, false)
+	}
+	f.Fuzz(func(t *testing.T, data []byte, verified bool) {
+		from := stranger
+		if verified {
+			from = client
+		}
+		h.Server.HandleDatagram(data, from)
+	})
+}
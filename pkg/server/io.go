@@ -0,0 +1,301 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"runtime"
+	"sync"
+
+	"github.com/aura-speak/networking/pkg/protocol"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/ipv4"
+)
+
+// DefaultBatchSize is the number of datagrams the Server reads or writes with one syscall
+const DefaultBatchSize = 32
+
+// remote is a remote address and the strings the state of the Server is keyed by
+// The remotes of sessions are cached, so their packets do not format their address again
+type remote struct {
+	addr *net.UDPAddr
+	key  string // addr.String(), the key of sessions, reports and session limits
+	ip   string // addr.IP.String(), the key of the IP limits and bans
+}
+
+func newRemote(addrPort netip.AddrPort) *remote {
+	addr := net.UDPAddrFromAddrPort(addrPort)
+	return &remote{addr: addr, key: addr.String(), ip: addr.IP.String()}
+}
+
+// remoteCache maps the address of a datagram to its remote without an allocation
+type remoteCache struct {
+	mu      sync.RWMutex
+	remotes map[netip.AddrPort]*remote
+}
+
+func newRemoteCache() *remoteCache {
+	return &remoteCache{remotes: make(map[netip.AddrPort]*remote)}
+}
+
+func (c *remoteCache) get(addrPort netip.AddrPort) (*remote, bool) {
+	c.mu.RLock()
+	r, ok := c.remotes[addrPort]
+	c.mu.RUnlock()
+	return r, ok
+}
+
+func (c *remoteCache) add(addrPort netip.AddrPort, r *remote) {
+	c.mu.Lock()
+	c.remotes[addrPort] = r
+	c.mu.Unlock()
+}
+
+// remove removes the remote with the key
+func (c *remoteCache) remove(key string) {
+	addrPort, err := netip.ParseAddrPort(key)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	delete(c.remotes, normalize(addrPort))
+	c.mu.Unlock()
+}
+
+// retain removes the remotes that are not kept
+func (c *remoteCache) retain(keep func(key string) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for addrPort, r := range c.remotes {
+		if !keep(r.key) {
+			delete(c.remotes, addrPort)
+		}
+	}
+}
+
+// normalize unmaps IPv4 addresses received on a dual stack socket, so both socket types use the same keys
+func normalize(addrPort netip.AddrPort) netip.AddrPort {
+	return netip.AddrPortFrom(addrPort.Addr().Unmap(), addrPort.Port())
+}
+
+// addrPortOf returns the address of a remote of any transport
+func addrPortOf(addr net.Addr) (netip.AddrPort, error) {
+	udp, err := udpAddr(addr)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	addrPort := udp.AddrPort()
+	if !addrPort.IsValid() {
+		return netip.AddrPort{}, errors.New("invalid remote address " + addr.String())
+	}
+	return normalize(addrPort), nil
+}
+
+// batchConn returns the connection for recvmmsg and sendmmsg or nil if the Server reads and writes single datagrams
+// x/net only batches on Linux and the IPv4 socket writes IPv4 addresses only, so the socket must be bound to IPv4
+func batchConn(conn net.PacketConn, batchSize int) *ipv4.PacketConn {
+	udp, ok := conn.(*net.UDPConn)
+	if !ok || batchSize <= 1 || runtime.GOOS != "linux" {
+		return nil
+	}
+	if local, ok := udp.LocalAddr().(*net.UDPAddr); !ok || local.IP.To4() == nil {
+		return nil
+	}
+	return ipv4.NewPacketConn(udp)
+}
+
+// receiver reads datagrams into pooled buffers of protocol.BufferSize
+// A plain UDP socket on Linux is read with recvmmsg, up to the batch size datagrams per syscall
+// Other platforms and transports read one datagram per call
+// The buffers are reused by the next read, so nothing may refer to a datagram after it was handled
+type receiver struct {
+	conn  net.PacketConn
+	udp   *net.UDPConn
+	batch *ipv4.PacketConn
+	msgs  []ipv4.Message
+	bufs  []*[]byte
+	lens  []int
+	addrs []netip.AddrPort
+}
+
+func newReceiver(conn net.PacketConn, batchSize int) *receiver {
+	r := &receiver{conn: conn, batch: batchConn(conn, batchSize)}
+	r.udp, _ = conn.(*net.UDPConn)
+	size := 1
+	if r.batch != nil {
+		size = batchSize
+	}
+	r.bufs = make([]*[]byte, size)
+	r.lens = make([]int, size)
+	r.addrs = make([]netip.AddrPort, size)
+	for i := range r.bufs {
+		r.bufs[i] = protocol.GetBuffer()
+	}
+	if r.batch != nil {
+		r.msgs = make([]ipv4.Message, size)
+		for i := range r.msgs {
+			r.msgs[i].Buffers = [][]byte{*r.bufs[i]}
+		}
+	}
+	return r
+}
+
+// read reads the next datagrams and returns their number
+func (r *receiver) read() (int, error) {
+	switch {
+	case r.batch != nil:
+		n, err := r.batch.ReadBatch(r.msgs, 0)
+		if err != nil {
+			return 0, err
+		}
+		for i, msg := range r.msgs[:n] {
+			r.lens[i], r.addrs[i] = msg.N, netip.AddrPort{}
+			if addr, ok := msg.Addr.(*net.UDPAddr); ok {
+				r.addrs[i] = normalize(addr.AddrPort())
+			}
+		}
+		return n, nil
+	case r.udp != nil:
+		n, addrPort, err := r.udp.ReadFromUDPAddrPort(*r.bufs[0])
+		if err != nil {
+			return 0, err
+		}
+		r.lens[0], r.addrs[0] = n, normalize(addrPort)
+		return 1, nil
+	default:
+		n, addr, err := r.conn.ReadFrom(*r.bufs[0])
+		if err != nil {
+			return 0, err
+		}
+		addrPort, err := addrPortOf(addr)
+		if err != nil {
+			log.WithField("caller", "server").WithError(err).Debug("Dropping datagram")
+			return 0, nil
+		}
+		r.lens[0], r.addrs[0] = n, addrPort
+		return 1, nil
+	}
+}
+
+// datagram returns the i-th datagram of the last read
+// The address is invalid if the datagram came from no UDP address
+func (r *receiver) datagram(i int) ([]byte, netip.AddrPort) {
+	return (*r.bufs[i])[:r.lens[i]], r.addrs[i]
+}
+
+// release returns the buffers to the pool
+func (r *receiver) release() {
+	for _, buf := range r.bufs {
+		protocol.PutBuffer(buf)
+	}
+}
+
+// remote returns the remote of a datagram address
+// Only the remotes of sessions are cached, anybody else could fill the cache with spoofed addresses
+func (s *Server) remote(addrPort netip.AddrPort) *remote {
+	if r, ok := s.remotes.get(addrPort); ok {
+		return r
+	}
+	r := newRemote(addrPort)
+	if _, ok := s.sessions.Load(r.key); ok {
+		s.remotes.add(addrPort, r)
+	}
+	return r
+}
+
+// fanOut is the recipient list of one broadcast, pooled so a broadcast does not allocate it
+type fanOut struct {
+	keys    []string
+	addrs   []*net.UDPAddr
+	msgs    []ipv4.Message
+	buffers [][]byte
+}
+
+var fanOutPool = sync.Pool{
+	New: func() any { return &fanOut{buffers: make([][]byte, 1)} },
+}
+
+func (f *fanOut) reset() {
+	clear(f.keys)
+	clear(f.addrs)
+	clear(f.msgs)
+	f.keys, f.addrs, f.msgs = f.keys[:0], f.addrs[:0], f.msgs[:0]
+	f.buffers[0] = nil
+}
+
+// sendAll sends an encoded packet to all remotes
+func (s *Server) sendAll(data []byte) {
+	s.send(data, nil)
+}
+
+// send sends an encoded packet to the remotes that include accepts, to all remotes if include is nil
+// With a batch connection the datagrams are sent with sendmmsg, up to BatchSize per syscall
+// A remote that cannot be sent to is forgotten
+func (s *Server) send(data []byte, include func(key string) bool) {
+	f := fanOutPool.Get().(*fanOut)
+	defer func() {
+		f.reset()
+		fanOutPool.Put(f)
+	}()
+	s.remoteConns.Range(func(key, value any) bool {
+		if include != nil && !include(key.(string)) {
+			return true
+		}
+		f.keys = append(f.keys, key.(string))
+		f.addrs = append(f.addrs, value.(*net.UDPAddr))
+		return true
+	})
+
+	if s.batch == nil {
+		for i, addr := range f.addrs {
+			if _, err := s.conn.WriteTo(data, addr); err != nil {
+				s.forget(f.keys[i])
+				continue
+			}
+			s.sent(f.keys[i], addr, data)
+		}
+		return
+	}
+
+	f.buffers[0] = data
+	for start := 0; start < len(f.addrs); {
+		end := min(start+s.BatchSize, len(f.addrs))
+		f.msgs = f.msgs[:0]
+		for _, addr := range f.addrs[start:end] {
+			f.msgs = append(f.msgs, ipv4.Message{Buffers: f.buffers, Addr: addr})
+		}
+		n, err := s.batch.WriteBatch(f.msgs, 0)
+		for i := start; i < start+n; i++ {
+			s.sent(f.keys[i], f.addrs[i], data)
+		}
+		start += n
+		if err != nil || n == 0 {
+			// sendmmsg stops at the first datagram it cannot send
+			if err != nil {
+				log.WithField("caller", "server").WithError(err).Debugf("Forgetting %s", f.keys[start])
+			}
+			s.forget(f.keys[start])
+			start++
+		}
+	}
+}
+
+// sent accounts a packet sent to a remote
+func (s *Server) sent(key string, addr *net.UDPAddr, data []byte) {
+	s.reportPeer(key).OnSent(data)
+	s.trace(TraceOut, addr, data[protocol.HeaderSize:])
+}
+
+// forget removes a remote and all its state
+func (s *Server) forget(key string) {
+	// the floor is released while the session still tells its SSRC
+	s.leaveChannel(key)
+	s.remoteConns.Delete(key)
+	s.reports.Delete(key)
+	if v, ok := s.sessions.LoadAndDelete(key); ok {
+		v.(*Session).stopExpiry()
+	}
+	s.peerIdentities.Delete(key)
+	s.sessionLimiter.Forget(key)
+	s.remotes.remove(key)
+}
@@ -0,0 +1,268 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/internal/config"
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/ratelimit"
+	"github.com/aura-speak/networking/pkg/server"
+	"github.com/aura-speak/networking/pkg/testkit"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestForgetEvictsRemote(t *testing.T) {
+	cfg := &config.Default().ServerConfig
+	cfg.Server.DTLS.Path = t.TempDir() + "/"
+	cfg.Server.BanList = ""
+	h := testkit.Start(t, testkit.Options{Config: cfg})
+	alice := h.Connect()
+	key := alice.LocalAddr().String()
+
+	alice.SendPacket(&protocol.Packet{PacketHeader: protocol.Header{PacketType: protocol.PacketTypeDebugAny}})
+	h.ExpectServerPacket(protocol.PacketTypeDebugAny, 0)
+	if !h.Server.CachedRemote(key) {
+		t.Fatal("remote of the session not cached")
+	}
+	if _, err := h.Server.BanIP("127.0.0.1", "test", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	testkit.Eventually(t, testkit.DefaultTimeout, func() bool {
+		_, ok := h.Server.Session(key)
+		return !ok
+	}, "session of the banned IP dropped")
+	if h.Server.CachedRemote(key) {
+		t.Fatal("remote of the forgotten session still cached")
+	}
+}
+
+// The benchmarks measure the packet path of the Server over loopback UDP
+// An op is one packet received by the Server, the allocations are counted for the whole process,
+// the raw sockets of the peers do not allocate
+
+const (
+	benchSenders    = 4
+	benchRecipients = 50
+	benchPayload    = 80
+	// benchWindow is the number of packets in flight, more get lost in the socket buffers
+	benchWindow = 256
+)
+
+// bench is a running Server without rate limits with connected peers
+type bench struct {
+	server  *server.Server
+	port    int
+	handled atomic.Int64
+}
+
+// startBench starts a Server on a free port of 127.0.0.1 and stops it when the benchmark ends
+func startBench(b *testing.B, shards int, handler func(bn *bench, packet *protocol.Packet)) *bench {
+	b.Helper()
+	// the Server logs every connect, that would only slow down the benchmark
+	log.SetLevel(log.WarnLevel)
+	cfg := &config.Default().ServerConfig
+	cfg.Server.DTLS.Path = b.TempDir() + "/"
+	cfg.Server.BanList = ""
+	cfg.Server.Shards = shards
+	cfg.Server.RateLimit.PerIP = config.RateLimitConfig{}
+	cfg.Server.RateLimit.PerSession = config.RateLimitConfig{}
+	cfg.Server.RateLimit.Ban = ratelimit.BanPolicy{}
+
+	bn := &bench{port: freePort(b)}
+	bn.server = server.NewServer(bn.port, context.Background(), cfg)
+	bn.server.OnPacket(protocol.PacketTypeDebugAny, func(packet *protocol.Packet, clientAddr string) error {
+		handler(bn, packet)
+		return nil
+	})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		bn.server.Run()
+	}()
+	b.Cleanup(func() {
+		bn.server.Stop()
+		<-done
+	})
+	// the Server has no ready signal, it is alive once it listens
+	testkit.Eventually(b, testkit.DefaultTimeout, func() bool {
+		return atomic.LoadInt32(&bn.server.IsAlive) == 1
+	}, "server listening on port %d", bn.port)
+	return bn
+}
+
+func freePort(b *testing.B) int {
+	b.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// connect opens a socket and completes the connect handshake, the socket is closed when the benchmark ends
+func (bn *bench) connect(b *testing.B) *net.UDPConn {
+	b.Helper()
+	conn, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: bn.port})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { conn.Close() })
+	if err := handshakeUDP(conn); err != nil {
+		b.Fatal(err)
+	}
+	return conn
+}
+
+// handshakeUDP sends connects until the Server accepts one
+func handshakeUDP(conn *net.UDPConn) error {
+	var cookie []byte
+	buf := make([]byte, protocol.MaxPacketSize)
+	for range 2 {
+		request := &protocol.ConnectRequest{Cookie: cookie}
+		packet := &protocol.Packet{PacketHeader: protocol.Header{PacketType: protocol.PacketTypeConnect}, Payload: request.Encode()}
+		if _, err := conn.Write(packet.Encode()); err != nil {
+			return err
+		}
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			return fmt.Errorf("handshake: %w", err)
+		}
+		answer, err := protocol.Decode(buf[:n])
+		if err != nil {
+			return err
+		}
+		switch answer.PacketHeader.PacketType {
+		case protocol.PacketTypeHelloVerify:
+			verify, err := protocol.DecodeHelloVerify(answer.Payload)
+			if err != nil {
+				return err
+			}
+			cookie = append([]byte(nil), verify.Cookie...)
+		case protocol.PacketTypeConnectAccept:
+			conn.SetReadDeadline(time.Time{})
+			return nil
+		default:
+			return fmt.Errorf("handshake answered with %s", protocol.PacketTypeMapType[answer.PacketHeader.PacketType])
+		}
+	}
+	return errors.New("handshake not accepted")
+}
+
+// drive sends n packets round robin over the senders and waits until done reports them all
+// At most benchWindow packets are in flight, packets that do not arrive within a stall timeout count as lost
+func drive(senders []*net.UDPConn, data []byte, n int, done func() int64) int64 {
+	start := done()
+	var sent, lost int64
+	lastProgress, lastDone := time.Now(), start
+	for sent < int64(n) || done()-start+lost < int64(n) {
+		current := done()
+		if current != lastDone {
+			lastDone, lastProgress = current, time.Now()
+		}
+		inFlight := sent - (current - start) - lost
+		if sent < int64(n) && inFlight < benchWindow {
+			senders[sent%int64(len(senders))].Write(data)
+			sent++
+			continue
+		}
+		if time.Since(lastProgress) > 200*time.Millisecond {
+			lost += inFlight
+			lastProgress = time.Now()
+			continue
+		}
+		// the Server works on the packets in flight
+		time.Sleep(20 * time.Microsecond)
+	}
+	return lost
+}
+
+func debugAny(size int) []byte {
+	packet := &protocol.Packet{
+		PacketHeader: protocol.Header{PacketType: protocol.PacketTypeDebugAny},
+		Payload:      make([]byte, size),
+	}
+	return packet.Encode()
+}
+
+// benchReceive sends DebugAny packets from connected senders to a handler that only counts them
+func benchReceive(b *testing.B, shards, senderCount int) {
+	bn := startBench(b, shards, func(bn *bench, packet *protocol.Packet) { bn.handled.Add(1) })
+	senders := make([]*net.UDPConn, senderCount)
+	for i := range senders {
+		senders[i] = bn.connect(b)
+	}
+	data := debugAny(benchPayload)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	lost := drive(senders, data, b.N, bn.handled.Load)
+	b.ReportMetric(float64(lost), "lost")
+}
+
+func BenchmarkReceive(b *testing.B) {
+	benchReceive(b, 1, benchSenders)
+}
+
+// BenchmarkReceiveShards compares shard counts, the kernel spreads the senders over the shards by their port
+func BenchmarkReceiveShards(b *testing.B) {
+	for _, shards := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			if shards > 1 && runtime.GOOS != "linux" {
+				b.Skip("shards are only supported on linux")
+			}
+			benchReceive(b, shards, 4*benchSenders)
+		})
+	}
+}
+
+// BenchmarkBroadcast lets the handler broadcast every packet to all connected recipients
+// An op is done once every recipient received the packet
+func BenchmarkBroadcast(b *testing.B) {
+	bn := startBench(b, 1, func(bn *bench, packet *protocol.Packet) { bn.server.Broadcast(packet) })
+	// the receivers end once their sockets are closed, the cleanups run in reverse order, so the wait runs after the closes
+	var wg sync.WaitGroup
+	b.Cleanup(wg.Wait)
+	senders := make([]*net.UDPConn, benchSenders)
+	for i := range senders {
+		senders[i] = bn.connect(b)
+	}
+	var delivered atomic.Int64
+	receive := func(conn *net.UDPConn) {
+		buf := make([]byte, protocol.MaxPacketSize)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			if n > 0 && protocol.PacketType(buf[0]) == protocol.PacketTypeDebugAny {
+				delivered.Add(1)
+			}
+		}
+	}
+	// the senders are sessions as well and receive the broadcast
+	for _, conn := range senders {
+		wg.Go(func() { receive(conn) })
+	}
+	for range benchRecipients {
+		conn := bn.connect(b)
+		wg.Go(func() { receive(conn) })
+	}
+	fanout := int64(benchSenders + benchRecipients)
+	data := debugAny(benchPayload)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	lost := drive(senders, data, b.N, func() int64 { return delivered.Load() / fanout })
+	b.ReportMetric(float64(lost), "lost")
+	b.ReportMetric(float64(fanout), "deliveries/op")
+}
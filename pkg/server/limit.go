@@ -0,0 +1,167 @@
+package server
+
+import (
+	"net"
+	"time"
+
+	"github.com/aura-speak/networking/internal/config"
+	"github.com/aura-speak/networking/pkg/banlist"
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/ratelimit"
+	log "github.com/sirupsen/logrus"
+)
+
+// admit checks the ban lists and the rate limits for a datagram before it is decoded
+// Datagrams over the limit are dropped silently
+// Only verified remotes count a violation of the source IP, enough violations ban the IP temporarily,
+// so a flood with a spoofed source can not ban its victim
+func (s *Server) admit(rm *remote, data []byte, now time.Time) bool {
+	if len(data) == 0 {
+		return false
+	}
+	if s.bans.IPBanned(rm.addr.IP, now) || s.offenders.Banned(rm.ip, now) {
+		return false
+	}
+
+	packetType := protocol.PacketType(data[0])
+	if !s.ipLimiter.Allow(rm.ip, packetType, len(data), now) {
+		if s.verified(rm, data) {
+			s.violation(rm, now)
+		}
+		return false
+	}
+	if _, ok := s.sessions.Load(rm.key); ok {
+		if !s.sessionLimiter.Allow(rm.key, packetType, len(data), now) {
+			s.violation(rm, now)
+			return false
+		}
+	}
+	return true
+}
+
+// admitHandshake checks the ban lists and the IP rate limit for the DTLS handshake of a new remote
+// It runs before the transport creates any state for the remote, the handshake counts as connect
+func (s *Server) admitHandshake(remote net.Addr, size int) bool {
+	addr, err := udpAddr(remote)
+	if err != nil {
+		return false
+	}
+	now := s.Clock.Now()
+	ip := addr.IP.String()
+	if s.bans.IPBanned(addr.IP, now) || s.offenders.Banned(ip, now) {
+		return false
+	}
+	return s.ipLimiter.Allow(ip, protocol.PacketTypeConnect, size, now)
+}
+
+// verified tells if the remote proved that it receives at its address
+// Remotes with a session did, as does a connect that returns a valid cookie
+func (s *Server) verified(rm *remote, data []byte) bool {
+	if _, ok := s.sessions.Load(rm.key); ok {
+		return true
+	}
+	if protocol.PacketType(data[0]) != protocol.PacketTypeConnect {
+		return false
+	}
+	request, err := protocol.DecodeConnectRequest(data[protocol.HeaderSize:])
+	return err == nil && s.cookies.verify(rm.addr, request.Cookie)
+}
+
+// violation records a rate limit violation and drops all sessions of the IP if it got banned
+func (s *Server) violation(rm *remote, now time.Time) {
+	banned, until := s.offenders.Violation(rm.ip, now)
+	if !banned {
+		return
+	}
+	log.WithField("caller", "server").Warnf("Banning %s until %s for exceeding the rate limit", rm.ip, until.Format(time.RFC3339))
+	s.dropSessions(func(session *Session) bool {
+		return session.Addr.IP.Equal(rm.addr.IP)
+	})
+}
+
+// dropSessions removes all sessions that match and their state
+func (s *Server) dropSessions(match func(session *Session) bool) {
+	s.sessions.Range(func(key, value any) bool {
+		if match(value.(*Session)) {
+			s.forget(key.(string))
+		}
+		return true
+	})
+}
+
+// Bans returns the entries of the persistent ban list
+func (s *Server) Bans() []banlist.Entry {
+	return s.bans.Entries()
+}
+
+// BanIP bans an IP address or CIDR range and drops the sessions in it
+// A duration of zero bans permanently
+//
+// Example:
+//
+//	if _, err := server.BanIP("203.0.113.0/24", "flooding", time.Hour); err != nil {
+//		fmt.Println("Error banning:", err)
+//	}
+func (s *Server) BanIP(target string, reason string, duration time.Duration) (banlist.Entry, error) {
+	entry, err := s.bans.BanIP(target, reason, duration)
+	if err != nil {
+		return entry, err
+	}
+	_, network, err := net.ParseCIDR(entry.IP)
+	if err != nil {
+		return entry, err
+	}
+	s.dropSessions(func(session *Session) bool {
+		return network.Contains(session.Addr.IP)
+	})
+	log.WithField("caller", "server").Infof("Banned %s: %s", entry.IP, reason)
+	return entry, nil
+}
+
+// BanUser bans a user ID and drops its sessions
+// A duration of zero bans permanently
+func (s *Server) BanUser(userID string, reason string, duration time.Duration) (banlist.Entry, error) {
+	entry, err := s.bans.BanUser(userID, reason, duration)
+	if err != nil {
+		return entry, err
+	}
+	s.dropSessions(func(session *Session) bool {
+		return session.Identity != nil && session.Identity.UserID == userID
+	})
+	log.WithField("caller", "server").Infof("Banned user %s: %s", userID, reason)
+	return entry, nil
+}
+
+// Unban removes the ban of an IP address, CIDR range or user ID
+// It returns false if there was no such ban
+func (s *Server) Unban(target string) (bool, error) {
+	return s.bans.Unban(target)
+}
+
+// newLimits converts the rate limit config into ratelimit.Limits
+func newLimits(cfg config.RateLimitConfig) ratelimit.Limits {
+	limits := ratelimit.Limits{
+		Default:     cfg.Default,
+		PacketTypes: make(map[protocol.PacketType]ratelimit.Limit),
+	}
+	for name, limit := range cfg.PacketTypes {
+		packetType, ok := protocol.ParsePacketType(name)
+		if !ok {
+			log.WithField("caller", "server").Warnf("Ignoring rate limit for unknown packet type %q", name)
+			continue
+		}
+		limits.PacketTypes[packetType] = limit
+	}
+	return limits
+}
+
+// newBanList loads the ban list configured in the server config
+// If the file is broken the bans are kept in memory, so the file is not overwritten
+func newBanList(cfg *config.ServerConfig) *banlist.List {
+	bans, err := banlist.Load(cfg.Server.BanList)
+	if err != nil {
+		log.WithField("caller", "server").WithError(err).Error("Failed to load ban list, keeping bans in memory only")
+		bans, _ = banlist.Load("")
+	}
+	return bans
+}
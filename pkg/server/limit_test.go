@@ -0,0 +1,93 @@
+package server_test
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/internal/config"
+	"github.com/aura-speak/networking/pkg/clock"
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/ratelimit"
+	"github.com/aura-speak/networking/pkg/testkit"
+)
+
+// startLimited starts a Server on a Fake clock that allows 5 packets per source IP and bans after 3 violations
+func startLimited(t *testing.T) (*testkit.Harness, *clock.Fake) {
+	t.Helper()
+	cfg := &config.Default().ServerConfig
+	cfg.Server.DTLS.Path = t.TempDir() + "/"
+	cfg.Server.BanList = ""
+	cfg.Server.RateLimit = config.RateLimitsConfig{
+		PerIP: config.RateLimitConfig{Default: ratelimit.Limit{PacketsPerSecond: 1, PacketBurst: 5}},
+		Ban:   ratelimit.BanPolicy{Violations: 3, Window: time.Minute, Duration: time.Minute, MaxDuration: time.Hour},
+	}
+	fake := clock.NewFake(time.Unix(1_700_000_000, 0))
+	return testkit.Start(t, testkit.Options{Config: cfg, Clock: fake}), fake
+}
+
+func flood(t *testing.T, conn net.Conn, n int) {
+	t.Helper()
+	data := (&protocol.Packet{PacketHeader: protocol.Header{PacketType: protocol.PacketTypeDebugAny}}).Encode()
+	for range n {
+		if _, err := conn.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestUnverifiedFloodDoesNotBan(t *testing.T) {
+	h, fake := startLimited(t)
+	// the flood comes from the IP of the clients, like one with a spoofed source
+	spoofed, err := h.Memory.Dial(net.JoinHostPort("127.0.0.1", strconv.Itoa(h.Addr().(*net.UDPAddr).Port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spoofed.Close()
+	flood(t, spoofed, 20)
+	testkit.Eventually(t, testkit.DefaultTimeout, func() bool {
+		return h.Received.Count(protocol.PacketTypeDebugAny) == 20
+	}, "server received the flood")
+
+	// the buckets refill long before a ban would end
+	fake.Advance(10 * time.Second)
+	h.Connect()
+}
+
+func TestSessionFloodBans(t *testing.T) {
+	h, _ := startLimited(t)
+	alice := h.Connect()
+	key := alice.LocalAddr().String()
+	for range 20 {
+		alice.SendPacket(&protocol.Packet{PacketHeader: protocol.Header{PacketType: protocol.PacketTypeDebugAny}})
+	}
+	testkit.Eventually(t, testkit.DefaultTimeout, func() bool {
+		_, ok := h.Server.Session(key)
+		return !ok
+	}, "session of the flooding IP dropped")
+}
+
+func TestBanExpiresOnClock(t *testing.T) {
+	h, fake := startLimited(t)
+	alice := h.Connect()
+	entry, err := h.Server.BanIP("127.0.0.1", "test", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !entry.Created.Equal(fake.Now().UTC()) {
+		t.Fatalf("ban created at %s, want %s of the clock", entry.Created, fake.Now())
+	}
+	if _, ok := h.Server.Session(alice.LocalAddr().String()); ok {
+		t.Fatal("session of the banned IP kept")
+	}
+	if bans := h.Server.Bans(); len(bans) != 1 {
+		t.Fatalf("%d bans", len(bans))
+	}
+
+	fake.Advance(time.Minute)
+	if bans := h.Server.Bans(); len(bans) != 0 {
+		t.Fatalf("bans after the expiry on the clock: %+v", bans)
+	}
+	h.Connect()
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/aura-speak/networking/internal/config"
+	"github.com/aura-speak/networking/pkg/codec"
+	"github.com/aura-speak/networking/pkg/mixer"
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/rtp"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ChannelModeForward forwards the voice of every speaker to the listeners, the default
+	ChannelModeForward = "forward"
+	// ChannelModeMix sends every listener one mixed stream without its own voice
+	ChannelModeMix = "mix"
+)
+
+// runningMixer is the mixer of a channel in mix mode, cancel stops it
+type runningMixer struct {
+	*mixer.Mixer
+	cancel context.CancelFunc
+}
+
+// configureMixers starts a mixer.Mixer for every channel in mix mode and stops the mixers of the other channels
+// The mixers run until they are stopped or the Server stops, nothing is started once it stopped
+// The mixed streams are L16, the only codec the Server can encode
+// The caller has to hold channelsMu
+func (s *Server) configureMixers(channels map[string]config.ChannelConfig) {
+	for name, m := range s.mixers {
+		if channels[name].Mode != ChannelModeMix {
+			m.cancel()
+			delete(s.mixers, name)
+			log.WithFields(log.Fields{"caller": "server", "channel": name}).Info("Stopped mixing channel")
+		}
+	}
+	if s.mixCtx == nil || s.mixCtx.Err() != nil {
+		return
+	}
+	if s.mixers == nil {
+		s.mixers = make(map[string]*runningMixer)
+	}
+	for name, channel := range channels {
+		if _, ok := s.mixers[name]; ok || channel.Mode != ChannelModeMix {
+			continue
+		}
+		m := mixer.New(s.Clock, mixer.Config{Codec: codec.L16{}, SSRC: s.ssrc}, func() []string {
+			return s.listeners(name)
+		}, s.sendMixed)
+		ctx, cancel := context.WithCancel(s.mixCtx)
+		s.wg.Go(func() {
+			m.Run(ctx)
+		})
+		s.mixers[name] = &runningMixer{Mixer: m, cancel: cancel}
+	}
+}
+
+// mixer returns the mixer of a channel in mix mode
+func (s *Server) mixer(channel string) (*mixer.Mixer, bool) {
+	s.channelsMu.RLock()
+	defer s.channelsMu.RUnlock()
+	m, ok := s.mixers[channel]
+	if !ok {
+		return nil, false
+	}
+	return m.Mixer, true
+}
+
+// SetGain sets the gain of a speaker in a channel in mix mode, 1 keeps the volume and 0 mutes it
+//
+// Example:
+//
+//	if err := server.SetGain("lobby", clientAddr, 0.5); err != nil {
+//		fmt.Println("Error setting gain:", err)
+//	}
+func (s *Server) SetGain(channel, clientAddr string, gain float64) error {
+	m, ok := s.mixer(channel)
+	if !ok {
+		return fmt.Errorf("channel %s is not in mix mode", channel)
+	}
+	m.SetGain(clientAddr, gain)
+	return nil
+}
+
+// routeVoice records a voice frame and mixes it into its channel or forwards it to the other members
+func (s *Server) routeVoice(voice protocol.Voice, channel, from string) error {
+	s.record(voice, channel, from)
+	m, ok := s.mixer(channel)
+	if !ok {
+		s.forwardVoice(voice, channel, from)
+		return nil
+	}
+	c, ok := codec.For(voice.Codec)
+	if !ok {
+		// end-to-end encrypted voice can only be forwarded
+		return stateError(fmt.Sprintf("channel %s mixes, voice with codec %s can not be decoded", channel, voice.Codec))
+	}
+	pcm, err := c.Decode(nil, voice.Frame)
+	if err != nil {
+		return err
+	}
+	m.Push(from, voice.Timestamp, pcm)
+	return nil
+}
+
+// listeners returns the members of a channel and the RTP peers if it is the RTP channel
+func (s *Server) listeners(channel string) []string {
+	keys := s.channels.list(channel)
+	if channel == s.rtpChannel {
+		s.rtpPeers.Range(func(key, value any) bool {
+			keys = append(keys, key.(string))
+			return true
+		})
+	}
+	return keys
+}
+
+// sendMixed sends the mixed stream of a listener as voice packet or RTP
+func (s *Server) sendMixed(key string, voice protocol.Voice) {
+	buf := protocol.GetBuffer()
+	defer protocol.PutBuffer(buf)
+	if strings.HasPrefix(key, "rtp:") {
+		v, ok := s.rtpPeers.Load(key)
+		if !ok || s.rtpConn == nil {
+			return
+		}
+		data, err := rtp.AppendPacketize((*buf)[:0], voice)
+		if err != nil {
+			return
+		}
+		if _, err := s.rtpConn.WriteTo(data, v.(*rtpPeer).addr); err != nil {
+			log.WithField("caller", "server").WithError(err).Debugf("Error sending RTP to %s", key)
+			return
+		}
+		s.reportPeer(key).OnSent(data)
+		return
+	}
+	v, ok := s.remoteConns.Load(key)
+	if !ok {
+		return
+	}
+	addr := v.(*net.UDPAddr)
+	data := voice.AppendEncode(append((*buf)[:0], byte(protocol.PacketTypeVoice)))
+	if _, err := s.conn.WriteTo(data, addr); err != nil {
+		s.forget(key)
+		return
+	}
+	s.sent(key, addr, data)
+}
@@ -0,0 +1,87 @@
+package server_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/internal/config"
+	"github.com/aura-speak/networking/pkg/auth"
+	"github.com/aura-speak/networking/pkg/codec"
+	"github.com/aura-speak/networking/pkg/mixer"
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/testkit"
+)
+
+// sendTone sends frames of 10ms L16 with a constant value
+func sendTone(t *testing.T, c *testkit.Client, value int16, frames int) {
+	t.Helper()
+	pcm := make([]int16, 480)
+	for i := range pcm {
+		pcm[i] = value
+	}
+	frame, _ := codec.L16{}.Encode(nil, pcm)
+	for i := range frames {
+		if err := c.SendVoice(protocol.CodecL16, uint32(i*len(pcm)), frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// heard returns the sample values of the mixed frames a client receives within d
+func heard(t *testing.T, c *testkit.Client, d time.Duration) []int16 {
+	t.Helper()
+	var values []int16
+	for {
+		packet, _, ok := c.Received.Next(protocol.PacketTypeVoice, d)
+		if !ok {
+			return values
+		}
+		voice, err := protocol.DecodeVoice(packet.Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if voice.Codec != protocol.CodecL16 {
+			t.Fatalf("mixed frame with codec %s", voice.Codec)
+		}
+		pcm, _ := codec.L16{}.Decode(nil, voice.Frame)
+		for _, sample := range pcm {
+			if !slices.Contains(values, sample) {
+				values = append(values, sample)
+			}
+		}
+	}
+}
+
+func TestMixChannel(t *testing.T) {
+	cfg := &config.Default().ServerConfig
+	cfg.Server.DTLS.Path = t.TempDir() + "/"
+	cfg.Server.Channels = map[string]config.ChannelConfig{"mixed": {Mode: "mix"}}
+	h := testkit.Start(t, testkit.Options{Config: cfg})
+	h.Server.Policy.SetRole(auth.RoleGuest, auth.PermissionSpeak|auth.PermissionListen)
+	clients := h.ConnectN(3)
+	alice, bob, carol := clients[0], clients[1], clients[2]
+	for _, c := range clients {
+		join(t, c, "mixed")
+	}
+
+	sendTone(t, alice, 100, 5)
+	sendTone(t, bob, 200, 5)
+	wait := 5 * mixer.DefaultDelay
+	if got := heard(t, carol, wait); !slices.Contains(got, 300) || slices.ContainsFunc(got, func(v int16) bool { return v != 0 && v != 100 && v != 200 && v != 300 }) {
+		t.Errorf("carol heard %v, want the sum 300", got)
+	}
+	// the listeners do not hear themselves
+	if got := heard(t, alice, 0); slices.Contains(got, 100) || slices.Contains(got, 300) {
+		t.Errorf("alice heard %v, want only bob", got)
+	}
+	if got := heard(t, bob, 0); slices.Contains(got, 200) || slices.Contains(got, 300) {
+		t.Errorf("bob heard %v, want only alice", got)
+	}
+
+	// Opus can not be decoded, so it is not mixed
+	if err := alice.SendVoice(protocol.CodecOpus, 0, []byte{0xFC}); err != nil {
+		t.Fatal(err)
+	}
+	carol.ExpectNoPacket(protocol.PacketTypeVoice, wait)
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"errors"
+	"net"
+
+	"github.com/aura-speak/networking/internal/config"
+	"github.com/aura-speak/networking/pkg/auth"
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/router"
+	log "github.com/sirupsen/logrus"
+)
+
+// OnPacketWithPermission registers a new PacketHandler that requires a permission
+// The permission is checked in the channel the client is in, server wide outside of a channel
+// Clients without the permission receive a PacketTypeError reply instead
+//
+// Example:
+//
+//	server.OnPacketWithPermission(protocol.PacketTypeDebugAny, auth.PermissionSpeak, func(packet *protocol.Packet, clientAddr string) error {
+//		server.Broadcast(packet)
+//		return nil
+//	})
+func (s *Server) OnPacketWithPermission(packetType protocol.PacketType, permission auth.Permission, handler router.ServerPacketHandler) {
+	log.WithField("caller", "server").Infof("Registering packet handler for packet type: %s (requires %s)", protocol.PacketTypeMapType[packetType], permission)
+	s.packetRouter.OnPacketWithPermission(packetType, permission, handler)
+}
+
+// OnPacketInChannel registers a new PacketHandler that requires a permission in the channel of the packet
+// The channel is resolved from the packet, e.g. from its payload
+// OnPacketWithPermission checks the permission in the channel the client is in
+//
+// Example:
+//
+//	server.OnPacketInChannel(protocol.PacketTypeDebugAny, auth.PermissionKick, func(packet *protocol.Packet, clientAddr string) string {
+//		return string(packet.Payload)
+//	}, func(packet *protocol.Packet, clientAddr string) error {
+//		return nil
+//	})
+func (s *Server) OnPacketInChannel(packetType protocol.PacketType, permission auth.Permission, channel router.ChannelResolver, handler router.ServerPacketHandler) {
+	log.WithField("caller", "server").Infof("Registering packet handler for packet type: %s (requires %s in its channel)", protocol.PacketTypeMapType[packetType], permission)
+	s.packetRouter.OnPacketInChannel(packetType, permission, channel, handler)
+}
+
+// Allowed checks if the client holds the permission in a channel
+// An empty channel checks the server wide permissions
+// Clients without a session or identity are guests
+//
+// Example:
+//
+//	if !server.Allowed(clientAddr, "lobby", auth.PermissionKick) {
+//		return errors.New("not allowed to kick in lobby")
+//	}
+func (s *Server) Allowed(clientAddr string, channel string, permission auth.Permission) bool {
+	var identity *auth.Identity
+	if session, ok := s.Session(clientAddr); ok {
+		identity = session.Identity
+	}
+	return s.Policy.Allowed(auth.RoleOf(identity), channel, permission)
+}
+
+// authorize is the router.Authorizer of the Server
+func (s *Server) authorize(clientAddr string, channel string, permission auth.Permission) bool {
+	return s.Allowed(clientAddr, channel, permission)
+}
+
+// sessionChannel is the router.ChannelResolver of the Server, a packet acts in the channel of its client
+// A client outside of any channel is checked with the server wide permissions
+func (s *Server) sessionChannel(packet *protocol.Packet, clientAddr string) string {
+	channel, _ := s.channels.channel(clientAddr)
+	return channel
+}
+
+// payloadChannel resolves the channel from the payload of packets that name a channel
+// An invalid name is checked with the server wide permissions, the handler rejects it
+func payloadChannel(packet *protocol.Packet, clientAddr string) string {
+	if protocol.ValidChannelName(packet.Payload) != nil {
+		return ""
+	}
+	return string(packet.Payload)
+}
+
+// newPolicy returns the Policy for the auth mode of the config
+// Without authentication every client is a guest, so the guests may speak like the members of auth.DefaultPolicy
+func newPolicy(cfg *config.ServerConfig) *auth.Policy {
+	policy := auth.DefaultPolicy()
+	if mode := cfg.Server.Auth.Mode; mode == "" || mode == "none" {
+		log.WithField("caller", "server").Warn("Authentication is disabled, every client is a guest that may speak")
+		policy.SetRole(auth.RoleGuest, auth.PermissionSpeak|auth.PermissionListen)
+	}
+	return policy
+}
+
+// stateError is the error of a packet that does not fit the state of the client
+// It is answered with protocol.ErrorCodeInvalidState
+type stateError string
+
+func (e stateError) Error() string { return string(e) }
+
+// replyError answers the error of a handler with a PacketTypeError reply
+// Permission, parse and state errors of the client are answered with their error code,
+// a handler may also return a *protocol.ErrorReply itself
+// Other errors are internal to the Server and not answered, it returns if the error was answered
+// Every error is counted by its code in HandlerErrors
+// Only clients are answered, the address of a remote without a session is not verified
+func (s *Server) replyError(key string, addr *net.UDPAddr, packetType protocol.PacketType, err error) bool {
+	reply, answer := errorReplyFor(err)
+	s.handlerErrors[reply.Code].Add(1)
+	if !answer {
+		return false
+	}
+	reply.PacketType = packetType
+	packet := &protocol.Packet{
+		PacketHeader: protocol.Header{PacketType: protocol.PacketTypeError},
+		Payload:      reply.Encode(),
+	}
+	data := packet.Encode()
+	if _, err := s.conn.WriteTo(data, addr); err != nil {
+		log.WithField("caller", "server").WithError(err).Error("Error sending error reply")
+		return true
+	}
+	s.sent(key, addr, data)
+	return true
+}
+
+// errorReplyFor maps the error of a handler to the reply for the client
+// It returns false for errors that are not answered
+func errorReplyFor(err error) (protocol.ErrorReply, bool) {
+	var denied *router.PermissionDeniedError
+	var reply *protocol.ErrorReply
+	var state stateError
+	switch {
+	case errors.As(err, &denied):
+		return protocol.ErrorReply{Code: protocol.ErrorCodePermissionDenied, Message: denied.Permission.String()}, true
+	case errors.As(err, &reply):
+		return *reply, true
+	case errors.As(err, &state):
+		return protocol.ErrorReply{Code: protocol.ErrorCodeInvalidState, Message: state.Error()}, true
+	case errors.Is(err, protocol.ErrMalformed):
+		return protocol.ErrorReply{Code: protocol.ErrorCodeMalformed, Message: err.Error()}, true
+	case errors.Is(err, router.ErrNoHandler), errors.Is(err, router.ErrInvalidPacketType):
+		return protocol.ErrorReply{Code: protocol.ErrorCodeUnsupported}, true
+	default:
+		return protocol.ErrorReply{Code: protocol.ErrorCodeUnknown}, false
+	}
+}
+
+// HandlerErrors returns how many packets the handlers refused by error code
+// Errors that were not answered are counted as protocol.ErrorCodeUnknown
+func (s *Server) HandlerErrors() map[protocol.ErrorCode]uint64 {
+	counts := make(map[protocol.ErrorCode]uint64)
+	for code := range s.handlerErrors {
+		if n := s.handlerErrors[code].Load(); n > 0 {
+			counts[protocol.ErrorCode(code)] = n
+		}
+	}
+	return counts
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/aura-speak/networking/internal/config"
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/recorder"
+	log "github.com/sirupsen/logrus"
+)
+
+// recordings are the running recordings of the Server by name
+// A channel is recorded as "channel:" + name, a session as "session:" + remote addr
+type recordings struct {
+	mu     sync.RWMutex
+	config recorder.Config
+	byName map[string]*recorder.Recorder
+}
+
+func newRecordings(cfg config.RecordingConfig) *recordings {
+	return &recordings{
+		config: recorder.Config{Dir: cfg.Dir, MaxSize: cfg.MaxSize, MaxDuration: cfg.MaxDuration},
+		byName: make(map[string]*recorder.Recorder),
+	}
+}
+
+func (r *recordings) get(name string) (*recorder.Recorder, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rec, ok := r.byName[name]
+	return rec, ok
+}
+
+// RecordChannel starts recording the voice of every speaker of a channel
+// The WAV files and their sidecar are written to the recording directory of the config
+//
+// Example:
+//
+//	if err := server.RecordChannel("lobby"); err != nil {
+//		fmt.Println("Error recording:", err)
+//	}
+//	defer server.StopRecording("channel:lobby")
+func (s *Server) RecordChannel(channel string) error {
+	if err := protocol.ValidChannelName([]byte(channel)); err != nil {
+		return err
+	}
+	return s.startRecording("channel:" + channel)
+}
+
+// RecordSession starts recording the voice of a client
+func (s *Server) RecordSession(clientAddr string) error {
+	if _, ok := s.Session(clientAddr); !ok {
+		return stateError("no session for " + clientAddr)
+	}
+	return s.startRecording("session:" + clientAddr)
+}
+
+func (s *Server) startRecording(name string) error {
+	s.recordings.mu.Lock()
+	defer s.recordings.mu.Unlock()
+	if _, ok := s.recordings.byName[name]; ok {
+		return stateError(name + " is already recorded")
+	}
+	rec, err := recorder.Start(s.Clock, s.recordings.config, name)
+	if err != nil {
+		return err
+	}
+	s.recordings.byName[name] = rec
+	log.WithField("caller", "server").Infof("Recording %s", name)
+	return nil
+}
+
+// StopRecording stops a recording and returns its sidecar
+func (s *Server) StopRecording(name string) (recorder.Sidecar, error) {
+	s.recordings.mu.Lock()
+	rec, ok := s.recordings.byName[name]
+	delete(s.recordings.byName, name)
+	s.recordings.mu.Unlock()
+	if !ok {
+		return recorder.Sidecar{}, stateError(name + " is not recorded")
+	}
+	log.WithField("caller", "server").Infof("Stopped recording %s", name)
+	return rec.Stop()
+}
+
+// Recordings returns the names of the running recordings
+func (s *Server) Recordings() []string {
+	s.recordings.mu.RLock()
+	defer s.recordings.mu.RUnlock()
+	names := make([]string, 0, len(s.recordings.byName))
+	for name := range s.recordings.byName {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// stopRecordings stops every recording
+func (s *Server) stopRecordings() {
+	for _, name := range s.Recordings() {
+		if _, err := s.StopRecording(name); err != nil {
+			log.WithField("caller", "server").WithError(err).Errorf("Error stopping recording %s", name)
+		}
+	}
+}
+
+// record writes a voice frame into the recordings of its channel and its sender
+func (s *Server) record(voice protocol.Voice, channel, from string) {
+	for _, name := range [2]string{"channel:" + channel, "session:" + from} {
+		rec, ok := s.recordings.get(name)
+		if !ok {
+			continue
+		}
+		var user string
+		if session, ok := s.Session(from); ok && session.Identity != nil {
+			user = session.Identity.UserID
+		}
+		if err := rec.Write(from, user, voice); err != nil {
+			log.WithField("caller", "server").WithError(err).Debugf("Not recording voice of %s", from)
+		}
+	}
+}
+
+// handleRecordStart starts recording the channel of the payload
+// The route requires auth.PermissionManageChannel in the channel
+func (s *Server) handleRecordStart(packet *protocol.Packet, clientAddr string) error {
+	if err := protocol.ValidChannelName(packet.Payload); err != nil {
+		return err
+	}
+	channel := string(packet.Payload)
+	if err := s.RecordChannel(channel); err != nil {
+		return err
+	}
+	return s.sendTo(clientAddr, protocol.PacketTypeRecordStart, []byte(channel))
+}
+
+// handleRecordStop stops recording the channel of the payload
+func (s *Server) handleRecordStop(packet *protocol.Packet, clientAddr string) error {
+	if err := protocol.ValidChannelName(packet.Payload); err != nil {
+		return err
+	}
+	channel := string(packet.Payload)
+	if _, err := s.StopRecording("channel:" + channel); err != nil {
+		return err
+	}
+	return s.sendTo(clientAddr, protocol.PacketTypeRecordStop, []byte(channel))
+}
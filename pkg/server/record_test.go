@@ -0,0 +1,57 @@
+package server_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aura-speak/networking/internal/config"
+	"github.com/aura-speak/networking/pkg/auth"
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/recorder"
+	"github.com/aura-speak/networking/pkg/testkit"
+)
+
+func TestRecordChannel(t *testing.T) {
+	cfg := &config.Default().ServerConfig
+	cfg.Server.DTLS.Path = t.TempDir() + "/"
+	cfg.Server.Recording.Dir = t.TempDir()
+	h := testkit.Start(t, testkit.Options{Config: cfg})
+	h.Server.Policy.SetRole(auth.RoleGuest, auth.PermissionSpeak|auth.PermissionListen)
+	h.Server.Policy.SetChannel("lobby", auth.RoleGuest, auth.PermissionSpeak|auth.PermissionListen|auth.PermissionManageChannel)
+	alice := h.Connect()
+	join(t, alice, "lobby")
+
+	// a channel the client may not manage
+	alice.StartRecording("other")
+	alice.ExpectPacket(protocol.PacketTypeError, 0)
+
+	alice.StartRecording("lobby")
+	alice.ExpectPacket(protocol.PacketTypeRecordStart, 0)
+	sendTone(t, alice, 100, 3)
+	alice.StopRecording("lobby")
+	alice.ExpectPacket(protocol.PacketTypeRecordStop, 0)
+	if names := h.Server.Recordings(); len(names) != 0 {
+		t.Fatalf("recordings %v after the stop", names)
+	}
+
+	sidecars, _ := filepath.Glob(filepath.Join(cfg.Server.Recording.Dir, "*.json"))
+	if len(sidecars) != 1 {
+		t.Fatalf("%d sidecars", len(sidecars))
+	}
+	data, err := os.ReadFile(sidecars[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sidecar recorder.Sidecar
+	if err := json.Unmarshal(data, &sidecar); err != nil {
+		t.Fatal(err)
+	}
+	if sidecar.Name != "channel:lobby" || len(sidecar.Speakers) != 1 || sidecar.Speakers[0].SSRC != alice.SSRC() {
+		t.Fatalf("sidecar %+v", sidecar)
+	}
+	if files := sidecar.Speakers[0].Files; len(files) != 1 || files[0].Samples != 3*480 {
+		t.Fatalf("files %+v", files)
+	}
+}
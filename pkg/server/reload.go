@@ -0,0 +1,59 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aura-speak/networking/internal/config"
+	"github.com/aura-speak/networking/pkg/auth"
+	log "github.com/sirupsen/logrus"
+)
+
+// ApplyConfig applies the parts of a new config that can change while the Server is running
+// These are the rate limits, the ban policy, the ban list and the channels
+// Channels that lost their floor control release the floor, channels that leave mix mode forward the voice again
+// The user list of the file Authenticator and the PSK keyfile are read again as well
+// Everything else, like the port or the DTLS settings, needs a restart (see config.IsLive)
+// Established sessions are kept
+//
+// Example:
+//
+//	for change := range watcher.Subscribe() {
+//		if change.Err == nil {
+//			server.ApplyConfig(&change.New.ServerConfig)
+//		}
+//	}
+func (s *Server) ApplyConfig(cfg *config.ServerConfig) error {
+	var errs []error
+	s.ipLimiter.SetLimits(newLimits(cfg.Server.RateLimit.PerIP))
+	s.sessionLimiter.SetLimits(newLimits(cfg.Server.RateLimit.PerSession))
+	s.offenders.SetPolicy(cfg.Server.RateLimit.Ban)
+
+	if cfg.Server.BanList != s.bans.Path() {
+		if err := s.bans.Open(cfg.Server.BanList); err != nil {
+			errs = append(errs, fmt.Errorf("open ban list: %w", err))
+		} else {
+			log.WithField("caller", "server").Infof("Using ban list %q", cfg.Server.BanList)
+		}
+	} else if err := s.bans.Reload(); err != nil {
+		errs = append(errs, fmt.Errorf("reload ban list: %w", err))
+	}
+
+	if a, ok := s.Authenticator.(*auth.FileAuthenticator); ok {
+		if err := a.Reload(); err != nil {
+			errs = append(errs, fmt.Errorf("reload user list: %w", err))
+		}
+	}
+
+	if s.psks != nil {
+		if err := s.psks.Reload(); err != nil {
+			errs = append(errs, fmt.Errorf("reload psk keyfile: %w", err))
+		}
+	}
+
+	previous := s.srvConfig.Swap(cfg)
+	s.channelsMu.Lock()
+	s.configureChannels(previous.Server.Channels, cfg.Server.Channels)
+	s.channelsMu.Unlock()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,127 @@
+package server_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/aura-speak/networking/internal/config"
+	"github.com/aura-speak/networking/pkg/auth"
+	"github.com/aura-speak/networking/pkg/mixer"
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/server"
+	"github.com/aura-speak/networking/pkg/testkit"
+	"github.com/pion/dtls/v3"
+)
+
+func TestApplyConfigReloadsPSKs(t *testing.T) {
+	cfg := &config.Default().ServerConfig
+	cfg.Server.DTLS.Path = t.TempDir() + "/"
+	cfg.Server.DTLS.Mode = server.DTLSModePSK
+	cfg.Server.BanList = ""
+	keyfile := filepath.Join(cfg.Server.DTLS.Path, cfg.Server.DTLS.PSKFile)
+	keys := "keys:\n  - identity: bot-1\n    key: 8d3f1a0c5e7b9d2f4a6c8e0b1d3f5a7c\n"
+	if err := os.WriteFile(keyfile, []byte(keys), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	h := testkit.Start(t, testkit.Options{Config: cfg})
+
+	bot2 := &dtls.State{IdentityHint: []byte("bot-2")}
+	if _, err := h.Server.DTLSPeerIdentity(bot2); err == nil {
+		t.Fatal("unknown psk identity accepted")
+	}
+	keys += "  - identity: bot-2\n    key: 0f1e2d3c4b5a69788796a5b4c3d2e1f0\n"
+	if err := os.WriteFile(keyfile, []byte(keys), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := *cfg
+	reloaded.Server.RateLimit.PerIP.Default.PacketsPerSecond++
+	if err := h.Server.ApplyConfig(&reloaded); err != nil {
+		t.Fatal(err)
+	}
+	identity, err := h.Server.DTLSPeerIdentity(bot2)
+	if err != nil {
+		t.Fatalf("psk identity added to the keyfile not accepted after ApplyConfig: %v", err)
+	}
+	if identity.UserID != "bot-2" {
+		t.Fatalf("psk identity of user %q", identity.UserID)
+	}
+
+	// a broken keyfile keeps the loaded keys
+	if err := os.WriteFile(keyfile, []byte("keys: ["), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Server.ApplyConfig(&reloaded); err == nil {
+		t.Fatal("broken psk keyfile applied without error")
+	}
+	if _, err := h.Server.DTLSPeerIdentity(bot2); err != nil {
+		t.Fatalf("loaded psk identity lost with a broken keyfile: %v", err)
+	}
+}
+
+func TestApplyConfigReloadsChannels(t *testing.T) {
+	cfg := &config.Default().ServerConfig
+	cfg.Server.DTLS.Path = t.TempDir() + "/"
+	cfg.Server.Channels = map[string]config.ChannelConfig{"radio": {Floor: true}}
+	h := testkit.Start(t, testkit.Options{Config: cfg})
+	h.Server.Policy.SetRole(auth.RoleGuest, auth.PermissionSpeak|auth.PermissionListen)
+	clients := h.ConnectN(2)
+	alice, bob := clients[0], clients[1]
+	for _, c := range clients {
+		join(t, c, "radio")
+	}
+	if err := alice.RequestFloor(); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range clients {
+		c.ExpectPacket(protocol.PacketTypeFloorGrant, 0)
+	}
+
+	// radio loses its floor control and mixed starts mixing
+	reloaded := *cfg
+	reloaded.Server.Channels = map[string]config.ChannelConfig{"mixed": {Mode: "mix"}}
+	if err := h.Server.ApplyConfig(&reloaded); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range clients {
+		c.ExpectPacket(protocol.PacketTypeFloorRevoke, 0)
+	}
+	sendTone(t, bob, 200, 1)
+	if voice := expectVoiceFrom(t, alice, bob.SSRC()); voice.Codec != protocol.CodecL16 {
+		t.Fatalf("forwarded %s voice in radio", voice.Codec)
+	}
+	for _, c := range clients {
+		join(t, c, "mixed")
+	}
+	sendTone(t, bob, 200, 5)
+	if got := heard(t, alice, 5*mixer.DefaultDelay); !slices.Contains(got, 200) {
+		t.Fatalf("alice heard %v in mixed, want 200", got)
+	}
+
+	// mixed forwards again once it left mix mode
+	forwarding := *cfg
+	forwarding.Server.Channels = nil
+	if err := h.Server.ApplyConfig(&forwarding); err != nil {
+		t.Fatal(err)
+	}
+	sendTone(t, bob, 200, 1)
+	expectVoiceFrom(t, alice, bob.SSRC())
+	if err := h.Server.SetGain("mixed", bob.LocalAddr().String(), 0.5); err == nil {
+		t.Fatal("set the gain of a channel that left mix mode")
+	}
+}
+
+// expectVoiceFrom skips voice frames until one with the SSRC arrives
+func expectVoiceFrom(t *testing.T, c *testkit.Client, ssrc uint32) protocol.Voice {
+	t.Helper()
+	for {
+		voice, err := protocol.DecodeVoice(c.ExpectPacket(protocol.PacketTypeVoice, 0).Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if voice.SSRC == ssrc {
+			return voice
+		}
+	}
+}
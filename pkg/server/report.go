@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/report"
+	log "github.com/sirupsen/logrus"
+)
+
+// reportPeer returns the report state for a remote address and creates it if needed
+func (s *Server) reportPeer(remote string) *report.Peer {
+	if v, ok := s.reports.Load(remote); ok {
+		return v.(*report.Peer)
+	}
+	v, _ := s.reports.LoadOrStore(remote, report.NewPeer())
+	return v.(*report.Peer)
+}
+
+// Stats returns the report statistics for all known remote addresses
+//
+// Example:
+//
+//	for addr, stats := range server.Stats() {
+//		fmt.Printf("%s: lost %d, jitter %.2fms\n", addr, stats.InboundLost, stats.InboundJitterMs)
+//	}
+func (s *Server) Stats() map[string]report.Stats {
+	stats := make(map[string]report.Stats)
+	s.reports.Range(func(key, value any) bool {
+		stats[key.(string)] = value.(*report.Peer).Stats()
+		return true
+	})
+	return stats
+}
+
+// handleSenderReport consumes a sender report from a client
+func (s *Server) handleSenderReport(packet *protocol.Packet, clientAddr string) error {
+	sr, err := protocol.DecodeSenderReport(packet.Payload)
+	if err != nil {
+		return err
+	}
+	s.reportPeer(clientAddr).HandleSenderReport(sr, s.Clock.Now())
+	return nil
+}
+
+// handleReceiverReport consumes a receiver report from a client
+func (s *Server) handleReceiverReport(packet *protocol.Packet, clientAddr string) error {
+	rr, err := protocol.DecodeReceiverReport(packet.Payload)
+	if err != nil {
+		return err
+	}
+	s.reportPeer(clientAddr).HandleReceiverReport(rr, s.Clock.Now())
+	return nil
+}
+
+// reportLoop periodically sends a sender report and, if possible, a receiver report to every remote
+// The RTP peers get a RTCP receiver report, the idle ones are removed
+// It returns when the context is done
+func (s *Server) reportLoop(ctx context.Context) {
+	ticker := s.Clock.NewTicker(s.ReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+		if atomic.LoadInt32(&s.shouldStop) == 1 {
+			return
+		}
+		s.remoteConns.Range(func(key, value any) bool {
+			s.sendReports(key.(string), value.(*net.UDPAddr))
+			return true
+		})
+		s.sendRTCP(s.Clock.Now())
+		s.expireRTPPeers(s.Clock.Now())
+		// forget removes the cached remote of a session, a remote cached while its session ended is removed here
+		s.remotes.retain(func(key string) bool {
+			_, ok := s.sessions.Load(key)
+			return ok
+		})
+	}
+}
+
+// sendReports sends the reports for one remote
+func (s *Server) sendReports(remote string, addr *net.UDPAddr) {
+	peer := s.reportPeer(remote)
+	now := s.Clock.Now()
+
+	sr := peer.SenderReport(now)
+	packets := []*protocol.Packet{{
+		PacketHeader: protocol.Header{PacketType: protocol.PacketTypeSenderReport},
+		Payload:      sr.Encode(),
+	}}
+	if rr, ok := peer.ReceiverReport(now); ok {
+		packets = append(packets, &protocol.Packet{
+			PacketHeader: protocol.Header{PacketType: protocol.PacketTypeReceiverReport},
+			Payload:      rr.Encode(),
+		})
+	}
+	for _, packet := range packets {
+		if _, err := s.conn.WriteTo(packet.Encode(), addr); err != nil {
+			log.WithField("caller", "server").WithError(err).Warnf("Error sending report to %s", remote)
+			return
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package server_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/internal/config"
+	"github.com/aura-speak/networking/pkg/auth"
+	"github.com/aura-speak/networking/pkg/clock"
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/report"
+	"github.com/aura-speak/networking/pkg/testkit"
+)
+
+func TestNoLossOnLosslessLink(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1_700_000_000, 0))
+	cfg := &config.Default().ServerConfig
+	cfg.Server.DTLS.Path = t.TempDir() + "/"
+	h := testkit.Start(t, testkit.Options{Config: cfg, Clock: fake, ReportInterval: time.Second})
+	h.Server.Policy.SetRole(auth.RoleGuest, auth.PermissionSpeak|auth.PermissionListen)
+	clients := h.ConnectN(2)
+	alice, bob := clients[0], clients[1]
+
+	// every kind of answer of the Server: replies, error replies and forwarded voice
+	join(t, alice, "lobby")
+	join(t, bob, "lobby")
+	alice.SendPacket(&protocol.Packet{PacketHeader: protocol.Header{PacketType: protocol.PacketTypeChannelJoin}, Payload: []byte("\x01")})
+	alice.ExpectPacket(protocol.PacketTypeError, 0)
+	for range 5 {
+		if err := alice.SendVoice(protocol.CodecOpus, 960, []byte{0xFC}); err != nil {
+			t.Fatal(err)
+		}
+		bob.ExpectPacket(protocol.PacketTypeVoice, 0)
+	}
+
+	// the reports are exchanged until both sides accounted for everything the other sent
+	for _, c := range clients {
+		key := c.LocalAddr().String()
+		testkit.Eventually(t, testkit.DefaultTimeout, func() bool {
+			fake.Advance(time.Second)
+			server, client := h.Server.Stats()[key], c.Stats()
+			return server.InboundExpected == client.PacketsSent && client.InboundExpected == server.PacketsSent
+		}, "sender reports of %s", key)
+		// the receiver reports that follow describe the complete stream
+		accounted := fake.Now()
+		testkit.Eventually(t, testkit.DefaultTimeout, func() bool {
+			fake.Advance(time.Second)
+			return h.Server.Stats()[key].LastReceiverReport.After(accounted) && c.Stats().LastReceiverReport.After(accounted)
+		}, "receiver reports of %s", key)
+		expectNoLoss(t, "server", h.Server.Stats()[key])
+		expectNoLoss(t, key, c.Stats())
+	}
+}
+
+func expectNoLoss(t *testing.T, side string, stats report.Stats) {
+	t.Helper()
+	if stats.PacketsSent == 0 || stats.PacketsReceived == 0 {
+		t.Fatalf("%s counted nothing: %+v", side, stats)
+	}
+	if stats.InboundLost != 0 || stats.InboundFractionLost != 0 || stats.OutboundLost != 0 || stats.OutboundFractionLost != 0 {
+		t.Fatalf("%s lost packets on a lossless link: %+v", side, stats)
+	}
+}
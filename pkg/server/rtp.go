@@ -0,0 +1,244 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/rtp"
+	"github.com/aura-speak/networking/pkg/transport"
+	log "github.com/sirupsen/logrus"
+)
+
+// MaxRTPPeers is the number of RTP senders the listener keeps at once
+// The listener has no handshake, the limit keeps spoofed sources from filling the state
+const MaxRTPPeers = 64
+
+// RTPPeerTimeout is how long a RTP peer is kept without a RTP packet
+// Spoofed sources send once, so they leave room for the real senders after the timeout
+const RTPPeerTimeout = 30 * time.Second
+
+// rtpPeer is a remote that sends plain RTP to the listener of the Server
+// It receives the voice of the clients as RTP in return
+// The first packet pins the SSRC of the peer, its voice is forwarded with the SSRC the Server chose for it
+// The extended highest sequence number of its stream is kept by its report.Peer
+type rtpPeer struct {
+	addr *net.UDPAddr
+	// localSSRC is the SSRC of the voice of the peer in the channel, like the SSRC of a session
+	localSSRC uint32
+
+	mu        sync.Mutex
+	ssrc      uint32
+	clockRate uint32
+	started   bool
+	lastSeen  time.Time
+}
+
+// received records a RTP packet of the peer
+// It returns false if the packet belongs to another source than the first packet of the peer
+func (p *rtpPeer) received(voice protocol.Voice, clockRate uint32, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.started && voice.SSRC != p.ssrc {
+		return false
+	}
+	p.ssrc, p.clockRate, p.started, p.lastSeen = voice.SSRC, clockRate, true, now
+	return true
+}
+
+// idle checks if the peer sent no RTP packet for RTPPeerTimeout
+func (p *rtpPeer) idle(now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return now.Sub(p.lastSeen) > RTPPeerTimeout
+}
+
+// ssrcOf returns the SSRC the peer sends
+func (p *rtpPeer) ssrcOf() uint32 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.ssrc
+}
+
+// source returns the SSRC and the clock rate of the peer
+func (p *rtpPeer) source() (ssrc uint32, clockRate uint32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.ssrc, p.clockRate
+}
+
+// listenRTP opens the RTP listener, it returns nil if none is configured
+func (s *Server) listenRTP() (net.PacketConn, error) {
+	if s.RTPListen == "" {
+		return nil, nil
+	}
+	conn, err := transport.UDP{}.Listen(s.RTPListen)
+	if err != nil {
+		return nil, err
+	}
+	log.WithField("caller", "server").Warnf("Accepting plain RTP without handshake on %s", conn.LocalAddr())
+	return conn, nil
+}
+
+// rtpLoop handles the datagrams of the RTP listener until it is closed
+func (s *Server) rtpLoop(conn net.PacketConn) {
+	buf := protocol.GetBuffer()
+	defer protocol.PutBuffer(buf)
+	for {
+		n, addr, err := conn.ReadFrom(*buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			continue
+		}
+		addrPort, err := addrPortOf(addr)
+		if err != nil {
+			continue
+		}
+		s.handleRTP((*buf)[:n], newRemote(addrPort))
+	}
+}
+
+// handleRTP handles a RTP or RTCP datagram of the listener
+// The bans and the IP limits apply, violations are not counted since the source address is not verified
+// The peers talk in the RTP channel, which they cannot do if it is under floor control
+// The SSRC of the voice is replaced with the SSRC of the peer, so nobody can speak as a client or another peer
+func (s *Server) handleRTP(data []byte, rm *remote) {
+	now := s.Clock.Now()
+	if s.bans.IPBanned(rm.addr.IP, now) || s.offenders.Banned(rm.ip, now) {
+		return
+	}
+	if !s.ipLimiter.Allow(rm.ip, protocol.PacketTypeVoice, len(data), now) {
+		return
+	}
+	key := "rtp:" + rm.key
+	if rtp.IsRTCP(data) {
+		s.handleRTCP(data, key, now)
+		return
+	}
+	voice, err := rtp.Depacketize(data)
+	if err != nil {
+		log.WithField("caller", "server").WithError(err).Debugf("Dropping RTP from %s", rm.key)
+		return
+	}
+	peer, ok := s.rtpPeer(key, rm.addr, now)
+	if !ok {
+		return
+	}
+	info, _ := voice.Codec.Info()
+	if !peer.received(voice, info.ClockRate, now) {
+		log.WithField("caller", "server").Debugf("Dropping RTP of SSRC %08x from %s, the peer sends SSRC %08x", voice.SSRC, rm.key, peer.ssrcOf())
+		return
+	}
+	report := s.reportPeer(key)
+	report.OnReceived(data)
+	report.OnMedia(voice.SSRC, voice.Sequence, voice.Timestamp, info.ClockRate, now)
+	if s.floors.Controlled(s.rtpChannel) {
+		return
+	}
+	voice.SSRC = peer.localSSRC
+	if err := s.routeVoice(voice, s.rtpChannel, key); err != nil {
+		log.WithField("caller", "server").WithError(err).Debugf("Dropping RTP from %s", rm.key)
+	}
+}
+
+// handleRTCP consumes the sender reports of a known RTP peer
+func (s *Server) handleRTCP(data []byte, key string, now time.Time) {
+	v, ok := s.rtpPeers.Load(key)
+	if !ok {
+		return
+	}
+	ssrc, clockRate := v.(*rtpPeer).source()
+	reports, err := rtp.DecodeReports(data, clockRate)
+	if err != nil {
+		log.WithField("caller", "server").WithError(err).Debugf("Dropping RTCP from %s", key)
+		return
+	}
+	for _, r := range reports {
+		if r.SSRC == ssrc && r.SenderReport != nil {
+			s.reportPeer(key).HandleSenderReport(*r.SenderReport, now)
+		}
+	}
+}
+
+// rtpPeer returns the peer of a RTP sender and creates it if there is room
+func (s *Server) rtpPeer(key string, addr *net.UDPAddr, now time.Time) (*rtpPeer, bool) {
+	if v, ok := s.rtpPeers.Load(key); ok {
+		return v.(*rtpPeer), true
+	}
+	if s.rtpCount.Add(1) > MaxRTPPeers {
+		s.rtpCount.Add(-1)
+		return nil, false
+	}
+	v, loaded := s.rtpPeers.LoadOrStore(key, &rtpPeer{addr: addr, localSSRC: s.newSSRC(), lastSeen: now})
+	if loaded {
+		s.rtpCount.Add(-1)
+	} else {
+		log.WithField("caller", "server").Infof("RTP peer %s joined", addr)
+	}
+	return v.(*rtpPeer), true
+}
+
+// expireRTPPeers removes the RTP peers that sent nothing for RTPPeerTimeout
+func (s *Server) expireRTPPeers(now time.Time) {
+	s.rtpPeers.Range(func(key, value any) bool {
+		if !value.(*rtpPeer).idle(now) {
+			return true
+		}
+		if _, loaded := s.rtpPeers.LoadAndDelete(key); !loaded {
+			return true
+		}
+		s.rtpCount.Add(-1)
+		s.reports.Delete(key)
+		if m, ok := s.mixer(s.rtpChannel); ok {
+			m.Remove(key.(string))
+		}
+		log.WithField("caller", "server").Infof("RTP peer %s expired", value.(*rtpPeer).addr)
+		return true
+	})
+}
+
+// sendRTP sends a RTP packet to every RTP peer except its sender
+func (s *Server) sendRTP(data []byte, from string) {
+	if s.rtpConn == nil {
+		return
+	}
+	s.rtpPeers.Range(func(key, value any) bool {
+		if key.(string) == from {
+			return true
+		}
+		if _, err := s.rtpConn.WriteTo(data, value.(*rtpPeer).addr); err != nil {
+			log.WithField("caller", "server").WithError(err).Debugf("Error sending RTP to %s", key)
+			return true
+		}
+		s.reportPeer(key.(string)).OnSent(data)
+		return true
+	})
+}
+
+// sendRTCP sends a RTCP receiver report to every RTP peer that sent a sender report
+// The Server forwards the streams of the clients with their own SSRCs, so it sends no sender report itself
+func (s *Server) sendRTCP(now time.Time) {
+	if s.rtpConn == nil {
+		return
+	}
+	s.rtpPeers.Range(func(key, value any) bool {
+		peer := value.(*rtpPeer)
+		rr, ok := s.reportPeer(key.(string)).ReceiverReport(now)
+		if !ok {
+			return true
+		}
+		ssrc, clockRate := peer.source()
+		data := rtp.AppendReport(nil, rtp.Report{
+			SSRC:   s.ssrc,
+			Blocks: []rtp.ReceptionReport{{Source: ssrc, ReceiverReport: rr}},
+		}, clockRate)
+		if _, err := s.rtpConn.WriteTo(data, peer.addr); err != nil {
+			log.WithField("caller", "server").WithError(err).Debugf("Error sending RTCP to %s", key)
+		}
+		return true
+	})
+}
@@ -0,0 +1,91 @@
+package server_test
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/internal/config"
+	"github.com/aura-speak/networking/pkg/auth"
+	"github.com/aura-speak/networking/pkg/clock"
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/rtp"
+	"github.com/aura-speak/networking/pkg/server"
+	"github.com/aura-speak/networking/pkg/testkit"
+)
+
+// startRTP starts a Server with a RTP listener for the channel "lobby" where guests may speak
+func startRTP(t *testing.T, clk clock.Clock) *testkit.Harness {
+	t.Helper()
+	cfg := &config.Default().ServerConfig
+	cfg.Server.DTLS.Path = t.TempDir() + "/"
+	cfg.Server.RTP = config.RTPConfig{Listen: "127.0.0.1:0", Channel: "lobby"}
+	h := testkit.Start(t, testkit.Options{Config: cfg, Clock: clk, ReportInterval: time.Second})
+	h.Server.Policy.SetRole(auth.RoleGuest, auth.PermissionSpeak|auth.PermissionListen)
+	// the harness returns once the Server listens, the RTP listener is open once it is alive
+	testkit.Eventually(t, testkit.DefaultTimeout, func() bool { return atomic.LoadInt32(&h.Server.IsAlive) == 1 }, "server alive")
+	return h
+}
+
+// dialRTP opens a plain RTP sender to the listener of the Server
+func dialRTP(t *testing.T, h *testkit.Harness) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("udp", h.Server.RTPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func sendRTP(t *testing.T, conn net.Conn, voice protocol.Voice) {
+	t.Helper()
+	data, err := rtp.Packetize(voice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRTPPeerCannotImpersonate(t *testing.T) {
+	h := startRTP(t, nil)
+	alice := h.Connect()
+	join(t, alice, "lobby")
+	conn := dialRTP(t, h)
+
+	// the peer claims the SSRC of alice, the voice reaches alice with the SSRC of the peer
+	sendRTP(t, conn, protocol.Voice{SSRC: alice.SSRC(), Sequence: 1, Codec: protocol.CodecOpus, Frame: []byte{0xFC}})
+	voice, err := protocol.DecodeVoice(alice.ExpectPacket(protocol.PacketTypeVoice, 0).Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if voice.SSRC == alice.SSRC() || voice.SSRC == 0 {
+		t.Fatalf("RTP forwarded with SSRC %08x, alice has %08x", voice.SSRC, alice.SSRC())
+	}
+
+	// another source from the same address is dropped
+	sendRTP(t, conn, protocol.Voice{SSRC: 7, Sequence: 2, Codec: protocol.CodecOpus, Frame: []byte{0xFC}})
+	alice.ExpectNoPacket(protocol.PacketTypeVoice, 100*time.Millisecond)
+	sendRTP(t, conn, protocol.Voice{SSRC: alice.SSRC(), Sequence: 3, Codec: protocol.CodecOpus, Frame: []byte{0xFC}})
+	if next, _ := protocol.DecodeVoice(alice.ExpectPacket(protocol.PacketTypeVoice, 0).Payload); next.SSRC != voice.SSRC {
+		t.Fatalf("SSRC of the peer changed from %08x to %08x", voice.SSRC, next.SSRC)
+	}
+}
+
+func TestRTPPeersExpire(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1_700_000_000, 0))
+	h := startRTP(t, fake)
+	sendRTP(t, dialRTP(t, h), protocol.Voice{SSRC: 1, Codec: protocol.CodecOpus, Frame: []byte{0xFC}})
+	testkit.Eventually(t, testkit.DefaultTimeout, func() bool { return h.Server.RTPPeers() == 1 }, "RTP peer")
+
+	testkit.Eventually(t, testkit.DefaultTimeout, func() bool {
+		fake.Advance(server.RTPPeerTimeout / 4)
+		return h.Server.RTPPeers() == 0
+	}, "idle RTP peer expired")
+	if _, ok := h.Server.Stats()["rtp:"+h.Server.RTPAddr().String()]; ok {
+		t.Fatal("report of an expired RTP peer")
+	}
+}
@@ -10,16 +10,28 @@ package server
 import (
 	"context"
 	"errors"
+	"math/rand/v2"
 	"net"
-	"path/filepath"
+	"net/netip"
+	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/aura-speak/networking/internal/config"
 	"github.com/aura-speak/networking/internal/util"
+	"github.com/aura-speak/networking/pkg/auth"
+	"github.com/aura-speak/networking/pkg/banlist"
+	"github.com/aura-speak/networking/pkg/certs"
+	"github.com/aura-speak/networking/pkg/clock"
+	"github.com/aura-speak/networking/pkg/floor"
 	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/ratelimit"
+	"github.com/aura-speak/networking/pkg/report"
 	"github.com/aura-speak/networking/pkg/router"
+	"github.com/aura-speak/networking/pkg/transport"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/ipv4"
 )
 
 // NOTE: Structs
@@ -37,11 +49,60 @@ import (
 // The wg for the Server
 // The out command channel
 // The packet router for the Server
+// The report state of the remote connections
+// The interval between two reports
+// The sessions of the connected clients
+// The Authenticator for the connect handshake
+// The Policy mapping roles to permissions
+// The cookie jar for the stateless cookie challenge
+// The interval after which the cookie secret is replaced
+// The rate limiters per source IP and per session
+// The automatic and the persistent bans
+// The reloadable DTLS certificates or the pre-shared keys
+// The identities authenticated by the transport
+// The transport the packet connection is opened with
+// The clock for timestamps, timeouts and tickers
+// The number of datagrams read or written with one syscall
+// The number of sockets the Server reads with SO_REUSEPORT
+// The cached remotes of the sessions
+// The listener for plain RTP and its senders
+// The channels of the sessions, their floor control and mixers
+// The running recordings
 type Server struct {
 	// Networking stuff
 	Port        int
-	conn        *net.UDPConn
+	conn        net.PacketConn
 	remoteConns *sync.Map
+	// Transport opens the packet connection, nil selects UDP or DTLS from the config
+	Transport transport.Transport
+	// Clock is the time source of the Server, a clock.Fake in tests
+	Clock clock.Clock
+	// BatchSize is the number of datagrams per recvmmsg and sendmmsg on Linux, 1 reads and writes single datagrams
+	BatchSize int
+	// Shards is the number of sockets on the port, each with its own read loop
+	// With more than one shard the handlers run concurrently, the packets of one remote stay in order
+	Shards  int
+	shards  []net.PacketConn
+	batch   *ipv4.PacketConn
+	remotes *remoteCache
+	// RTPListen is the address of the plain RTP listener, empty disables it
+	// RTP senders skip the handshake, so it should be a loopback or test network address
+	RTPListen string
+	rtpConn   net.PacketConn
+	rtpPeers  *sync.Map // "rtp:" + remote addr -> *rtpPeer
+	rtpCount  atomic.Int32
+	ssrc      uint32 // SSRC of the Server in RTCP
+	// rtpChannel is the channel the RTP peers talk and listen in
+	rtpChannel string
+
+	channels *channelMap
+	floors   *floor.Manager
+	// channelsMu guards the floors and the mixers while ApplyConfig reconfigures the channels
+	channelsMu sync.RWMutex
+	mixers     map[string]*runningMixer // channels in mix mode
+	mixCtx     context.Context          // the mixers run until it is done, nil if the Server does not run
+
+	recordings *recordings
 
 	ctx context.Context
 
@@ -58,9 +119,36 @@ type Server struct {
 	OutCommandCh chan InternalCommand
 
 	packetRouter *router.ServerPacketRouter
-	TraceCh      chan TraceEvent
+	// refused packets by protocol.ErrorCode
+	handlerErrors [256]atomic.Uint64
+	TraceCh       chan TraceEvent
+
+	// config of the Server, replaced by ApplyConfig while Run reads it
+	srvConfig atomic.Pointer[config.ServerConfig]
+
+	// Sender and receiver reports
+	reports        *sync.Map // remote addr -> *report.Peer
+	ReportInterval time.Duration
+
+	// Connect handshake
+	sessions      *sync.Map // remote addr -> *Session
+	Authenticator auth.Authenticator
+	Policy        *auth.Policy
+	cookies       *cookieJar
+	// CookieRotation is the interval of the cookie secret rotation on the Clock, zero keeps the secret
+	CookieRotation time.Duration
+
+	// Rate limits and bans
+	ipLimiter      *ratelimit.Limiter
+	sessionLimiter *ratelimit.Limiter
+	offenders      *ratelimit.Escalator
+	bans           *banlist.List
 
-	srvConfig *config.ServerConfig
+	// DTLS certificates or pre-shared keys, nil if they could not be loaded
+	dtlsMode       string
+	certs          *certs.Provider
+	psks           *auth.PSKStore
+	peerIdentities *sync.Map // remote addr -> *auth.Identity authenticated by the transport
 }
 
 // ServerState is the struct for the server state
@@ -79,26 +167,80 @@ type ServerState struct {
 // NewServer creates a new UDP Server it takes the port of the Server and the context of the Server
 func NewServer(port int, ctx context.Context, cfg *config.ServerConfig) *Server {
 	srv := &Server{
-		Port:         port,
-		remoteConns:  new(sync.Map),
-		OutCommandCh: make(chan InternalCommand, 10),
-		ctx:          ctx,
-		packetRouter: router.NewServerPacketRouter(),
+		Port:           port,
+		remoteConns:    new(sync.Map),
+		OutCommandCh:   make(chan InternalCommand, 10),
+		ctx:            ctx,
+		packetRouter:   router.NewServerPacketRouter(),
+		reports:        new(sync.Map),
+		ReportInterval: report.DefaultInterval,
+		sessions:       new(sync.Map),
+		Authenticator:  newAuthenticator(cfg),
+		Policy:         newPolicy(cfg),
+		cookies:        newCookieJar(),
+		CookieRotation: DefaultCookieRotation,
+		ipLimiter:      ratelimit.NewLimiter(newLimits(cfg.Server.RateLimit.PerIP)),
+		sessionLimiter: ratelimit.NewLimiter(newLimits(cfg.Server.RateLimit.PerSession)),
+		offenders:      ratelimit.NewEscalator(cfg.Server.RateLimit.Ban),
+		bans:           newBanList(cfg),
+		dtlsMode:       cfg.Server.DTLS.Mode,
+		peerIdentities: new(sync.Map),
+		Clock:          clock.Real,
+		BatchSize:      DefaultBatchSize,
+		Shards:         max(cfg.Server.Shards, 1),
+		remotes:        newRemoteCache(),
+		RTPListen:      cfg.Server.RTP.Listen,
+		rtpPeers:       new(sync.Map),
+		ssrc:           rand.Uint32(),
+		rtpChannel:     cfg.Server.RTP.Channel,
+		channels:       newChannelMap(),
+		recordings:     newRecordings(cfg.Server.Recording),
 	}
+	srv.srvConfig.Store(cfg)
+	srv.packetRouter.SetAuthorizer(srv.authorize)
+	srv.packetRouter.SetChannelResolver(srv.sessionChannel)
 
-	if !util.FileExists(filepath.Join(cfg.Server.DTLS.Path, cfg.Server.DTLS.Key)) ||
-		!util.FileExists(filepath.Join(cfg.Server.DTLS.Path, cfg.Server.DTLS.Cert)) ||
-		!util.FileExists(filepath.Join(cfg.Server.DTLS.Path, cfg.Server.DTLS.CA)) {
+	switch srv.dtlsMode {
+	case DTLSModePSK:
+		if store, err := newPSKStore(cfg); err != nil {
+			log.WithError(err).WithField("caller", "server").Error("Failed to load psk keyfile")
+		} else {
+			srv.psks = store
+		}
+	default:
+		if srv.dtlsMode != DTLSModeMTLS {
+			log.WithField("caller", "server").Errorf("Unknown dtls mode %q, using %s", srv.dtlsMode, DTLSModeMTLS)
+			srv.dtlsMode = DTLSModeMTLS
+		}
 		if err := util.GenerateCertificates(cfg); err != nil {
 			log.WithError(err).WithField("caller", "server").Error("Failed to generate certificates")
 		}
+		if provider, err := certs.NewProvider(certOptions(cfg)); err != nil {
+			log.WithError(err).WithField("caller", "server").Error("Failed to load certificates")
+		} else {
+			srv.certs = provider
+		}
 	}
 	srv.initTracer()
+	srv.OnPacket(protocol.PacketTypeConnect, srv.handleConnect)
 	srv.OnPacket(protocol.PacketTypeDebugHello, srv.handleDebugHello)
+	srv.OnPacket(protocol.PacketTypeSenderReport, srv.handleSenderReport)
+	srv.OnPacket(protocol.PacketTypeReceiverReport, srv.handleReceiverReport)
+	srv.OnPacketWithPermission(protocol.PacketTypeVoice, auth.PermissionSpeak, srv.handleVoice)
+	srv.OnPacketInChannel(protocol.PacketTypeChannelJoin, auth.PermissionListen, payloadChannel, srv.handleChannelJoin)
+	srv.OnPacket(protocol.PacketTypeChannelLeave, srv.handleChannelLeave)
+	srv.OnPacket(protocol.PacketTypeFloorRequest, srv.handleFloorRequest)
+	srv.OnPacket(protocol.PacketTypeFloorRelease, srv.handleFloorRelease)
+	srv.OnPacketWithPermission(protocol.PacketTypeKeyMessage, auth.PermissionListen, srv.handleKeyMessage)
+	srv.OnPacketInChannel(protocol.PacketTypeRecordStart, auth.PermissionManageChannel, payloadChannel, srv.handleRecordStart)
+	srv.OnPacketInChannel(protocol.PacketTypeRecordStop, auth.PermissionManageChannel, payloadChannel, srv.handleRecordStop)
 	return srv
 }
 
 // OnPacket registers a new PacketHandler for a specific packet type
+// The packet and its payload are only valid until the handler returns, the Server reuses their memory
+// A handler that keeps the payload has to copy it
+// With more than one shard the handlers of different remotes run concurrently
 //
 // Example:
 //
@@ -117,69 +259,166 @@ func (s *Server) Run() error {
 	if atomic.LoadInt32(&s.IsAlive) == 1 {
 		return errors.New("server is already running")
 	}
-	addr := net.UDPAddr{
-		IP:   net.IPv4(0, 0, 0, 0),
-		Port: s.Port,
+	s.useClock()
+	t, err := s.transport()
+	if err != nil {
+		return err
+	}
+	// The cookie rotation starts before the Server listens, so it follows the Clock from the first connect on
+	rotation := s.newCookieRotation()
+	s.shards, err = s.listen(t)
+	if err == nil {
+		// Stop reads the sockets once the Server is alive, so all of them are opened before
+		if s.rtpConn, err = s.listenRTP(); err != nil {
+			closeAll(s.shards)
+		}
 	}
-	var err error
-	s.conn, err = net.ListenUDP("udp", &addr)
 	if err != nil {
+		if rotation != nil {
+			rotation.Stop()
+		}
 		return err
 	}
-	defer s.conn.Close()
+	// The first shard sends all packets, the remotes see the same port on every shard
+	s.conn = s.shards[0]
+	s.batch = batchConn(s.conn, s.BatchSize)
+	// The background goroutines end with Run, so a stopped Server leaves nothing running
+	runCtx, cancel := context.WithCancel(s.ctx)
+	defer s.wg.Wait()
+	// ApplyConfig starts no mixer once the context is done
+	defer func() {
+		s.channelsMu.Lock()
+		defer s.channelsMu.Unlock()
+		cancel()
+		s.mixCtx = nil
+	}()
+	s.channelsMu.Lock()
+	// The talk time timers run on the Clock, which may be replaced until Run
+	s.floors = floor.NewManager(s.Clock, s.floorEvents)
+	s.mixCtx = runCtx
+	s.configureChannels(nil, s.srvConfig.Load().Server.Channels)
+	s.channelsMu.Unlock()
+	// The read loops of the other shards end once their sockets are closed, so they are closed before the wait
+	var shardWG sync.WaitGroup
+	defer shardWG.Wait()
+	defer closeAll(s.shards)
 	s.setIsAlive(true)
-	log.WithField("caller", "server").Infof("Server started on port %d", s.Port)
+	log.WithField("caller", "server").Infof("Server started on port %d with %d shards", s.Port, len(s.shards))
+	s.wg.Go(func() {
+		s.reportLoop(runCtx)
+	})
+	s.wg.Go(func() {
+		s.cookieLoop(runCtx, rotation)
+	})
+	if s.certs != nil {
+		s.wg.Go(func() {
+			s.certs.Watch(runCtx, certs.DefaultReloadInterval)
+		})
+	}
+
+	if s.rtpConn != nil {
+		defer s.rtpConn.Close()
+		shardWG.Go(func() {
+			s.rtpLoop(s.rtpConn)
+		})
+	}
+
+	for _, conn := range s.shards[1:] {
+		shardWG.Go(func() {
+			s.readLoop(conn)
+		})
+	}
+	s.readLoop(s.conn)
+	s.setIsAlive(false)
+	return nil
+}
+
+// readLoop handles the datagrams of one shard until the Server stops or the socket is closed
+func (s *Server) readLoop(conn net.PacketConn) {
+	recv := newReceiver(conn, s.BatchSize)
+	defer recv.release()
+	// The packet is reused for every datagram, handlers must not keep it
+	packet := new(protocol.Packet)
 
 	// Infinite loop that listens for incoming UDP packets
 	for {
 		select {
 		case <-s.ctx.Done():
-			return nil
+			return
 		case <-s.OutCommandCh:
 		default:
 		}
-		shouldStop := atomic.LoadInt32(&s.shouldStop) == 1
-		if shouldStop {
-			break
+		if atomic.LoadInt32(&s.shouldStop) == 1 {
+			return
+		}
+		n, err := recv.read()
+		if errors.Is(err, net.ErrClosed) {
+			return
 		}
-		// TODO: Change this Later
-		// Buffer to hold incoming data
-		buf := make([]byte, 1024)
-		n, remoteAddr, err := s.conn.ReadFromUDP(buf)
 		if err != nil {
 			continue
 		}
-		// Check if it is a new remote address
-		// If so, store it in the map
-		if _, ok := s.remoteConns.Load(remoteAddr.String()); !ok {
-			s.remoteConns.Store(remoteAddr.String(), remoteAddr)
+		for i := range n {
+			data, addrPort := recv.datagram(i)
+			s.handleDatagram(data, addrPort, packet)
 		}
-		packet, err := protocol.Decode(buf[:n])
-		s.trace(TraceIn, remoteAddr, packet.Payload)
-		if err != nil {
-			log.WithField("caller", "server").WithError(err).Error("Error decoding packet")
-			continue
+	}
+}
+
+// handleDatagram admits, decodes and routes one datagram
+func (s *Server) handleDatagram(data []byte, addrPort netip.AddrPort, packet *protocol.Packet) {
+	if !addrPort.IsValid() {
+		return
+	}
+	rm := s.remote(addrPort)
+	if !s.admit(rm, data, s.Clock.Now()) {
+		return
+	}
+	if err := protocol.DecodeInto(packet, data); err != nil {
+		// Anybody can send garbage, so this is no error of the Server
+		log.WithField("caller", "server").WithError(err).Debugf("Dropping undecodable datagram from %s", rm.key)
+		return
+	}
+	s.trace(TraceIn, rm.addr, packet.Payload)
+	verified := s.isClient(rm.key)
+	if !verified && packet.PacketHeader.PacketType != protocol.PacketTypeConnect {
+		log.WithField("caller", "server").Debugf("Dropping packet from unverified remote %s", rm.key)
+		return
+	}
+	// Only clients have report state, a spoofed source leaves nothing behind
+	if verified {
+		s.reportPeer(rm.key).OnReceived(data)
+	}
+	if err := s.packetRouter.HandlePacket(packet, rm.key); err != nil {
+		if !verified {
+			// The source address is not verified, the connect handshake answers it on its own
+			log.WithField("caller", "server").WithError(err).Debugf("Refused connect from %s", rm.key)
+			return
 		}
-		if err := s.packetRouter.HandlePacket(packet, remoteAddr.String()); err != nil {
-			log.WithField("caller", "server").WithError(err).Error("Error handling packet")
-			continue
+		if s.replyError(rm.key, rm.addr, packet.PacketHeader.PacketType, err) {
+			// the client sent a packet it should not have, the reply tells it why
+			log.WithField("caller", "server").WithError(err).Debugf("Refused packet from %s", rm.key)
+			return
 		}
+		log.WithField("caller", "server").WithError(err).Error("Error handling packet")
 	}
-	s.setIsAlive(false)
-	return nil
 }
 
+// Broadcast sends the packet to all connected clients
+// The packet is encoded once before Broadcast returns, so a handler may broadcast the packet it handles
+//
+// Example:
+//
+//	server.OnPacket(protocol.PacketTypeDebugAny, func(packet *protocol.Packet, clientAddr string) error {
+//		server.Broadcast(packet)
+//		return nil
+//	})
 func (s *Server) Broadcast(packet *protocol.Packet) {
+	buf := protocol.GetBuffer()
+	data := packet.AppendEncode((*buf)[:0])
 	s.wg.Go(func() {
-		s.remoteConns.Range(func(key, value any) bool {
-			if _, err := s.conn.WriteToUDP(packet.Encode(), value.(*net.UDPAddr)); err != nil {
-				// Remove client if needed
-				s.remoteConns.Delete(key)
-				return true
-			}
-			s.trace(TraceOut, value.(*net.UDPAddr), packet.Payload)
-			return true
-		})
+		defer protocol.PutBuffer(buf)
+		s.sendAll(data)
 	})
 }
 
@@ -190,12 +429,15 @@ func (s *Server) Stop() {
 	// Send stop message to all connected clients
 	if s.conn != nil {
 		s.remoteConns.Range(func(key, value any) bool {
-			s.conn.WriteToUDP([]byte("STOP"), value.(*net.UDPAddr))
+			s.conn.WriteTo([]byte("STOP"), value.(*net.UDPAddr))
 			return true
 		})
 
-		// Close the UDP connection to interrupt ReadFrom
-		s.conn.Close()
+		// Close the UDP connections to interrupt the read loops
+		closeAll(s.shards)
+	}
+	if s.rtpConn != nil {
+		s.rtpConn.Close()
 	}
 
 	// Clear all remote connections
@@ -203,6 +445,20 @@ func (s *Server) Stop() {
 		s.remoteConns.Delete(key)
 		return true
 	})
+	s.sessions.Range(func(key, value any) bool {
+		value.(*Session).stopExpiry()
+		return true
+	})
+	s.sessions.Clear()
+	s.peerIdentities.Clear()
+	s.rtpPeers.Clear()
+	s.rtpCount.Store(0)
+	s.channels.clear()
+	s.stopRecordings()
+	if s.floors != nil {
+		s.floors.Reset()
+	}
+	s.remotes.retain(func(string) bool { return false })
 }
 
 // setShouldStop sets the shouldStop sign for the Server
@@ -234,3 +490,64 @@ func (s *Server) setIsAlive(val bool) {
 	s.updated = true
 	s.ServerState.IsAlive = val
 }
+
+// clockSetter is a part of the Server that keeps time on a Clock
+type clockSetter interface {
+	SetClock(clk clock.Clock)
+}
+
+// useClock hands the Clock of the Server to the ban list, the Authenticator and the certificates
+// The Clock may be replaced until Run, so they get it when the Server starts
+func (s *Server) useClock() {
+	s.bans.SetClock(s.Clock)
+	if a, ok := s.Authenticator.(clockSetter); ok {
+		a.SetClock(s.Clock)
+	}
+	if s.certs != nil {
+		s.certs.SetClock(s.Clock)
+	}
+}
+
+// transport returns the transport of the Server
+// Without a transport the server.transport setting selects UDP or DTLS
+func (s *Server) transport() (transport.Transport, error) {
+	if s.Transport != nil {
+		return s.Transport, nil
+	}
+	if cfg := s.srvConfig.Load(); cfg != nil && cfg.Server.Transport == TransportDTLS {
+		return s.DTLSTransport(nil)
+	}
+	return transport.UDP{}, nil
+}
+
+// listen opens the sockets of the Server, one per shard
+// A transport that is not transport.Sharded opens one socket
+func (s *Server) listen(t transport.Transport) ([]net.PacketConn, error) {
+	addr := net.JoinHostPort("0.0.0.0", strconv.Itoa(s.Port))
+	if s.Shards > 1 {
+		if sharded, ok := t.(transport.Sharded); ok {
+			return sharded.ListenShards(addr, s.Shards)
+		}
+		log.WithField("caller", "server").Warnf("Transport %T has no shards, listening on one socket", t)
+	}
+	conn, err := t.Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	return []net.PacketConn{conn}, nil
+}
+
+func closeAll(conns []net.PacketConn) {
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+// udpAddr returns the UDP address of a remote
+// All transports use UDP addresses, other addresses are parsed from their string
+func udpAddr(addr net.Addr) (*net.UDPAddr, error) {
+	if udp, ok := addr.(*net.UDPAddr); ok {
+		return udp, nil
+	}
+	return net.ResolveUDPAddr("udp", addr.String())
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/aura-speak/networking/internal/config"
+	"github.com/aura-speak/networking/pkg/auth"
+	"github.com/aura-speak/networking/pkg/clock"
+	"github.com/aura-speak/networking/pkg/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// Session is the state of a client that completed the connect handshake
+// It contains the address of the client
+// The authenticated identity, nil if the Server has no Authenticator
+// The time the handshake completed
+// The SSRC of the voice stream of the client
+// The timer that ends the session when the credential expires
+type Session struct {
+	Addr        *net.UDPAddr
+	Identity    *auth.Identity
+	ConnectedAt time.Time
+	SSRC        uint32
+
+	expiry clock.Timer
+}
+
+// Session returns the session of a client address
+//
+// Example:
+//
+//	server.OnPacket(protocol.PacketTypeDebugAny, func(packet *protocol.Packet, clientAddr string) error {
+//		if session, ok := server.Session(clientAddr); ok && session.Identity != nil {
+//			fmt.Println("Packet from user:", session.Identity.UserID)
+//		}
+//		return nil
+//	})
+func (s *Server) Session(clientAddr string) (*Session, bool) {
+	v, ok := s.sessions.Load(clientAddr)
+	if !ok {
+		return nil, false
+	}
+	return v.(*Session), true
+}
+
+// isClient checks if the remote address has a session
+// Only the packets of clients are handled and answered, everybody else may only send a connect
+// A session exists only after the remote returned a valid cookie, so its address is verified
+func (s *Server) isClient(remote string) bool {
+	_, ok := s.sessions.Load(remote)
+	return ok
+}
+
+// handleConnect validates the credential of a connect handshake and creates the session
+// If the transport already authenticated the remote (DTLS PSK or client certificate) its identity is used
+// Until the remote returns a valid cookie nothing is stored and the answer is never larger than the request
+// A connect of a client with a session re-authenticates it, it keeps its SSRC and channel and gets the new identity
+func (s *Server) handleConnect(packet *protocol.Packet, clientAddr string) error {
+	addr, err := net.ResolveUDPAddr("udp", clientAddr)
+	if err != nil {
+		return err
+	}
+	request, err := protocol.DecodeConnectRequest(packet.Payload)
+	if err != nil {
+		// The address is not verified yet, so there is no answer
+		return err
+	}
+
+	if !s.cookies.verify(addr, request.Cookie) {
+		return s.helloVerify(addr, protocol.HeaderSize+len(packet.Payload))
+	}
+
+	identity := s.peerIdentity(clientAddr)
+	if identity == nil && s.Authenticator != nil {
+		identity, err = s.Authenticator.Authenticate(request.Credential)
+		if err != nil {
+			s.rejectConnect(addr, rejectReasonFor(err))
+			return err
+		}
+	}
+	if identity != nil && s.bans.UserBanned(identity.UserID, s.Clock.Now()) {
+		s.rejectConnect(addr, protocol.RejectReasonBanned)
+		return fmt.Errorf("user %s is banned", identity.UserID)
+	}
+
+	if identity != nil && !identity.ExpiresAt.IsZero() && !s.Clock.Now().Before(identity.ExpiresAt) {
+		s.rejectConnect(addr, protocol.RejectReasonExpired)
+		return fmt.Errorf("credential of %s expired at %s", clientAddr, identity.ExpiresAt)
+	}
+
+	session := &Session{
+		Addr:        addr,
+		Identity:    identity,
+		ConnectedAt: s.Clock.Now(),
+	}
+	previous, reauthenticated := s.Session(clientAddr)
+	if reauthenticated {
+		session.ConnectedAt, session.SSRC = previous.ConnectedAt, previous.SSRC
+		previous.stopExpiry()
+	} else {
+		session.SSRC = s.newSSRC()
+	}
+	s.sessions.Store(clientAddr, session)
+	s.remoteConns.Store(clientAddr, addr)
+	s.expireAt(clientAddr, session)
+
+	fields := log.Fields{"caller": "server", "remote": clientAddr}
+	if identity != nil {
+		fields["user"] = identity.UserID
+	}
+	if reauthenticated {
+		log.WithFields(fields).Info("Client reauthenticated")
+	} else {
+		log.WithFields(fields).Info("Client connected")
+	}
+
+	// The accept tells the client its SSRC, so it recognizes its own floor grants
+	accept := &protocol.Packet{
+		PacketHeader: protocol.Header{PacketType: protocol.PacketTypeConnectAccept},
+		Payload:      (&protocol.ConnectAccept{SSRC: session.SSRC}).Encode(),
+	}
+	_, err = s.conn.WriteTo(accept.Encode(), addr)
+	return err
+}
+
+// expireAt ends the session when the credential of its identity expires
+// The client is told with a connect reject, it may connect again with a fresh credential
+func (s *Server) expireAt(clientAddr string, session *Session) {
+	if session.Identity == nil || session.Identity.ExpiresAt.IsZero() {
+		return
+	}
+	session.expiry = s.Clock.AfterFunc(session.Identity.ExpiresAt.Sub(s.Clock.Now()), func() {
+		// a reauthenticated session is a new Session, so the old timer leaves it alone
+		if current, ok := s.Session(clientAddr); !ok || current != session {
+			return
+		}
+		log.WithFields(log.Fields{"caller": "server", "remote": clientAddr, "user": session.Identity.UserID}).Info("Credential expired")
+		s.rejectConnect(session.Addr, protocol.RejectReasonExpired)
+		s.forget(clientAddr)
+	})
+}
+
+// stopExpiry stops the expiry timer of a session
+func (session *Session) stopExpiry() {
+	if session.expiry != nil {
+		session.expiry.Stop()
+	}
+}
+
+// helloVerify answers a connect without a valid cookie with a cookie challenge
+// The answer is dropped if it would be larger than the request
+func (s *Server) helloVerify(addr *net.UDPAddr, requestSize int) error {
+	verify := &protocol.HelloVerify{Cookie: s.cookies.cookie(addr)}
+	packet := &protocol.Packet{
+		PacketHeader: protocol.Header{PacketType: protocol.PacketTypeHelloVerify},
+		Payload:      verify.Encode(),
+	}
+	data := packet.Encode()
+	if len(data) > requestSize {
+		return fmt.Errorf("connect from %s too small for a hello verify (%d < %d bytes)", addr.String(), requestSize, len(data))
+	}
+	_, err := s.conn.WriteTo(data, addr)
+	return err
+}
+
+// rejectConnect sends a connect reject with the reason to the remote
+func (s *Server) rejectConnect(addr *net.UDPAddr, reason protocol.RejectReason) {
+	log.WithField("caller", "server").Warnf("Rejecting connect from %s: %s", addr.String(), reason)
+	reject := &protocol.ConnectReject{Reason: reason}
+	packet := &protocol.Packet{
+		PacketHeader: protocol.Header{PacketType: protocol.PacketTypeConnectReject},
+		Payload:      reject.Encode(),
+	}
+	if _, err := s.conn.WriteTo(packet.Encode(), addr); err != nil {
+		log.WithField("caller", "server").WithError(err).Error("Error sending connect reject")
+	}
+}
+
+// rejectReasonFor maps an authentication error to the reject reason of the handshake
+func rejectReasonFor(err error) protocol.RejectReason {
+	switch {
+	case errors.Is(err, auth.ErrMissingCredential):
+		return protocol.RejectReasonMissingCredential
+	case errors.Is(err, auth.ErrMalformedToken):
+		return protocol.RejectReasonMalformed
+	case errors.Is(err, auth.ErrInvalidSignature):
+		return protocol.RejectReasonInvalidCredential
+	case errors.Is(err, auth.ErrTokenExpired):
+		return protocol.RejectReasonExpired
+	case errors.Is(err, auth.ErrUnknownUser):
+		return protocol.RejectReasonUnknownUser
+	case errors.Is(err, auth.ErrUserDisabled):
+		return protocol.RejectReasonUserDisabled
+	default:
+		return protocol.RejectReasonUnknown
+	}
+}
+
+// denyAuthenticator rejects every credential
+// It is used when the configured Authenticator could not be created, so a broken config does not open the Server
+type denyAuthenticator struct {
+	err error
+}
+
+func (a denyAuthenticator) Authenticate(credential []byte) (*auth.Identity, error) {
+	return nil, a.err
+}
+
+// newAuthenticator creates the Authenticator configured in the server config
+// It returns nil if authentication is disabled
+func newAuthenticator(cfg *config.ServerConfig) auth.Authenticator {
+	switch cfg.Server.Auth.Mode {
+	case "", "none":
+		return nil
+	case "static":
+		if cfg.Server.Auth.Secret == "" {
+			log.WithField("caller", "server").Error("auth mode static requires a secret, rejecting all clients")
+			return denyAuthenticator{err: auth.ErrInvalidSignature}
+		}
+		return auth.NewStaticSecretAuthenticator([]byte(cfg.Server.Auth.Secret))
+	case "file":
+		a, err := auth.NewFileAuthenticator(cfg.Server.Auth.UsersFile)
+		if err != nil {
+			log.WithField("caller", "server").WithError(err).Error("Failed to load user list, rejecting all clients")
+			return denyAuthenticator{err: auth.ErrUnknownUser}
+		}
+		return a
+	default:
+		log.WithField("caller", "server").Errorf("Unknown auth mode %q, rejecting all clients", cfg.Server.Auth.Mode)
+		return denyAuthenticator{err: auth.ErrUnknownUser}
+	}
+}
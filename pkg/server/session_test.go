@@ -0,0 +1,196 @@
+package server_test
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/auth"
+	"github.com/aura-speak/networking/pkg/clock"
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/server"
+	"github.com/aura-speak/networking/pkg/testkit"
+)
+
+// expiringAuthenticator accepts every credential as user ID, the identity expires after ttl
+type expiringAuthenticator struct {
+	clock clock.Clock
+	ttl   time.Duration
+}
+
+func (a expiringAuthenticator) Authenticate(credential []byte) (*auth.Identity, error) {
+	return &auth.Identity{UserID: string(credential), Role: auth.RoleGuest, ExpiresAt: a.clock.Now().Add(a.ttl)}, nil
+}
+
+func TestSessionExpires(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1_700_000_000, 0))
+	h := testkit.Start(t, testkit.Options{Clock: fake})
+	h.Server.Authenticator = expiringAuthenticator{clock: fake, ttl: time.Minute}
+	alice := h.ConnectWith(testkit.ClientOptions{Credential: []byte("alice")})
+
+	fake.Advance(time.Minute - time.Second)
+	alice.ExpectNoPacket(protocol.PacketTypeConnectReject, 50*time.Millisecond)
+
+	fake.Advance(time.Second)
+	reject, err := protocol.DecodeConnectReject(alice.ExpectPacket(protocol.PacketTypeConnectReject, 0).Payload)
+	if err != nil || reject.Reason != protocol.RejectReasonExpired {
+		t.Fatalf("reject %v, %v", reject, err)
+	}
+	testkit.Eventually(t, testkit.DefaultTimeout, func() bool { return !alice.Connected() }, "client disconnected")
+	if _, ok := h.Server.Session(alice.LocalAddr().String()); ok {
+		t.Fatal("session of an expired credential is kept")
+	}
+}
+
+func TestReauthenticateExtendsSession(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1_700_000_000, 0))
+	h := testkit.Start(t, testkit.Options{Clock: fake})
+	h.Server.Authenticator = expiringAuthenticator{clock: fake, ttl: time.Minute}
+	alice := h.ConnectWith(testkit.ClientOptions{Credential: []byte("alice")})
+	key := alice.LocalAddr().String()
+	before, _ := h.Server.Session(key)
+
+	fake.Advance(30 * time.Second)
+	if err := alice.Reauthenticate([]byte("alice")); err != nil {
+		t.Fatal(err)
+	}
+	testkit.Eventually(t, testkit.DefaultTimeout, func() bool {
+		session, ok := h.Server.Session(key)
+		return ok && session.Identity.ExpiresAt.After(before.Identity.ExpiresAt)
+	}, "session reauthenticated")
+	after, _ := h.Server.Session(key)
+	if after.SSRC != before.SSRC || !after.ConnectedAt.Equal(before.ConnectedAt) {
+		t.Fatalf("reauthenticated session %+v, was %+v", after, before)
+	}
+
+	// the first credential would have expired now
+	fake.Advance(30 * time.Second)
+	alice.ExpectNoPacket(protocol.PacketTypeConnectReject, 50*time.Millisecond)
+	fake.Advance(30 * time.Second)
+	alice.ExpectPacket(protocol.PacketTypeConnectReject, 0)
+}
+
+// handshake sends a connect with the cookie from conn and returns the handshake answer of the Server
+func handshake(t *testing.T, conn net.Conn, cookie []byte) *protocol.Packet {
+	t.Helper()
+	request := &protocol.ConnectRequest{Cookie: cookie}
+	packet := &protocol.Packet{PacketHeader: protocol.Header{PacketType: protocol.PacketTypeConnect}, Payload: request.Encode()}
+	if _, err := conn.Write(packet.Encode()); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, protocol.BufferSize)
+	conn.SetReadDeadline(time.Now().Add(testkit.DefaultTimeout))
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		answer, err := protocol.Decode(buf[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a connected remote also receives reports
+		switch answer.PacketHeader.PacketType {
+		case protocol.PacketTypeHelloVerify, protocol.PacketTypeConnectAccept, protocol.PacketTypeConnectReject:
+			return answer
+		}
+	}
+}
+
+// cookieOf returns the cookie the Server currently hands out to conn
+func cookieOf(t *testing.T, conn net.Conn) []byte {
+	t.Helper()
+	verify, err := protocol.DecodeHelloVerify(handshake(t, conn, nil).Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return verify.Cookie
+}
+
+func TestCookieRotatesOnClock(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1_700_000_000, 0))
+	h := testkit.Start(t, testkit.Options{Clock: fake})
+	// a raw connection, a Client would answer every HelloVerify with a connect
+	conn, err := h.Memory.Dial(net.JoinHostPort("127.0.0.1", strconv.Itoa(h.Addr().(*net.UDPAddr).Port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	first := cookieOf(t, conn)
+
+	fake.Advance(server.DefaultCookieRotation)
+	var second []byte
+	testkit.Eventually(t, testkit.DefaultTimeout, func() bool {
+		second = cookieOf(t, conn)
+		return !bytes.Equal(second, first)
+	}, "cookie secret rotated")
+	// the cookie of the previous secret stays valid for one interval
+	if answer := handshake(t, conn, first); answer.PacketHeader.PacketType != protocol.PacketTypeConnectAccept {
+		t.Fatalf("cookie of the previous secret answered with packet type %d", answer.PacketHeader.PacketType)
+	}
+
+	fake.Advance(server.DefaultCookieRotation)
+	testkit.Eventually(t, testkit.DefaultTimeout, func() bool {
+		return !bytes.Equal(cookieOf(t, conn), second)
+	}, "cookie secret rotated again")
+	if answer := handshake(t, conn, first); answer.PacketHeader.PacketType != protocol.PacketTypeHelloVerify {
+		t.Fatalf("cookie of a secret two rotations ago answered with packet type %d", answer.PacketHeader.PacketType)
+	}
+}
+
+func TestErrorReplies(t *testing.T) {
+	h := startChannels(t)
+	alice := h.Connect()
+	refused := func(packetType protocol.PacketType, payload []byte, want protocol.ErrorCode) {
+		t.Helper()
+		alice.SendPacket(&protocol.Packet{PacketHeader: protocol.Header{PacketType: packetType}, Payload: payload})
+		reply, err := protocol.DecodeErrorReply(alice.ExpectPacket(protocol.PacketTypeError, 0).Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply.Code != want || reply.PacketType != packetType {
+			t.Fatalf("error reply %+v, want %s for packet type %d", reply, want, packetType)
+		}
+	}
+	refused(protocol.PacketTypeChannelJoin, []byte("lob\x00by"), protocol.ErrorCodeMalformed)
+	refused(protocol.PacketTypeHelloVerify, nil, protocol.ErrorCodeUnsupported)
+	refused(protocol.PacketTypeVoice, (&protocol.Voice{Codec: protocol.CodecOpus, Frame: []byte{0xFC}}).Encode(), protocol.ErrorCodeInvalidState)
+
+	errs := h.Server.HandlerErrors()
+	if errs[protocol.ErrorCodeMalformed] != 1 || errs[protocol.ErrorCodeUnsupported] != 1 || errs[protocol.ErrorCodeInvalidState] != 1 {
+		t.Fatalf("handler errors %v", errs)
+	}
+}
+
+func TestNoAnswerToUnverifiedRemote(t *testing.T) {
+	h := testkit.Start(t, testkit.Options{})
+	conn, err := h.Memory.Dial(net.JoinHostPort("127.0.0.1", strconv.Itoa(h.Addr().(*net.UDPAddr).Port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// neither a truncated connect nor a packet before the handshake are answered
+	for _, packet := range []*protocol.Packet{
+		{PacketHeader: protocol.Header{PacketType: protocol.PacketTypeConnect}, Payload: []byte{16, 0x00}},
+		{PacketHeader: protocol.Header{PacketType: protocol.PacketTypeChannelJoin}, Payload: []byte("lob\x00by")},
+	} {
+		if _, err := conn.Write(packet.Encode()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf := make([]byte, protocol.BufferSize)
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if n, err := conn.Read(buf); err == nil {
+		t.Fatalf("unverified remote answered with % x", buf[:n])
+	}
+	// a wrong cookie only gets a new one
+	if answer := handshake(t, conn, []byte("guessed")); answer.PacketHeader.PacketType != protocol.PacketTypeHelloVerify {
+		t.Fatalf("connect with a wrong cookie answered with packet type %d", answer.PacketHeader.PacketType)
+	}
+	if _, ok := h.Server.Stats()[conn.LocalAddr().String()]; ok {
+		t.Fatal("report state of an unverified remote")
+	}
+}
@@ -4,6 +4,7 @@
 package server
 
 import (
+	"bytes"
 	"net"
 	"time"
 
@@ -27,9 +28,9 @@ type TraceEvent struct {
 	ClientID int            `json:"client_id"`
 }
 
-func NewTraceEvent(dir TraceDirection, local string, remote string, len int, payload []byte, clientID int) TraceEvent {
+func NewTraceEvent(ts time.Time, dir TraceDirection, local string, remote string, len int, payload []byte, clientID int) TraceEvent {
 	return TraceEvent{
-		TS:       time.Now(),
+		TS:       ts,
 		Dir:      dir,
 		Local:    local,
 		Remote:   remote,
@@ -51,9 +52,11 @@ func (s *Server) emitTrace(dir TraceDirection, local, remote string, payload []b
 	if len(payload) > 1024 {
 		payload = payload[:1024]
 	}
+	// the Server reuses the memory of the payload once the packet is handled
+	payload = bytes.Clone(payload)
 
 	select {
-	case s.TraceCh <- NewTraceEvent(dir, local, remote, len(payload), payload, clientID):
+	case s.TraceCh <- NewTraceEvent(s.Clock.Now(), dir, local, remote, len(payload), payload, clientID):
 	default:
 	}
 }
@@ -3,7 +3,10 @@
 
 package server
 
-import "net"
+import (
+	"net"
+	"time"
+)
 
 type TraceDirection string
 
@@ -16,7 +19,7 @@ type TraceEvent struct{}
 
 func (s *Server) initTracer() chan TraceEvent { return nil }
 
-func NewTraceEvent(dir TraceDirection, local string, remote string, len int, payload []byte, clientID int) *TraceEvent {
+func NewTraceEvent(ts time.Time, dir TraceDirection, local string, remote string, len int, payload []byte, clientID int) *TraceEvent {
 	return nil
 }
 
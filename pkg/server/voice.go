@@ -0,0 +1,92 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/rtp"
+	log "github.com/sirupsen/logrus"
+)
+
+// handleVoice forwards a voice frame of a client to the other members of its channel or mixes it
+// The SSRC of the frame is replaced with the SSRC of the session, so nobody can speak as somebody else
+// The route requires auth.PermissionSpeak in the channel, guests only listen unless the Server runs without authentication
+// In a channel with floor control only the holder of the floor is forwarded, the frames of the others are dropped
+func (s *Server) handleVoice(packet *protocol.Packet, clientAddr string) error {
+	session, ok := s.Session(clientAddr)
+	if !ok {
+		return stateError("voice from " + clientAddr + " without session")
+	}
+	channel, ok := s.channels.channel(clientAddr)
+	if !ok {
+		return stateError("voice from " + clientAddr + " outside of a channel")
+	}
+	if !s.floors.MayTalk(channel, clientAddr) {
+		return nil
+	}
+	// the payload is the receive buffer of the Server, it may be changed in place
+	if !protocol.SetVoiceSSRC(packet.Payload, session.SSRC) {
+		return errors.New("voice frame too short")
+	}
+	voice, err := protocol.DecodeVoice(packet.Payload)
+	if err != nil {
+		return err
+	}
+	info, ok := voice.Codec.Info()
+	if !ok {
+		return fmt.Errorf("voice frame with unknown codec %s", voice.Codec)
+	}
+	s.reportPeer(clientAddr).OnMedia(voice.SSRC, voice.Sequence, voice.Timestamp, info.ClockRate, s.Clock.Now())
+	return s.routeVoice(voice, channel, clientAddr)
+}
+
+// forwardVoice sends a voice frame to every member of a channel except its sender
+// The RTP peers are members of the RTP channel of the Server
+// The frame is encoded before forwardVoice returns, so it may point into a receive buffer
+func (s *Server) forwardVoice(voice protocol.Voice, channel, from string) {
+	buf := protocol.GetBuffer()
+	data := voice.AppendEncode(append((*buf)[:0], byte(protocol.PacketTypeVoice)))
+	// only the RTP channel is heard by the RTP peers
+	var rtpBuf *[]byte
+	var rtpData []byte
+	if channel == s.rtpChannel && s.rtpConn != nil {
+		rtpBuf = protocol.GetBuffer()
+		var err error
+		if rtpData, err = rtp.AppendPacketize((*rtpBuf)[:0], voice); err != nil {
+			log.WithField("caller", "server").WithError(err).Debugf("Not forwarding the voice of %s as RTP", from)
+			rtpData = nil
+		}
+	}
+	s.wg.Go(func() {
+		defer protocol.PutBuffer(buf)
+		s.send(data, func(key string) bool { return key != from && s.channels.in(key, channel) })
+		if rtpBuf == nil {
+			return
+		}
+		defer protocol.PutBuffer(rtpBuf)
+		if rtpData != nil {
+			s.sendRTP(rtpData, from)
+		}
+	})
+}
+
+// newSSRC returns a random SSRC that no session or RTP peer uses yet
+func (s *Server) newSSRC() uint32 {
+	for {
+		ssrc := rand.Uint32()
+		used := ssrc == s.ssrc
+		s.sessions.Range(func(key, value any) bool {
+			used = used || value.(*Session).SSRC == ssrc
+			return !used
+		})
+		s.rtpPeers.Range(func(key, value any) bool {
+			used = used || value.(*rtpPeer).localSSRC == ssrc
+			return !used
+		})
+		if !used {
+			return ssrc
+		}
+	}
+}
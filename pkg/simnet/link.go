@@ -0,0 +1,155 @@
+package simnet
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Link is the impairment of one direction between two endpoints
+// A Network has one Link per direction between two hosts, a proxy can use Links without a Network
+//
+// Example:
+//
+//	up := simnet.NewLink(1, nil, simnet.Profile{Loss: 0.02})
+//	for _, delay := range up.Send(len(datagram)) {
+//		scheduler.After(delay, func() { conn.Write(datagram) })
+//	}
+type Link struct {
+	clock Clock
+
+	mu        sync.Mutex
+	profile   Profile
+	rand      *rand.Rand
+	bad       bool      // state of the Gilbert-Elliott model
+	busyUntil time.Time // time the bandwidth is used until
+	stats     LinkStats
+}
+
+// NewLink creates a Link with a profile, the clock is the real time if nil
+// Links with the same seed and profile make the same decisions for the same datagrams
+func NewLink(seed uint64, clock Clock, p Profile) *Link {
+	return newLink(seed, 0, clock, p)
+}
+
+func newLink(seed1, seed2 uint64, clock Clock, p Profile) *Link {
+	if clock == nil {
+		clock = realClock
+	}
+	return &Link{
+		clock:   clock,
+		profile: p,
+		rand:    rand.New(rand.NewPCG(seed1, seed2)),
+	}
+}
+
+// SetProfile changes the profile, the state of the burst loss model and the bandwidth queue are kept
+func (l *Link) SetProfile(p Profile) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.profile = p
+}
+
+// Profile returns the current profile
+func (l *Link) Profile() Profile {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.profile
+}
+
+// Stats returns the counters of the link
+func (l *Link) Stats() LinkStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+// Send decides the fate of a datagram of size bytes and returns the delays after which copies are delivered
+// An empty result drops the datagram
+func (l *Link) Send(size int) []time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	p := l.profile
+	l.stats.Sent++
+	if l.lost(p) {
+		l.stats.Lost++
+		return nil
+	}
+
+	// bandwidth: the datagram is sent after the ones before it
+	now := l.clock.Now()
+	var queued time.Duration
+	if p.Rate > 0 {
+		start := l.busyUntil
+		if start.Before(now) {
+			start = now
+		}
+		done := start.Add(time.Duration(int64(size) * int64(time.Second) / int64(p.Rate)))
+		if p.MaxQueue > 0 && done.Sub(now) > p.MaxQueue {
+			l.stats.Overflow++
+			return nil
+		}
+		l.busyUntil = done
+		queued = done.Sub(now)
+	}
+
+	delays := []time.Duration{queued + l.delay(p)}
+	if p.Duplicate > 0 && l.rand.Float64() < p.Duplicate {
+		l.stats.Duplicated++
+		delays = append(delays, queued+l.delay(p))
+	}
+	return delays
+}
+
+// Delivered counts a datagram that arrived at the receiver
+func (l *Link) Delivered() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stats.Delivered++
+}
+
+// partitioned counts a datagram dropped by a partition
+func (l *Link) partitioned() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stats.Sent++
+	l.stats.Partition++
+}
+
+// lost decides if a datagram is lost and moves the Gilbert-Elliott model on
+// The caller has to hold the lock
+func (l *Link) lost(p Profile) bool {
+	if p.Burst == nil {
+		return p.Loss > 0 && l.rand.Float64() < p.Loss
+	}
+	ge := p.Burst
+	loss := ge.LossGood
+	if l.bad {
+		loss = ge.LossBad
+	}
+	lost := loss > 0 && l.rand.Float64() < loss
+	if l.bad {
+		l.bad = !(l.rand.Float64() < ge.BadToGood)
+	} else {
+		l.bad = l.rand.Float64() < ge.GoodToBad
+	}
+	return lost
+}
+
+// delay returns the latency of one datagram
+// The caller has to hold the lock
+func (l *Link) delay(p Profile) time.Duration {
+	if p.Reorder > 0 && p.Delay > 0 && l.rand.Float64() < p.Reorder {
+		l.stats.Reordered++
+		return 0
+	}
+	d := p.Delay
+	if p.Jitter > 0 {
+		d += time.Duration(l.rand.Int64N(2*int64(p.Jitter)+1)) - p.Jitter
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
@@ -0,0 +1,139 @@
+package simnet_test
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/clock"
+	"github.com/aura-speak/networking/pkg/simnet"
+)
+
+func newFake() *clock.Fake {
+	return clock.NewFake(time.Unix(1_700_000_000, 0))
+}
+
+func TestLinkIsDeterministic(t *testing.T) {
+	p := simnet.Profile{Loss: 0.3, Delay: 40 * time.Millisecond, Jitter: 20 * time.Millisecond, Duplicate: 0.1, Reorder: 0.1}
+	a, b := simnet.NewLink(7, newFake(), p), simnet.NewLink(7, newFake(), p)
+	other := simnet.NewLink(8, newFake(), p)
+	same := true
+	for i := range 1000 {
+		da, db, dother := a.Send(100), b.Send(100), other.Send(100)
+		if !slices.Equal(da, db) {
+			t.Fatalf("datagram %d: %v and %v with the same seed", i, da, db)
+		}
+		same = same && slices.Equal(da, dother)
+	}
+	if same {
+		t.Fatal("another seed made the same decisions")
+	}
+	if a.Stats() != b.Stats() {
+		t.Fatalf("stats %+v and %+v with the same seed", a.Stats(), b.Stats())
+	}
+}
+
+func TestLinkLoss(t *testing.T) {
+	l := simnet.NewLink(1, newFake(), simnet.Profile{Loss: 0.1})
+	for range 10_000 {
+		for range l.Send(100) {
+			l.Delivered()
+		}
+	}
+	stats := l.Stats()
+	if stats.Sent != 10_000 || stats.Lost+stats.Delivered != stats.Sent {
+		t.Fatalf("stats %+v do not add up", stats)
+	}
+	if stats.Lost < 800 || stats.Lost > 1200 {
+		t.Fatalf("%d of 10000 datagrams lost, want about 10%%", stats.Lost)
+	}
+}
+
+func TestLinkBurstLoss(t *testing.T) {
+	// the link goes bad after the first datagram and never recovers
+	l := simnet.NewLink(1, newFake(), simnet.Profile{Burst: &simnet.GilbertElliott{GoodToBad: 1, LossBad: 1}})
+	if len(l.Send(100)) != 1 {
+		t.Fatal("datagram lost in the good state")
+	}
+	for i := range 100 {
+		if len(l.Send(100)) != 0 {
+			t.Fatalf("datagram %d delivered in the bad state", i)
+		}
+	}
+}
+
+func TestLinkDelayAndJitter(t *testing.T) {
+	p := simnet.Profile{Delay: 40 * time.Millisecond, Jitter: 10 * time.Millisecond}
+	l := simnet.NewLink(1, newFake(), p)
+	varied := false
+	for range 1000 {
+		delays := l.Send(100)
+		if len(delays) != 1 || delays[0] < 30*time.Millisecond || delays[0] > 50*time.Millisecond {
+			t.Fatalf("delays %v, want one between 30ms and 50ms", delays)
+		}
+		varied = varied || delays[0] != p.Delay
+	}
+	if !varied {
+		t.Fatal("no jitter")
+	}
+
+	// every datagram skips the delay and is delivered twice
+	l.SetProfile(simnet.Profile{Delay: 40 * time.Millisecond, Duplicate: 1, Reorder: 1})
+	if delays := l.Send(100); !slices.Equal(delays, []time.Duration{0, 0}) {
+		t.Fatalf("delays %v, want two copies without delay", delays)
+	}
+	if stats := l.Stats(); stats.Duplicated != 1 || stats.Reordered != 2 {
+		t.Fatalf("stats %+v, want one duplicate and two reordered copies", stats)
+	}
+}
+
+func TestLinkBandwidth(t *testing.T) {
+	fake := newFake()
+	l := simnet.NewLink(1, fake, simnet.Profile{Rate: 1000, MaxQueue: 250 * time.Millisecond})
+	// 100 bytes take 100ms, the datagrams queue behind each other
+	for _, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond} {
+		if delays := l.Send(100); !slices.Equal(delays, []time.Duration{want}) {
+			t.Fatalf("delays %v, want %s", delays, want)
+		}
+	}
+	if delays := l.Send(100); len(delays) != 0 {
+		t.Fatalf("delays %v, want a drop after waiting longer than the queue", delays)
+	}
+	if stats := l.Stats(); stats.Overflow != 1 {
+		t.Fatalf("stats %+v, want one overflow", stats)
+	}
+	// the queue drains with the time
+	fake.Advance(200 * time.Millisecond)
+	if delays := l.Send(100); !slices.Equal(delays, []time.Duration{100 * time.Millisecond}) {
+		t.Fatalf("delays %v after the queue drained, want 100ms", delays)
+	}
+}
+
+func TestProfileJSON(t *testing.T) {
+	p := simnet.Profile{
+		Loss:     0.05,
+		Burst:    &simnet.GilbertElliott{GoodToBad: 0.01, BadToGood: 0.25, LossBad: 0.5},
+		Delay:    40 * time.Millisecond,
+		Jitter:   5 * time.Millisecond,
+		Rate:     64_000,
+		MaxQueue: time.Second,
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded simnet.Profile
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Delay != p.Delay || decoded.Jitter != p.Jitter || decoded.MaxQueue != p.MaxQueue || *decoded.Burst != *p.Burst || decoded.Loss != p.Loss || decoded.Rate != p.Rate {
+		t.Fatalf("decoded %s into %+v", data, decoded)
+	}
+
+	for _, invalid := range []string{`{"loss": 1.5}`, `{"delay": "-1s"}`, `{"delay": "soon"}`, `{"burst": {"lossBad": -0.1}}`, `{"rate": -1}`} {
+		if err := json.Unmarshal([]byte(invalid), &decoded); err == nil {
+			t.Errorf("decoded the invalid profile %s", invalid)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package simnet
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Profile is the impairment of a link in one direction
+// The zero Profile is a perfect link
+type Profile struct {
+	// Loss is the probability that a datagram is lost, 0 to 1
+	Loss float64
+	// Burst replaces Loss with bursty loss if set
+	Burst *GilbertElliott
+	// Delay is the one-way latency
+	Delay time.Duration
+	// Jitter is added to or subtracted from the delay of every datagram, uniformly distributed
+	// A large jitter reorders datagrams like on a real network
+	Jitter time.Duration
+	// Duplicate is the probability that a datagram is delivered twice, 0 to 1
+	Duplicate float64
+	// Reorder is the probability that a datagram skips the delay and overtakes the ones before it, 0 to 1
+	// Like netem it only has an effect with a delay
+	Reorder float64
+	// Rate is the bandwidth in bytes per second, unlimited if zero
+	// Datagrams wait until the ones before them are sent
+	Rate int
+	// MaxQueue is the longest a datagram waits for the bandwidth, longer waits drop it; unlimited if zero
+	MaxQueue time.Duration
+}
+
+// GilbertElliott is the two-state burst loss model
+// The link is either good or bad, every datagram first decides if it is lost in the current state
+// and then if the link changes its state
+//
+// Example:
+//
+//	// about 2% loss in bursts of 4 datagrams on average
+//	burst := &simnet.GilbertElliott{GoodToBad: 0.005, BadToGood: 0.25, LossBad: 1}
+type GilbertElliott struct {
+	GoodToBad float64 `json:"goodToBad"` // probability to change from good to bad per datagram
+	BadToGood float64 `json:"badToGood"` // probability to change from bad to good per datagram
+	LossGood  float64 `json:"lossGood"`  // loss probability in the good state
+	LossBad   float64 `json:"lossBad"`   // loss probability in the bad state
+}
+
+// LinkStats are the counters of a link
+type LinkStats struct {
+	Sent       int `json:"sent"`       // datagrams written to the link
+	Delivered  int `json:"delivered"`  // datagrams that arrived at the receiving host, duplicates included
+	Lost       int `json:"lost"`       // datagrams dropped by the loss model
+	Duplicated int `json:"duplicated"` // extra copies
+	Reordered  int `json:"reordered"`  // datagrams that skipped the delay
+	Overflow   int `json:"overflow"`   // datagrams dropped because they waited longer than MaxQueue
+	Partition  int `json:"partition"`  // datagrams dropped by a partition
+}
+
+// profileJSON is the JSON form of a Profile with durations like "40ms"
+type profileJSON struct {
+	Loss      float64         `json:"loss,omitempty"`
+	Burst     *GilbertElliott `json:"burst,omitempty"`
+	Delay     string          `json:"delay,omitempty"`
+	Jitter    string          `json:"jitter,omitempty"`
+	Duplicate float64         `json:"duplicate,omitempty"`
+	Reorder   float64         `json:"reorder,omitempty"`
+	Rate      int             `json:"rate,omitempty"`
+	MaxQueue  string          `json:"maxQueue,omitempty"`
+}
+
+// MarshalJSON encodes the durations as strings like "40ms"
+func (p Profile) MarshalJSON() ([]byte, error) {
+	pj := profileJSON{
+		Loss:      p.Loss,
+		Burst:     p.Burst,
+		Duplicate: p.Duplicate,
+		Reorder:   p.Reorder,
+		Rate:      p.Rate,
+	}
+	if p.Delay != 0 {
+		pj.Delay = p.Delay.String()
+	}
+	if p.Jitter != 0 {
+		pj.Jitter = p.Jitter.String()
+	}
+	if p.MaxQueue != 0 {
+		pj.MaxQueue = p.MaxQueue.String()
+	}
+	return json.Marshal(pj)
+}
+
+// UnmarshalJSON decodes a profile with durations like "40ms" and checks the values
+func (p *Profile) UnmarshalJSON(data []byte) error {
+	var pj profileJSON
+	if err := json.Unmarshal(data, &pj); err != nil {
+		return err
+	}
+	profile := Profile{
+		Loss:      pj.Loss,
+		Burst:     pj.Burst,
+		Duplicate: pj.Duplicate,
+		Reorder:   pj.Reorder,
+		Rate:      pj.Rate,
+	}
+	var err error
+	if profile.Delay, err = parseDuration("delay", pj.Delay); err != nil {
+		return err
+	}
+	if profile.Jitter, err = parseDuration("jitter", pj.Jitter); err != nil {
+		return err
+	}
+	if profile.MaxQueue, err = parseDuration("maxQueue", pj.MaxQueue); err != nil {
+		return err
+	}
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+	*p = profile
+	return nil
+}
+
+func parseDuration(name, s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	return d, nil
+}
+
+// Validate checks that the probabilities are between 0 and 1 and nothing is negative
+func (p Profile) Validate() error {
+	type probability struct {
+		name  string
+		value float64
+	}
+	probabilities := []probability{{"loss", p.Loss}, {"duplicate", p.Duplicate}, {"reorder", p.Reorder}}
+	if ge := p.Burst; ge != nil {
+		probabilities = append(probabilities,
+			probability{"burst.goodToBad", ge.GoodToBad},
+			probability{"burst.badToGood", ge.BadToGood},
+			probability{"burst.lossGood", ge.LossGood},
+			probability{"burst.lossBad", ge.LossBad},
+		)
+	}
+	for _, prob := range probabilities {
+		if prob.value < 0 || prob.value > 1 {
+			return fmt.Errorf("%s must be between 0 and 1, got %g", prob.name, prob.value)
+		}
+	}
+	if p.Delay < 0 || p.Jitter < 0 || p.MaxQueue < 0 {
+		return fmt.Errorf("delay, jitter and maxQueue must not be negative")
+	}
+	if p.Rate < 0 {
+		return fmt.Errorf("rate must not be negative, got %d", p.Rate)
+	}
+	return nil
+}
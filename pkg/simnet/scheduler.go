@@ -0,0 +1,106 @@
+package simnet
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// event is a delivery that is due at a time
+// seq keeps events with the same time in the order they were scheduled
+type event struct {
+	at  time.Time
+	seq uint64
+	f   func()
+}
+
+type eventHeap []event
+
+func (h eventHeap) Len() int { return len(h) }
+func (h eventHeap) Less(i, j int) bool {
+	if h[i].at.Equal(h[j].at) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].at.Before(h[j].at)
+}
+func (h eventHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *eventHeap) Push(x any)   { *h = append(*h, x.(event)) }
+func (h *eventHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// Scheduler runs delayed deliveries in the order of their time
+// It only keeps one timer of the clock for the earliest event, so deliveries never overtake each other
+// because of the scheduling of the timers
+type Scheduler struct {
+	clock Clock
+
+	mu     sync.Mutex
+	events eventHeap
+	seq    uint64
+	timer  Timer
+	next   time.Time // time the timer is set for
+	gen    uint64    // generation of the timer, a stopped timer that fires anyway is ignored
+}
+
+// NewScheduler creates a Scheduler on a clock, the real time if nil
+func NewScheduler(clock Clock) *Scheduler {
+	if clock == nil {
+		clock = realClock
+	}
+	return &Scheduler{clock: clock}
+}
+
+// After runs f after d
+// Functions that are due at the same time run in the order they were scheduled
+func (s *Scheduler) After(d time.Duration, f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	at := s.clock.Now().Add(d)
+	s.seq++
+	heap.Push(&s.events, event{at: at, seq: s.seq, f: f})
+	s.arm()
+}
+
+// arm sets the timer to the earliest event
+// The caller has to hold the lock
+func (s *Scheduler) arm() {
+	if len(s.events) == 0 {
+		return
+	}
+	at := s.events[0].at
+	if s.timer != nil {
+		if !s.next.After(at) {
+			return
+		}
+		s.timer.Stop()
+	}
+	s.gen++
+	gen := s.gen
+	s.next = at
+	s.timer = s.clock.AfterFunc(at.Sub(s.clock.Now()), func() { s.run(gen) })
+}
+
+// run delivers all events that are due
+func (s *Scheduler) run(gen uint64) {
+	s.mu.Lock()
+	if gen != s.gen {
+		s.mu.Unlock()
+		return
+	}
+	s.timer = nil
+	now := s.clock.Now()
+	var due []func()
+	for len(s.events) > 0 && !s.events[0].at.After(now) {
+		due = append(due, heap.Pop(&s.events).(event).f)
+	}
+	s.arm()
+	s.mu.Unlock()
+
+	for _, f := range due {
+		f()
+	}
+}
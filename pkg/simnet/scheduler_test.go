@@ -0,0 +1,39 @@
+package simnet_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/simnet"
+)
+
+func TestSchedulerRunsInOrder(t *testing.T) {
+	fake := newFake()
+	s := simnet.NewScheduler(fake)
+	var order []string
+	s.After(20*time.Millisecond, func() { order = append(order, "late") })
+	s.After(10*time.Millisecond, func() { order = append(order, "first") })
+	s.After(10*time.Millisecond, func() { order = append(order, "second") })
+	if fake.Pending() != 1 {
+		t.Fatalf("%d timers pending, want one for the earliest event", fake.Pending())
+	}
+
+	fake.Advance(9 * time.Millisecond)
+	if len(order) != 0 {
+		t.Fatalf("ran %v before the time", order)
+	}
+	fake.Advance(time.Millisecond)
+	if !slices.Equal(order, []string{"first", "second"}) {
+		t.Fatalf("ran %v, want the events of the same time in the order they were scheduled", order)
+	}
+	// an event scheduled later but due earlier runs first
+	s.After(time.Millisecond, func() { order = append(order, "overtaking") })
+	fake.Advance(10 * time.Millisecond)
+	if !slices.Equal(order, []string{"first", "second", "overtaking", "late"}) {
+		t.Fatalf("ran %v", order)
+	}
+	if fake.Pending() != 0 {
+		t.Fatalf("%d timers pending without events", fake.Pending())
+	}
+}
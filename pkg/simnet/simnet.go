@@ -0,0 +1,349 @@
+// Package Simnet contains a simulated network for tests
+// It is responsible for connecting in-memory transports of many hosts and impairing the links between them
+// Every link between two hosts has a Profile with loss, burst loss, delay, jitter, duplication, reordering and bandwidth
+// Hosts can be partitioned from each other
+// All random decisions come from a seeded source per link and all delays from a Clock,
+// so a run with the same seed, the same clock and the same datagrams behaves the same
+package simnet
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/clock"
+	"github.com/aura-speak/networking/pkg/transport"
+)
+
+// Clock is the time source that schedules the delivery of delayed datagrams
+// Every clock.Clock is one, e.g. a clock.Fake to advance the network by hand
+// Delayed datagrams are delivered in the order of their time, even if the clock runs timers out of order
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a scheduled function of a Clock
+type Timer = clock.Timer
+
+// realClock is the Clock of the time package
+var realClock Clock = clock.Real
+
+// Options are the settings of a Network
+type Options struct {
+	// Seed of the random decisions, runs with the same seed make the same decisions
+	Seed uint64
+	// Clock schedules delayed datagrams, the real time if nil
+	Clock Clock
+	// Default is the profile of every link without an own profile
+	Default Profile
+}
+
+// Network is a simulated network of hosts
+//
+// Example:
+//
+//	network := simnet.New(simnet.Options{Seed: 1})
+//	network.SetPath("10.0.0.1", "10.0.0.2", simnet.Profile{Loss: 0.05, Delay: 40 * time.Millisecond, Jitter: 10 * time.Millisecond})
+//	srv.Transport = network.Host("10.0.0.1")
+//	c := client.NewClient("10.0.0.1", 8080)
+//	c.Transport = network.Host("10.0.0.2")
+type Network struct {
+	memory    *transport.Memory
+	clock     Clock
+	scheduler *Scheduler
+	seed      uint64
+
+	mu         sync.Mutex
+	def        Profile
+	profiles   map[linkKey]Profile
+	links      map[linkKey]*Link
+	partitions map[string]int // host -> group, hosts in different groups can not reach each other
+}
+
+// linkKey is the direction of a link between two hosts
+type linkKey struct {
+	from, to string
+}
+
+// New creates a new Network without hosts
+func New(opts Options) *Network {
+	clock := opts.Clock
+	if clock == nil {
+		clock = realClock
+	}
+	return &Network{
+		memory:    transport.NewMemory(),
+		clock:     clock,
+		scheduler: NewScheduler(clock),
+		seed:      opts.Seed,
+		def:       opts.Default,
+		profiles:  make(map[linkKey]Profile),
+		links:     make(map[linkKey]*Link),
+	}
+}
+
+// Host returns the transport of the host with an IP address
+// The host does not need to be created, every IP address is a host
+// It panics if ip is not an IP address
+func (n *Network) Host(ip string) *Host {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		panic(fmt.Sprintf("simnet: %q is not an IP address", ip))
+	}
+	return &Host{network: n, ip: parsed}
+}
+
+// SetDefault sets the profile of every link without an own profile
+func (n *Network) SetDefault(p Profile) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.def = p
+	for key, l := range n.links {
+		l.SetProfile(n.profile(key))
+	}
+}
+
+// SetLink sets the profile of the link from one host to another
+func (n *Network) SetLink(from, to string, p Profile) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	key := linkKey{from: hostKey(from), to: hostKey(to)}
+	n.profiles[key] = p
+	if l, ok := n.links[key]; ok {
+		l.SetProfile(p)
+	}
+}
+
+// SetPath sets the profile of the links between two hosts in both directions
+func (n *Network) SetPath(a, b string, p Profile) {
+	n.SetLink(a, b, p)
+	n.SetLink(b, a, p)
+}
+
+// ResetLink removes the own profile of a link, it uses the default profile again
+func (n *Network) ResetLink(from, to string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	key := linkKey{from: hostKey(from), to: hostKey(to)}
+	delete(n.profiles, key)
+	if l, ok := n.links[key]; ok {
+		l.SetProfile(n.def)
+	}
+}
+
+// Partition splits the hosts into groups that can not reach each other
+// Hosts that are in no group form one more group
+// Datagrams that are already on the way are still delivered
+//
+// Example:
+//
+//	network.Partition([]string{"10.0.0.1"}, []string{"10.0.0.2", "10.0.0.3"})
+//	// ...
+//	network.Heal()
+func (n *Network) Partition(groups ...[]string) {
+	partitions := make(map[string]int)
+	for i, group := range groups {
+		for _, host := range group {
+			partitions[hostKey(host)] = i + 1
+		}
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.partitions = partitions
+}
+
+// Heal removes all partitions
+func (n *Network) Heal() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.partitions = nil
+}
+
+// Stats returns the counters of the link from one host to another
+func (n *Network) Stats(from, to string) LinkStats {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if l, ok := n.links[linkKey{from: hostKey(from), to: hostKey(to)}]; ok {
+		return l.Stats()
+	}
+	return LinkStats{}
+}
+
+// hostKey normalizes the IP address of a host, so "::ffff:10.0.0.1" and "10.0.0.1" are the same host
+func hostKey(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil {
+		return parsed.String()
+	}
+	return ip
+}
+
+// link returns the state of a link and creates it on first use
+// Every link has its own random source derived from the seed, so the decisions of a link
+// do not depend on the traffic of other links
+// The caller has to hold the lock
+func (n *Network) link(key linkKey) *Link {
+	if l, ok := n.links[key]; ok {
+		return l
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key.from + ">" + key.to))
+	l := newLink(n.seed, h.Sum64(), n.clock, n.profile(key))
+	n.links[key] = l
+	return l
+}
+
+// profile returns the profile of a link
+// The caller has to hold the lock
+func (n *Network) profile(key linkKey) Profile {
+	if p, ok := n.profiles[key]; ok {
+		return p
+	}
+	return n.def
+}
+
+// partitioned tells if two hosts are in different partitions
+// The caller has to hold the lock
+func (n *Network) partitioned(key linkKey) bool {
+	if n.partitions == nil {
+		return false
+	}
+	return n.partitions[key.from] != n.partitions[key.to]
+}
+
+// schedule decides the fate of a datagram on a link and returns the delays after which copies are delivered
+// An empty result drops the datagram
+func (n *Network) schedule(key linkKey, size int) []time.Duration {
+	n.mu.Lock()
+	l := n.link(key)
+	partitioned := n.partitioned(key)
+	n.mu.Unlock()
+
+	if partitioned {
+		l.partitioned()
+		return nil
+	}
+	return l.Send(size)
+}
+
+// delivered counts a datagram that reached the receiving host
+func (n *Network) delivered(key linkKey) {
+	n.mu.Lock()
+	l := n.link(key)
+	n.mu.Unlock()
+	l.Delivered()
+}
+
+// Host is a host of a Network
+// It is the transport of the Server or a Client on that host
+type Host struct {
+	network *Network
+	ip      net.IP
+}
+
+// IP returns the IP address of the host
+func (h *Host) IP() net.IP {
+	return h.ip
+}
+
+// Listen opens a connection on the host, the IP address of addr is ignored
+func (h *Host) Listen(addr string) (net.PacketConn, error) {
+	_, port, err := h.resolve(addr)
+	if err != nil {
+		return nil, err
+	}
+	return h.open(port)
+}
+
+// Dial opens a connection on the host with a free port that is connected to addr
+// localhost is the host itself
+func (h *Host) Dial(addr string) (net.Conn, error) {
+	ip, port, err := h.resolve(addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := h.open(0)
+	if err != nil {
+		return nil, err
+	}
+	return transport.Connect(conn, &net.UDPAddr{IP: ip, Port: port}), nil
+}
+
+func (h *Host) open(port int) (*conn, error) {
+	inner, err := h.network.memory.Listen(net.JoinHostPort(h.ip.String(), strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	return &conn{PacketConn: inner, host: h}, nil
+}
+
+// resolve splits "host:port", an empty host and localhost are the host itself
+func (h *Host) resolve(addr string) (net.IP, int, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, 0, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 65535 {
+		return nil, 0, fmt.Errorf("invalid port in %q", addr)
+	}
+	switch host {
+	case "", "localhost":
+		return h.ip, port, nil
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, 0, fmt.Errorf("simnet: %q is not an IP address", host)
+	}
+	if ip.IsUnspecified() || ip.IsLoopback() {
+		return h.ip, port, nil
+	}
+	return ip, port, nil
+}
+
+// conn is a connection of a host
+// Writes go through the link to the receiving host, reads come straight from the in-memory network
+type conn struct {
+	net.PacketConn
+	host *Host
+}
+
+func (c *conn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	raddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		ip, port, err := c.host.resolve(addr.String())
+		if err != nil {
+			return 0, err
+		}
+		raddr = &net.UDPAddr{IP: ip, Port: port}
+	}
+	key := linkKey{from: c.host.ip.String(), to: raddr.IP.String()}
+	delays := c.host.network.schedule(key, len(b))
+	if len(delays) == 0 {
+		return len(b), nil
+	}
+
+	data := make([]byte, len(b))
+	copy(data, b)
+	for _, d := range delays {
+		if d <= 0 {
+			c.deliver(key, data, raddr)
+			continue
+		}
+		c.host.network.scheduler.After(d, func() {
+			c.deliver(key, data, raddr)
+		})
+	}
+	return len(b), nil
+}
+
+// deliver hands a datagram to the in-memory network
+// A datagram of a connection that was closed in the meantime is lost
+func (c *conn) deliver(key linkKey, data []byte, raddr *net.UDPAddr) {
+	if _, err := c.PacketConn.WriteTo(data, raddr); err == nil {
+		c.host.network.delivered(key)
+	}
+}
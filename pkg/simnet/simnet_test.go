@@ -0,0 +1,128 @@
+package simnet_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/simnet"
+)
+
+// listen opens a connection on a host and hands the datagrams it receives to a channel
+func listen(t *testing.T, host *simnet.Host, addr string) <-chan string {
+	t.Helper()
+	conn, err := host.Listen(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	received := make(chan string, 16)
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			received <- string(buf[:n])
+		}
+	}()
+	return received
+}
+
+func expectDatagram(t *testing.T, received <-chan string, want string) {
+	t.Helper()
+	select {
+	case got := <-received:
+		if got != want {
+			t.Fatalf("received %q, want %q", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("%q not received", want)
+	}
+}
+
+func expectNoDatagram(t *testing.T, received <-chan string) {
+	t.Helper()
+	select {
+	case got := <-received:
+		t.Fatalf("received %q", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestNetworkDelaysOnTheClock(t *testing.T) {
+	fake := newFake()
+	network := simnet.New(simnet.Options{Seed: 1, Clock: fake})
+	network.SetLink("10.0.0.2", "10.0.0.1", simnet.Profile{Delay: 40 * time.Millisecond})
+	received := listen(t, network.Host("10.0.0.1"), ":9000")
+	conn, err := network.Host("10.0.0.2").Dial("10.0.0.1:9000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	fake.Advance(39 * time.Millisecond)
+	expectNoDatagram(t, received)
+	fake.Advance(time.Millisecond)
+	expectDatagram(t, received, "hello")
+	if stats := network.Stats("10.0.0.2", "10.0.0.1"); stats.Sent != 1 || stats.Delivered != 1 {
+		t.Fatalf("stats %+v, want one datagram delivered", stats)
+	}
+
+	// the link back uses the default profile, a perfect link
+	back := listen(t, network.Host("10.0.0.2"), ":9001")
+	sender, err := network.Host("10.0.0.1").Dial("10.0.0.2:9001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+	sender.Write([]byte("back"))
+	expectDatagram(t, back, "back")
+}
+
+func TestNetworkPartition(t *testing.T) {
+	network := simnet.New(simnet.Options{Seed: 1})
+	received := listen(t, network.Host("10.0.0.1"), ":9000")
+	conn, err := network.Host("10.0.0.2").Dial("10.0.0.1:9000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	network.Partition([]string{"10.0.0.1"}, []string{"10.0.0.2"})
+	conn.Write([]byte("lost"))
+	expectNoDatagram(t, received)
+	if stats := network.Stats("10.0.0.2", "10.0.0.1"); stats.Partition != 1 {
+		t.Fatalf("stats %+v, want one datagram dropped by the partition", stats)
+	}
+
+	network.Heal()
+	conn.Write([]byte("healed"))
+	expectDatagram(t, received, "healed")
+}
+
+func TestNetworkProfiles(t *testing.T) {
+	network := simnet.New(simnet.Options{Seed: 1, Default: simnet.Profile{Loss: 1}})
+	received := listen(t, network.Host("10.0.0.1"), ":9000")
+	conn, err := network.Host("::ffff:10.0.0.2").Dial("10.0.0.1:9000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("lost"))
+	expectNoDatagram(t, received)
+	// the IPv4-mapped address is the same host
+	network.SetPath("10.0.0.1", "10.0.0.2", simnet.Profile{})
+	conn.Write([]byte("delivered"))
+	expectDatagram(t, received, "delivered")
+	network.ResetLink("10.0.0.2", "10.0.0.1")
+	conn.Write([]byte("lost again"))
+	expectNoDatagram(t, received)
+	network.SetDefault(simnet.Profile{})
+	conn.Write([]byte("default"))
+	expectDatagram(t, received, "default")
+}
@@ -0,0 +1,151 @@
+package testkit
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/client"
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+// ClientOptions are the settings of a Client of a Harness
+type ClientOptions struct {
+	// Credential is sent in the connect handshake
+	Credential []byte
+}
+
+// Client is a running client.Client of a Harness that records the packets it receives
+type Client struct {
+	*client.Client
+	t     testing.TB
+	local net.Addr
+	done  chan error
+
+	// Received are the packets the Client received
+	Received *Recorder
+}
+
+// Connect starts a Client and waits until the Server accepted it
+func (h *Harness) Connect() *Client {
+	h.t.Helper()
+	return h.ConnectWith(ClientOptions{})
+}
+
+// ConnectN connects n Clients one after another
+func (h *Harness) ConnectN(n int) []*Client {
+	h.t.Helper()
+	clients := make([]*Client, n)
+	for i := range clients {
+		clients[i] = h.Connect()
+	}
+	return clients
+}
+
+// ConnectWith starts a Client with options and waits until the Server accepted it
+func (h *Harness) ConnectWith(opts ClientOptions) *Client {
+	h.t.Helper()
+	c := h.StartClient(opts)
+	c.WaitConnected(DefaultTimeout)
+	return c
+}
+
+// StartClient starts a Client without waiting for the connect handshake, e.g. to test a rejection
+func (h *Harness) StartClient(opts ClientOptions) *Client {
+	h.t.Helper()
+	c := &Client{
+		Client:   client.NewClient("127.0.0.1", h.port()),
+		t:        h.t,
+		done:     make(chan error, 1),
+		Received: newRecorder(h.clock()),
+	}
+	c.Credential = opts.Credential
+	c.Clock = h.clock()
+	if h.opts.ReportInterval > 0 {
+		c.ReportInterval = h.opts.ReportInterval
+	}
+
+	dialed := make(chan net.Addr, 1)
+	c.Transport = &tap{
+		inner: h.inner,
+		onDial: func(local net.Addr) {
+			dialed <- local
+		},
+		onPacket: func(packet *protocol.Packet, from net.Addr) {
+			c.Received.add(packet, from)
+		},
+	}
+	h.clients = append(h.clients, c)
+	go func() {
+		c.done <- c.Run()
+	}()
+
+	select {
+	case c.local = <-dialed:
+	case err := <-c.done:
+		h.t.Fatalf("testkit: client stopped before dialing: %v", err)
+	case <-Wall.After(DefaultTimeout):
+		h.t.Fatalf("testkit: client did not dial after %s", DefaultTimeout)
+	}
+	return c
+}
+
+// LocalAddr returns the address the Client sends from, the Server knows the Client by it
+func (c *Client) LocalAddr() net.Addr {
+	return c.local
+}
+
+// WaitConnected waits until the Server accepted the Client
+// It fails the test after the timeout, DefaultTimeout if zero
+func (c *Client) WaitConnected(timeout time.Duration) {
+	c.t.Helper()
+	Eventually(c.t, orDefault(timeout), c.Connected, "client %s connected", c.local)
+}
+
+// ExpectPacket waits until the Client received a packet of the type and returns it
+// Every packet is returned only once, so two calls expect two packets
+// It fails the test after the timeout, DefaultTimeout if zero
+func (c *Client) ExpectPacket(packetType protocol.PacketType, timeout time.Duration) *protocol.Packet {
+	c.t.Helper()
+	packet, _, ok := c.Received.Next(packetType, orDefault(timeout))
+	if !ok {
+		c.t.Fatalf("testkit: client %s received no %s packet within %s", c.local, typeName(packetType), orDefault(timeout))
+	}
+	return packet
+}
+
+// ExpectNoPacket fails the test if the Client receives a packet of the type within d
+func (c *Client) ExpectNoPacket(packetType protocol.PacketType, d time.Duration) {
+	c.t.Helper()
+	if packet, _, ok := c.Received.Next(packetType, d); ok {
+		c.t.Fatalf("testkit: client %s received an unexpected %s packet with %d bytes payload", c.local, typeName(packetType), len(packet.Payload))
+	}
+}
+
+// SendPacket encodes and sends a packet to the Server
+// It fails the test if the packet can not be handed to the Client
+func (c *Client) SendPacket(packet *protocol.Packet) {
+	c.t.Helper()
+	if err := c.Send(packet.Encode()); err != nil {
+		c.t.Fatalf("testkit: client %s can not send a %s packet: %v", c.local, typeName(packet.PacketHeader.PacketType), err)
+	}
+}
+
+// Close stops the Client and waits until Run returned
+// It is called when the Harness stops, calling it earlier is fine
+func (c *Client) Close() {
+	select {
+	case err := <-c.done:
+		// already stopped, keep the result for further calls
+		c.done <- err
+		return
+	default:
+	}
+	c.Stop()
+	select {
+	case err := <-c.done:
+		c.done <- err
+	case <-Wall.After(DefaultTimeout):
+		c.t.Errorf("testkit: client %s did not stop after %s", c.local, DefaultTimeout)
+	}
+}
@@ -0,0 +1,88 @@
+package testkit
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// leakTimeout is the time goroutines get to end after the test before they count as leaked
+const leakTimeout = 2 * time.Second
+
+// CheckGoroutines fails the test if goroutines that start during the test still run when it ends
+// It is called at the start of the test, the check runs in t.Cleanup after the cleanups registered later
+//
+// Example:
+//
+//	func TestStop(t *testing.T) {
+//		testkit.CheckGoroutines(t)
+//		srv := server.NewServer(0, ctx, cfg)
+//		...
+//	}
+func CheckGoroutines(t testing.TB) {
+	t.Helper()
+	before := goroutines()
+	t.Cleanup(func() {
+		var leaked []string
+		WaitFor(leakTimeout, func() bool {
+			leaked = leaked[:0]
+			for id, stack := range goroutines() {
+				if _, ok := before[id]; !ok && !ignoredGoroutine(stack) {
+					leaked = append(leaked, stack)
+				}
+			}
+			return len(leaked) == 0
+		})
+		if len(leaked) > 0 {
+			t.Errorf("testkit: %d goroutines leaked:\n\n%s", len(leaked), strings.Join(leaked, "\n\n"))
+		}
+	})
+}
+
+// goroutines returns the stacks of all goroutines by their id
+func goroutines() map[int]string {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	stacks := make(map[int]string)
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		// goroutine 42 [chan receive]:
+		header, _, _ := strings.Cut(string(stack), "\n")
+		fields := strings.Fields(header)
+		if len(fields) < 2 || fields[0] != "goroutine" {
+			continue
+		}
+		id, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		stacks[id] = string(stack)
+	}
+	return stacks
+}
+
+// ignoredGoroutine tells if a goroutine belongs to the runtime or the test framework
+func ignoredGoroutine(stack string) bool {
+	for _, frame := range []string{
+		"testing.(*T).Run",
+		"testing.tRunner",
+		"testkit.goroutines",
+		"runtime.goexit0",
+		"os/signal.signal_recv",
+	} {
+		if strings.Contains(stack, frame) {
+			return true
+		}
+	}
+	return false
+}
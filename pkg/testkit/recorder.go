@@ -0,0 +1,95 @@
+package testkit
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/clock"
+	"github.com/aura-speak/networking/pkg/protocol"
+)
+
+// Received is a packet recorded by a Recorder
+type Received struct {
+	Packet *protocol.Packet
+	From   net.Addr
+	At     time.Time // on the Clock of the Harness
+}
+
+// Recorder keeps the decoded packets one side received in their order
+// Next consumes packets, All returns every packet since the start
+type Recorder struct {
+	mu      sync.Mutex
+	all     []Received
+	pending []Received
+	notify  chan struct{} // closed and replaced on every new packet
+	clock   clock.Clock
+}
+
+func newRecorder(clk clock.Clock) *Recorder {
+	return &Recorder{notify: make(chan struct{}), clock: clk}
+}
+
+func (r *Recorder) add(packet *protocol.Packet, from net.Addr) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	received := Received{Packet: packet, From: from, At: r.clock.Now()}
+	r.all = append(r.all, received)
+	r.pending = append(r.pending, received)
+	close(r.notify)
+	r.notify = make(chan struct{})
+}
+
+// Next waits until a packet of the type was received that Next did not return before
+// Packets of other types stay pending, it returns false after the timeout on the Wall clock
+func (r *Recorder) Next(packetType protocol.PacketType, timeout time.Duration) (*protocol.Packet, net.Addr, bool) {
+	deadline := Wall.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		r.mu.Lock()
+		for i, received := range r.pending {
+			if received.Packet.PacketHeader.PacketType == packetType {
+				r.pending = append(r.pending[:i], r.pending[i+1:]...)
+				r.mu.Unlock()
+				return received.Packet, received.From, true
+			}
+		}
+		notify := r.notify
+		r.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-deadline.C():
+			return nil, nil, false
+		}
+	}
+}
+
+// All returns every packet received so far, including the ones Next returned
+func (r *Recorder) All() []Received {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Received(nil), r.all...)
+}
+
+// Count returns how many packets of the type were received so far
+func (r *Recorder) Count(packetType protocol.PacketType) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := 0
+	for _, received := range r.all {
+		if received.Packet.PacketHeader.PacketType == packetType {
+			count++
+		}
+	}
+	return count
+}
+
+// typeName returns the name of a packet type for messages
+func typeName(packetType protocol.PacketType) string {
+	if name, ok := protocol.PacketTypeMapType[packetType]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%02x", uint8(packetType))
+}
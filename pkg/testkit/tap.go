@@ -0,0 +1,73 @@
+package testkit
+
+import (
+	"net"
+
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/transport"
+)
+
+// tap is a Transport that reports every datagram it reads, decoded as a packet
+// Datagrams that do not decode, e.g. the STOP of the Server, are passed on without a report
+type tap struct {
+	inner    transport.Transport
+	onListen func(addr net.Addr)
+	onDial   func(local net.Addr)
+	onPacket func(packet *protocol.Packet, from net.Addr)
+}
+
+func (t *tap) Listen(addr string) (net.PacketConn, error) {
+	conn, err := t.inner.Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	if t.onListen != nil {
+		t.onListen(conn.LocalAddr())
+	}
+	return &tapPacketConn{PacketConn: conn, tap: t}, nil
+}
+
+func (t *tap) Dial(addr string) (net.Conn, error) {
+	conn, err := t.inner.Dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	if t.onDial != nil {
+		t.onDial(conn.LocalAddr())
+	}
+	return &tapConn{Conn: conn, tap: t}, nil
+}
+
+func (t *tap) report(data []byte, from net.Addr) {
+	packet, err := protocol.Decode(append([]byte(nil), data...))
+	if err != nil || packet == nil {
+		return
+	}
+	t.onPacket(packet, from)
+}
+
+type tapPacketConn struct {
+	net.PacketConn
+	tap *tap
+}
+
+func (c *tapPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	if err == nil {
+		c.tap.report(p[:n], addr)
+	}
+	return n, addr, err
+}
+
+type tapConn struct {
+	net.Conn
+	tap *tap
+}
+
+func (c *tapConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if err == nil {
+		c.tap.report(p[:n], c.Conn.RemoteAddr())
+	}
+	return n, err
+}
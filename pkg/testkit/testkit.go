@@ -0,0 +1,207 @@
+// Package Testkit contains a harness for integration tests of code built on the server and client packages
+// It is responsible for starting an in-process Server and Clients over the in-memory or the UDP transport,
+// recording the packets both sides receive and stopping everything again when the test ends
+// The helpers wait with timeouts on the Wall clock and fail the test with t.Fatalf, so they are called from the test goroutine
+//
+// Example:
+//
+//	func TestHello(t *testing.T) {
+//		h := testkit.Start(t, testkit.Options{CheckLeaks: true})
+//		alice := h.Connect()
+//		h.Server.Broadcast(&protocol.Packet{PacketHeader: protocol.Header{PacketType: protocol.PacketTypeDebugAny}})
+//		alice.ExpectPacket(protocol.PacketTypeDebugAny, time.Second)
+//	}
+package testkit
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/internal/config"
+	"github.com/aura-speak/networking/pkg/clock"
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/server"
+	"github.com/aura-speak/networking/pkg/transport"
+)
+
+// DefaultTimeout is the time Start, Connect and the Wait helpers wait if no timeout is given
+const DefaultTimeout = 5 * time.Second
+
+const (
+	// TransportMemory connects the Server and the Clients over a transport.Memory, the default
+	TransportMemory = "memory"
+	// TransportUDP connects them over UDP sockets on 127.0.0.1 with a free port
+	TransportUDP = "udp"
+)
+
+// Options are the settings of a Harness
+type Options struct {
+	// Transport is TransportMemory or TransportUDP, TransportMemory if empty
+	Transport string
+	// Config of the Server, config.Default with the certificates in a temporary directory if nil
+	// A relative ban list is moved into a temporary directory, so no test writes to the working directory
+	Config *config.ServerConfig
+	// Clock of the Server and the Clients, the real time if nil
+	Clock clock.Clock
+	// ReportInterval of the Server and the Clients, the default of the report package if zero
+	ReportInterval time.Duration
+	// CheckLeaks fails the test if goroutines started during the test still run after the Harness stopped
+	CheckLeaks bool
+}
+
+// Harness is a running Server with its Clients
+// Everything is stopped in t.Cleanup, Close stops it earlier
+type Harness struct {
+	t      testing.TB
+	opts   Options
+	inner  transport.Transport
+	cancel context.CancelFunc
+	done   chan error
+
+	// Server is the running Server, handlers can be registered on it before the Clients connect
+	Server *server.Server
+	// Memory is the in-memory network, nil with TransportUDP
+	Memory *transport.Memory
+	// Received are the packets the Server received
+	Received *Recorder
+
+	addr    net.Addr
+	clients []*Client
+	closed  bool
+}
+
+// Start starts a Server and returns when it listens
+func Start(t testing.TB, opts Options) *Harness {
+	t.Helper()
+	if opts.CheckLeaks {
+		// registered first, so it runs after the cleanup of the Harness
+		CheckGoroutines(t)
+	}
+
+	h := &Harness{
+		t:    t,
+		opts: opts,
+		done: make(chan error, 1),
+	}
+	h.Received = newRecorder(h.clock())
+	switch opts.Transport {
+	case "", TransportMemory:
+		h.Memory = transport.NewMemory()
+		h.inner = h.Memory
+	case TransportUDP:
+		h.inner = transport.UDP{}
+	default:
+		t.Fatalf("testkit: unknown transport %q", opts.Transport)
+	}
+
+	cfg := opts.Config
+	if cfg == nil {
+		cfg = &config.Default().ServerConfig
+		cfg.Server.DTLS.Path = t.TempDir() + "/"
+	}
+	if cfg.Server.BanList != "" && !filepath.IsAbs(cfg.Server.BanList) {
+		cfg.Server.BanList = filepath.Join(t.TempDir(), cfg.Server.BanList)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	h.Server = server.NewServer(0, ctx, cfg)
+	h.Server.Clock = h.clock()
+	if opts.ReportInterval > 0 {
+		h.Server.ReportInterval = opts.ReportInterval
+	}
+
+	listening := make(chan net.Addr, 1)
+	h.Server.Transport = &tap{
+		inner: h.inner,
+		onListen: func(addr net.Addr) {
+			listening <- addr
+		},
+		onPacket: func(packet *protocol.Packet, from net.Addr) {
+			h.Received.add(packet, from)
+		},
+	}
+	t.Cleanup(h.Close)
+	go func() {
+		h.done <- h.Server.Run()
+	}()
+
+	select {
+	case h.addr = <-listening:
+	case err := <-h.done:
+		t.Fatalf("testkit: server stopped before listening: %v", err)
+	case <-Wall.After(DefaultTimeout):
+		t.Fatalf("testkit: server did not listen after %s", DefaultTimeout)
+	}
+	return h
+}
+
+// Addr returns the address the Server listens on
+func (h *Harness) Addr() net.Addr {
+	return h.addr
+}
+
+// clock returns the Clock of the Server and the Clients
+func (h *Harness) clock() clock.Clock {
+	if h.opts.Clock != nil {
+		return h.opts.Clock
+	}
+	return clock.Real
+}
+
+// port returns the port the Server listens on
+func (h *Harness) port() int {
+	return h.addr.(*net.UDPAddr).Port
+}
+
+// Close stops all Clients and the Server and waits until they returned
+// It is called by t.Cleanup, calling it earlier is fine
+func (h *Harness) Close() {
+	if h.closed {
+		return
+	}
+	h.closed = true
+	for _, c := range h.clients {
+		c.Close()
+	}
+	h.Server.Stop()
+	select {
+	case <-h.done:
+	case <-Wall.After(DefaultTimeout):
+		h.t.Errorf("testkit: server did not stop after %s", DefaultTimeout)
+	}
+	h.cancel()
+}
+
+// ExpectServerPacket waits until the Server received a packet of the type and returns it with its sender
+// It fails the test after the timeout, DefaultTimeout if zero
+func (h *Harness) ExpectServerPacket(packetType protocol.PacketType, timeout time.Duration) (*protocol.Packet, net.Addr) {
+	h.t.Helper()
+	packet, from, ok := h.Received.Next(packetType, orDefault(timeout))
+	if !ok {
+		h.t.Fatalf("testkit: server received no %s packet within %s", typeName(packetType), orDefault(timeout))
+	}
+	return packet, from
+}
+
+// WaitSession waits until the Server has a session for the Client and returns it
+// It fails the test after the timeout, DefaultTimeout if zero
+func (h *Harness) WaitSession(c *Client, timeout time.Duration) *server.Session {
+	h.t.Helper()
+	var session *server.Session
+	Eventually(h.t, orDefault(timeout), func() bool {
+		var ok bool
+		session, ok = h.Server.Session(c.LocalAddr().String())
+		return ok
+	}, "server session for %s", c.LocalAddr())
+	return session
+}
+
+func orDefault(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return DefaultTimeout
+	}
+	return timeout
+}
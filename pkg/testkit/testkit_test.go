@@ -0,0 +1,137 @@
+package testkit_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/internal/config"
+	"github.com/aura-speak/networking/pkg/auth"
+	"github.com/aura-speak/networking/pkg/clock"
+	"github.com/aura-speak/networking/pkg/protocol"
+	"github.com/aura-speak/networking/pkg/testkit"
+)
+
+var secret = []byte("secret")
+
+func token(t *testing.T, userID string) []byte {
+	t.Helper()
+	return signed(t, secret, userID)
+}
+
+func signed(t *testing.T, secret []byte, userID string) []byte {
+	t.Helper()
+	token, err := auth.NewToken(secret, auth.Claims{UserID: userID, ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []byte(token)
+}
+
+// expectReject waits for the reject of a Client and checks its reason
+func expectReject(t *testing.T, c *testkit.Client, reason protocol.RejectReason) {
+	t.Helper()
+	reject, err := protocol.DecodeConnectReject(c.ExpectPacket(protocol.PacketTypeConnectReject, 0).Payload)
+	if err != nil || reject.Reason != reason {
+		t.Fatalf("reject %v, %v, want %s", reject, err, reason)
+	}
+	testkit.Eventually(t, testkit.DefaultTimeout, func() bool { return c.ConnectErr() != nil }, "connect error of %s", c.LocalAddr())
+}
+
+func TestAccept(t *testing.T) {
+	h := testkit.Start(t, testkit.Options{CheckLeaks: true})
+	alice, bob := h.Connect(), h.Connect()
+	if session := h.WaitSession(alice, 0); session.SSRC == h.WaitSession(bob, 0).SSRC {
+		t.Fatalf("clients share the ssrc %d", session.SSRC)
+	}
+
+	alice.SendPacket(&protocol.Packet{PacketHeader: protocol.Header{PacketType: protocol.PacketTypeDebugAny}, Payload: []byte("hello")})
+	packet, from := h.ExpectServerPacket(protocol.PacketTypeDebugAny, 0)
+	if from.String() != alice.LocalAddr().String() || string(packet.Payload) != "hello" {
+		t.Fatalf("server received %q from %s", packet.Payload, from)
+	}
+
+	h.Server.Broadcast(&protocol.Packet{PacketHeader: protocol.Header{PacketType: protocol.PacketTypeDebugAny}})
+	alice.ExpectPacket(protocol.PacketTypeDebugAny, 0)
+	bob.ExpectPacket(protocol.PacketTypeDebugAny, 0)
+}
+
+func TestReject(t *testing.T) {
+	h := testkit.Start(t, testkit.Options{CheckLeaks: true})
+	h.Server.Authenticator = auth.NewStaticSecretAuthenticator(secret)
+
+	mallory := h.StartClient(testkit.ClientOptions{Credential: signed(t, []byte("guessed"), "mallory")})
+	expectReject(t, mallory, protocol.RejectReasonInvalidCredential)
+	expectReject(t, h.StartClient(testkit.ClientOptions{Credential: []byte("forged")}), protocol.RejectReasonMalformed)
+	if _, ok := h.Server.Session(mallory.LocalAddr().String()); ok {
+		t.Fatal("session of a rejected client")
+	}
+	h.ConnectWith(testkit.ClientOptions{Credential: token(t, "alice")})
+}
+
+func TestBan(t *testing.T) {
+	h := testkit.Start(t, testkit.Options{CheckLeaks: true})
+	h.Server.Authenticator = auth.NewStaticSecretAuthenticator(secret)
+	alice := h.ConnectWith(testkit.ClientOptions{Credential: token(t, "alice")})
+
+	if _, err := h.Server.BanUser("mallory", "spam", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	expectReject(t, h.StartClient(testkit.ClientOptions{Credential: token(t, "mallory")}), protocol.RejectReasonBanned)
+	// the ban list of the default config is kept out of the working directory
+	if _, err := os.Stat("bans.yml"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("ban list in the working directory: %v", err)
+	}
+
+	if _, err := h.Server.BanIP("127.0.0.1", "flooding", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	testkit.Eventually(t, testkit.DefaultTimeout, func() bool {
+		_, ok := h.Server.Session(alice.LocalAddr().String())
+		return !ok
+	}, "session of the banned IP dropped")
+}
+
+func TestReports(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1_700_000_000, 0))
+	h := testkit.Start(t, testkit.Options{Clock: fake, ReportInterval: time.Second, CheckLeaks: true})
+	alice := h.Connect()
+
+	// the report loops start with the connect, the clock advances until both sides reported
+	testkit.Eventually(t, testkit.DefaultTimeout, func() bool {
+		fake.Advance(time.Second)
+		return h.Received.Count(protocol.PacketTypeSenderReport) > 0 && alice.Received.Count(protocol.PacketTypeSenderReport) > 0
+	}, "sender reports of both sides")
+	testkit.Eventually(t, testkit.DefaultTimeout, func() bool {
+		_, ok := h.Server.Stats()[alice.LocalAddr().String()]
+		return ok
+	}, "report stats of %s", alice.LocalAddr())
+
+	received := h.Received.All()
+	if at := received[len(received)-1].At; at.Before(time.Unix(1_700_000_000, 0)) || at.After(fake.Now()) {
+		t.Fatalf("packet recorded at %s, not on the clock of the harness at %s", at, fake.Now())
+	}
+}
+
+func TestReload(t *testing.T) {
+	cfg := &config.Default().ServerConfig
+	cfg.Server.DTLS.Path = t.TempDir() + "/"
+	cfg.Server.BanList = filepath.Join(t.TempDir(), "bans.yml")
+	h := testkit.Start(t, testkit.Options{Config: cfg, CheckLeaks: true})
+	h.Server.Authenticator = auth.NewStaticSecretAuthenticator(secret)
+	h.ConnectWith(testkit.ClientOptions{Credential: token(t, "mallory")}).Close()
+
+	bans := "bans:\n  - user_id: mallory\n    reason: spam\n    created: 2024-01-01T00:00:00Z\n"
+	if err := os.WriteFile(cfg.Server.BanList, []byte(bans), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Server.ApplyConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	expectReject(t, h.StartClient(testkit.ClientOptions{Credential: token(t, "mallory")}), protocol.RejectReasonBanned)
+	if bans := h.Server.Bans(); len(bans) != 1 || bans[0].UserID != "mallory" {
+		t.Fatalf("bans after the reload: %+v", bans)
+	}
+}
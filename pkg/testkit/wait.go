@@ -0,0 +1,45 @@
+package testkit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/clock"
+)
+
+// pollInterval is the time between two checks of Eventually
+const pollInterval = 5 * time.Millisecond
+
+// Wall is the Clock the timeouts of the testkit run on
+// It stays the real time when the Server runs on a clock.Fake, the packets still need real time to arrive
+var Wall clock.Clock = clock.Real
+
+// Eventually waits until cond returns true and fails the test after the timeout
+// The format and args describe what was awaited in the failure message
+//
+// Example:
+//
+//	testkit.Eventually(t, time.Second, func() bool {
+//		return len(h.Server.Stats()) == 2
+//	}, "reports of %d clients", 2)
+func Eventually(t testing.TB, timeout time.Duration, cond func() bool, format string, args ...any) {
+	t.Helper()
+	if !WaitFor(timeout, cond) {
+		t.Fatalf("testkit: timeout after %s waiting for %s", timeout, fmt.Sprintf(format, args...))
+	}
+}
+
+// WaitFor waits until cond returns true, it returns false after the timeout
+func WaitFor(timeout time.Duration, cond func() bool) bool {
+	deadline := Wall.Now().Add(timeout)
+	for {
+		if cond() {
+			return true
+		}
+		if Wall.Now().After(deadline) {
+			return false
+		}
+		<-Wall.After(pollInterval)
+	}
+}
@@ -0,0 +1,443 @@
+package transport
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/clock"
+	"github.com/pion/dtls/v3"
+	dtlsnet "github.com/pion/dtls/v3/pkg/net"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultHandshakeTimeout is the time a DTLS handshake may take
+const DefaultHandshakeTimeout = 10 * time.Second
+
+// Defaults of the limits for handshakes in progress
+const (
+	// DefaultMaxHandshakes is the number of handshakes that may be in progress at once
+	DefaultMaxHandshakes = 256
+	// DefaultMaxHandshakesPerIP is the number of handshakes one IP may have in progress at once
+	DefaultMaxHandshakesPerIP = 4
+	// DefaultCookieTimeout is the time a new remote has to return the cookie of the HelloVerifyRequest
+	DefaultCookieTimeout = 3 * time.Second
+)
+
+// DTLS record and handshake layout, only a ClientHello of epoch 0 opens a new connection
+const (
+	recordTypeHandshake    = 22
+	recordHeaderSize       = 13
+	handshakeHeaderSize    = 12
+	handshakeClientHello   = 1
+	clientHelloSessionIDAt = recordHeaderSize + handshakeHeaderSize + 2 + 32 // after version and random
+)
+
+// DTLS runs the Server and the Client on DTLS on top of another transport
+// The Server gets one packet connection for all clients, every client has its own DTLS connection below it
+// Datagrams are only exchanged after the handshake, a failed handshake never reaches the Server
+//
+// Example:
+//
+//	cfg := client.NewDTLSClientPSKConfig("bot-1", key)
+//	c.Transport = &transport.DTLS{Config: cfg}
+type DTLS struct {
+	Config *dtls.Config
+	// Inner is the transport the DTLS records are sent on, UDP if nil
+	Inner Transport
+	// HandshakeTimeout is the time a handshake may take, DefaultHandshakeTimeout if zero
+	HandshakeTimeout time.Duration
+	// OnHandshake is called on the Server when the handshake of a client completed
+	// An error closes the connection of the client
+	OnHandshake func(conn *dtls.Conn) error
+	// OnClose is called on the Server when the connection of a client was closed
+	OnClose func(remote net.Addr)
+	// Admit is called on the Server for the ClientHello of a new remote before any state is created for it
+	// The Server checks its ban list and the IP rate limit, false drops the datagram
+	Admit func(remote net.Addr, size int) bool
+	// MaxHandshakes and MaxHandshakesPerIP limit the handshakes in progress,
+	// DefaultMaxHandshakes and DefaultMaxHandshakesPerIP if zero
+	MaxHandshakes      int
+	MaxHandshakesPerIP int
+	// CookieTimeout is the time a new remote has to return the cookie of the HelloVerifyRequest,
+	// DefaultCookieTimeout if zero
+	// A remote that does not receive at its address never returns it, its connection is dropped then
+	CookieTimeout time.Duration
+	// Clock runs the CookieTimeout, clock.Real if nil
+	// The handshake timeout and the deadlines run on the real clock like the timers of pion
+	Clock clock.Clock
+}
+
+func (d *DTLS) inner() Transport {
+	if d.Inner == nil {
+		return UDP{}
+	}
+	return d.Inner
+}
+
+func (d *DTLS) handshakeTimeout() time.Duration {
+	if d.HandshakeTimeout <= 0 {
+		return DefaultHandshakeTimeout
+	}
+	return d.HandshakeTimeout
+}
+
+func (d *DTLS) clock() clock.Clock {
+	if d.Clock == nil {
+		return clock.Real
+	}
+	return d.Clock
+}
+
+func (d *DTLS) cookieTimeout() time.Duration {
+	if d.CookieTimeout <= 0 {
+		return DefaultCookieTimeout
+	}
+	return d.CookieTimeout
+}
+
+func (d *DTLS) maxHandshakes() (int, int) {
+	total, perIP := d.MaxHandshakes, d.MaxHandshakesPerIP
+	if total <= 0 {
+		total = DefaultMaxHandshakes
+	}
+	if perIP <= 0 {
+		perIP = DefaultMaxHandshakesPerIP
+	}
+	return total, perIP
+}
+
+// Listen opens the inner transport on addr and accepts DTLS connections on it
+func (d *DTLS) Listen(addr string) (net.PacketConn, error) {
+	if d.Config == nil {
+		return nil, errors.New("dtls: no config")
+	}
+	conn, err := d.inner().Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	l := &dtlsListener{
+		transport: d,
+		conn:      conn,
+		peers:     make(map[string]*dtlsPeer),
+		pending:   make(map[string]int),
+		inbox:     newInbox(clock.Real),
+	}
+	go l.demux()
+	return l, nil
+}
+
+// Dial connects the inner transport to addr and runs the client handshake
+func (d *DTLS) Dial(addr string) (net.Conn, error) {
+	if d.Config == nil {
+		return nil, errors.New("dtls: no config")
+	}
+	conn, err := d.inner().Dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	dc, err := dtls.Client(dtlsnet.PacketConnFromConn(conn), conn.RemoteAddr(), d.Config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d.handshakeTimeout())
+	defer cancel()
+	if err := dc.HandshakeContext(ctx); err != nil {
+		dc.Close()
+		return nil, fmt.Errorf("dtls handshake with %s: %w", addr, err)
+	}
+	return dc, nil
+}
+
+// dtlsListener is the packet connection of a Server on DTLS
+// Its deadlines run on the real clock like the timers of pion
+// It demultiplexes the records of the inner connection to one DTLS connection per remote
+// and merges the decrypted datagrams of all remotes into one queue
+type dtlsListener struct {
+	transport *DTLS
+	conn      net.PacketConn
+
+	mu           sync.Mutex
+	peers        map[string]*dtlsPeer // remote addr -> peer
+	pending      map[string]int       // IP -> handshakes in progress
+	pendingTotal int
+
+	inbox *inbox
+}
+
+// demux reads the records of the inner connection and hands them to the peers
+// A remote without a connection only gets one for a ClientHello that passes Admit and the handshake limits
+// The records of the other remotes are dropped without any state
+func (l *dtlsListener) demux() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) || l.inbox.isClosed() {
+				return
+			}
+			continue
+		}
+		if n == 0 {
+			continue
+		}
+		data := make([]byte, n)
+		copy(data, buf[:n])
+
+		l.mu.Lock()
+		peer, ok := l.peers[addr.String()]
+		l.mu.Unlock()
+		if !ok {
+			peer = l.open(addr, data)
+		} else if cookie, ok := clientHelloCookie(data); ok && len(cookie) > 0 {
+			// the remote received the HelloVerifyRequest at its address
+			peer.verified.Store(true)
+		}
+		if peer != nil {
+			peer.inbox.push(datagram{data: data, addr: addr})
+		}
+	}
+}
+
+// open creates the connection of a new remote for its first ClientHello
+// It returns nil if the datagram is no ClientHello, Admit refuses it or too many handshakes are in progress
+func (l *dtlsListener) open(addr net.Addr, data []byte) *dtlsPeer {
+	if _, ok := clientHelloCookie(data); !ok || l.inbox.isClosed() {
+		return nil
+	}
+	d := l.transport
+	if d.Admit != nil && !d.Admit(addr, len(data)) {
+		return nil
+	}
+	ip := hostOf(addr)
+	total, perIP := d.maxHandshakes()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.peers[addr.String()]; ok || l.pendingTotal >= total || l.pending[ip] >= perIP {
+		return nil
+	}
+	peer := &dtlsPeer{listener: l, remote: addr, ip: ip, inbox: newInbox(clock.Real)}
+	peer.pending.Store(true)
+	l.peers[addr.String()] = peer
+	l.pending[ip]++
+	l.pendingTotal++
+	go peer.serve()
+	return peer
+}
+
+// handshakeDone takes a peer out of the handshakes in progress
+func (l *dtlsListener) handshakeDone(p *dtlsPeer) {
+	if !p.pending.CompareAndSwap(true, false) {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pendingTotal--
+	if l.pending[p.ip]--; l.pending[p.ip] <= 0 {
+		delete(l.pending, p.ip)
+	}
+}
+
+// remove forgets a peer
+func (l *dtlsListener) remove(p *dtlsPeer) {
+	l.handshakeDone(p)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.peers[p.remote.String()] == p {
+		delete(l.peers, p.remote.String())
+	}
+}
+
+// clientHelloCookie returns the cookie of a datagram that starts with the first fragment of a ClientHello of epoch 0
+func clientHelloCookie(data []byte) ([]byte, bool) {
+	if len(data) < clientHelloSessionIDAt+2 || data[0] != recordTypeHandshake {
+		return nil, false
+	}
+	epoch := binary.BigEndian.Uint16(data[3:5])
+	handshake := data[recordHeaderSize:]
+	fragmentOffset := uint32(handshake[6])<<16 | uint32(handshake[7])<<8 | uint32(handshake[8])
+	if epoch != 0 || handshake[0] != handshakeClientHello || fragmentOffset != 0 {
+		return nil, false
+	}
+	at := clientHelloSessionIDAt + 1 + int(data[clientHelloSessionIDAt])
+	if at >= len(data) || at+1+int(data[at]) > len(data) {
+		return nil, true
+	}
+	return data[at+1 : at+1+int(data[at])], true
+}
+
+// hostOf returns the IP of an address, the whole address if it has no port
+func hostOf(addr net.Addr) string {
+	if udp, ok := addr.(*net.UDPAddr); ok {
+		return udp.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+func (l *dtlsListener) ReadFrom(b []byte) (int, net.Addr, error) {
+	return l.inbox.pop(b)
+}
+
+// WriteTo encrypts a datagram for a remote with a completed handshake
+func (l *dtlsListener) WriteTo(b []byte, addr net.Addr) (int, error) {
+	l.mu.Lock()
+	peer, ok := l.peers[addr.String()]
+	l.mu.Unlock()
+	if !ok || !peer.established.Load() {
+		return 0, fmt.Errorf("dtls: no connection to %s", addr)
+	}
+	return peer.conn.Write(b)
+}
+
+// Close closes the connections of all remotes and the inner connection
+func (l *dtlsListener) Close() error {
+	if !l.inbox.close() {
+		return net.ErrClosed
+	}
+	l.mu.Lock()
+	peers := make([]*dtlsPeer, 0, len(l.peers))
+	for _, p := range l.peers {
+		peers = append(peers, p)
+	}
+	l.mu.Unlock()
+	for _, p := range peers {
+		p.close()
+	}
+	return l.conn.Close()
+}
+
+func (l *dtlsListener) LocalAddr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+func (l *dtlsListener) SetDeadline(t time.Time) error {
+	return l.SetReadDeadline(t)
+}
+
+func (l *dtlsListener) SetReadDeadline(t time.Time) error {
+	l.inbox.readDeadline.set(t)
+	return nil
+}
+
+// SetWriteDeadline does nothing, writes go to the DTLS connection of the remote
+func (l *dtlsListener) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// dtlsPeer is the DTLS connection of one remote on the Server
+// It is also the packet connection below that DTLS connection
+type dtlsPeer struct {
+	listener    *dtlsListener
+	remote      net.Addr
+	ip          string
+	inbox       *inbox
+	conn        *dtls.Conn
+	pending     atomic.Bool // counted as handshake in progress
+	verified    atomic.Bool // returned the cookie of the HelloVerifyRequest
+	established atomic.Bool
+}
+
+// serve runs the handshake and forwards the decrypted datagrams to the listener until the connection fails
+func (p *dtlsPeer) serve() {
+	d := p.listener.transport
+	logger := log.WithField("caller", "transport").WithField("remote", p.remote.String())
+	defer p.listener.remove(p)
+
+	conn, err := dtls.Server(p, p.remote, d.Config)
+	if err != nil {
+		logger.WithError(err).Debug("Rejected dtls connection")
+		p.inbox.close()
+		return
+	}
+	p.conn = conn
+	defer conn.Close()
+
+	// a remote that does not receive at its address never returns the cookie, its state is dropped early
+	unverified := d.clock().AfterFunc(d.cookieTimeout(), func() {
+		if !p.verified.Load() {
+			p.inbox.close()
+		}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), d.handshakeTimeout())
+	err = conn.HandshakeContext(ctx)
+	cancel()
+	unverified.Stop()
+	p.listener.handshakeDone(p)
+	if err != nil {
+		logger.WithError(err).Debug("Dtls handshake failed")
+		return
+	}
+	if d.OnHandshake != nil {
+		if err := d.OnHandshake(conn); err != nil {
+			logger.WithError(err).Warn("Closing dtls connection")
+			return
+		}
+	}
+	p.established.Store(true)
+	if d.OnClose != nil {
+		defer d.OnClose(p.remote)
+	}
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			logger.WithError(err).Debug("Dtls connection closed")
+			return
+		}
+		data := make([]byte, n)
+		copy(data, buf[:n])
+		p.listener.inbox.push(datagram{data: data, addr: p.remote})
+	}
+}
+
+// close closes the DTLS connection, that ends serve
+func (p *dtlsPeer) close() {
+	if p.established.Load() {
+		p.conn.Close()
+		return
+	}
+	p.inbox.close()
+}
+
+func (p *dtlsPeer) ReadFrom(b []byte) (int, net.Addr, error) {
+	return p.inbox.pop(b)
+}
+
+func (p *dtlsPeer) WriteTo(b []byte, _ net.Addr) (int, error) {
+	return p.listener.conn.WriteTo(b, p.remote)
+}
+
+// Close only closes the queue of the remote, the inner connection is shared
+func (p *dtlsPeer) Close() error {
+	p.inbox.close()
+	return nil
+}
+
+func (p *dtlsPeer) LocalAddr() net.Addr {
+	return p.listener.conn.LocalAddr()
+}
+
+func (p *dtlsPeer) SetDeadline(t time.Time) error {
+	return p.SetReadDeadline(t)
+}
+
+func (p *dtlsPeer) SetReadDeadline(t time.Time) error {
+	p.inbox.readDeadline.set(t)
+	return nil
+}
+
+func (p *dtlsPeer) SetWriteDeadline(time.Time) error {
+	return nil
+}
@@ -0,0 +1,153 @@
+package transport_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/clock"
+	"github.com/aura-speak/networking/pkg/transport"
+	"github.com/pion/dtls/v3"
+	"github.com/pion/dtls/v3/pkg/protocol"
+	"github.com/pion/dtls/v3/pkg/protocol/handshake"
+	"github.com/pion/dtls/v3/pkg/protocol/recordlayer"
+)
+
+var testPSK = []byte("0123456789abcdef")
+
+func pskConfig() *dtls.Config {
+	return &dtls.Config{
+		PSK:             func([]byte) ([]byte, error) { return testPSK, nil },
+		PSKIdentityHint: []byte("test"),
+		CipherSuites:    []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_GCM_SHA256},
+	}
+}
+
+// clientHello is the first flight of a handshake, the server answers it with a HelloVerifyRequest
+func clientHello(t *testing.T) []byte {
+	t.Helper()
+	record := &recordlayer.RecordLayer{
+		Header: recordlayer.Header{Version: protocol.Version1_2},
+		Content: &handshake.Handshake{Message: &handshake.MessageClientHello{
+			Version:            protocol.Version1_2,
+			CipherSuiteIDs:     []uint16{uint16(dtls.TLS_PSK_WITH_AES_128_GCM_SHA256)},
+			CompressionMethods: []*protocol.CompressionMethod{{}},
+		}},
+	}
+	data, err := record.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// answered sends a ClientHello from a new port of ip and tells if the listener answered it
+func answered(t *testing.T, m *transport.Memory, server net.Addr, ip string) bool {
+	t.Helper()
+	conn, err := m.Listen(ip + ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if _, err := conn.WriteTo(clientHello(t), server); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	buf := make([]byte, 2048)
+	_, _, err = conn.ReadFrom(buf)
+	return err == nil
+}
+
+func TestDTLSLimitsHandshakes(t *testing.T) {
+	m := transport.NewMemory()
+	fake := clock.NewFake(time.Unix(1_700_000_000, 0))
+	d := &transport.DTLS{
+		Config:             pskConfig(),
+		Inner:              m,
+		MaxHandshakes:      3,
+		MaxHandshakesPerIP: 2,
+		CookieTimeout:      time.Minute,
+		Clock:              fake,
+		Admit: func(remote net.Addr, size int) bool {
+			return !strings.HasPrefix(remote.String(), "10.0.0.9:")
+		},
+	}
+	l, err := d.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	server := l.LocalAddr()
+
+	if answered(t, m, server, "10.0.0.9") {
+		t.Fatal("handshake refused by Admit answered")
+	}
+	for i := range 2 {
+		if !answered(t, m, server, "10.0.0.1") {
+			t.Fatalf("handshake %d of the IP not answered", i+1)
+		}
+	}
+	if answered(t, m, server, "10.0.0.1") {
+		t.Fatal("handshake over the limit per IP answered")
+	}
+	if !answered(t, m, server, "10.0.0.2") {
+		t.Fatal("handshake of another IP not answered")
+	}
+	if answered(t, m, server, "10.0.0.3") {
+		t.Fatal("handshake over the global limit answered")
+	}
+
+	// the remotes never return the cookie, their state is dropped after the CookieTimeout
+	fake.BlockUntil(3)
+	fake.Advance(time.Minute)
+	deadline := time.Now().Add(5 * time.Second)
+	for !answered(t, m, server, "10.0.0.3") {
+		if time.Now().After(deadline) {
+			t.Fatal("handshakes without cookie still counted after the CookieTimeout")
+		}
+	}
+}
+
+func TestDTLSHandshakeWithCookie(t *testing.T) {
+	m := transport.NewMemory()
+	d := &transport.DTLS{Config: pskConfig(), Inner: m, MaxHandshakesPerIP: 1, CookieTimeout: 100 * time.Millisecond}
+	l, err := d.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// records of unknown remotes that are no ClientHello get no state
+	conn, err := m.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.WriteTo([]byte{23, 0xfe, 0xfd, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1, 0xFF}, l.LocalAddr())
+
+	c, err := d.Dial(l.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	l.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 64)
+	n, _, err := l.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "hello" {
+		t.Fatalf("received %q", buf[:n])
+	}
+
+	// the established connection no longer counts as handshake in progress
+	c2, err := d.Dial(l.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("second handshake of the IP: %v", err)
+	}
+	c2.Close()
+}
@@ -0,0 +1,230 @@
+package transport
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/clock"
+)
+
+// firstEphemeralPort is the first port the in-memory network assigns to dialed connections
+const firstEphemeralPort = 49152
+
+// Memory is an in-memory network for tests
+// Datagrams are delivered between the connections of the same Memory without any socket
+// Addresses are IP addresses with ports, "localhost" is 127.0.0.1 and a connection on 0.0.0.0 receives for every IP of its port
+// Like UDP a datagram to an address nobody listens on or to a full queue is dropped
+// The read deadlines of the connections run on Clock, clock.Real if nil
+//
+// Example:
+//
+//	network := transport.NewMemory()
+//	srv.Transport = network
+//	c.Transport = network
+type Memory struct {
+	// Clock must be set before the first connection is opened
+	Clock clock.Clock
+
+	mu       sync.Mutex
+	conns    map[string]*memoryConn // local addr -> connection
+	nextPort int
+}
+
+// NewMemory creates a new empty in-memory network
+func NewMemory() *Memory {
+	return &Memory{
+		conns:    make(map[string]*memoryConn),
+		nextPort: firstEphemeralPort,
+	}
+}
+
+func (m *Memory) clock() clock.Clock {
+	if m.Clock == nil {
+		return clock.Real
+	}
+	return m.Clock
+}
+
+// Listen opens a connection on addr, port 0 picks a free port
+func (m *Memory) Listen(addr string) (net.PacketConn, error) {
+	laddr, err := parseMemoryAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	return m.open(laddr)
+}
+
+// Dial opens a connection on 127.0.0.1 with a free port that is connected to addr
+func (m *Memory) Dial(addr string) (net.Conn, error) {
+	raddr, err := parseMemoryAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := m.open(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return nil, err
+	}
+	return Connect(conn, raddr), nil
+}
+
+// open registers a connection on laddr
+func (m *Memory) open(laddr *net.UDPAddr) (*memoryConn, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if laddr.Port == 0 {
+		port, err := m.freePort()
+		if err != nil {
+			return nil, err
+		}
+		laddr.Port = port
+	}
+	for _, c := range m.conns {
+		if c.local.Port != laddr.Port {
+			continue
+		}
+		if c.local.IP.Equal(laddr.IP) || c.local.IP.IsUnspecified() || laddr.IP.IsUnspecified() {
+			return nil, fmt.Errorf("listen %s: address already in use", laddr)
+		}
+	}
+	conn := &memoryConn{
+		network: m,
+		local:   laddr,
+		inbox:   newInbox(m.clock()),
+	}
+	m.conns[laddr.String()] = conn
+	return conn, nil
+}
+
+// freePort returns the next ephemeral port nobody uses
+// The caller has to hold the lock
+func (m *Memory) freePort() (int, error) {
+	used := make(map[int]bool, len(m.conns))
+	for _, c := range m.conns {
+		used[c.local.Port] = true
+	}
+	for i := 0; i <= 65535-firstEphemeralPort; i++ {
+		port := m.nextPort
+		m.nextPort++
+		if m.nextPort > 65535 {
+			m.nextPort = firstEphemeralPort
+		}
+		if !used[port] {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("no free port")
+}
+
+// lookup returns the connection a datagram to addr is delivered to
+func (m *Memory) lookup(addr *net.UDPAddr) *memoryConn {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok := m.conns[addr.String()]; ok {
+		return c
+	}
+	for _, c := range m.conns {
+		if c.local.Port == addr.Port && c.local.IP.IsUnspecified() {
+			return c
+		}
+	}
+	return nil
+}
+
+func (m *Memory) remove(c *memoryConn) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.conns[c.local.String()] == c {
+		delete(m.conns, c.local.String())
+	}
+}
+
+// parseMemoryAddr parses "host:port" where host is an IP address, localhost or empty
+func parseMemoryAddr(addr string) (*net.UDPAddr, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid port in %q", addr)
+	}
+	var ip net.IP
+	switch host {
+	case "":
+		ip = net.IPv4zero
+	case "localhost":
+		ip = net.IPv4(127, 0, 0, 1)
+	default:
+		if ip = net.ParseIP(host); ip == nil {
+			return nil, fmt.Errorf("memory transport: %q is not an IP address", host)
+		}
+	}
+	return &net.UDPAddr{IP: ip, Port: port}, nil
+}
+
+// memoryConn is a connection of the in-memory network
+type memoryConn struct {
+	network *Memory
+	local   *net.UDPAddr
+	inbox   *inbox
+}
+
+func (c *memoryConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	return c.inbox.pop(b)
+}
+
+func (c *memoryConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if c.inbox.isClosed() {
+		return 0, net.ErrClosed
+	}
+	raddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		var err error
+		if raddr, err = parseMemoryAddr(addr.String()); err != nil {
+			return 0, err
+		}
+	}
+	dst := c.network.lookup(raddr)
+	if dst == nil {
+		return len(b), nil
+	}
+	// like the kernel a connection on 0.0.0.0 sends from the address it was reached on
+	src := c.local
+	if src.IP.IsUnspecified() {
+		src = &net.UDPAddr{IP: raddr.IP, Port: src.Port}
+	}
+	data := make([]byte, len(b))
+	copy(data, b)
+	dst.inbox.push(datagram{data: data, addr: src})
+	return len(b), nil
+}
+
+func (c *memoryConn) Close() error {
+	if !c.inbox.close() {
+		return net.ErrClosed
+	}
+	c.network.remove(c)
+	return nil
+}
+
+func (c *memoryConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *memoryConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *memoryConn) SetReadDeadline(t time.Time) error {
+	c.inbox.readDeadline.set(t)
+	return nil
+}
+
+// SetWriteDeadline does nothing, writes never block
+func (c *memoryConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
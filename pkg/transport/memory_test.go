@@ -0,0 +1,51 @@
+package transport_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/clock"
+	"github.com/aura-speak/networking/pkg/transport"
+)
+
+func TestMemoryDeadlineOnClock(t *testing.T) {
+	fake := clock.NewFake(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+	m := transport.NewMemory()
+	m.Clock = fake
+	conn, err := m.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(fake.Now().Add(time.Second))
+	read := make(chan error, 1)
+	go func() {
+		_, _, err := conn.ReadFrom(make([]byte, 16))
+		read <- err
+	}()
+	fake.BlockUntil(1)
+	fake.Advance(999 * time.Millisecond)
+	select {
+	case err := <-read:
+		t.Fatalf("read returned before the deadline: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	fake.Advance(time.Millisecond)
+	select {
+	case err := <-read:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("read after the deadline: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("read still waits after the deadline passed on the clock")
+	}
+
+	// a deadline in the past of the clock fails the read at once
+	conn.SetReadDeadline(fake.Now().Add(-time.Second))
+	if _, _, err := conn.ReadFrom(make([]byte, 16)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("read with a passed deadline: %v", err)
+	}
+}
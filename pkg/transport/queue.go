@@ -0,0 +1,143 @@
+package transport
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aura-speak/networking/pkg/clock"
+)
+
+// queueSize is the number of datagrams a connection buffers before it drops new ones like a full socket buffer
+const queueSize = 1024
+
+// datagram is a received packet and the address it came from
+type datagram struct {
+	data []byte
+	addr net.Addr
+}
+
+// deadline is a read deadline that can be changed while a read waits for it
+// The channel of wait is closed when the deadline passed on the Clock
+type deadline struct {
+	clock  clock.Clock
+	mu     sync.Mutex
+	timer  clock.Timer
+	cancel chan struct{}
+}
+
+func newDeadline(clk clock.Clock) *deadline {
+	return &deadline{clock: clk, cancel: make(chan struct{})}
+}
+
+// set moves the deadline, a zero time removes it
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		// the timer fired, wait until it closed the channel
+		<-d.cancel
+	}
+	d.timer = nil
+
+	closed := isClosed(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+	if dur := t.Sub(d.clock.Now()); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = d.clock.AfterFunc(dur, func() { close(cancel) })
+		return
+	}
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+// wait returns a channel that is closed when the deadline passed
+func (d *deadline) wait() chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// inbox is the receive queue of a connection
+type inbox struct {
+	ch           chan datagram
+	closed       chan struct{}
+	closeOnce    sync.Once
+	readDeadline *deadline
+}
+
+func newInbox(clk clock.Clock) *inbox {
+	return &inbox{
+		ch:           make(chan datagram, queueSize),
+		closed:       make(chan struct{}),
+		readDeadline: newDeadline(clk),
+	}
+}
+
+// push queues a datagram, it is dropped if the queue is full or closed
+func (q *inbox) push(d datagram) bool {
+	select {
+	case <-q.closed:
+		return false
+	default:
+	}
+	select {
+	case q.ch <- d:
+		return true
+	default:
+		return false
+	}
+}
+
+// pop waits for the next datagram and copies it into b
+func (q *inbox) pop(b []byte) (int, net.Addr, error) {
+	select {
+	case <-q.closed:
+		return 0, nil, net.ErrClosed
+	case <-q.readDeadline.wait():
+		return 0, nil, os.ErrDeadlineExceeded
+	default:
+	}
+	select {
+	case d := <-q.ch:
+		return copy(b, d.data), d.addr, nil
+	case <-q.closed:
+		return 0, nil, net.ErrClosed
+	case <-q.readDeadline.wait():
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+}
+
+// close wakes up all reads, it returns false if the inbox was already closed
+func (q *inbox) close() bool {
+	closed := false
+	q.closeOnce.Do(func() {
+		close(q.closed)
+		closed = true
+	})
+	return closed
+}
+
+func (q *inbox) isClosed() bool {
+	return isClosed(q.closed)
+}
@@ -0,0 +1,63 @@
+//go:build linux
+// +build linux
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// ListenShards opens n UDP sockets with SO_REUSEPORT on addr
+// Any process of the same user can join the port the same way, the sockets do not protect it
+//
+// Example:
+//
+//	conns, err := transport.UDP{}.ListenShards("0.0.0.0:8080", 4)
+func (UDP) ListenShards(addr string, n int) ([]net.PacketConn, error) {
+	if n < 1 {
+		return nil, errors.New("at least one shard is required")
+	}
+	laddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	lc := net.ListenConfig{Control: reusePort}
+	network := udpNetwork(laddr)
+	conns := make([]net.PacketConn, 0, n)
+	for range n {
+		conn, err := lc.ListenPacket(context.Background(), network, laddr.String())
+		if err != nil {
+			for _, c := range conns {
+				c.Close()
+			}
+			return nil, err
+		}
+		if len(conns) == 0 && laddr.Port == 0 {
+			// the other shards join the port the kernel picked
+			laddr.Port = conn.LocalAddr().(*net.UDPAddr).Port
+		}
+		conns = append(conns, conn)
+	}
+	return conns, nil
+}
+
+// reusePort sets SO_REUSEPORT on a socket before it is bound
+func reusePort(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if err != nil {
+		return err
+	}
+	if sockErr != nil {
+		return fmt.Errorf("SO_REUSEPORT on %s %s: %w", network, address, sockErr)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+// +build !linux
+
+package transport
+
+import (
+	"errors"
+	"net"
+)
+
+// ListenShards opens a single socket, SO_REUSEPORT sharding is only supported on Linux
+// Other systems either do not spread the datagrams over the sockets or deliver them to the last one
+func (u UDP) ListenShards(addr string, n int) ([]net.PacketConn, error) {
+	if n < 1 {
+		return nil, errors.New("at least one shard is required")
+	}
+	if n > 1 {
+		return nil, errors.New("udp shards are only supported on linux")
+	}
+	conn, err := u.Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	return []net.PacketConn{conn}, nil
+}
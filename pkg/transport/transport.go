@@ -0,0 +1,143 @@
+// Package Transport contains the packet connections the Server and the Client run on
+// It is responsible for opening the connection of the Server and the connection of a Client to the Server
+// The implementations are plain UDP, DTLS on top of another transport and an in-memory network for tests
+// Every transport carries whole datagrams, so the protocol does not know which one it runs on
+package transport
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// Transport opens the packet connections of the Server and the Client
+//
+// Example:
+//
+//	srv := server.NewServer(8080, ctx, cfg)
+//	srv.Transport = transport.NewMemory()
+type Transport interface {
+	// Listen opens the connection of a Server on a local address, e.g. "0.0.0.0:8080"
+	Listen(addr string) (net.PacketConn, error)
+	// Dial opens the connection of a Client to the Server at addr, e.g. "localhost:8080"
+	Dial(addr string) (net.Conn, error)
+}
+
+// Sharded is implemented by transports that can open several sockets on the same address
+// The Server reads every socket with its own goroutine
+// The kernel picks the socket by the addresses of a datagram, so the datagrams of one remote arrive on the same socket
+type Sharded interface {
+	// ListenShards opens n sockets on a local address, with port 0 they share the port of the first one
+	ListenShards(addr string, n int) ([]net.PacketConn, error)
+}
+
+// UDP is the plain UDP transport
+// It is Sharded with SO_REUSEPORT on Linux
+type UDP struct{}
+
+// Listen opens a UDP socket on addr
+// An IPv4 address like 0.0.0.0 opens an IPv4 socket instead of a dual stack one, the Server batches its syscalls on it
+func (UDP) Listen(addr string) (net.PacketConn, error) {
+	laddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP(udpNetwork(laddr), laddr)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// udpNetwork returns udp4 for IPv4 addresses and udp otherwise
+func udpNetwork(laddr *net.UDPAddr) string {
+	if laddr.IP.To4() != nil {
+		return "udp4"
+	}
+	return "udp"
+}
+
+// Dial opens a UDP socket that is connected to addr
+func (UDP) Dial(addr string) (net.Conn, error) {
+	raddr, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// packetConnTransport is the transport of FromPacketConn
+type packetConnTransport struct {
+	mu   sync.Mutex
+	conn net.PacketConn
+	used bool
+}
+
+// FromPacketConn returns a transport on an existing packet connection, e.g. a proxy or a simulated network
+// Listen returns the connection itself and can only be called once, the address is ignored
+// Dial connects the connection to the address, the address has to resolve like a UDP address
+func FromPacketConn(conn net.PacketConn) Transport {
+	return &packetConnTransport{conn: conn}
+}
+
+func (t *packetConnTransport) take() (net.PacketConn, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.used {
+		return nil, errors.New("packet connection is already in use")
+	}
+	t.used = true
+	return t.conn, nil
+}
+
+func (t *packetConnTransport) Listen(string) (net.PacketConn, error) {
+	return t.take()
+}
+
+func (t *packetConnTransport) Dial(addr string) (net.Conn, error) {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := t.take()
+	if err != nil {
+		return nil, err
+	}
+	return Connect(conn, raddr), nil
+}
+
+// Connect turns a packet connection into a connection to one remote
+// Read drops datagrams from other remotes, Close closes the packet connection
+func Connect(conn net.PacketConn, remote net.Addr) net.Conn {
+	return &connectedConn{PacketConn: conn, remote: remote}
+}
+
+// connectedConn is a packet connection that only talks to one remote
+type connectedConn struct {
+	net.PacketConn
+	remote net.Addr
+}
+
+func (c *connectedConn) Read(b []byte) (int, error) {
+	for {
+		n, addr, err := c.ReadFrom(b)
+		if err != nil {
+			return n, err
+		}
+		if addr.String() == c.remote.String() {
+			return n, nil
+		}
+	}
+}
+
+func (c *connectedConn) Write(b []byte) (int, error) {
+	return c.WriteTo(b, c.remote)
+}
+
+func (c *connectedConn) RemoteAddr() net.Addr {
+	return c.remote
+}
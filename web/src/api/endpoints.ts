@@ -1,10 +1,15 @@
 import type { ApiClient } from "./client";
-import type { ID, Paginated, ServerState, UDPClient, UDPClientState, SendDatagramRequest, MermaidTraces } from "./types";
+import type { BanEntry, BanRequest, CertStatus, ID, Paginated, ServerState, ServerStats, UDPClient, UDPClientState, UDPClientStats, SendDatagramRequest, MermaidTraces, NetemProfile, NetemProfileRequest, NetemStartRequest, NetemStatus } from "./types";
 
 export interface ServerApi {
     start: () => Promise<void>;
     stop: () => Promise<void>;
     getState: () => Promise<ServerState>;
+    getStats: () => Promise<ServerStats>;
+    getBans: () => Promise<{ bans: BanEntry[] }>;
+    ban: (request: BanRequest) => Promise<void>;
+    unban: (target: string) => Promise<void>;
+    getCerts: () => Promise<CertStatus>;
 }
 
 export interface UDPClientApi {
@@ -15,6 +20,15 @@ export interface UDPClientApi {
     getAll: () => Promise<{ udpClients: UDPClient[] }>;
     list: (params: { page?: number, pageSize?: number, q?: string }) => Promise<Paginated<UDPClient>>;
     sendDatagram: (request: SendDatagramRequest) => Promise<void>;
+    getStats: (name: string) => Promise<UDPClientStats>;
+}
+
+export interface NetemApi {
+    start: (request?: NetemStartRequest) => Promise<NetemStatus>;
+    stop: () => Promise<void>;
+    getStatus: () => Promise<NetemStatus>;
+    setProfile: (request: NetemProfileRequest) => Promise<NetemStatus>;
+    getPresets: () => Promise<{ presets: Record<string, NetemProfile> }>;
 }
 
 export interface TraceApi {
@@ -26,6 +40,11 @@ export function createServerApi(client: ApiClient): ServerApi {
         start: () => client.post("/api/server/start"),
         stop: () => client.post("/api/server/stop"),
         getState: () => client.get("/api/server/get"),
+        getStats: () => client.get("/api/server/stats"),
+        getBans: () => client.get("/api/server/bans"),
+        ban: (request: BanRequest) => client.post("/api/server/bans", { body: request }),
+        unban: (target: string) => client.del("/api/server/bans", { query: { target } }),
+        getCerts: () => client.get("/api/server/certs"),
     }
 }
 
@@ -38,6 +57,17 @@ export function createUDPClientApi(client: ApiClient): UDPClientApi {
         getAll: () => client.get("/api/client/get/all"),
         list: (params: { page?: number, pageSize?: number, q?: string }) => client.get("/api/client/get/all/paginated", { query: params }),
         sendDatagram: (request: SendDatagramRequest) => client.post("/api/client/send", { body: request }),
+        getStats: (name: string) => client.get("/api/client/stats", { query: { name } }),
+    };
+}
+
+export function createNetemApi(client: ApiClient): NetemApi {
+    return {
+        start: (request?: NetemStartRequest) => client.post("/api/netem/start", { body: request ?? {} }),
+        stop: () => client.post("/api/netem/stop"),
+        getStatus: () => client.get("/api/netem/get"),
+        setProfile: (request: NetemProfileRequest) => client.put("/api/netem/profile", { body: request }),
+        getPresets: () => client.get("/api/netem/presets"),
     };
 }
 
@@ -29,6 +29,71 @@ export interface ServerState {
     isAlive: boolean;
 }
 
+export interface ReportStats {
+    packetsSent: number;
+    octetsSent: number;
+    packetsReceived: number;
+    octetsReceived: number;
+    inboundExpected: number;
+    inboundLost: number;
+    inboundFractionLost: number;
+    inboundJitterMs: number;
+    outboundLost: number;
+    outboundFractionLost: number;
+    outboundJitterMs: number;
+    roundTripMs: number;
+    lastSenderReport: string;
+    lastReceiverReport: string;
+}
+
+export interface ServerStats {
+    remotes: Record<string, ReportStats>;
+}
+
+export interface CertInfo {
+    file: string;
+    subject: string;
+    serial: string;
+    notBefore: string;
+    notAfter: string;
+}
+
+export interface CertWarning {
+    file: string;
+    subject: string;
+    notAfter: string;
+    daysLeft: number;
+    expired: boolean;
+}
+
+export interface CertStatus {
+    certificates: CertInfo[];
+    warnings: CertWarning[] | null;
+    revoked: number;
+    loadedAt: string;
+    lastError?: string;
+}
+
+export interface UDPClientStats {
+    id: ID;
+    stats: ReportStats;
+}
+
+export interface BanEntry {
+    ip?: string;
+    userId?: string;
+    reason?: string;
+    created: string;
+    expires?: string;
+}
+
+export interface BanRequest {
+    ip?: string;
+    userId?: string;
+    reason?: string;
+    duration?: string;
+}
+
 export const DatagramDirection = {
     ClientToServer: 1,
     ServerToClient: 2,
@@ -68,4 +133,55 @@ export interface LogEntry {
     msg: string;
     time: string;
     [key: string]: any; // Für zukünftige dynamische Felder
-}
\ No newline at end of file
+}
+
+export interface GilbertElliott {
+    goodToBad: number;
+    badToGood: number;
+    lossGood: number;
+    lossBad: number;
+}
+
+// Durations are strings like "40ms"
+export interface NetemProfile {
+    loss?: number;
+    burst?: GilbertElliott;
+    delay?: string;
+    jitter?: string;
+    duplicate?: number;
+    reorder?: number;
+    rate?: number;
+    maxQueue?: string;
+}
+
+export interface LinkStats {
+    sent: number;
+    delivered: number;
+    lost: number;
+    duplicated: number;
+    reordered: number;
+    overflow: number;
+    partition: number;
+}
+
+export interface NetemStatus {
+    listen: string;
+    upstream: string;
+    up: NetemProfile;
+    down: NetemProfile;
+    upStats: LinkStats;
+    downStats: LinkStats;
+    sessions: number;
+}
+
+export interface NetemStartRequest {
+    listen?: string;
+    preset?: string;
+}
+
+export interface NetemProfileRequest {
+    preset?: string;
+    both?: NetemProfile;
+    up?: NetemProfile;
+    down?: NetemProfile;
+}